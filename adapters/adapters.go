@@ -0,0 +1,121 @@
+// Package adapters plugs the logger into libraries that expect their own logging interfaces, like the
+// standard library logger or gRPC, without adding their dependencies to the core package.
+package adapters
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/mxmauro/logger"
+)
+
+//------------------------------------------------------------------------------
+
+// GRPCLogger sends the messages of libraries expecting a gRPC grpclog.LoggerV2 to the logger. It matches
+// the interface by its methods so the gRPC module is not required.
+type GRPCLogger struct {
+	lg *logger.Logger
+}
+
+type levelWriter struct {
+	lg    *logger.Logger
+	level logger.LogLevel
+}
+
+//------------------------------------------------------------------------------
+
+// NewWriter returns an io.Writer that logs each write, without the trailing line break, as a text message of
+// the given level. Debug messages are sent with debug level zero.
+func NewWriter(lg *logger.Logger, level logger.LogLevel) io.Writer {
+	return &levelWriter{
+		lg:    lg,
+		level: level,
+	}
+}
+
+// NewStdLogger returns a standard library logger that sends its messages, at info level, to the logger. It
+// is useful for libraries that accept a *log.Logger or a Printf-like function.
+func NewStdLogger(lg *logger.Logger) *log.Logger {
+	return log.New(NewWriter(lg, logger.LogLevelInfo), "", 0)
+}
+
+// NewGRPCLogger returns an adapter implementing grpclog.LoggerV2, to use with grpclog.SetLoggerV2. gRPC
+// verbosity levels are mapped to debug levels.
+func NewGRPCLogger(lg *logger.Logger) *GRPCLogger {
+	return &GRPCLogger{
+		lg: lg,
+	}
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\r\n")
+	if len(msg) > 0 {
+		w.lg.Log(w.level, msg)
+	}
+	return len(p), nil
+}
+
+func (a *GRPCLogger) Info(args ...interface{}) {
+	a.lg.Info(fmt.Sprint(args...))
+}
+
+func (a *GRPCLogger) Infoln(args ...interface{}) {
+	a.lg.Info(sprintln(args...))
+}
+
+func (a *GRPCLogger) Infof(format string, args ...interface{}) {
+	a.lg.Infof(format, args...)
+}
+
+func (a *GRPCLogger) Warning(args ...interface{}) {
+	a.lg.Warning(fmt.Sprint(args...))
+}
+
+func (a *GRPCLogger) Warningln(args ...interface{}) {
+	a.lg.Warning(sprintln(args...))
+}
+
+func (a *GRPCLogger) Warningf(format string, args ...interface{}) {
+	a.lg.Warningf(format, args...)
+}
+
+func (a *GRPCLogger) Error(args ...interface{}) {
+	a.lg.Error(fmt.Sprint(args...))
+}
+
+func (a *GRPCLogger) Errorln(args ...interface{}) {
+	a.lg.Error(sprintln(args...))
+}
+
+func (a *GRPCLogger) Errorf(format string, args ...interface{}) {
+	a.lg.Errorf(format, args...)
+}
+
+func (a *GRPCLogger) Fatal(args ...interface{}) {
+	a.lg.Fatal(fmt.Sprint(args...))
+}
+
+func (a *GRPCLogger) Fatalln(args ...interface{}) {
+	a.lg.Fatal(sprintln(args...))
+}
+
+func (a *GRPCLogger) Fatalf(format string, args ...interface{}) {
+	a.lg.Fatal(fmt.Sprintf(format, args...))
+}
+
+// V reports whether messages of the given verbosity are logged. Verbosity zero requires the info level and
+// higher ones require the debug level with, at least, the same debug level.
+func (a *GRPCLogger) V(l int) bool {
+	level, debugLevel := a.lg.Level()
+	if l <= 0 {
+		return level >= logger.LogLevelInfo
+	}
+	return level >= logger.LogLevelDebug && debugLevel >= uint(l)
+}
+
+// sprintln formats the arguments like fmt.Sprintln but without the trailing line break.
+func sprintln(args ...interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+}
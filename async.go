@@ -0,0 +1,203 @@
+package logger
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	defaultAsyncBufferSize = 1024
+)
+
+const (
+	// OverflowDropNewest drops the message being logged if the buffer is full.
+	OverflowDropNewest OverflowPolicy = 0
+
+	// OverflowDropOldest drops the oldest queued message to make room for the one being logged.
+	OverflowDropOldest OverflowPolicy = 1
+
+	// OverflowBlock waits until there is room in the buffer, so no message is lost.
+	OverflowBlock OverflowPolicy = 2
+)
+
+//------------------------------------------------------------------------------
+
+// OverflowPolicy defines what to do when the asynchronous mode buffer is full.
+type OverflowPolicy uint
+
+// asyncQueue delivers messages to the engines from a background goroutine.
+type asyncQueue struct {
+	lg              *Logger
+	ch              chan *logRecord
+	overflowPolicy  OverflowPolicy
+	maxRecordAge    time.Duration
+	mtx             sync.Mutex
+	dropped         atomic.Uint64
+	droppedStale    atomic.Uint64
+	highWaterMark   atomic.Int64
+	wg              sync.WaitGroup
+	workerCtx       context.Context
+	workerCancelCtx context.CancelFunc
+}
+
+//------------------------------------------------------------------------------
+
+func newAsyncQueue(lg *Logger, bufferSize uint, overflowPolicy OverflowPolicy, maxRecordAge time.Duration) *asyncQueue {
+	if bufferSize == 0 {
+		bufferSize = defaultAsyncBufferSize
+	}
+
+	q := &asyncQueue{
+		lg:             lg,
+		ch:             make(chan *logRecord, bufferSize),
+		overflowPolicy: overflowPolicy,
+		maxRecordAge:   maxRecordAge,
+		mtx:            sync.Mutex{},
+		wg:             sync.WaitGroup{},
+	}
+	q.workerCtx, q.workerCancelCtx = context.WithCancel(context.Background())
+
+	// Create the background worker
+	q.wg.Add(1)
+	go q.worker()
+
+	// Done
+	return q
+}
+
+// destroy stops the worker after delivering the queued messages.
+func (q *asyncQueue) destroy() {
+	q.workerCancelCtx()
+	q.wg.Wait()
+}
+
+// enqueue queues the message. If the buffer is full, the overflow policy is applied.
+func (q *asyncQueue) enqueue(rec *logRecord) {
+	if q.maxRecordAge > 0 {
+		rec.enqueuedAt = time.Now()
+	}
+
+	for {
+		select {
+		case q.ch <- rec:
+			q.updateHighWaterMark()
+			return
+		default:
+		}
+
+		switch q.overflowPolicy {
+		case OverflowDropOldest:
+			select {
+			case oldest := <-q.ch:
+				if oldest.flushedCh != nil {
+					// A flush marker at the head means the messages queued before it were already delivered
+					close(oldest.flushedCh)
+				} else {
+					q.dropped.Add(1)
+				}
+			default:
+			}
+
+		case OverflowBlock:
+			select {
+			case q.ch <- rec:
+				q.updateHighWaterMark()
+			case <-q.workerCtx.Done():
+				q.dropped.Add(1)
+			}
+			return
+
+		default:
+			q.dropped.Add(1)
+			return
+		}
+	}
+}
+
+// lock prevents the worker from delivering messages while the engines are modified. The caller must hold
+// the logger write lock.
+func (q *asyncQueue) lock() {
+	q.mtx.Lock()
+}
+
+func (q *asyncQueue) unlock() {
+	q.mtx.Unlock()
+}
+
+// flush waits until the messages queued before the call are delivered.
+func (q *asyncQueue) flush() {
+	rec := &logRecord{
+		flushedCh: make(chan struct{}),
+	}
+
+	select {
+	case q.ch <- rec:
+	case <-q.workerCtx.Done():
+		return
+	}
+
+	select {
+	case <-rec.flushedCh:
+	case <-q.workerCtx.Done():
+	}
+}
+
+func (q *asyncQueue) updateHighWaterMark() {
+	n := int64(len(q.ch))
+	for {
+		hwm := q.highWaterMark.Load()
+		if n <= hwm || q.highWaterMark.CompareAndSwap(hwm, n) {
+			return
+		}
+	}
+}
+
+func (q *asyncQueue) worker() {
+	defer q.wg.Done()
+
+	// Mark this goroutine as processing messages so engines logging from here are not queued again
+	gid, _ := q.lg.enterLog()
+	defer q.lg.leaveLog(gid)
+
+	for {
+		select {
+		case <-q.workerCtx.Done():
+			// Deliver the remaining messages
+			for {
+				select {
+				case rec := <-q.ch:
+					q.process(rec)
+				default:
+					return
+				}
+			}
+
+		case rec := <-q.ch:
+			q.process(rec)
+		}
+	}
+}
+
+func (q *asyncQueue) process(rec *logRecord) {
+	if rec.flushedCh != nil {
+		close(rec.flushedCh)
+		return
+	}
+
+	// Discard the message if it waited too long
+	if q.maxRecordAge > 0 && time.Since(rec.enqueuedAt) > q.maxRecordAge {
+		q.droppedStale.Add(1)
+		return
+	}
+
+	// Lock access
+	// NOTE: The logger lock is not used because callers hold it while waiting for room in the buffer.
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.lg.dispatch(rec)
+}
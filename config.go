@@ -0,0 +1,166 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mxmauro/logger/engines/cloudwatch"
+	"github.com/mxmauro/logger/engines/console"
+	"github.com/mxmauro/logger/engines/file"
+	"github.com/mxmauro/logger/engines/http"
+	"github.com/mxmauro/logger/engines/journald"
+	"github.com/mxmauro/logger/engines/kafka"
+	"github.com/mxmauro/logger/engines/otlp"
+	"github.com/mxmauro/logger/engines/prometheus"
+	"github.com/mxmauro/logger/engines/seq"
+	"github.com/mxmauro/logger/engines/syslog"
+)
+
+//------------------------------------------------------------------------------
+
+// Config specifies the logger settings and the engines to attach when it is created with FromConfig.
+type Config struct {
+	Options
+
+	// Engines to attach, in order.
+	Engines []EngineConfig `json:"engines,omitempty"`
+}
+
+// EngineConfig specifies an engine to attach. Type is the engine type, like "console", "file" or "syslog",
+// and Options the engine settings, like a file.Options value or a pointer to it. When decoded from JSON, the
+// options are decoded into the settings of the engine type and unknown fields are rejected.
+type EngineConfig struct {
+	Type    string      `json:"type"`
+	Options interface{} `json:"options,omitempty"`
+}
+
+type engineType struct {
+	newOptions func() interface{}
+	add        func(lg *Logger, opts interface{}) error
+}
+
+//------------------------------------------------------------------------------
+
+var engineTypes = map[string]engineType{
+	"console": {
+		newOptions: func() interface{} { return &console.Options{} },
+		add:        func(lg *Logger, opts interface{}) error { return lg.AddConsoleEngine(*opts.(*console.Options)) },
+	},
+	"file": {
+		newOptions: func() interface{} { return &file.Options{} },
+		add:        func(lg *Logger, opts interface{}) error { return lg.AddFileEngine(*opts.(*file.Options)) },
+	},
+	"syslog": {
+		newOptions: func() interface{} { return &syslog.Options{} },
+		add:        func(lg *Logger, opts interface{}) error { return lg.AddSysLogEngine(*opts.(*syslog.Options)) },
+	},
+	"http": {
+		newOptions: func() interface{} { return &http.Options{} },
+		add:        func(lg *Logger, opts interface{}) error { return lg.AddHTTPEngine(*opts.(*http.Options)) },
+	},
+	"seq": {
+		newOptions: func() interface{} { return &seq.Options{} },
+		add:        func(lg *Logger, opts interface{}) error { return lg.AddSeqEngine(*opts.(*seq.Options)) },
+	},
+	"cloudwatch": {
+		newOptions: func() interface{} { return &cloudwatch.Options{} },
+		add:        func(lg *Logger, opts interface{}) error { return lg.AddCloudWatchEngine(*opts.(*cloudwatch.Options)) },
+	},
+	"kafka": {
+		newOptions: func() interface{} { return &kafka.Options{} },
+		add:        func(lg *Logger, opts interface{}) error { return lg.AddKafkaEngine(*opts.(*kafka.Options)) },
+	},
+	"otlp": {
+		newOptions: func() interface{} { return &otlp.Options{} },
+		add:        func(lg *Logger, opts interface{}) error { return lg.AddOTLPEngine(*opts.(*otlp.Options)) },
+	},
+	"journald": {
+		newOptions: func() interface{} { return &journald.Options{} },
+		add:        func(lg *Logger, opts interface{}) error { return lg.AddJournaldEngine(*opts.(*journald.Options)) },
+	},
+	"prometheus": {
+		newOptions: func() interface{} { return &prometheus.Options{} },
+		add:        func(lg *Logger, opts interface{}) error { return lg.AddPrometheusEngine(*opts.(*prometheus.Options)) },
+	},
+}
+
+//------------------------------------------------------------------------------
+
+// FromConfig creates a new logger and attaches the engines of the configuration. If an engine cannot be
+// created, the logger is destroyed and an error is returned. YAML documents can be used by converting them
+// to JSON first, for example, with sigs.k8s.io/yaml.
+func FromConfig(cfg Config) (*Logger, error) {
+	lg := Create(cfg.Options)
+
+	for idx, ec := range cfg.Engines {
+		// Duplicated streams are skipped as requested by the DeduplicateStreams option
+		err := lg.addConfiguredEngine(ec)
+		if err != nil && !errors.Is(err, ErrDuplicateStream) {
+			lg.Destroy()
+			return nil, fmt.Errorf("engine #%d (%v): %w", idx+1, ec.Type, err)
+		}
+	}
+
+	// Done
+	return lg, nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (ec *EngineConfig) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type    string          `json:"type"`
+		Options json.RawMessage `json:"options"`
+	}
+
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	et, ok := engineTypes[strings.ToLower(raw.Type)]
+	if !ok {
+		return errors.New("unknown engine type \"" + raw.Type + "\"")
+	}
+
+	opts := et.newOptions()
+	if len(raw.Options) > 0 && !bytes.Equal(raw.Options, []byte("null")) {
+		decoder := json.NewDecoder(bytes.NewReader(raw.Options))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(opts)
+		if err != nil {
+			return fmt.Errorf("invalid options for engine type \"%v\": %w", raw.Type, err)
+		}
+	}
+
+	ec.Type = raw.Type
+	ec.Options = opts
+
+	// Done
+	return nil
+}
+
+func (lg *Logger) addConfiguredEngine(ec EngineConfig) error {
+	et, ok := engineTypes[strings.ToLower(ec.Type)]
+	if !ok {
+		return errors.New("unknown engine type")
+	}
+
+	// Accept the options either by value or by pointer
+	opts := ec.Options
+	if opts == nil {
+		opts = et.newOptions()
+	} else if refObj := reflect.ValueOf(opts); refObj.Kind() != reflect.Ptr {
+		ptr := reflect.New(refObj.Type())
+		ptr.Elem().Set(refObj)
+		opts = ptr.Interface()
+	}
+	if reflect.TypeOf(opts) != reflect.TypeOf(et.newOptions()) || reflect.ValueOf(opts).IsNil() {
+		return fmt.Errorf("unexpected options type %T", ec.Options)
+	}
+
+	// Done
+	return et.add(lg, opts)
+}
@@ -0,0 +1,169 @@
+package logger
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+// Deduplication specifies how to collapse repeated messages. Within the window, consecutive identical messages
+// of the same level are suppressed and, when the window closes or a different message arrives, a single
+// summary with the amount of repetitions is emitted.
+type Deduplication struct {
+	// Duration of the deduplication window. Zero disables deduplication.
+	Window time.Duration `json:"window,omitempty"`
+
+	// Levels to deduplicate. Success messages use the level they are sent at. Defaults to all levels.
+	Levels []LogLevel `json:"levels,omitempty"`
+}
+
+type deduplicator struct {
+	mtx     sync.Mutex
+	window  time.Duration
+	enabled [5]bool
+	entries [5]dedupEntry
+}
+
+type dedupEntry struct {
+	msg       string
+	isJSON    bool
+	jsonLevel string
+	firstAt   time.Time
+	lastAt    time.Time
+	repeated  uint64
+	timer     *time.Timer
+}
+
+type dedupSummary struct {
+	msg       string
+	isJSON    bool
+	jsonLevel string
+	_type     logType
+}
+
+//------------------------------------------------------------------------------
+
+func newDeduplicator(opts *Deduplication, successLevel LogLevel) *deduplicator {
+	if opts == nil || opts.Window <= 0 {
+		return nil
+	}
+
+	d := &deduplicator{
+		window: opts.Window,
+	}
+	for _type := logTypeSuccess; _type <= logTypeDebug; _type++ {
+		if len(opts.Levels) == 0 {
+			d.enabled[_type] = true
+			continue
+		}
+		level := logTypeLevel(_type, successLevel)
+		for _, l := range opts.Levels {
+			if l == level {
+				d.enabled[_type] = true
+				break
+			}
+		}
+	}
+	return d
+}
+
+// check returns true if the message must be emitted. It also returns the summary of the previous message
+// repetitions, if any, that must be emitted before it. If the message is suppressed, onWindowClosed is
+// called when its window closes.
+func (d *deduplicator) check(
+	_type logType, msg string, isJSON bool, jsonLevel string, onWindowClosed func(_type logType),
+) (bool, *dedupSummary) {
+	if !d.enabled[_type] {
+		return true, nil
+	}
+
+	now := time.Now()
+
+	// Lock access
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	entry := &d.entries[_type]
+	if entry.msg == msg && entry.isJSON == isJSON && now.Sub(entry.firstAt) < d.window {
+		// Suppress the repetition and emit the summary when the window closes
+		entry.repeated += 1
+		entry.lastAt = now
+		if entry.timer == nil {
+			entry.timer = time.AfterFunc(d.window-now.Sub(entry.firstAt), func() {
+				onWindowClosed(_type)
+			})
+		}
+		return false, nil
+	}
+
+	// The message changed or the window closed
+	summary := entry.takeSummary(_type)
+	*entry = dedupEntry{
+		msg:       msg,
+		isJSON:    isJSON,
+		jsonLevel: jsonLevel,
+		firstAt:   now,
+	}
+	return true, summary
+}
+
+// closeWindow returns the summary of the message repetitions of the given type, if any, and starts a new
+// window.
+func (d *deduplicator) closeWindow(_type logType) *dedupSummary {
+	// Lock access
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	entry := &d.entries[_type]
+	summary := entry.takeSummary(_type)
+	entry.msg = ""
+	return summary
+}
+
+// closeAll returns the pending summaries and stops the timers.
+func (d *deduplicator) closeAll() []*dedupSummary {
+	summaries := make([]*dedupSummary, 0)
+
+	// Lock access
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	for _type := range d.entries {
+		summary := d.entries[_type].takeSummary(logType(_type))
+		if summary != nil {
+			summaries = append(summaries, summary)
+		}
+	}
+	return summaries
+}
+
+func (e *dedupEntry) takeSummary(_type logType) *dedupSummary {
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	if e.repeated == 0 {
+		return nil
+	}
+
+	summary := &dedupSummary{
+		isJSON:    e.isJSON,
+		jsonLevel: e.jsonLevel,
+		_type:     _type,
+	}
+	elapsed := e.lastAt.Sub(e.firstAt).Round(time.Millisecond)
+	if !e.isJSON {
+		summary.msg = fmt.Sprintf("%v (repeated %d times in %v)", e.msg, e.repeated, elapsed)
+	} else if len(e.msg) > 2 && e.msg[0] == '{' {
+		summary.msg = `{"repeated":` + strconv.FormatUint(e.repeated, 10) + `,"repeated_in":"` + elapsed.String() +
+			`",` + e.msg[1:]
+	} else {
+		summary.msg = `{"repeated":` + strconv.FormatUint(e.repeated, 10) + `,"repeated_in":"` + elapsed.String() +
+			`"}`
+	}
+	e.repeated = 0
+	return summary
+}
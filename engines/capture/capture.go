@@ -0,0 +1,125 @@
+package capture
+
+import (
+	"sync"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+// Entry is a message recorded by the capture engine.
+type Entry struct {
+	Level string
+	Msg   string
+	Time  time.Time
+
+	// Raw indicates the message is a JSON object that already contains the level and timestamp.
+	Raw bool
+}
+
+// Engine records every message it receives so tests can check what was logged. Attach it to a logger
+// with AddEngine.
+type Engine struct {
+	mtx     sync.Mutex
+	entries []Entry
+}
+
+//------------------------------------------------------------------------------
+
+// NewEngine creates a new capture engine.
+func NewEngine() *Engine {
+	return &Engine{
+		mtx:     sync.Mutex{},
+		entries: make([]Entry, 0),
+	}
+}
+
+func (lg *Engine) Class() string {
+	return "capture"
+}
+
+func (lg *Engine) Destroy() {
+	// Do nothing
+}
+
+func (lg *Engine) Success(now time.Time, msg string, raw bool, sendSuccessAtErrorLogLevel bool) {
+	if sendSuccessAtErrorLogLevel {
+		lg.add(now, "error", msg, raw)
+	} else {
+		lg.add(now, "success", msg, raw)
+	}
+}
+
+func (lg *Engine) Error(now time.Time, msg string, raw bool) {
+	lg.add(now, "error", msg, raw)
+}
+
+func (lg *Engine) Warning(now time.Time, msg string, raw bool) {
+	lg.add(now, "warning", msg, raw)
+}
+
+func (lg *Engine) Info(now time.Time, msg string, raw bool) {
+	lg.add(now, "info", msg, raw)
+}
+
+func (lg *Engine) Debug(now time.Time, msg string, raw bool) {
+	lg.add(now, "debug", msg, raw)
+}
+
+// Entries returns a copy of the recorded messages, from the oldest to the newest.
+func (lg *Engine) Entries() []Entry {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	return append([]Entry{}, lg.entries...)
+}
+
+// Reset deletes the recorded messages.
+func (lg *Engine) Reset() {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	lg.entries = lg.entries[:0]
+}
+
+// LastMessage returns the text of the most recent message or an empty string if none was recorded.
+func (lg *Engine) LastMessage() string {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	if len(lg.entries) == 0 {
+		return ""
+	}
+	return lg.entries[len(lg.entries)-1].Msg
+}
+
+// ContainsLevel returns true if a message of the given level, "success", "error", "warning", "info" or "debug",
+// was recorded.
+func (lg *Engine) ContainsLevel(level string) bool {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	for _, entry := range lg.entries {
+		if entry.Level == level {
+			return true
+		}
+	}
+	return false
+}
+
+func (lg *Engine) add(now time.Time, level string, msg string, raw bool) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	lg.entries = append(lg.entries, Entry{
+		Level: level,
+		Msg:   msg,
+		Time:  now,
+		Raw:   raw,
+	})
+}
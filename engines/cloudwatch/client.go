@@ -0,0 +1,255 @@
+package cloudwatch
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	serviceName     = "logs"
+	targetPrefix    = "Logs_20140328."
+	apiContentType  = "application/x-amz-json-1.1"
+	signAlgorithm   = "AWS4-HMAC-SHA256"
+	amzDateLayout   = "20060102T150405Z"
+	shortDateLayout = "20060102"
+)
+
+//------------------------------------------------------------------------------
+
+// APIError is returned when the service rejects a request.
+type APIError struct {
+	StatusCode            int
+	Type                  string
+	Message               string
+	ExpectedSequenceToken string
+}
+
+type client struct {
+	endpoint    string
+	region      string
+	credentials *credentialsCache
+	httpClient  *http.Client
+}
+
+//------------------------------------------------------------------------------
+
+func newClient(
+	endpoint string, region string, provider func(ctx context.Context) (Credentials, error), httpClient *http.Client,
+) *client {
+	return &client{
+		endpoint:    strings.TrimSuffix(endpoint, "/") + "/",
+		region:      region,
+		credentials: newCredentialsCache(provider, httpClient),
+		httpClient:  httpClient,
+	}
+}
+
+func (e *APIError) Error() string {
+	if len(e.Message) > 0 {
+		return e.Type + ": " + e.Message
+	}
+	return e.Type
+}
+
+func (c *client) createLogGroup(ctx context.Context, logGroup string) error {
+	return c.call(ctx, "CreateLogGroup", map[string]interface{}{
+		"logGroupName": logGroup,
+	}, nil)
+}
+
+func (c *client) createLogStream(ctx context.Context, logGroup string, logStream string) error {
+	return c.call(ctx, "CreateLogStream", map[string]interface{}{
+		"logGroupName":  logGroup,
+		"logStreamName": logStream,
+	}, nil)
+}
+
+func (c *client) putLogEvents(
+	ctx context.Context, logGroup string, logStream string, events []inputLogEvent, sequenceToken string,
+) (string, error) {
+	resp := struct {
+		NextSequenceToken string `json:"nextSequenceToken"`
+	}{}
+
+	req := map[string]interface{}{
+		"logGroupName":  logGroup,
+		"logStreamName": logStream,
+		"logEvents":     events,
+	}
+	if len(sequenceToken) > 0 {
+		req["sequenceToken"] = sequenceToken
+	}
+	err := c.call(ctx, "PutLogEvents", req, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.NextSequenceToken, nil
+}
+
+// call sends a signed request to the service and decodes the response.
+func (c *client) call(ctx context.Context, operation string, in interface{}, out interface{}) error {
+	creds, err := c.credentials.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	// Create the request
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", apiContentType)
+	req.Header.Set("X-Amz-Target", targetPrefix+operation)
+	signRequest(req, body, creds, c.region, serviceName, time.Now())
+
+	// Send it
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return parseAPIError(resp.StatusCode, respBody)
+	}
+	if out != nil && len(respBody) > 0 {
+		err = json.Unmarshal(respBody, out)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Done
+	return nil
+}
+
+func parseAPIError(statusCode int, body []byte) error {
+	resp := struct {
+		Type                  string `json:"__type"`
+		Message               string `json:"message"`
+		MessageUpper          string `json:"Message"`
+		ExpectedSequenceToken string `json:"expectedSequenceToken"`
+	}{}
+
+	if json.Unmarshal(body, &resp) != nil || len(resp.Type) == 0 {
+		return errors.New("unexpected response status code " + strconv.Itoa(statusCode))
+	}
+
+	apiErr := &APIError{
+		StatusCode:            statusCode,
+		Type:                  resp.Type,
+		Message:               resp.Message,
+		ExpectedSequenceToken: resp.ExpectedSequenceToken,
+	}
+	if idx := strings.LastIndexByte(apiErr.Type, '#'); idx >= 0 {
+		apiErr.Type = apiErr.Type[idx+1:]
+	}
+	if len(apiErr.Message) == 0 {
+		apiErr.Message = resp.MessageUpper
+	}
+	return apiErr
+}
+
+func isAPIError(err error, errType string) bool {
+	var apiErr *APIError
+
+	return errors.As(err, &apiErr) && apiErr.Type == errType
+}
+
+// signRequest adds the AWS signature version 4 authorization to the request. All the headers already set
+// in the request, and the host, are signed.
+func signRequest(req *http.Request, body []byte, creds Credentials, region string, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(amzDateLayout)
+	scope := now.Format(shortDateLayout) + "/" + region + "/" + service + "/aws4_request"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if len(creds.SessionToken) > 0 {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	// Build the canonical headers
+	host := req.Host
+	if len(host) == 0 {
+		host = req.URL.Host
+	}
+	headers := map[string]string{
+		"host": host,
+	}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for idx, v := range values {
+			trimmed[idx] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := strings.Builder{}
+	for _, name := range names {
+		_, _ = canonicalHeaders.WriteString(name)
+		_, _ = canonicalHeaders.WriteString(":")
+		_, _ = canonicalHeaders.WriteString(headers[name])
+		_, _ = canonicalHeaders.WriteString("\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	// Sign it
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := signAlgorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), now.Format(shortDateLayout))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", signAlgorithm+" Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
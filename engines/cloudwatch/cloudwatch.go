@@ -0,0 +1,506 @@
+package cloudwatch
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mxmauro/logger/engines"
+	"github.com/mxmauro/resetevent"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	defaultBatchSize     = 1000
+	defaultFlushInterval = 5 * time.Second
+	defaultTimeout       = 10 * time.Second
+	defaultMaxQueueSize  = 10000
+
+	minRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff = 30 * time.Second
+
+	flushTimeout = 5 * time.Second
+
+	// PutLogEvents limits
+	maxBatchEvents = 10000
+	maxBatchBytes  = 1048576
+	maxBatchSpan   = 24 * time.Hour
+	eventOverhead  = 26
+	maxEventBytes  = 262144
+
+	levelSuccess = "success"
+	levelError   = "error"
+	levelWarning = "warning"
+	levelInfo    = "info"
+	levelDebug   = "debug"
+)
+
+//------------------------------------------------------------------------------
+
+// Options specifies the CloudWatch Logs engine settings to use when it is created.
+type Options struct {
+	// Name of the log group. It is created if it does not exist.
+	LogGroup string `json:"logGroup,omitempty"`
+
+	// Name of the log stream. It is created if it does not exist. Defaults to the host name.
+	LogStream string `json:"logStream,omitempty"`
+
+	// AWS region. Defaults to the AWS_REGION or AWS_DEFAULT_REGION environment variables.
+	Region string `json:"region,omitempty"`
+
+	// Optional URL of the service endpoint, for example, a VPC endpoint. Defaults to the regional one.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Maximum amount of events to send in a single request. Defaults to 1000. Maximum is 10000.
+	BatchSize uint `json:"batchSize,omitempty"`
+
+	// Maximum time to wait before sending an incomplete batch. Defaults to 5 seconds.
+	FlushInterval time.Duration `json:"flushInterval,omitempty"`
+
+	// Timeout of each request. Defaults to 10 seconds.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// Set the maximum amount of events to keep in memory if the service cannot be reached.
+	// When exceeded, the oldest events are dropped.
+	MaxQueueSize uint `json:"queueSize,omitempty"`
+
+	// Optional time zone of the timestamps added to text messages instead of the one set in the logger. JSON
+	// messages already carry the timestamp added by the logger.
+	TimeZone *time.Location `json:"-"`
+
+	// Optional function that provides the AWS credentials. If not set, they are taken from the environment
+	// variables, the shared credentials file, the ECS container or the EC2 instance metadata, in that order.
+	Credentials func(ctx context.Context) (Credentials, error) `json:"-"`
+}
+
+type engine struct {
+	logGroup        string
+	logStream       string
+	client          *client
+	batchSize       int
+	flushInterval   time.Duration
+	timeLayout      string
+	location        *time.Location
+	sequenceToken   string
+	mtx             sync.Mutex
+	queue           *list.List
+	queueAvailEv    *resetevent.AutoResetEvent
+	queueEmptyEv    *resetevent.ManualResetEvent
+	maxQueueSize    uint
+	lastSendFailed  atomic.Bool
+	shutdownOnce    sync.Once
+	wg              sync.WaitGroup
+	workerCtx       context.Context
+	workerCancelCtx context.CancelFunc
+}
+
+type event struct {
+	timestamp int64
+	message   string
+}
+
+type inputLogEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+//------------------------------------------------------------------------------
+
+func NewEngine(opts Options) (engines.Engine, error) {
+	if len(opts.LogGroup) == 0 {
+		return nil, errors.New("invalid log group")
+	}
+	if len(opts.LogStream) == 0 {
+		opts.LogStream, _ = os.Hostname()
+		if len(opts.LogStream) == 0 {
+			return nil, errors.New("invalid log stream")
+		}
+	}
+	if len(opts.Region) == 0 {
+		opts.Region = os.Getenv("AWS_REGION")
+		if len(opts.Region) == 0 {
+			opts.Region = os.Getenv("AWS_DEFAULT_REGION")
+			if len(opts.Region) == 0 {
+				return nil, errors.New("region not specified")
+			}
+		}
+	}
+	if len(opts.Endpoint) == 0 {
+		opts.Endpoint = "https://logs." + opts.Region + ".amazonaws.com"
+		if strings.HasPrefix(opts.Region, "cn-") {
+			opts.Endpoint += ".cn"
+		}
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	// Create CloudWatch adapter
+	lg := &engine{
+		location:      opts.TimeZone,
+		logGroup:      opts.LogGroup,
+		logStream:     opts.LogStream,
+		batchSize:     int(opts.BatchSize),
+		flushInterval: opts.FlushInterval,
+		mtx:           sync.Mutex{},
+		queue:         list.New(),
+		queueAvailEv:  resetevent.NewAutoResetEvent(),
+		queueEmptyEv:  resetevent.NewManualResetEvent(),
+		maxQueueSize:  opts.MaxQueueSize,
+		shutdownOnce:  sync.Once{},
+		wg:            sync.WaitGroup{},
+	}
+	lg.client = newClient(opts.Endpoint, opts.Region, opts.Credentials, &http.Client{
+		Timeout: opts.Timeout,
+	})
+	if opts.BatchSize == 0 {
+		lg.batchSize = defaultBatchSize
+	} else if opts.BatchSize > maxBatchEvents {
+		lg.batchSize = maxBatchEvents
+	}
+	if opts.FlushInterval <= 0 {
+		lg.flushInterval = defaultFlushInterval
+	}
+	if opts.MaxQueueSize == 0 {
+		lg.maxQueueSize = defaultMaxQueueSize
+	}
+
+	lg.queueEmptyEv.Set()
+
+	lg.workerCtx, lg.workerCancelCtx = context.WithCancel(context.Background())
+
+	// Create a background messenger worker
+	lg.wg.Add(1)
+	go lg.messengerWorker()
+
+	// Done
+	return lg, nil
+}
+
+func (lg *engine) Class() string {
+	return "cloudwatch"
+}
+
+func (lg *engine) Destroy() {
+	lg.shutdownOnce.Do(func() {
+		// Stop worker
+		lg.workerCancelCtx()
+
+		// Wait until exits
+		lg.wg.Wait()
+
+		lg.workerCtx = nil
+		lg.workerCancelCtx = nil
+
+		// Flush queued events
+		lg.flushQueue()
+		lg.queueEmptyEv.Set()
+	})
+}
+
+func (lg *engine) SetTimeLayout(layout string) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	lg.timeLayout = layout
+}
+
+// Flush sends all the queued events and waits until they are delivered or the flush timeout expires.
+func (lg *engine) Flush() {
+	ctx, cancelCtx := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancelCtx()
+
+	lg.queueAvailEv.Set()
+	_ = lg.queueEmptyEv.Wait(ctx)
+}
+
+// Healthy returns false if the last attempt to deliver events failed.
+func (lg *engine) Healthy() bool {
+	return !lg.lastSendFailed.Load()
+}
+
+// QueueDepth returns the amount of events waiting to be delivered.
+func (lg *engine) QueueDepth() int {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	return lg.queue.Len()
+}
+
+func (lg *engine) Success(now time.Time, msg string, raw bool, sendSuccessAtErrorLogLevel bool) {
+	if sendSuccessAtErrorLogLevel {
+		lg.queueEvent(now, levelError, msg, raw)
+	} else {
+		lg.queueEvent(now, levelSuccess, msg, raw)
+	}
+}
+
+func (lg *engine) Error(now time.Time, msg string, raw bool) {
+	lg.queueEvent(now, levelError, msg, raw)
+}
+
+func (lg *engine) Warning(now time.Time, msg string, raw bool) {
+	lg.queueEvent(now, levelWarning, msg, raw)
+}
+
+func (lg *engine) Info(now time.Time, msg string, raw bool) {
+	lg.queueEvent(now, levelInfo, msg, raw)
+}
+
+func (lg *engine) Debug(now time.Time, msg string, raw bool) {
+	lg.queueEvent(now, levelDebug, msg, raw)
+}
+
+func (lg *engine) queueEvent(now time.Time, level string, msg string, raw bool) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	// Build the event. JSON messages already contain the timestamp and level.
+	if !raw {
+		sb := strings.Builder{}
+
+		ts := engines.FormatTimestamp(engines.InLocation(now, lg.location), lg.timeLayout)
+		if !engines.IsNumericTimeLayout(lg.timeLayout) {
+			ts = strconv.Quote(ts)
+		}
+		b, _ := json.Marshal(msg)
+
+		_, _ = sb.WriteString(`{"timestamp":`)
+		_, _ = sb.WriteString(ts)
+		_, _ = sb.WriteString(`,"level":"`)
+		_, _ = sb.WriteString(level)
+		_, _ = sb.WriteString(`","message":`)
+		_, _ = sb.Write(b)
+		_, _ = sb.WriteString(`}`)
+		msg = sb.String()
+	}
+
+	// Add to queue
+	for uint(lg.queue.Len()) >= lg.maxQueueSize {
+		lg.queue.Remove(lg.queue.Front())
+	}
+	lg.queue.PushBack(&event{
+		timestamp: now.UnixMilli(),
+		message:   truncateMessage(msg),
+	})
+	lg.queueEmptyEv.Reset()
+
+	// Wake up worker if a batch is complete
+	if lg.queue.Len() >= lg.batchSize {
+		lg.queueAvailEv.Set()
+	}
+}
+
+// peekBatch returns the oldest queued events without removing them from the queue. The batch is limited
+// by the amount of events, their total size and the time span they cover.
+func (lg *engine) peekBatch() []*list.Element {
+	var batchBytes int
+	var minTimestamp, maxTimestamp int64
+
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	batch := make([]*list.Element, 0, lg.batchSize)
+	for elem := lg.queue.Front(); elem != nil && len(batch) < lg.batchSize; elem = elem.Next() {
+		ev := elem.Value.(*event)
+
+		evBytes := len(ev.message) + eventOverhead
+		if len(batch) > 0 {
+			if batchBytes+evBytes > maxBatchBytes {
+				break
+			}
+			if ev.timestamp-minTimestamp >= maxBatchSpan.Milliseconds() ||
+				maxTimestamp-ev.timestamp >= maxBatchSpan.Milliseconds() {
+				break
+			}
+		}
+		if len(batch) == 0 || ev.timestamp < minTimestamp {
+			minTimestamp = ev.timestamp
+		}
+		if len(batch) == 0 || ev.timestamp > maxTimestamp {
+			maxTimestamp = ev.timestamp
+		}
+		batchBytes += evBytes
+		batch = append(batch, elem)
+	}
+	if len(batch) == 0 {
+		// Signal waiters that all events were processed
+		lg.queueEmptyEv.Set()
+	}
+	return batch
+}
+
+// removeBatch removes the delivered events from the queue. Events dropped meanwhile are ignored.
+func (lg *engine) removeBatch(batch []*list.Element) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	for _, elem := range batch {
+		lg.queue.Remove(elem)
+	}
+}
+
+// The messenger worker do actual events delivery. The intention of this goroutine, is to
+// avoid halting the routine that sends the message if there are network issues.
+func (lg *engine) messengerWorker() {
+	defer lg.wg.Done()
+
+	ticker := time.NewTicker(lg.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lg.workerCtx.Done():
+			return
+
+		case <-ticker.C:
+		case <-lg.queueAvailEv.WaitCh():
+		}
+
+		backoff := minRetryBackoff
+		for {
+			batch := lg.peekBatch()
+			if len(batch) == 0 {
+				break
+			}
+
+			// Send events to the service
+			err := lg.send(lg.workerCtx, batch)
+			lg.lastSendFailed.Store(err != nil)
+			if err == nil {
+				lg.removeBatch(batch)
+				backoff = minRetryBackoff
+				continue
+			}
+
+			// On error, wait and retry
+			select {
+			case <-lg.workerCtx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+		}
+	}
+}
+
+func (lg *engine) flushQueue() {
+	ctx, cancelCtx := context.WithDeadline(context.Background(), time.Now().Add(flushTimeout))
+	defer cancelCtx()
+
+	for {
+		batch := lg.peekBatch()
+		if len(batch) == 0 {
+			break // Reached the end
+		}
+
+		// Send events to the service
+		err := lg.send(ctx, batch)
+		lg.lastSendFailed.Store(err != nil)
+		if err != nil {
+			break // Stop on error
+		}
+		lg.removeBatch(batch)
+	}
+}
+
+// send delivers the batch. It creates the log group and stream if they do not exist and keeps track of
+// the sequence token required by the service.
+func (lg *engine) send(ctx context.Context, batch []*list.Element) error {
+	var apiErr *APIError
+
+	// Events in a request must be in chronological order
+	events := make([]inputLogEvent, 0, len(batch))
+	for _, elem := range batch {
+		ev := elem.Value.(*event)
+		events = append(events, inputLogEvent{
+			Timestamp: ev.timestamp,
+			Message:   ev.message,
+		})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp < events[j].Timestamp
+	})
+
+	for attempt := 0; attempt < 3; attempt++ {
+		nextSequenceToken, err := lg.client.putLogEvents(ctx, lg.logGroup, lg.logStream, events, lg.sequenceToken)
+		if err == nil {
+			lg.sequenceToken = nextSequenceToken
+			return nil
+		}
+		if !errors.As(err, &apiErr) {
+			return err
+		}
+
+		switch apiErr.Type {
+		case "ResourceNotFoundException":
+			err = lg.createLogStream(ctx)
+			if err != nil {
+				return err
+			}
+
+		case "InvalidSequenceTokenException":
+			lg.sequenceToken = apiErr.ExpectedSequenceToken
+
+		case "DataAlreadyAcceptedException":
+			lg.sequenceToken = apiErr.ExpectedSequenceToken
+			return nil
+
+		default:
+			return err
+		}
+	}
+	return errors.New("unable to put log events")
+}
+
+// createLogStream creates the log stream and, if needed, the log group.
+func (lg *engine) createLogStream(ctx context.Context) error {
+	err := lg.client.createLogStream(ctx, lg.logGroup, lg.logStream)
+	if isAPIError(err, "ResourceNotFoundException") {
+		err = lg.client.createLogGroup(ctx, lg.logGroup)
+		if err != nil && !isAPIError(err, "ResourceAlreadyExistsException") {
+			return err
+		}
+		err = lg.client.createLogStream(ctx, lg.logGroup, lg.logStream)
+	}
+	if err != nil && !isAPIError(err, "ResourceAlreadyExistsException") {
+		return err
+	}
+
+	// A new stream does not have a sequence token
+	lg.sequenceToken = ""
+
+	// Done
+	return nil
+}
+
+// truncateMessage shortens messages larger than the maximum event size the service accepts.
+func truncateMessage(msg string) string {
+	maxLen := maxEventBytes - eventOverhead
+	if len(msg) <= maxLen {
+		return msg
+	}
+	for maxLen > 0 && !utf8.RuneStart(msg[maxLen]) {
+		maxLen -= 1
+	}
+	return msg[:maxLen]
+}
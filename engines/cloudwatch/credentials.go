@@ -0,0 +1,285 @@
+package cloudwatch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	containerCredentialsHost = "http://169.254.170.2"
+	instanceMetadataHost     = "http://169.254.169.254"
+	instanceMetadataTimeout  = time.Second
+
+	// Refresh temporary credentials a while before they expire
+	credentialsExpiryWindow = 5 * time.Minute
+)
+
+//------------------------------------------------------------------------------
+
+// Credentials contains the AWS credentials used to sign the requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Expiration time of temporary credentials. Zero if they do not expire.
+	Expires time.Time
+}
+
+type credentialsCache struct {
+	mtx        sync.Mutex
+	provider   func(ctx context.Context) (Credentials, error)
+	httpClient *http.Client
+	creds      Credentials
+	valid      bool
+}
+
+// Response of the container and instance metadata credentials endpoints.
+type credentialsResponse struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+//------------------------------------------------------------------------------
+
+func newCredentialsCache(
+	provider func(ctx context.Context) (Credentials, error), httpClient *http.Client,
+) *credentialsCache {
+	return &credentialsCache{
+		mtx:        sync.Mutex{},
+		provider:   provider,
+		httpClient: httpClient,
+	}
+}
+
+// get returns the cached credentials, retrieving them again if they are about to expire.
+func (cc *credentialsCache) get(ctx context.Context) (Credentials, error) {
+	var err error
+
+	// Lock access
+	cc.mtx.Lock()
+	defer cc.mtx.Unlock()
+
+	if cc.valid && (cc.creds.Expires.IsZero() || time.Until(cc.creds.Expires) > credentialsExpiryWindow) {
+		return cc.creds, nil
+	}
+
+	if cc.provider != nil {
+		cc.creds, err = cc.provider(ctx)
+	} else {
+		cc.creds, err = cc.getFromDefaultChain(ctx)
+	}
+	cc.valid = err == nil
+	return cc.creds, err
+}
+
+// getFromDefaultChain looks for the credentials in the environment variables, the shared credentials file,
+// the ECS container and the EC2 instance metadata.
+func (cc *credentialsCache) getFromDefaultChain(ctx context.Context) (Credentials, error) {
+	// Environment variables
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if len(creds.AccessKeyID) > 0 && len(creds.SecretAccessKey) > 0 {
+		return creds, nil
+	}
+
+	// Shared credentials file
+	creds, ok, err := getSharedCredentials()
+	if err != nil || ok {
+		return creds, err
+	}
+
+	// ECS container
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); len(uri) > 0 {
+		return cc.getContainerCredentials(ctx, containerCredentialsHost+uri)
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); len(uri) > 0 {
+		return cc.getContainerCredentials(ctx, uri)
+	}
+
+	// EC2 instance metadata
+	if !strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		creds, err = cc.getInstanceCredentials(ctx)
+		if err == nil {
+			return creds, nil
+		}
+	}
+
+	return Credentials{}, errors.New("no AWS credentials found")
+}
+
+func getSharedCredentials() (Credentials, bool, error) {
+	creds := Credentials{}
+
+	filename := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if len(filename) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return creds, false, nil
+		}
+		filename = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if len(profile) == 0 {
+		profile = "default"
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return creds, false, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	// Parse the INI file looking for the profile section
+	inProfile := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			inProfile = strings.TrimSpace(line[1:len(line)-1]) == profile
+			continue
+		}
+		if !inProfile {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.SessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return creds, false, err
+	}
+
+	// Done
+	return creds, len(creds.AccessKeyID) > 0 && len(creds.SecretAccessKey) > 0, nil
+}
+
+func (cc *credentialsCache) getContainerCredentials(ctx context.Context, url string) (Credentials, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if tokenFile := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); len(tokenFile) > 0 {
+		b, err2 := os.ReadFile(tokenFile)
+		if err2 != nil {
+			return Credentials{}, err2
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if len(token) > 0 {
+		req.Header.Set("Authorization", token)
+	}
+
+	return cc.fetchCredentials(req)
+}
+
+func (cc *credentialsCache) getInstanceCredentials(ctx context.Context) (Credentials, error) {
+	ctx, cancelCtx := context.WithTimeout(ctx, instanceMetadataTimeout)
+	defer cancelCtx()
+
+	// Get a session token (IMDSv2)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, instanceMetadataHost+"/latest/api/token", nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+	token, err := cc.fetch(req)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	// Get the name of the role attached to the instance
+	url := instanceMetadataHost + "/latest/meta-data/iam/security-credentials/"
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token", string(token))
+	role, err := cc.fetch(req)
+	if err != nil {
+		return Credentials{}, err
+	}
+	roleName, _, _ := strings.Cut(strings.TrimSpace(string(role)), "\n")
+
+	// And its credentials
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, url+roleName, nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token", string(token))
+	return cc.fetchCredentials(req)
+}
+
+func (cc *credentialsCache) fetchCredentials(req *http.Request) (Credentials, error) {
+	b, err := cc.fetch(req)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	resp := credentialsResponse{}
+	err = json.Unmarshal(b, &resp)
+	if err != nil {
+		return Credentials{}, err
+	}
+	if len(resp.AccessKeyID) == 0 || len(resp.SecretAccessKey) == 0 {
+		return Credentials{}, errors.New("invalid credentials response")
+	}
+	return Credentials{
+		AccessKeyID:     resp.AccessKeyID,
+		SecretAccessKey: resp.SecretAccessKey,
+		SessionToken:    resp.Token,
+		Expires:         resp.Expiration,
+	}, nil
+}
+
+func (cc *credentialsCache) fetch(req *http.Request) ([]byte, error) {
+	resp, err := cc.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, errors.New("unable to get credentials from " + req.URL.Host)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,96 @@
+package console
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+//------------------------------------------------------------------------------
+
+var (
+	colorNames = map[string]color.Attribute{
+		"black":   color.FgBlack,
+		"red":     color.FgRed,
+		"green":   color.FgGreen,
+		"yellow":  color.FgYellow,
+		"blue":    color.FgBlue,
+		"magenta": color.FgMagenta,
+		"cyan":    color.FgCyan,
+		"white":   color.FgWhite,
+	}
+)
+
+//------------------------------------------------------------------------------
+
+// applyLevelColors replaces the theme colors of the levels present in the map.
+func applyLevelColors(theme *Theme, levelColors map[string]string) error {
+	for level, spec := range levelColors {
+		attrs, err := parseColorSpec(spec)
+		if err != nil {
+			return errors.New("invalid color for level \"" + level + "\": " + err.Error())
+		}
+
+		switch strings.ToLower(level) {
+		case "error":
+			theme.Error = attrs
+		case "warning", "warn":
+			theme.Warning = attrs
+		case "info":
+			theme.Info = attrs
+		case "debug":
+			theme.Debug = attrs
+		case "success":
+			theme.Success = attrs
+		default:
+			return errors.New("unknown level \"" + level + "\" in level colors")
+		}
+	}
+
+	// Done
+	return nil
+}
+
+// parseColorSpec converts a foreground color name, optionally followed by a colon and a background color
+// name, like "white:red", into color attributes. Names can have a "bright" prefix, like "brightyellow".
+func parseColorSpec(spec string) ([]color.Attribute, error) {
+	fg, bg, hasBg := strings.Cut(spec, ":")
+
+	fgAttr, err := parseColorName(fg)
+	if err != nil {
+		return nil, err
+	}
+	attrs := []color.Attribute{fgAttr}
+
+	if hasBg {
+		bgAttr, err2 := parseColorName(bg)
+		if err2 != nil {
+			return nil, err2
+		}
+		// Background colors are at a fixed distance from the foreground ones
+		attrs = append(attrs, bgAttr+(color.BgBlack-color.FgBlack))
+	}
+
+	// Done
+	return attrs, nil
+}
+
+func parseColorName(name string) (color.Attribute, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	bright := false
+	if strings.HasPrefix(name, "bright") {
+		bright = true
+		name = strings.TrimSpace(strings.TrimPrefix(name, "bright"))
+	}
+
+	attr, ok := colorNames[name]
+	if !ok {
+		return 0, errors.New("unknown color \"" + name + "\"")
+	}
+	if bright {
+		attr += color.FgHiBlack - color.FgBlack
+	}
+	return attr, nil
+}
@@ -1,6 +1,8 @@
 package console
 
 import (
+	"errors"
+	"io"
 	"os"
 	"time"
 
@@ -15,34 +17,166 @@ import (
 type Options struct {
 	// Do not print colored output.
 	DisableColor bool `json:"disableColor,omitempty"`
+
+	// Override the terminal color support auto-detection. If set to false, it behaves like DisableColor.
+	ForceColor *bool `json:"forceColor,omitempty"`
+
+	// Set the colors to use for each level tag. Levels without attributes use the default colors.
+	Theme Theme `json:"theme,omitempty"`
+
+	// Set the colors of the level tags by level name, like {"warning": "magenta", "error": "white:red"}, so
+	// they can be changed from a configuration file. Values are a foreground color name, optionally followed
+	// by a colon and a background color name. Names can have a "bright" prefix, like "brightyellow". They
+	// take precedence over the Theme ones.
+	LevelColors map[string]string `json:"levelColors,omitempty"`
+
+	// Color the whole line of text messages, including the timestamp, instead of only the level tag.
+	ColorFullLine bool `json:"colorFullLine,omitempty"`
+
+	// Prefix each line with the sd-daemon priority of the message, like <3> for errors, so systemd assigns
+	// the right priority to the journal entries.
+	SystemdPrefix bool `json:"systemdPrefix,omitempty"`
+
+	// Indent and colorize JSON messages if the output is a terminal with color support. Compact single-line
+	// output is used otherwise.
+	Pretty bool `json:"pretty,omitempty"`
+
+	// Optional time zone used to print the timestamps, like time.Local for people reading the console, instead
+	// of the one set in the logger. It only changes how the time is displayed.
+	TimeZone *time.Location `json:"-"`
+
+	// Optional writers to use instead of the standard output and error streams.
+	Stdout io.Writer `json:"-"`
+	Stderr io.Writer `json:"-"`
+
+	// Send the messages of all the levels to the standard output instead of sending errors and warnings to the
+	// standard error, so a collector reading both streams does not interleave them.
+	AllToStdout bool `json:"allToStdout,omitempty"`
+
+	// Send the messages of all the levels to the standard error.
+	AllToStderr bool `json:"allToStderr,omitempty"`
+
+	// Optional function that builds the printed lines instead of the built-in format. It receives the
+	// timestamp in the engine time zone, the level name, like "error" or "success", the message and if it is
+	// a JSON object. The systemd prefix and the whole line color, if set, are still applied.
+	Formatter func(now time.Time, level string, msg string, raw bool) string `json:"-"`
+
+	// Print the control characters of text messages as they are. By default, they are escaped, like \x1b, so
+	// escape sequences in untrusted values cannot change the terminal. Line breaks and tabs are always kept.
+	AllowControlChars bool `json:"allowControlChars,omitempty"`
+}
+
+// Theme specifies the color attributes of each level tag.
+type Theme struct {
+	Error   []color.Attribute `json:"error,omitempty"`
+	Warning []color.Attribute `json:"warning,omitempty"`
+	Info    []color.Attribute `json:"info,omitempty"`
+	Debug   []color.Attribute `json:"debug,omitempty"`
+	Success []color.Attribute `json:"success,omitempty"`
 }
 
 type engine struct {
 	themedLevels [5]string
+	lineColors   [5]*color.Color
+	linePrefixes [5]string
+	pretty       bool
+	timeLayout   string
+	location     *time.Location
+	formatter    func(now time.Time, level string, msg string, raw bool) string
+	sanitize     bool
+	stdout       io.Writer
+	stderr       io.Writer
 }
 
 //------------------------------------------------------------------------------
 
-func NewEngine(opts Options) engines.Engine {
+var (
+	levelNames = [5]string{"error", "warning", "info", "debug", "success"}
+
+	defaultTheme = Theme{
+		Error:   []color.Attribute{color.BlinkRapid, color.FgHiWhite, color.BgRed},
+		Warning: []color.Attribute{color.FgHiYellow},
+		Info:    []color.Attribute{color.FgHiBlue},
+		Debug:   []color.Attribute{color.FgCyan},
+		Success: []color.Attribute{color.FgHiGreen},
+	}
+)
+
+//------------------------------------------------------------------------------
+
+func NewEngine(opts Options) (engines.Engine, error) {
+	if opts.AllToStdout && opts.AllToStderr {
+		return nil, errors.New("AllToStdout and AllToStderr cannot be set at the same time")
+	}
+	if len(opts.LevelColors) > 0 {
+		err := applyLevelColors(&opts.Theme, opts.LevelColors)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Create console adapter
-	lg := &engine{}
+	lg := &engine{
+		location:  opts.TimeZone,
+		formatter: opts.Formatter,
+		sanitize:  !opts.AllowControlChars,
+		stdout:    opts.Stdout,
+		stderr:    opts.Stderr,
+	}
+	if lg.stdout == nil {
+		lg.stdout = os.Stdout
+	}
+	if lg.stderr == nil {
+		lg.stderr = os.Stderr
+	}
+	if opts.AllToStdout {
+		lg.stderr = lg.stdout
+	} else if opts.AllToStderr {
+		lg.stdout = lg.stderr
+	}
 
-	if opts.DisableColor || termenv.ColorProfile() == termenv.Ascii {
+	useColor := !opts.DisableColor && termenv.ColorProfile() != termenv.Ascii
+	forceColor := false
+	if opts.ForceColor != nil {
+		useColor = *opts.ForceColor
+		forceColor = *opts.ForceColor
+	}
+
+	if !useColor || opts.ColorFullLine {
 		lg.themedLevels[0] = "[ERROR]"
 		lg.themedLevels[1] = "[WARN]"
 		lg.themedLevels[2] = "[INFO]"
 		lg.themedLevels[3] = "[DEBUG]"
 		lg.themedLevels[4] = "[SUCCESS]"
 	} else {
-		lg.themedLevels[0] = color.New(color.BlinkRapid, color.FgHiWhite, color.BgRed).Sprintf("[ERROR]")
-		lg.themedLevels[1] = color.New(color.FgHiYellow).Sprintf("[WARN]")
-		lg.themedLevels[2] = color.New(color.FgHiBlue).Sprintf("[INFO]")
-		lg.themedLevels[3] = color.New(color.FgCyan).Sprintf("[DEBUG]")
-		lg.themedLevels[3] = color.New(color.FgHiGreen).Sprintf("[SUCCESS]")
+		lg.themedLevels[0] = colorize("[ERROR]", opts.Theme.Error, defaultTheme.Error, forceColor)
+		lg.themedLevels[1] = colorize("[WARN]", opts.Theme.Warning, defaultTheme.Warning, forceColor)
+		lg.themedLevels[2] = colorize("[INFO]", opts.Theme.Info, defaultTheme.Info, forceColor)
+		lg.themedLevels[3] = colorize("[DEBUG]", opts.Theme.Debug, defaultTheme.Debug, forceColor)
+		lg.themedLevels[4] = colorize("[SUCCESS]", opts.Theme.Success, defaultTheme.Success, forceColor)
+	}
+
+	// When the whole line is colored, the level tags are not colored on their own
+	if useColor && opts.ColorFullLine {
+		lg.lineColors[0] = newColor(opts.Theme.Error, defaultTheme.Error, forceColor)
+		lg.lineColors[1] = newColor(opts.Theme.Warning, defaultTheme.Warning, forceColor)
+		lg.lineColors[2] = newColor(opts.Theme.Info, defaultTheme.Info, forceColor)
+		lg.lineColors[3] = newColor(opts.Theme.Debug, defaultTheme.Debug, forceColor)
+		lg.lineColors[4] = newColor(opts.Theme.Success, defaultTheme.Success, forceColor)
+	}
+
+	lg.pretty = opts.Pretty && useColor
+
+	if opts.SystemdPrefix {
+		lg.linePrefixes[0] = "<3>"
+		lg.linePrefixes[1] = "<4>"
+		lg.linePrefixes[2] = "<6>"
+		lg.linePrefixes[3] = "<7>"
+		lg.linePrefixes[4] = "<5>"
 	}
 
 	// Done
-	return lg
+	return lg, nil
 }
 
 func (lg *engine) Class() string {
@@ -50,49 +184,125 @@ func (lg *engine) Class() string {
 }
 
 func (lg *engine) Destroy() {
-	// Do nothing
+	lg.Flush()
+}
+
+// Flush writes any data buffered by the output writers, like the ones wrapped with bufio.Writer.
+func (lg *engine) Flush() {
+	consoleFlush(lg.stdout)
+	if lg.stderr != lg.stdout {
+		consoleFlush(lg.stderr)
+	}
+}
+
+func (lg *engine) Streams() []io.Writer {
+	if lg.stderr == lg.stdout {
+		return []io.Writer{lg.stdout}
+	}
+	return []io.Writer{lg.stdout, lg.stderr}
+}
+
+func (lg *engine) SetTimeLayout(layout string) {
+	lg.timeLayout = layout
+}
+
+func (lg *engine) formatTimestamp(now time.Time) string {
+	return engines.FormatTimestamp(engines.InLocation(now, lg.location), lg.timeLayout)
+}
+
+func (lg *engine) textMessage(msg string) string {
+	if lg.sanitize {
+		return engines.EscapeControlChars(msg, true)
+	}
+	return msg
+}
+
+func (lg *engine) rawMessage(msg string) string {
+	if lg.pretty {
+		return prettyJSON(msg)
+	}
+	return msg
 }
 
 func (lg *engine) Success(now time.Time, msg string, raw bool, sendSuccessAtErrorLogLevel bool) {
-	of := os.Stdout
+	of := lg.stdout
+	linePrefix := lg.linePrefixes[4]
 	if sendSuccessAtErrorLogLevel {
-		of = os.Stderr
+		of = lg.stderr
+		linePrefix = lg.linePrefixes[0]
+	}
+	if lg.formatter != nil {
+		lg.printFormatted(of, linePrefix, 4, now, msg, raw)
+		return
 	}
 	if !raw {
-		consolePrint(of, now, lg.themedLevels[4], msg)
+		consolePrint(of, linePrefix, lg.formatTimestamp(now), lg.themedLevels[4], lg.lineColors[4],
+			lg.textMessage(msg))
 	} else {
-		consolePrintRAW(of, msg)
+		consolePrintRAW(of, linePrefix, lg.rawMessage(msg))
 	}
 }
 
 func (lg *engine) Error(now time.Time, msg string, raw bool) {
+	if lg.formatter != nil {
+		lg.printFormatted(lg.stderr, lg.linePrefixes[0], 0, now, msg, raw)
+		return
+	}
 	if !raw {
-		consolePrint(os.Stderr, now, lg.themedLevels[0], msg)
+		consolePrint(lg.stderr, lg.linePrefixes[0], lg.formatTimestamp(now), lg.themedLevels[0],
+			lg.lineColors[0], lg.textMessage(msg))
 	} else {
-		consolePrintRAW(os.Stderr, msg)
+		consolePrintRAW(lg.stderr, lg.linePrefixes[0], lg.rawMessage(msg))
 	}
 }
 
 func (lg *engine) Warning(now time.Time, msg string, raw bool) {
+	if lg.formatter != nil {
+		lg.printFormatted(lg.stderr, lg.linePrefixes[1], 1, now, msg, raw)
+		return
+	}
 	if !raw {
-		consolePrint(os.Stderr, now, lg.themedLevels[1], msg)
+		consolePrint(lg.stderr, lg.linePrefixes[1], lg.formatTimestamp(now), lg.themedLevels[1],
+			lg.lineColors[1], lg.textMessage(msg))
 	} else {
-		consolePrintRAW(os.Stderr, msg)
+		consolePrintRAW(lg.stderr, lg.linePrefixes[1], lg.rawMessage(msg))
 	}
 }
 
 func (lg *engine) Info(now time.Time, msg string, raw bool) {
+	if lg.formatter != nil {
+		lg.printFormatted(lg.stdout, lg.linePrefixes[2], 2, now, msg, raw)
+		return
+	}
 	if !raw {
-		consolePrint(os.Stdout, now, lg.themedLevels[2], msg)
+		consolePrint(lg.stdout, lg.linePrefixes[2], lg.formatTimestamp(now), lg.themedLevels[2],
+			lg.lineColors[2], lg.textMessage(msg))
 	} else {
-		consolePrintRAW(os.Stdout, msg)
+		consolePrintRAW(lg.stdout, lg.linePrefixes[2], lg.rawMessage(msg))
 	}
 }
 
 func (lg *engine) Debug(now time.Time, msg string, raw bool) {
+	if lg.formatter != nil {
+		lg.printFormatted(lg.stdout, lg.linePrefixes[3], 3, now, msg, raw)
+		return
+	}
 	if !raw {
-		consolePrint(os.Stdout, now, lg.themedLevels[3], msg)
+		consolePrint(lg.stdout, lg.linePrefixes[3], lg.formatTimestamp(now), lg.themedLevels[3],
+			lg.lineColors[3], lg.textMessage(msg))
 	} else {
-		consolePrintRAW(os.Stdout, msg)
+		consolePrintRAW(lg.stdout, lg.linePrefixes[3], lg.rawMessage(msg))
+	}
+}
+
+// printFormatted prints the line built by the custom formatter.
+func (lg *engine) printFormatted(w io.Writer, linePrefix string, levelIdx int, now time.Time, msg string, raw bool) {
+	if !raw {
+		msg = lg.textMessage(msg)
+	}
+	line := lg.formatter(engines.InLocation(now, lg.location), levelNames[levelIdx], msg, raw)
+	if lg.lineColors[levelIdx] != nil {
+		line = lg.lineColors[levelIdx].Sprint(line)
 	}
+	consolePrintRAW(w, linePrefix, line)
 }
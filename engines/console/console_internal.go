@@ -3,8 +3,10 @@ package console
 import (
 	"fmt"
 	"io"
+	"strings"
 	"sync"
-	"time"
+
+	"github.com/fatih/color"
 )
 
 //------------------------------------------------------------------------------
@@ -15,21 +17,70 @@ var (
 
 //------------------------------------------------------------------------------
 
-func consolePrint(w io.Writer, now time.Time, themedLevel string, msg string) {
+func consoleFlush(w io.Writer) {
 	// Lock console access
 	consoleMtx.Lock()
 	defer consoleMtx.Unlock()
 
-	// Print the message prefixed with the timestamp and level
-	_, _ = fmt.Fprintf(w, "%v %v %v\n", now.Format("2006-01-02 15:04:05.000"), themedLevel, msg)
+	// Flush buffered writers and sync files
+	switch f := w.(type) {
+	case interface{ Flush() error }:
+		_ = f.Flush()
+	case interface{ Sync() error }:
+		_ = f.Sync()
+	}
 }
 
-func consolePrintRAW(w io.Writer, msg string) {
+func consolePrint(
+	w io.Writer, linePrefix string, timestamp string, themedLevel string, lineColor *color.Color, msg string,
+) {
+	msg = prefixLines(linePrefix, msg)
+
+	// Build the line with the timestamp and level
+	line := timestamp + " " + themedLevel + " " + msg
+	if lineColor != nil {
+		line = lineColor.Sprint(line)
+	}
+
+	// Lock console access
+	consoleMtx.Lock()
+	defer consoleMtx.Unlock()
+
+	// Print the message
+	_, _ = fmt.Fprintf(w, "%v%v\n", linePrefix, line)
+}
+
+func consolePrintRAW(w io.Writer, linePrefix string, msg string) {
+	msg = prefixLines(linePrefix, msg)
+
 	// Lock console access
 	consoleMtx.Lock()
 	defer consoleMtx.Unlock()
 
 	// Print the message with extra payload
-	_, _ = fmt.Fprintf(w, "%v\n", msg)
+	_, _ = fmt.Fprintf(w, "%v%v\n", linePrefix, msg)
+}
+
+// prefixLines adds the prefix to the continuation lines of a multi-line message so the journal
+// assigns them the same priority.
+func prefixLines(linePrefix string, msg string) string {
+	if len(linePrefix) == 0 {
+		return msg
+	}
+	return strings.ReplaceAll(msg, "\n", "\n"+linePrefix)
 }
 
+func colorize(s string, attrs []color.Attribute, defaultAttrs []color.Attribute, force bool) string {
+	return newColor(attrs, defaultAttrs, force).Sprint(s)
+}
+
+func newColor(attrs []color.Attribute, defaultAttrs []color.Attribute, force bool) *color.Color {
+	if len(attrs) == 0 {
+		attrs = defaultAttrs
+	}
+	c := color.New(attrs...)
+	if force {
+		c.EnableColor()
+	}
+	return c
+}
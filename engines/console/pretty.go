@@ -0,0 +1,81 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+//------------------------------------------------------------------------------
+
+var (
+	prettyKeyColor     = newPrettyColor(color.FgHiBlue)
+	prettyStringColor  = newPrettyColor(color.FgGreen)
+	prettyNumberColor  = newPrettyColor(color.FgYellow)
+	prettyLiteralColor = newPrettyColor(color.FgMagenta)
+)
+
+//------------------------------------------------------------------------------
+
+// prettyJSON indents and colorizes a JSON message. If the message is not valid JSON, it is returned as is.
+func prettyJSON(msg string) string {
+	buf := bytes.Buffer{}
+	if json.Indent(&buf, []byte(msg), "", "  ") != nil {
+		return msg
+	}
+	s := buf.String()
+
+	sb := strings.Builder{}
+	sb.Grow(len(s) * 2)
+	for idx := 0; idx < len(s); {
+		c := s[idx]
+		switch {
+		case c == '"':
+			end := idx + 1
+			for s[end] != '"' {
+				if s[end] == '\\' {
+					end += 1
+				}
+				end += 1
+			}
+			end += 1
+
+			// Keys are followed by a colon
+			if end < len(s) && s[end] == ':' {
+				_, _ = sb.WriteString(prettyKeyColor.Sprint(s[idx:end]))
+			} else {
+				_, _ = sb.WriteString(prettyStringColor.Sprint(s[idx:end]))
+			}
+			idx = end
+
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := idx + 1
+			for end < len(s) && strings.IndexByte("+-.0123456789eE", s[end]) >= 0 {
+				end += 1
+			}
+			_, _ = sb.WriteString(prettyNumberColor.Sprint(s[idx:end]))
+			idx = end
+
+		case c == 't' || c == 'f' || c == 'n':
+			end := idx + 1
+			for end < len(s) && s[end] >= 'a' && s[end] <= 'z' {
+				end += 1
+			}
+			_, _ = sb.WriteString(prettyLiteralColor.Sprint(s[idx:end]))
+			idx = end
+
+		default:
+			_ = sb.WriteByte(c)
+			idx += 1
+		}
+	}
+	return sb.String()
+}
+
+func newPrettyColor(attr color.Attribute) *color.Color {
+	c := color.New(attr)
+	c.EnableColor() // Pretty output is only used if colors are enabled
+	return c
+}
@@ -0,0 +1,161 @@
+package file
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	// CompressionNone keeps the rotated files as they are.
+	CompressionNone CompressionFormat = 0
+
+	// CompressionGzip compresses the rotated files with gzip, adding the .gz extension.
+	CompressionGzip CompressionFormat = 1
+
+	// CompressionZstd compresses the rotated files with Zstandard, adding the .zst extension. To avoid adding
+	// the dependency to every application, a compressor must be registered with RegisterCompressor before
+	// creating the engine.
+	CompressionZstd CompressionFormat = 2
+
+	maxCompressionFormat = CompressionZstd
+
+	// Extension of the temporary files written while compressing, which are not recognized as log files
+	compressTempSuffix = ".tmp"
+)
+
+//------------------------------------------------------------------------------
+
+// CompressionFormat defines how the rotated files are compressed.
+type CompressionFormat uint
+
+// CompressorFunc returns a writer that compresses the data written to it into w. Closing it must flush the
+// compressed data without closing w.
+type CompressorFunc func(w io.Writer) (io.WriteCloser, error)
+
+//------------------------------------------------------------------------------
+
+var (
+	compressorsMtx = sync.RWMutex{}
+	compressors    = map[CompressionFormat]CompressorFunc{
+		CompressionGzip: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+	}
+)
+
+//------------------------------------------------------------------------------
+
+// RegisterCompressor sets the function that creates the compressors of a format, replacing the existing
+// one. For example, to use Zstandard with the github.com/klauspost/compress/zstd package:
+//
+//	file.RegisterCompressor(file.CompressionZstd, func(w io.Writer) (io.WriteCloser, error) {
+//		return zstd.NewWriter(w)
+//	})
+func RegisterCompressor(format CompressionFormat, fn CompressorFunc) {
+	compressorsMtx.Lock()
+	defer compressorsMtx.Unlock()
+
+	if fn != nil {
+		compressors[format] = fn
+	} else {
+		delete(compressors, format)
+	}
+}
+
+// getCompressor returns the compressor registered for the format.
+func getCompressor(format CompressionFormat) (CompressorFunc, error) {
+	if format > maxCompressionFormat {
+		return nil, errors.New("invalid compression format")
+	}
+
+	compressorsMtx.RLock()
+	defer compressorsMtx.RUnlock()
+
+	fn, ok := compressors[format]
+	if !ok {
+		return nil, errors.New("no compressor registered for the compression format")
+	}
+	return fn, nil
+}
+
+// extension returns the extension added to the compressed files.
+func (f CompressionFormat) extension() string {
+	switch f {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// trimCompressionExtension removes the extension of the compression formats from the lowercase filename. It
+// also returns true if it had one.
+func trimCompressionExtension(filename string) (string, bool) {
+	for f := CompressionGzip; f <= maxCompressionFormat; f++ {
+		if base, found := strings.CutSuffix(filename, f.extension()); found {
+			return base, true
+		}
+	}
+	return filename, false
+}
+
+// compressFile compresses the file and deletes the original. The modification time of the compressed file
+// is set to the creation time of the original so the age-based purge keeps working.
+func (lg *engine) compressFile(filename string) error {
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so partially compressed files are never taken as valid
+	dstFilename := filename + lg.compression.extension()
+	tempFilename := dstFilename + compressTempSuffix
+	err = lg.writeCompressed(tempFilename, src)
+	if err == nil {
+		createdAt := getFileCreationTime(fi)
+		_ = os.Chtimes(tempFilename, time.Now(), createdAt)
+		err = os.Rename(tempFilename, dstFilename)
+	}
+	if err != nil {
+		_ = os.Remove(tempFilename)
+		return err
+	}
+
+	_ = src.Close()
+	return os.Remove(filename)
+}
+
+func (lg *engine) writeCompressed(filename string, src io.Reader) error {
+	dst, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, lg.fileMode)
+	if err != nil {
+		return err
+	}
+
+	w, err := lg.compressor(dst)
+	if err == nil {
+		_, err = io.Copy(w, src)
+		if err2 := w.Close(); err == nil {
+			err = err2
+		}
+	}
+	if err2 := dst.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
@@ -1,14 +1,21 @@
 package file
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"math"
 	"os"
 	"path/filepath"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/mxmauro/logger/engines"
@@ -19,6 +26,29 @@ import (
 const (
 	minFileSize      = 10 * 1024
 	minFileVaultSize = 100 * 1024
+
+	rotatedToMarker     = "--- rotated to "
+	continuedFromMarker = "--- continued from "
+	markerSuffix        = " ---"
+
+	defaultFileMode os.FileMode = 0644
+	defaultDirMode  os.FileMode = 0755
+
+	utf8BOM = "\uFEFF"
+
+	writeRetryDelay = 10 * time.Millisecond
+
+	// Unlikely index used to locate the index in the file names
+	indexPlaceholder = 987654321
+
+	errorReportInterval = time.Minute
+)
+
+const (
+	levelError   = 1
+	levelWarning = 2
+	levelInfo    = 3
+	levelDebug   = 4
 )
 
 //------------------------------------------------------------------------------
@@ -39,21 +69,190 @@ type Options struct {
 
 	// Set the maximum file storage size. Minimum is 1Mb. Unlimited if zero.
 	MaxFileVaultSize uint64 `json:"maxFileVaultSize,omitempty"`
+
+	// Set the maximum amount of files to keep, including the active one. Oldest files are deleted first.
+	// Unlimited if zero.
+	MaxFiles uint `json:"maxFiles,omitempty"`
+
+	// Set the pattern used to build the filenames, without the .log extension. Supported tokens are {prefix},
+	// {date}, {time}, {index}, {host} and {pid}. {prefix} and {date} are required, and {index} too if the file
+	// size is limited. Defaults to "{prefix}.{date}" or "{prefix}.{date}-{index}" if the file size is limited.
+	FilenamePattern string `json:"filenamePattern,omitempty"`
+
+	// Write a marker line at the end of a rotated file and at the beginning of the next one
+	// to help correlating split files.
+	RotationMarkers bool `json:"rotationMarkers,omitempty"`
+
+	// Discard the content of the file written first by this engine instead of appending to it, so tools that
+	// run briefly only keep the messages of the latest run. Files opened by later rotations are not affected.
+	Truncate bool `json:"truncate,omitempty"`
+
+	// Write a UTF-8 byte order mark at the beginning of new files, so Windows viewers do not misinterpret
+	// non-ASCII messages. Files that already have content are appended to as they are.
+	WriteBOM bool `json:"writeBOM,omitempty"`
+
+	// Compress the files once they are rotated, in the background. Defaults to CompressionNone. The active
+	// file is never compressed.
+	CompressionFormat CompressionFormat `json:"compressionFormat,omitempty"`
+
+	// Number of times a write is retried when a transient error, like an interrupted system call, occurs.
+	// Zero disables retries.
+	WriteRetries uint `json:"writeRetries,omitempty"`
+
+	// Keep a "prefix.log" symbolic link pointing to the active file, so it can be tailed across rotations.
+	// On Windows, the active filename is written into a "prefix.current" text file instead.
+	CurrentSymlink bool `json:"currentSymlink,omitempty"`
+
+	// Flush files to disk when they are rotated or closed. Disabling it avoids an fsync on each rotation,
+	// useful on systems with very frequent rotations, at the cost of losing the latest messages if the
+	// system crashes before the operating system writes them. Defaults to true.
+	SyncOnRotate *bool `json:"syncOnRotate,omitempty"`
+
+	// Flush files to disk after each message is written. This provides the highest durability but each
+	// message pays the cost of an fsync, so it should only be used for low volume logs.
+	SyncEveryWrite bool `json:"syncEveryWrite,omitempty"`
+
+	// Flush files to disk after each error message is written, so they are not lost if the system crashes,
+	// without paying the cost of an fsync for the rest of the messages.
+	SyncOnError bool `json:"syncOnError,omitempty"`
+
+	// Flush files with unsynced messages to disk periodically, from a background goroutine, to bound the
+	// messages lost if the system crashes without paying the cost of an fsync on each write. Files are also
+	// flushed when the engine is destroyed. Zero disables it.
+	SyncInterval time.Duration `json:"syncInterval,omitempty"`
+
+	// Write plain text messages as JSON objects with the timestamp, level and message fields, so all the lines
+	// of the files are JSON objects.
+	JSONLines bool `json:"jsonLines,omitempty"`
+
+	// Additional sets of files, written by the same engine, with their own level filter and retention.
+	Tiers []Tier `json:"tiers,omitempty"`
+
+	// Additional sets of files, written by the same engine, that only receive the messages of a single level.
+	// The key is the level, "error", "warning", "info" or "debug", and the value the filename prefix. They use
+	// the same retention settings of the engine.
+	LevelFiles map[string]string `json:"levelFiles,omitempty"`
+
+	// Permissions of the log files. They must allow the owner to write. Defaults to 0644. As usual, the process
+	// umask is applied when a file is created.
+	FileMode os.FileMode `json:"fileMode,omitempty"`
+
+	// Permissions of the directories created to store the log files. They must allow the owner to read, write
+	// and search. Defaults to 0755.
+	DirMode os.FileMode `json:"dirMode,omitempty"`
+
+	// Optional time zone of the timestamps of text lines and of the dates used in file names and daily rotation,
+	// instead of the one set in the logger.
+	TimeZone *time.Location `json:"-"`
+
+	// Optional function that builds the written lines instead of the built-in format, like adding the host
+	// name. It receives the timestamp in the engine time zone, the level name, like "error" or "success", the
+	// message and if it is a JSON object. JSONLines does not apply to the lines it builds.
+	Formatter func(now time.Time, level string, msg string, raw bool) string `json:"-"`
+
+	// Optional callback invoked when a file cannot be written or rotated. While the error persists, it is
+	// called once a minute at most. The callback must not log to the same engine.
+	OnError func(err error) `json:"-"`
+}
+
+// Tier specifies an additional set of log files written by the file engine.
+type Tier struct {
+	// Filename prefix to use when a file is created. Must be different from the engine's prefix.
+	Prefix string `json:"prefix"`
+
+	// The most verbose level written to this tier: "error", "warning", "info" or "debug". Defaults to "debug".
+	MaxLevel string `json:"maxLevel,omitempty"`
+
+	// Amount of days to keep old logs.
+	DaysToKeep uint `json:"daysToKeep,omitempty"`
+
+	// Set the maximum file size. Minimum is 10Kb. Unlimited if zero.
+	MaxFileSize uint64 `json:"maxFileSize,omitempty"`
+
+	// Set the maximum file storage size. Minimum is 1Mb. Unlimited if zero.
+	MaxFileVaultSize uint64 `json:"maxFileVaultSize,omitempty"`
+
+	// Set the maximum amount of files to keep, including the active one. Unlimited if zero.
+	MaxFiles uint `json:"maxFiles,omitempty"`
+}
+
+type logFile interface {
+	WriteString(s string) (int, error)
+	Sync() error
+	Close() error
 }
 
 type engine struct {
-	mtx                  sync.Mutex
-	fd                   *os.File
-	lastWasError         int32
-	directory            string
+	mtx              sync.Mutex
+	lastWasError     int32
+	lastError        atomic.Pointer[lastError]
+	lastErrorReport  time.Time
+	onError          func(err error)
+	directory        string
+	rotationMarkers  bool
+	writeBOM         bool
+	currentSymlink   bool
+	syncOnRotate     bool
+	syncEveryWrite   bool
+	syncOnError      bool
+	syncInterval     time.Duration
+	syncStopCh       chan struct{}
+	syncWg           sync.WaitGroup
+	backgroundMtx    sync.Mutex
+	backgroundCh     chan struct{}
+	backgroundStopCh chan struct{}
+	backgroundWg     sync.WaitGroup
+	compression      CompressionFormat
+	compressor       CompressorFunc
+	jsonLines        bool
+	writeRetries     uint
+	timeLayout       string
+	location         *time.Location
+	formatter        func(now time.Time, level string, msg string, raw bool) string
+	filenamePattern  string
+	fileMode         os.FileMode
+	dirMode          os.FileMode
+	hostname         string
+	pid              int
+	streams          []*stream
+}
+
+type lastError struct {
+	err error
+	at  time.Time
+}
+
+type stream struct {
+	fd                   logFile
+	prefix               string
+	minLevel             int
+	maxLevel             int
 	daysToKeep           uint
 	maxFileSize          int64
 	maxFileVaultSize     int64
-	prefix               string
+	maxFiles             int
 	subFileIndex         int
 	dayOfFile            int
 	currentFileSize      int64
 	currentFileVaultSize int64
+	currentFilename      string
+	filenameRegex        *regexp.Regexp
+	unsynced             bool
+	purgePending         bool
+	pendingCompress      []string
+	truncate             bool
+	purging              bool
+}
+
+//------------------------------------------------------------------------------
+
+// openFile opens the log files. Tests can replace it to simulate write errors.
+var openFile = func(name string, flag int, perm os.FileMode) (logFile, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
 //------------------------------------------------------------------------------
@@ -77,15 +276,51 @@ func NewEngine(opts Options) (engines.Engine, error) {
 
 	// Create file adapter
 	lg := &engine{
-		prefix:    opts.Prefix,
-		dayOfFile: -1,
+		location:        opts.TimeZone,
+		formatter:       opts.Formatter,
+		rotationMarkers: opts.RotationMarkers,
+		writeBOM:        opts.WriteBOM,
+		currentSymlink:  opts.CurrentSymlink,
+		syncOnRotate:    true,
+		syncEveryWrite:  opts.SyncEveryWrite,
+		syncOnError:     opts.SyncOnError,
+		syncInterval:    opts.SyncInterval,
+		jsonLines:       opts.JSONLines,
+		writeRetries:    opts.WriteRetries,
+		onError:         opts.OnError,
+		filenamePattern: opts.FilenamePattern,
+		fileMode:        opts.FileMode,
+		dirMode:         opts.DirMode,
+		pid:             os.Getpid(),
+		streams:         make([]*stream, 0, 1+len(opts.Tiers)+len(opts.LevelFiles)),
 	}
+	lg.hostname, _ = os.Hostname()
 
-	// Set the number of days to keep the old files
-	if opts.DaysToKeep < 365 {
-		lg.daysToKeep = opts.DaysToKeep
-	} else {
-		lg.daysToKeep = 365
+	if opts.SyncOnRotate != nil {
+		lg.syncOnRotate = *opts.SyncOnRotate
+	}
+
+	if opts.SyncInterval < 0 {
+		return nil, errors.New("invalid sync interval")
+	}
+
+	if opts.CompressionFormat != CompressionNone {
+		lg.compression = opts.CompressionFormat
+		lg.compressor, err = getCompressor(opts.CompressionFormat)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.FileMode == 0 {
+		lg.fileMode = defaultFileMode
+	} else if opts.FileMode&^os.ModePerm != 0 || opts.FileMode&0200 == 0 {
+		return nil, fmt.Errorf("invalid file mode %v", opts.FileMode)
+	}
+	if opts.DirMode == 0 {
+		lg.dirMode = defaultDirMode
+	} else if opts.DirMode&^os.ModePerm != 0 || opts.DirMode&0700 != 0700 {
+		return nil, fmt.Errorf("invalid directory mode %v", opts.DirMode)
 	}
 
 	// Establishes the target directory
@@ -110,192 +345,686 @@ func NewEngine(opts Options) (engines.Engine, error) {
 		lg.directory += string(filepath.Separator)
 	}
 
-	// File size and vault limits
-	if opts.MaxFileSize > 0 {
-		if opts.MaxFileSize > uint64(math.MaxInt64) {
-			lg.maxFileSize = int64(math.MaxInt64)
-		} else if opts.MaxFileSize < uint64(minFileSize) {
-			lg.maxFileSize = int64(minFileSize)
-		} else {
-			lg.maxFileSize = int64(opts.MaxFileSize)
+	// Create the main stream and the additional tiers
+	lg.streams = append(lg.streams, newStream(opts.Prefix, levelDebug, opts.DaysToKeep, opts.MaxFileSize,
+		opts.MaxFileVaultSize, opts.MaxFiles))
+
+	for _, tier := range opts.Tiers {
+		var maxLevel int
+
+		if len(tier.Prefix) == 0 {
+			return nil, errors.New("tier prefix not specified")
 		}
+		if lg.hasStream(tier.Prefix) {
+			return nil, fmt.Errorf("duplicated tier prefix \"%v\"", tier.Prefix)
+		}
+
+		maxLevel, err = parseLevel(tier.MaxLevel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tier level \"%v\"", tier.MaxLevel)
+		}
+
+		lg.streams = append(lg.streams, newStream(tier.Prefix, maxLevel, tier.DaysToKeep, tier.MaxFileSize,
+			tier.MaxFileVaultSize, tier.MaxFiles))
 	}
 
-	if opts.MaxFileVaultSize > 0 {
-		if opts.MaxFileVaultSize > uint64(math.MaxInt64) {
-			lg.maxFileVaultSize = int64(math.MaxInt64)
-		} else if opts.MaxFileVaultSize < uint64(minFileVaultSize) {
-			lg.maxFileVaultSize = int64(minFileVaultSize)
-		} else {
-			lg.maxFileVaultSize = int64(opts.MaxFileVaultSize)
+	// Create the streams of the single level files, sorted by level name to get a stable order
+	levelNames := make([]string, 0, len(opts.LevelFiles))
+	for levelName := range opts.LevelFiles {
+		levelNames = append(levelNames, levelName)
+	}
+	slices.Sort(levelNames)
+	for _, levelName := range levelNames {
+		var level int
+
+		prefix := opts.LevelFiles[levelName]
+		if len(prefix) == 0 {
+			return nil, fmt.Errorf("prefix not specified for level \"%v\"", levelName)
 		}
-		if lg.maxFileVaultSize < lg.maxFileSize {
-			lg.maxFileVaultSize = lg.maxFileSize
+		if lg.hasStream(prefix) {
+			return nil, fmt.Errorf("duplicated level file prefix \"%v\"", prefix)
+		}
+
+		level, err = parseLevel(levelName)
+		if err != nil || len(levelName) == 0 {
+			return nil, fmt.Errorf("invalid level \"%v\"", levelName)
+		}
+
+		st := newStream(prefix, level, opts.DaysToKeep, opts.MaxFileSize, opts.MaxFileVaultSize, opts.MaxFiles)
+		st.minLevel = level
+		lg.streams = append(lg.streams, st)
+	}
+
+	// Validate the filename pattern
+	if len(lg.filenamePattern) > 0 {
+		for _, st := range lg.streams {
+			err = validateFilenamePattern(lg.filenamePattern, st.maxFileSize > 0)
+			if err != nil {
+				return nil, err
+			}
+			st.filenameRegex = compileFilenamePattern(lg.filenamePattern, st.prefix, lg.hostname)
 		}
 	}
 
 	// Delete old files and get the current vault size
-	lg.currentFileVaultSize, _ = lg.purgeFileVault()
+	for _, st := range lg.streams {
+		st.currentFileVaultSize, _ = lg.purgeFileVault(st, "")
+		st.truncate = opts.Truncate
+	}
+
+	// Start the background worker, rotated files are compressed and old files deleted without blocking
+	// the writers
+	for _, st := range lg.streams {
+		if st.hasPurgeLimits() || lg.compressor != nil {
+			lg.backgroundCh = make(chan struct{}, 1)
+			lg.backgroundStopCh = make(chan struct{})
+			lg.backgroundWg.Add(1)
+			go lg.backgroundWorker(lg.backgroundStopCh)
+			break
+		}
+	}
+
+	// Start the background syncer
+	if lg.syncInterval > 0 {
+		lg.syncStopCh = make(chan struct{})
+		lg.syncWg.Add(1)
+		go lg.syncWorker(lg.syncStopCh)
+	}
 
 	// Done
 	return lg, nil
 }
 
+func newStream(prefix string, maxLevel int, daysToKeep uint, maxFileSize uint64, maxFileVaultSize uint64,
+	maxFiles uint) *stream {
+	st := &stream{
+		prefix:    prefix,
+		maxLevel:  maxLevel,
+		maxFiles:  int(maxFiles),
+		dayOfFile: -1,
+	}
+
+	// Set the number of days to keep the old files
+	if daysToKeep < 365 {
+		st.daysToKeep = daysToKeep
+	} else {
+		st.daysToKeep = 365
+	}
+
+	// File size and vault limits
+	if maxFileSize > 0 {
+		if maxFileSize > uint64(math.MaxInt64) {
+			st.maxFileSize = int64(math.MaxInt64)
+		} else if maxFileSize < uint64(minFileSize) {
+			st.maxFileSize = int64(minFileSize)
+		} else {
+			st.maxFileSize = int64(maxFileSize)
+		}
+	}
+
+	if maxFileVaultSize > 0 {
+		if maxFileVaultSize > uint64(math.MaxInt64) {
+			st.maxFileVaultSize = int64(math.MaxInt64)
+		} else if maxFileVaultSize < uint64(minFileVaultSize) {
+			st.maxFileVaultSize = int64(minFileVaultSize)
+		} else {
+			st.maxFileVaultSize = int64(maxFileVaultSize)
+		}
+		if st.maxFileVaultSize < st.maxFileSize {
+			st.maxFileVaultSize = st.maxFileSize
+		}
+	}
+
+	// Done
+	return st
+}
+
+// hasStream returns true if a stream with the given prefix already exists.
+func (lg *engine) hasStream(prefix string) bool {
+	for _, st := range lg.streams {
+		if strings.EqualFold(st.prefix, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func (lg *engine) Class() string {
 	return "file"
 }
 
 func (lg *engine) Destroy() {
+	// Stop the background syncer
+	lg.mtx.Lock()
+	syncStopCh := lg.syncStopCh
+	lg.syncStopCh = nil
+	lg.mtx.Unlock()
+	if syncStopCh != nil {
+		close(syncStopCh)
+		lg.syncWg.Wait()
+	}
+
+	// Stop the background worker and complete the pending tasks
+	if lg.backgroundStopCh != nil {
+		close(lg.backgroundStopCh)
+		lg.backgroundWg.Wait()
+		lg.backgroundStopCh = nil
+	}
+	lg.runPendingTasks()
+
 	lg.mtx.Lock()
 	defer lg.mtx.Unlock()
 
-	if lg.fd != nil {
-		_ = lg.fd.Sync()
-		_ = lg.fd.Close()
-		lg.fd = nil
+	for _, st := range lg.streams {
+		if st.fd != nil {
+			if lg.syncOnRotate || (lg.syncInterval > 0 && st.unsynced) {
+				_ = st.fd.Sync()
+			}
+			_ = st.fd.Close()
+			st.fd = nil
+		}
 	}
 }
 
-func (lg *engine) Success(now time.Time, msg string, raw bool, _ bool) {
-	if !raw {
-		lg.write(now, "SUCCESS", msg)
-	} else {
-		lg.writeRAW(now, msg)
+func (lg *engine) SetTimeLayout(layout string) {
+	lg.timeLayout = layout
+}
+
+// LastError returns the most recent write or rotate error and when it happened. The error is cleared after
+// a successful write.
+func (lg *engine) LastError() (error, time.Time) {
+	le := lg.lastError.Load()
+	if le == nil {
+		return nil, time.Time{}
 	}
+	return le.err, le.at
 }
 
-func (lg *engine) Error(now time.Time, msg string, raw bool) {
-	if !raw {
-		lg.write(now, "ERROR", msg)
-	} else {
-		lg.writeRAW(now, msg)
+func (lg *engine) Flush() {
+	lg.runPendingTasks()
+
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	for _, st := range lg.streams {
+		if st.fd != nil {
+			_ = st.fd.Sync()
+			st.unsynced = false
+		}
 	}
 }
 
-func (lg *engine) Warning(now time.Time, msg string, raw bool) {
-	if !raw {
-		lg.write(now, "WARNING", msg)
-	} else {
-		lg.writeRAW(now, msg)
+// syncWorker periodically flushes to disk the files with messages written since the last flush.
+func (lg *engine) syncWorker(stopCh <-chan struct{}) {
+	defer lg.syncWg.Done()
+
+	ticker := time.NewTicker(lg.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case <-ticker.C:
+		}
+
+		lg.mtx.Lock()
+		for _, st := range lg.streams {
+			// Files are closed between rotations and after write errors
+			if st.fd != nil && st.unsynced {
+				_ = st.fd.Sync()
+				st.unsynced = false
+			}
+		}
+		lg.mtx.Unlock()
 	}
 }
 
-func (lg *engine) Info(now time.Time, msg string, raw bool) {
-	if !raw {
-		lg.write(now, "INFO", msg)
-	} else {
-		lg.writeRAW(now, msg)
+// backgroundWorker compresses and deletes the old files of the streams that were rotated.
+func (lg *engine) backgroundWorker(stopCh <-chan struct{}) {
+	defer lg.backgroundWg.Done()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case <-lg.backgroundCh:
+		}
+
+		lg.runPendingTasks()
 	}
 }
 
+// runPendingTasks compresses the rotated files and deletes the old files of the streams that were rotated.
+// The directory is scanned without holding the engine lock, so the bytes written meanwhile are added to the
+// calculated vault size.
+func (lg *engine) runPendingTasks() {
+	lg.backgroundMtx.Lock()
+	defer lg.backgroundMtx.Unlock()
+
+	for _, st := range lg.streams {
+		lg.mtx.Lock()
+		purge := st.purgePending
+		compressFilenames := st.pendingCompress
+		if !purge && len(compressFilenames) == 0 {
+			lg.mtx.Unlock()
+			continue
+		}
+		st.purgePending = false
+		st.purging = purge
+		st.pendingCompress = nil
+		currentFilename := ""
+		if st.fd != nil {
+			currentFilename = st.currentFilename
+		}
+		vaultSizeBefore := st.currentFileVaultSize
+		lg.mtx.Unlock()
+
+		// The rotated files are compressed first so the purge sees their final size
+		for _, filename := range compressFilenames {
+			if filename != currentFilename {
+				_ = lg.compressFile(filename)
+			}
+		}
+		if !purge {
+			continue
+		}
+
+		vaultSize, err := lg.purgeFileVault(st, currentFilename)
+
+		lg.mtx.Lock()
+		if err == nil {
+			st.currentFileVaultSize = vaultSize + st.currentFileVaultSize - vaultSizeBefore
+		}
+		st.purging = false
+		lg.mtx.Unlock()
+	}
+}
+
+// wakeBackgroundWorker signals the background worker there are pending tasks.
+func (lg *engine) wakeBackgroundWorker() {
+	select {
+	case lg.backgroundCh <- struct{}{}:
+	default:
+	}
+}
+
+// Validate checks the target directory can be created and written by creating and deleting a temporary
+// file in it.
+func (lg *engine) Validate(_ context.Context) error {
+	err := os.MkdirAll(lg.directory, lg.dirMode)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(lg.directory, ".validate-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString("\n")
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+
+	// Done
+	return err
+}
+
+func (lg *engine) Success(now time.Time, msg string, raw bool, sendSuccessAtErrorLogLevel bool) {
+	level := levelInfo
+	if sendSuccessAtErrorLogLevel {
+		level = levelError
+	}
+	lg.writeMessage(now, level, "SUCCESS", msg, raw)
+}
+
+func (lg *engine) Error(now time.Time, msg string, raw bool) {
+	lg.writeMessage(now, levelError, "ERROR", msg, raw)
+}
+
+func (lg *engine) Warning(now time.Time, msg string, raw bool) {
+	lg.writeMessage(now, levelWarning, "WARNING", msg, raw)
+}
+
+func (lg *engine) Info(now time.Time, msg string, raw bool) {
+	lg.writeMessage(now, levelInfo, "INFO", msg, raw)
+}
+
 func (lg *engine) Debug(now time.Time, msg string, raw bool) {
-	if !raw {
-		lg.write(now, "DEBUG", msg)
+	lg.writeMessage(now, levelDebug, "DEBUG", msg, raw)
+}
+
+func (lg *engine) writeMessage(now time.Time, level int, levelName string, msg string, raw bool) {
+	if lg.formatter != nil {
+		now = engines.InLocation(now, lg.location)
+		lg.writeRAW(now, level, lg.formatter(now, strings.ToLower(levelName), msg, raw))
+	} else if !raw {
+		lg.write(now, level, levelName, msg)
 	} else {
-		lg.writeRAW(now, msg)
+		lg.writeRAW(now, level, msg)
 	}
 }
 
-func (lg *engine) write(now time.Time, level string, msg string) {
+func (lg *engine) write(now time.Time, level int, levelName string, msg string) {
+	now = engines.InLocation(now, lg.location)
+
 	sb := strings.Builder{}
-	_, _ = sb.WriteString(now.Format("2006-01-02 15:04:05.000"))
+	if lg.jsonLines {
+		ts := engines.FormatTimestamp(now, lg.timeLayout)
+		if !engines.IsNumericTimeLayout(lg.timeLayout) {
+			ts = strconv.Quote(ts)
+		}
+		b, _ := json.Marshal(msg)
+
+		_, _ = sb.WriteString(`{"timestamp":`)
+		_, _ = sb.WriteString(ts)
+		_, _ = sb.WriteString(`,"level":"`)
+		_, _ = sb.WriteString(strings.ToLower(levelName))
+		_, _ = sb.WriteString(`","message":`)
+		_, _ = sb.Write(b)
+		_, _ = sb.WriteString(`}`)
+		lg.writeRAW(now, level, sb.String())
+		return
+	}
+
+	_, _ = sb.WriteString(engines.FormatTimestamp(now, lg.timeLayout))
 	_, _ = sb.WriteString(" [")
-	_, _ = sb.WriteString(level)
+	_, _ = sb.WriteString(levelName)
 	_, _ = sb.WriteString("]: ")
 	_, _ = sb.WriteString(msg)
-	lg.writeRAW(now, sb.String())
+	lg.writeRAW(now, level, sb.String())
 }
 
-func (lg *engine) writeRAW(now time.Time, msg string) {
-	msgLen := len(msg)
+func (lg *engine) writeRAW(now time.Time, level int, msg string) {
+	var err error
+
+	// The date of the file names and the daily rotation also use the engine time zone
+	now = engines.InLocation(now, lg.location)
 
 	// Lock access
 	lg.mtx.Lock()
-	defer lg.mtx.Unlock()
 
-	err := lg.openOrRotateFile(now, msgLen+newLineLen)
+	for _, st := range lg.streams {
+		if level >= st.minLevel && level <= st.maxLevel {
+			if err2 := lg.writeStream(st, now, level, msg); err2 != nil && err == nil {
+				err = err2
+			}
+		}
+	}
+
+	// Check if the error must be reported
+	reportErr := lg.checkError(err)
+
+	lg.mtx.Unlock()
+
+	// Report the error outside the lock
+	if reportErr != nil {
+		lg.onError(reportErr)
+	}
+}
+
+// checkError tracks the write failures. It returns the error to report, if any, avoiding duplicates.
+func (lg *engine) checkError(err error) error {
 	if err == nil {
-		// Save message to file
-		_, err = lg.fd.WriteString(msg)
+		lg.lastWasError = 0
+		if lg.lastError.Load() != nil {
+			lg.lastError.Store(nil)
+		}
+		return nil
+	}
+
+	now := time.Now()
+	lg.lastError.Store(&lastError{
+		err: err,
+		at:  now,
+	})
+
+	report := lg.onError != nil && (lg.lastWasError == 0 || now.Sub(lg.lastErrorReport) >= errorReportInterval)
+	lg.lastWasError = 1
+	if !report {
+		return nil
+	}
+	lg.lastErrorReport = now
+	return err
+}
+
+func (lg *engine) writeStream(st *stream, now time.Time, level int, msg string) error {
+	msgLen := len(msg)
+
+	written := 0
+	for retry := uint(0); ; retry++ {
+		err := lg.openOrRotateFile(st, now, msgLen+newLineLen)
 		if err == nil {
-			lg.currentFileSize += int64(msgLen)
-			lg.currentFileVaultSize += int64(msgLen)
-			_, err = lg.fd.WriteString(newLine)
+			// Save message to file
+			err = st.writeLine(msg, &written)
 			if err == nil {
-				lg.currentFileSize += int64(newLineLen)
-				lg.currentFileVaultSize += int64(newLineLen)
+				if lg.syncEveryWrite || (lg.syncOnError && level == levelError) {
+					_ = st.fd.Sync()
+					st.unsynced = false
+				} else {
+					st.unsynced = true
+				}
+				return nil
+			}
+		}
+
+		// Retry on transient errors only
+		if retry >= lg.writeRetries || !isTransientError(err) {
+			// Close the file so the directory and the file are created again on the next write
+			if st.fd != nil {
+				_ = st.fd.Close()
+				st.fd = nil
 			}
+			return err
+		}
+		time.Sleep(time.Duration(retry+1) * writeRetryDelay)
+
+		// Reopen the file if the descriptor is no longer usable
+		if st.fd != nil && (errors.Is(err, fs.ErrClosed) || errors.Is(err, syscall.EIO)) {
+			_ = st.reopenFile(lg.fileMode)
 		}
 	}
 }
 
-func (lg *engine) openOrRotateFile(now time.Time, msgLen int) error {
+func (lg *engine) openOrRotateFile(st *stream, now time.Time, msgLen int) error {
 	dayOfNow := now.Day()
 
-	// Check if we have to rotate files
-	rotate := lg.fd == nil || dayOfNow != lg.dayOfFile ||
-		(lg.maxFileSize > 0 && lg.currentFileSize+int64(msgLen) > lg.maxFileSize) ||
-		(lg.maxFileVaultSize > 0 && lg.currentFileVaultSize+int64(msgLen) > lg.maxFileVaultSize)
+	// If rotation markers are enabled, reserve room for the marker that closes the current file
+	markerLen := 0
+	if lg.rotationMarkers && st.fd != nil {
+		markerLen = len(rotatedToMarker) + len(filepath.Base(st.currentFilename)) + len(markerSuffix) + newLineLen
+	}
+
+	// Check if we have to rotate files. The vault size is not checked until the purge of the previous rotation
+	// updates it.
+	rotate := dayOfNow != st.dayOfFile ||
+		(st.maxFileSize > 0 && st.currentFileSize+int64(msgLen+markerLen) > st.maxFileSize) ||
+		(st.maxFileVaultSize > 0 && !st.purgePending && !st.purging &&
+			st.currentFileVaultSize+int64(msgLen) > st.maxFileVaultSize)
 	if !rotate {
-		return nil
+		if st.fd != nil {
+			return nil
+		}
+
+		// The file was closed after a write error, reopen it so failed writes do not advance the index
+		if len(st.currentFilename) > 0 {
+			err := os.MkdirAll(lg.directory, lg.dirMode)
+			if err != nil {
+				return err
+			}
+			return st.reopenFile(lg.fileMode)
+		}
 	}
 
-	// Close old file if anyone is open
-	if lg.fd != nil {
-		_ = lg.fd.Sync()
-		_ = lg.fd.Close()
-		lg.fd = nil
-	}
-	lg.currentFileSize = 0
-	if lg.maxFileSize > 0 {
-		if dayOfNow != lg.dayOfFile {
-			lg.subFileIndex = 1
+	prevSubFileIndex := st.subFileIndex
+	if st.maxFileSize > 0 {
+		if dayOfNow != st.dayOfFile {
+			st.subFileIndex = lg.nextSubFileIndex(st, now)
 		} else {
-			lg.subFileIndex += 1
+			st.subFileIndex += 1
 		}
 	}
+	filename := lg.getFilename(st, now)
 
-	// Delete old files and get the current vault size
-	lg.currentFileVaultSize, _ = lg.purgeFileVault()
+	// Close old file if anyone is open
+	oldFilename := ""
+	if st.fd != nil {
+		if lg.rotationMarkers && filename != st.currentFilename {
+			n, _ := st.fd.WriteString(rotatedToMarker + filepath.Base(filename) + markerSuffix + newLine)
+			st.currentFileVaultSize += int64(n)
+			oldFilename = st.currentFilename
+		}
+
+		// The background syncer cannot flush the file once it is closed
+		if lg.syncOnRotate || (lg.syncInterval > 0 && st.unsynced) {
+			_ = st.fd.Sync()
+		}
+		_ = st.fd.Close()
+		st.fd = nil
+		st.unsynced = false
+	}
+
+	// Compress the closed file in the background, even if it was closed after a write error
+	if lg.compressor != nil && len(st.currentFilename) > 0 && filename != st.currentFilename {
+		st.pendingCompress = append(st.pendingCompress, st.currentFilename)
+		lg.wakeBackgroundWorker()
+	}
+	st.currentFileSize = 0
 
 	// Create target directory if it does not exist
-	err := os.MkdirAll(lg.directory, 0755)
+	err := os.MkdirAll(lg.directory, lg.dirMode)
 	if err != nil {
+		// Retry with the same index on the next write
+		st.subFileIndex = prevSubFileIndex
+		st.currentFilename = ""
 		return err
 	}
 
-	// Create a new log file
-	filenameSB := strings.Builder{}
-	_, _ = filenameSB.WriteString(lg.directory)
-	_, _ = filenameSB.WriteString(strings.ToLower(lg.prefix))
-	_, _ = filenameSB.WriteString(".")
-	_, _ = filenameSB.WriteString(now.Format("2006-01-02"))
-	if lg.maxFileSize > 0 {
-		_, _ = filenameSB.WriteString("-")
-		_, _ = filenameSB.WriteString(fmt.Sprintf("%03d", lg.subFileIndex))
+	// Create a new log file, discarding the previous content if it is the first one of the run
+	flags := os.O_WRONLY | os.O_APPEND | os.O_CREATE
+	existingSize := int64(0)
+	if fi, err2 := os.Stat(filename); err2 == nil {
+		existingSize = fi.Size()
 	}
-	_, _ = filenameSB.WriteString(".log")
-
-	lg.fd, err = os.OpenFile(filenameSB.String(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if st.truncate {
+		flags |= os.O_TRUNC
+	}
+	st.fd, err = openFile(filename, flags, lg.fileMode)
 	if err != nil {
+		// Retry with the same index on the next write
+		st.subFileIndex = prevSubFileIndex
+		st.currentFilename = ""
 		return err
 	}
+	st.currentFilename = filename
+
+	// The vault size included the discarded content
+	if st.truncate {
+		st.truncate = false
+		st.currentFileVaultSize -= existingSize
+		if st.currentFileVaultSize < 0 {
+			st.currentFileVaultSize = 0
+		}
+		existingSize = 0
+	}
+
+	// Mark new files as UTF-8
+	if lg.writeBOM && existingSize == 0 {
+		n, _ := st.fd.WriteString(utf8BOM)
+		st.currentFileSize += int64(n)
+		st.currentFileVaultSize += int64(n)
+	}
 
-	lg.dayOfFile = dayOfNow
+	st.dayOfFile = dayOfNow
+
+	// Point the current link to the new file
+	if lg.currentSymlink {
+		_ = updateCurrentLink(lg.directory+strings.ToLower(st.prefix)+currentLinkSuffix, filename)
+	}
+
+	// Delete old files in the background
+	if lg.backgroundCh != nil && st.hasPurgeLimits() {
+		st.purgePending = true
+		lg.wakeBackgroundWorker()
+	}
+
+	// Link the new file with the previous one
+	if len(oldFilename) > 0 {
+		n, _ := st.fd.WriteString(continuedFromMarker + filepath.Base(oldFilename) + markerSuffix + newLine)
+		st.currentFileSize += int64(n)
+		st.currentFileVaultSize += int64(n)
+	}
 
 	// Done
 	return nil
 }
 
-// This also returns the current vault size
-func (lg *engine) purgeFileVault() (int64, error) {
+// nextSubFileIndex returns the index that follows the highest one of the existing files of the day, so a
+// restarted process does not append to the files written before.
+func (lg *engine) nextSubFileIndex(st *stream, now time.Time) int {
+	// Get the parts of the file names around the index
+	savedSubFileIndex := st.subFileIndex
+	st.subFileIndex = indexPlaceholder
+	filename := filepath.Base(lg.getFilename(st, now))
+	st.subFileIndex = savedSubFileIndex
+
+	before, after, found := strings.Cut(filename, strconv.Itoa(indexPlaceholder))
+	if !found {
+		return 1
+	}
+
+	entries, err := os.ReadDir(lg.directory)
+	if err != nil {
+		return 1
+	}
+
+	highest := 0
+	for _, entry := range entries {
+		// Compressed files keep their index
+		name, _ := trimCompressionExtension(strings.ToLower(entry.Name()))
+		if entry.IsDir() || len(name) <= len(before)+len(after) || !strings.HasPrefix(name, before) ||
+			!strings.HasSuffix(name, after) {
+			continue
+		}
+		index, err2 := strconv.Atoi(name[len(before) : len(name)-len(after)])
+		if err2 == nil && index > highest {
+			highest = index
+		}
+	}
+
+	// Done
+	return highest + 1
+}
+
+func (lg *engine) getFilename(st *stream, now time.Time) string {
+	if len(lg.filenamePattern) > 0 {
+		return lg.directory + formatFilenamePattern(lg.filenamePattern, st.prefix, lg.hostname, lg.pid,
+			st.subFileIndex, now) + ".log"
+	}
+
+	filenameSB := strings.Builder{}
+	_, _ = filenameSB.WriteString(lg.directory)
+	_, _ = filenameSB.WriteString(strings.ToLower(st.prefix))
+	_, _ = filenameSB.WriteString(".")
+	_, _ = filenameSB.WriteString(now.Format("2006-01-02"))
+	if st.maxFileSize > 0 {
+		_, _ = filenameSB.WriteString("-")
+		_, _ = filenameSB.WriteString(fmt.Sprintf("%03d", st.subFileIndex))
+	}
+	_, _ = filenameSB.WriteString(".log")
+	return filenameSB.String()
+}
+
+// This also returns the current vault size. The currently open file, if any, is never deleted.
+func (lg *engine) purgeFileVault(st *stream, currentFilename string) (int64, error) {
 	type LogFile struct {
 		Name      string
 		FileSize  int64
 		CreatedAt time.Time
 	}
 
-	if lg.daysToKeep == 0 && lg.maxFileVaultSize == 0 {
+	if !st.hasPurgeLimits() {
 		return 0, nil // Nothing to do
 	}
 
@@ -306,6 +1035,7 @@ func (lg *engine) purgeFileVault() (int64, error) {
 	}
 
 	// Filter undesired files
+	filenamePrefix := strings.ToLower(st.prefix) + "."
 	filteredFiles := make([]LogFile, 0, len(files))
 	for _, f := range files {
 		var fi fs.FileInfo
@@ -314,21 +1044,34 @@ func (lg *engine) purgeFileVault() (int64, error) {
 			continue // Ignore directories
 		}
 
-		filename := f.Name()
+		filename, compressed := trimCompressionExtension(strings.ToLower(f.Name()))
 		filenameLen := len(filename)
-		if filenameLen < 4 || strings.ToLower(filename[filenameLen-4:]) != ".log" {
+		if filenameLen < 4 || filename[filenameLen-4:] != ".log" {
 			continue // Ignore non-log files
 		}
+		if st.filenameRegex != nil {
+			if !st.filenameRegex.MatchString(filename) {
+				continue // Ignore files that belong to other streams
+			}
+		} else if !strings.HasPrefix(filename, filenamePrefix) || !isDigit(filename, len(filenamePrefix)) {
+			continue // Ignore files that belong to other streams
+		}
 
 		fi, err = f.Info()
 		if err != nil {
 			continue
 		}
 
+		// Compressed files keep the creation time of the original as their modification time
+		createdAt := getFileCreationTime(fi)
+		if compressed {
+			createdAt = fi.ModTime()
+		}
+
 		filteredFiles = append(filteredFiles, LogFile{
-			Name:      filename,
+			Name:      f.Name(),
 			FileSize:  fi.Size(),
-			CreatedAt: getFileCreationTime(fi),
+			CreatedAt: createdAt,
 		})
 	}
 	filteredFilesLen := len(filteredFiles)
@@ -340,8 +1083,8 @@ func (lg *engine) purgeFileVault() (int64, error) {
 
 	// Find the cut point for old files
 	deleteUntilIndex := 0
-	if lg.daysToKeep > 0 {
-		lowestTime := time.Now().UTC().AddDate(0, 0, -(int(lg.daysToKeep)))
+	if st.daysToKeep > 0 {
+		lowestTime := time.Now().UTC().AddDate(0, 0, -(int(st.daysToKeep)))
 		for deleteUntilIndex = 0; deleteUntilIndex < filteredFilesLen; deleteUntilIndex += 1 {
 			if !filteredFiles[deleteUntilIndex].CreatedAt.Before(lowestTime) {
 				break
@@ -356,19 +1099,107 @@ func (lg *engine) purgeFileVault() (int64, error) {
 	}
 
 	// Check if we need more space
-	if lg.maxFileVaultSize > 0 {
-		requiredMaxSize := lg.maxFileVaultSize - minFileSize
+	if st.maxFileVaultSize > 0 {
+		requiredMaxSize := st.maxFileVaultSize - minFileSize
 		for deleteUntilIndex < filteredFilesLen && fileVaultSize > requiredMaxSize {
 			fileVaultSize -= filteredFiles[deleteUntilIndex].FileSize
 			deleteUntilIndex += 1
 		}
 	}
 
+	// Check if there are too many files, leaving room for the one about to be created if none is open
+	if st.maxFiles > 0 {
+		maxFiles := st.maxFiles
+		if len(currentFilename) == 0 {
+			maxFiles -= 1
+		}
+		for deleteUntilIndex < filteredFilesLen && filteredFilesLen-deleteUntilIndex > maxFiles {
+			fileVaultSize -= filteredFiles[deleteUntilIndex].FileSize
+			deleteUntilIndex += 1
+		}
+	}
+
 	// Delete the files we dont need
+	currentName := strings.ToLower(filepath.Base(currentFilename))
 	for idx := 0; idx < deleteUntilIndex; idx++ {
+		if strings.ToLower(filteredFiles[idx].Name) == currentName {
+			fileVaultSize += filteredFiles[idx].FileSize
+			continue
+		}
 		_ = os.Remove(lg.directory + filteredFiles[idx].Name)
 	}
 
 	// Done
 	return fileVaultSize, nil
 }
+
+// hasPurgeLimits returns true if old files of the stream must be deleted.
+func (st *stream) hasPurgeLimits() bool {
+	return st.daysToKeep > 0 || st.maxFileVaultSize > 0 || st.maxFiles > 0
+}
+
+// writeLine writes the message followed by a new line starting at the given offset. The offset is
+// updated with the amount of bytes written so a retry does not duplicate data.
+func (st *stream) writeLine(msg string, written *int) error {
+	msgLen := len(msg)
+
+	if *written < msgLen {
+		n, err := st.fd.WriteString(msg[*written:])
+		*written += n
+		st.currentFileSize += int64(n)
+		st.currentFileVaultSize += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := st.fd.WriteString(newLine[*written-msgLen:])
+	*written += n
+	st.currentFileSize += int64(n)
+	st.currentFileVaultSize += int64(n)
+	return err
+}
+
+func (st *stream) reopenFile(perm os.FileMode) error {
+	if st.fd != nil {
+		_ = st.fd.Close()
+		st.fd = nil
+	}
+
+	fd, err := openFile(st.currentFilename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, perm)
+	if err != nil {
+		return err
+	}
+	st.fd = fd
+	return nil
+}
+
+// parseLevel converts a level name to its value. An empty name means debug.
+func parseLevel(name string) (int, error) {
+	switch strings.ToLower(name) {
+	case "error":
+		return levelError, nil
+	case "warning", "warn":
+		return levelWarning, nil
+	case "info":
+		return levelInfo, nil
+	case "debug", "":
+		return levelDebug, nil
+	}
+	return 0, errors.New("invalid level")
+}
+
+func isTransientError(err error) bool {
+	var tempErr interface {
+		Temporary() bool
+	}
+
+	if errors.Is(err, fs.ErrClosed) || errors.Is(err, syscall.EIO) {
+		return true
+	}
+	return errors.As(err, &tempErr) && tempErr.Temporary()
+}
+
+func isDigit(s string, idx int) bool {
+	return idx < len(s) && s[idx] >= '0' && s[idx] <= '9'
+}
@@ -0,0 +1,865 @@
+package file
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+func TestWriteRetryOnTransientError(t *testing.T) {
+	var failing *failingFile
+
+	dir := t.TempDir()
+
+	oldOpenFile := openFile
+	openFile = func(name string, flag int, perm os.FileMode) (logFile, error) {
+		f, err := os.OpenFile(name, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		failing = &failingFile{
+			File:     f,
+			failures: 2,
+			err:      syscall.EINTR,
+		}
+		return failing, nil
+	}
+	defer func() {
+		openFile = oldOpenFile
+	}()
+
+	e, err := NewEngine(Options{
+		Prefix:       "Test",
+		Directory:    dir,
+		WriteRetries: 3,
+	})
+	if err != nil {
+		t.Errorf("unable to initialize. [%v]", err)
+		return
+	}
+
+	e.Info(time.Now(), "This is an information message sample", false)
+	e.Destroy()
+
+	if failing.failures != 0 {
+		t.Errorf("write was not retried")
+	}
+	if s := readLogFiles(t, dir); strings.Count(s, "This is an information message sample") != 1 {
+		t.Errorf("message was not written once. [%v]", s)
+	}
+}
+
+func TestWriteRetryOnPermanentError(t *testing.T) {
+	var failing *failingFile
+
+	dir := t.TempDir()
+
+	oldOpenFile := openFile
+	openFile = func(name string, flag int, perm os.FileMode) (logFile, error) {
+		f, err := os.OpenFile(name, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		failing = &failingFile{
+			File:     f,
+			failures: 100,
+			err:      errors.New("no space left on device"),
+		}
+		return failing, nil
+	}
+	defer func() {
+		openFile = oldOpenFile
+	}()
+
+	e, err := NewEngine(Options{
+		Prefix:       "Test",
+		Directory:    dir,
+		WriteRetries: 3,
+	})
+	if err != nil {
+		t.Errorf("unable to initialize. [%v]", err)
+		return
+	}
+
+	e.Info(time.Now(), "This is an information message sample", false)
+	e.Destroy()
+
+	if failing.attempts != 1 {
+		t.Errorf("permanent errors must not be retried. [%v]", failing.attempts)
+	}
+}
+
+func TestOnErrorWhenDirectoryBecomesUnwritable(t *testing.T) {
+	var reported []error
+
+	dir := filepath.Join(t.TempDir(), "logs")
+
+	e, err := NewEngine(Options{
+		Prefix:    "Test",
+		Directory: dir,
+		OnError: func(err error) {
+			reported = append(reported, err)
+		},
+	})
+	if err != nil {
+		t.Errorf("unable to initialize. [%v]", err)
+		return
+	}
+	defer e.Destroy()
+
+	now := time.Now()
+	e.Info(now, "This is an information message sample", false)
+
+	// Make the directory unwritable by replacing it with a regular file. Unlike changing the directory
+	// permissions, this also works when tests are run by privileged users.
+	err = os.RemoveAll(dir)
+	if err == nil {
+		err = os.WriteFile(dir, []byte{}, 0444)
+	}
+	if err != nil {
+		t.Fatalf("unable to make the directory unwritable. [%v]", err)
+	}
+
+	// Writing on the next day forces the creation of a new file
+	now = now.AddDate(0, 0, 1)
+	for i := 0; i < 3; i++ {
+		e.Info(now, "This is an information message sample", false)
+	}
+	if len(reported) != 1 {
+		t.Fatalf("unexpected number of reported errors. [%v]", len(reported))
+	}
+
+	// Restore the directory, the next write must create it again
+	err = os.Remove(dir)
+	if err != nil {
+		t.Fatalf("unable to restore the directory. [%v]", err)
+	}
+	e.Info(now, "This is the message written after recovery", false)
+	if s := readLogFiles(t, dir); !strings.Contains(s, "This is the message written after recovery") {
+		t.Errorf("message was not written after recovery. [%v]", s)
+	}
+
+	// A new failure must be reported again
+	e.Destroy()
+	_ = os.RemoveAll(dir)
+	_ = os.WriteFile(dir, []byte{}, 0444)
+	e.Info(now, "This is an information message sample", false)
+	if len(reported) != 2 {
+		t.Errorf("unexpected number of reported errors. [%v]", len(reported))
+	}
+}
+
+func TestFileIndexAfterWriteErrors(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+
+	e, err := NewEngine(Options{
+		Prefix:      "Test",
+		Directory:   dir,
+		MaxFileSize: minFileSize,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+	defer e.Destroy()
+
+	now := time.Now()
+	e.Info(now, "This is an information message sample", true)
+
+	// Fail some writes on the same day. The descriptor is closed because writing to a removed file succeeds.
+	lg := e.(*engine)
+	lg.mtx.Lock()
+	_ = lg.streams[0].fd.Close()
+	lg.mtx.Unlock()
+	err = os.RemoveAll(dir)
+	if err == nil {
+		err = os.WriteFile(dir, []byte{}, 0444)
+	}
+	if err != nil {
+		t.Fatalf("unable to make the directory unwritable. [%v]", err)
+	}
+	for i := 0; i < 5; i++ {
+		e.Info(now, "This is an information message sample", true)
+	}
+
+	// After recovery, the messages must go to the file with the same index
+	err = os.Remove(dir)
+	if err != nil {
+		t.Fatalf("unable to restore the directory. [%v]", err)
+	}
+	e.Info(now, "This is the message written after recovery", true)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(files) != 1 || !strings.HasSuffix(files[0], "-001.log") {
+		t.Errorf("unexpected files. [%v]", files)
+	}
+}
+
+func TestSyncOptions(t *testing.T) {
+	syncOnRotateDisabled := false
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected int
+	}{
+		{"default", Options{MaxFileSize: minFileSize}, 3},
+		{"no sync on rotate", Options{MaxFileSize: minFileSize, SyncOnRotate: &syncOnRotateDisabled}, 0},
+		{"sync every write", Options{SyncEveryWrite: true, SyncOnRotate: &syncOnRotateDisabled}, 4},
+		{"sync on error", Options{SyncOnError: true, SyncOnRotate: &syncOnRotateDisabled}, 1},
+	}
+	for _, test := range tests {
+		var syncs int
+
+		oldOpenFile := openFile
+		openFile = func(name string, flag int, perm os.FileMode) (logFile, error) {
+			f, err := os.OpenFile(name, flag, perm)
+			if err != nil {
+				return nil, err
+			}
+			return &syncCounterFile{
+				File:  f,
+				syncs: &syncs,
+			}, nil
+		}
+
+		test.opts.Prefix = "Test"
+		test.opts.Directory = t.TempDir()
+		e, err := NewEngine(test.opts)
+		if err != nil {
+			openFile = oldOpenFile
+			t.Fatalf("unable to initialize. [%v]", err)
+		}
+
+		// With the minimum file size, each message causes a rotation
+		msg := strings.Repeat("x", minFileSize/2+1)
+		for i := 0; i < 3; i++ {
+			e.Info(time.Now(), msg, true)
+		}
+		e.Error(time.Now(), "error", false)
+		e.Destroy()
+		openFile = oldOpenFile
+
+		if syncs != test.expected {
+			t.Errorf("unexpected number of syncs for %v. [%v != %v]", test.name, syncs, test.expected)
+		}
+	}
+}
+
+func TestSyncInterval(t *testing.T) {
+	var syncs int
+
+	oldOpenFile := openFile
+	openFile = func(name string, flag int, perm os.FileMode) (logFile, error) {
+		f, err := os.OpenFile(name, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		return &syncCounterFile{
+			File:  f,
+			syncs: &syncs,
+		}, nil
+	}
+	defer func() {
+		openFile = oldOpenFile
+	}()
+
+	syncOnRotateDisabled := false
+	e, err := NewEngine(Options{
+		Prefix:       "Test",
+		Directory:    t.TempDir(),
+		SyncOnRotate: &syncOnRotateDisabled,
+		SyncInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+	lg := e.(*engine)
+
+	getSyncs := func() int {
+		lg.mtx.Lock()
+		defer lg.mtx.Unlock()
+		return syncs
+	}
+
+	// Nothing to sync until a message is written
+	time.Sleep(60 * time.Millisecond)
+	if n := getSyncs(); n != 0 {
+		t.Errorf("unexpected number of syncs without messages. [%v]", n)
+	}
+
+	e.Info(time.Now(), "This is an information message sample", false)
+	deadline := time.Now().Add(2 * time.Second)
+	for getSyncs() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := getSyncs(); n != 1 {
+		t.Fatalf("unexpected number of syncs after a message. [%v]", n)
+	}
+
+	// Destroy does a final sync of the messages written since the last one
+	e.Info(time.Now(), "This is another information message sample", false)
+	e.Destroy()
+	if syncs < 2 {
+		t.Errorf("unsynced messages were not synced on destroy. [%v]", syncs)
+	}
+
+	_, err = NewEngine(Options{
+		Directory:    t.TempDir(),
+		SyncInterval: -time.Second,
+	})
+	if err == nil {
+		t.Errorf("negative sync interval accepted")
+	}
+}
+
+func TestMaxFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	e, err := NewEngine(Options{
+		Prefix:      "Test",
+		Directory:   dir,
+		MaxFileSize: minFileSize,
+		MaxFiles:    3,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	// With the minimum file size, each message causes a rotation
+	msg := strings.Repeat("x", minFileSize/2+1)
+	for i := 0; i < 10; i++ {
+		e.Info(time.Now(), msg, true)
+
+		// Old files are deleted in the background, flushing waits for it
+		e.(*engine).Flush()
+		files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+		if len(files) > 3 {
+			t.Fatalf("too many files kept. [%v]", len(files))
+		}
+	}
+	e.Destroy()
+
+	// The newest files are kept
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(files) != 3 || !strings.HasSuffix(files[2], "-010.log") {
+		t.Errorf("unexpected files kept. [%v]", files)
+	}
+}
+
+func TestFilenamePattern(t *testing.T) {
+	dir := t.TempDir()
+	hostname, _ := os.Hostname()
+
+	for _, pattern := range []string{"{prefix}.{date}-{unknown}", "{date}-{index}", "{prefix}.{index}", "{prefix}.{date}"} {
+		_, err := NewEngine(Options{
+			Prefix:          "Test",
+			Directory:       dir,
+			MaxFileSize:     minFileSize,
+			FilenamePattern: pattern,
+		})
+		if err == nil {
+			t.Errorf("invalid pattern was accepted. [%v]", pattern)
+		}
+	}
+
+	e, err := NewEngine(Options{
+		Prefix:          "Test",
+		Directory:       dir,
+		MaxFileSize:     minFileSize,
+		MaxFiles:        2,
+		FilenamePattern: "{prefix}_{host}_{date}T{time}_{index}_{pid}",
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	// With the minimum file size, each message causes a rotation
+	msg := strings.Repeat("x", minFileSize/2+1)
+	for i := 0; i < 5; i++ {
+		e.Info(time.Now(), msg, true)
+	}
+	e.Destroy()
+
+	// Old files generated by the pattern must be recognized and purged
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(files) != 2 {
+		t.Fatalf("unexpected number of files. [%v]", files)
+	}
+	expectedPrefix := "test_" + strings.ToLower(hostname) + "_"
+	expectedSuffix := "_005_" + strconv.Itoa(os.Getpid()) + ".log"
+	name := filepath.Base(files[1])
+	if !strings.HasPrefix(name, expectedPrefix) || !strings.HasSuffix(name, expectedSuffix) {
+		t.Errorf("unexpected filename. [%v]", name)
+	}
+}
+
+func TestLevelFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, levelFiles := range []map[string]string{{"fatal": "Errors"}, {"error": "App"}, {"error": ""}} {
+		_, err := NewEngine(Options{
+			Prefix:     "App",
+			Directory:  dir,
+			LevelFiles: levelFiles,
+		})
+		if err == nil {
+			t.Errorf("invalid level files were accepted. [%v]", levelFiles)
+		}
+	}
+
+	e, err := NewEngine(Options{
+		Prefix:    "App",
+		Directory: dir,
+		LevelFiles: map[string]string{
+			"error":   "Errors",
+			"warning": "Warnings",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	now := time.Now()
+	e.Error(now, "error message", false)
+	e.Warning(now, "warning message", false)
+	e.Info(now, "info message", false)
+	e.Destroy()
+
+	for prefix, expected := range map[string][]string{
+		"app":      {"error message", "warning message", "info message"},
+		"errors":   {"error message"},
+		"warnings": {"warning message"},
+	} {
+		b, err2 := os.ReadFile(filepath.Join(dir, prefix+"."+now.Format("2006-01-02")+".log"))
+		if err2 != nil {
+			t.Fatalf("unable to read file. [%v]", err2)
+		}
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		if len(lines) != len(expected) {
+			t.Fatalf("unexpected content in %v file. [%v]", prefix, lines)
+		}
+		for idx, line := range lines {
+			if !strings.HasSuffix(line, expected[idx]) {
+				t.Errorf("unexpected line in %v file. [%v]", prefix, line)
+			}
+		}
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	dir := t.TempDir()
+
+	e, err := NewEngine(Options{
+		Prefix:    "Test",
+		Directory: dir,
+		JSONLines: true,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	now := time.Now()
+	e.Warning(now, "a \"quoted\"\nmulti-line message", false)
+	e.Success(now, "done", false, false)
+	e.Info(now, `{"timestamp":"now","level":"info","count":1}`, true)
+	e.Destroy()
+
+	b, err := os.ReadFile(filepath.Join(dir, "test."+now.Format("2006-01-02")+".log"))
+	if err != nil {
+		t.Fatalf("unable to read file. [%v]", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected number of lines. [%v]", lines)
+	}
+
+	expected := []map[string]interface{}{
+		{"level": "warning", "message": "a \"quoted\"\nmulti-line message"},
+		{"level": "success", "message": "done"},
+		{"level": "info", "count": float64(1)},
+	}
+	for idx, line := range lines {
+		var entry map[string]interface{}
+
+		if err = json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line is not a JSON object. [%v]", line)
+		}
+		if _, ok := entry["timestamp"]; !ok {
+			t.Errorf("timestamp not found. [%v]", line)
+		}
+		for k, v := range expected[idx] {
+			if entry[k] != v {
+				t.Errorf("unexpected %v field. [%v]", k, line)
+			}
+		}
+	}
+}
+
+func TestWriteBOM(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	// The mark is only written when the file is created
+	for run := 1; run <= 2; run++ {
+		e, err := NewEngine(Options{
+			Prefix:           "Test",
+			Directory:        dir,
+			MaxFileVaultSize: minFileVaultSize,
+			WriteBOM:         true,
+		})
+		if err != nil {
+			t.Fatalf("unable to initialize. [%v]", err)
+		}
+		e.Info(now, "Message of run "+strconv.Itoa(run), true)
+
+		lg := e.(*engine)
+		lg.mtx.Lock()
+		vaultSize := lg.streams[0].currentFileVaultSize
+		lg.mtx.Unlock()
+		e.Destroy()
+
+		data := readLogFiles(t, dir)
+		if int64(len(data)) != vaultSize {
+			t.Errorf("unexpected vault size. [%v]", vaultSize)
+		}
+	}
+
+	data := readLogFiles(t, dir)
+	if data != utf8BOM+"Message of run 1\nMessage of run 2\n" {
+		t.Fatalf("unexpected content. [%q]", data)
+	}
+}
+
+//------------------------------------------------------------------------------
+// Private methods
+
+type failingFile struct {
+	*os.File
+	failures int
+	attempts int
+	err      error
+}
+
+func (f *failingFile) WriteString(s string) (int, error) {
+	f.attempts += 1
+	if f.failures > 0 {
+		f.failures -= 1
+		return 0, &os.PathError{Op: "write", Path: f.Name(), Err: f.err}
+	}
+	return f.File.WriteString(s)
+}
+
+type syncCounterFile struct {
+	*os.File
+	syncs *int
+}
+
+func (f *syncCounterFile) Sync() error {
+	*f.syncs += 1
+	return f.File.Sync()
+}
+
+func readLogFiles(t *testing.T, dir string) string {
+	sb := strings.Builder{}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	for _, name := range files {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Errorf("unable to read file. [%v]", err)
+			continue
+		}
+		_, _ = sb.Write(b)
+	}
+	return sb.String()
+}
+
+func TestFormatter(t *testing.T) {
+	dir := t.TempDir()
+
+	e, err := NewEngine(Options{
+		Prefix:    "Test",
+		Directory: dir,
+		JSONLines: true,
+		Formatter: func(now time.Time, level string, msg string, raw bool) string {
+			return now.Format("2006") + " myhost " + level + " " + strconv.FormatBool(raw) + " " + msg
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	e.Error(now, "This is an error message sample", false)
+	e.Success(now, `{"message":"sample"}`, true, true)
+	e.Destroy()
+
+	expected := "2024 myhost error false This is an error message sample\n" +
+		`2024 myhost success true {"message":"sample"}` + "\n"
+	if s := readLogFiles(t, dir); s != expected {
+		t.Errorf("unexpected formatted lines. [%q]", s)
+	}
+}
+
+func TestSubFileIndexAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	// Files left by a previous run. Files of other days and prefixes must not be considered.
+	for _, name := range []string{
+		"test.2024-05-01-001.log", "test.2024-05-01-003.log", "test.2024-04-30-007.log", "other.2024-05-01-009.log",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("previous run\n"), 0644); err != nil {
+			t.Fatalf("unable to create file. [%v]", err)
+		}
+	}
+
+	for _, pattern := range []string{"", "{prefix}-{index}-{date}"} {
+		e, err := NewEngine(Options{
+			Prefix:          "Test",
+			Directory:       dir,
+			MaxFileSize:     minFileSize,
+			FilenamePattern: pattern,
+		})
+		if err != nil {
+			t.Fatalf("unable to initialize. [%v]", err)
+		}
+		e.Info(now, "This is an information message sample", false)
+		e.Destroy()
+	}
+
+	// Previous files must not be appended to
+	for name, expected := range map[string]string{
+		"test.2024-05-01-001.log": "previous run\n",
+		"test.2024-05-01-003.log": "previous run\n",
+		"test.2024-05-01-004.log": "This is an information message sample\n",
+		"test-001-2024-05-01.log": "This is an information message sample\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("unable to read file. [%v]", err)
+		} else if !strings.HasSuffix(string(data), expected) || strings.Count(string(data), "\n") != 1 {
+			t.Errorf("unexpected content of %v. [%q]", name, string(data))
+		}
+	}
+}
+
+func BenchmarkRotationWithLargeDirectory(b *testing.B) {
+	msg := strings.Repeat("x", 256)
+
+	newEngine := func(b *testing.B, maxFiles uint) *engine {
+		dir := b.TempDir()
+
+		// Files of other streams make every directory scan of the purge slow
+		for i := 0; i < 2000; i++ {
+			name := filepath.Join(dir, "other.2024-05-01-"+strconv.Itoa(i)+".log")
+			if err := os.WriteFile(name, []byte("previous run\n"), 0644); err != nil {
+				b.Fatalf("unable to create file. [%v]", err)
+			}
+		}
+
+		e, err := NewEngine(Options{
+			Prefix:      "Test",
+			Directory:   dir,
+			MaxFileSize: minFileSize,
+			MaxFiles:    maxFiles,
+		})
+		if err != nil {
+			b.Fatalf("unable to initialize. [%v]", err)
+		}
+		return e.(*engine)
+	}
+
+	runWriters := func(b *testing.B, lg *engine) {
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				lg.Info(time.Now(), msg, true)
+			}
+		})
+		b.StopTimer()
+	}
+
+	// Baseline: the old files are purged on the write path, before opening the new file, while the engine
+	// lock blocks the other writers
+	b.Run("PurgeOnWrite", func(b *testing.B) {
+		lg := newEngine(b, 0)
+		defer lg.Destroy()
+
+		st := lg.streams[0]
+		st.maxFiles = 5
+
+		oldOpenFile := openFile
+		openFile = func(name string, flag int, perm os.FileMode) (logFile, error) {
+			st.currentFileVaultSize, _ = lg.purgeFileVault(st, "")
+			return oldOpenFile(name, flag, perm)
+		}
+		defer func() {
+			openFile = oldOpenFile
+		}()
+
+		runWriters(b, lg)
+	})
+
+	// Writers are not blocked while the old files are purged after each rotation
+	b.Run("PurgeInBackground", func(b *testing.B) {
+		lg := newEngine(b, 5)
+		defer lg.Destroy()
+
+		runWriters(b, lg)
+	})
+}
+
+func TestRotationMarkersVaultSize(t *testing.T) {
+	dir := t.TempDir()
+
+	e, err := NewEngine(Options{
+		Prefix:          "Test",
+		Directory:       dir,
+		MaxFileSize:     minFileSize,
+		RotationMarkers: true,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+	defer e.Destroy()
+
+	msg := strings.Repeat("x", 1000)
+	for i := 0; i < 25; i++ {
+		e.Info(time.Now(), msg, true)
+	}
+
+	// Both markers of each rotation must be accounted
+	data := readLogFiles(t, dir)
+	if strings.Count(data, rotatedToMarker) < 2 || strings.Count(data, continuedFromMarker) < 2 {
+		t.Fatalf("files were not rotated")
+	}
+	lg := e.(*engine)
+	lg.mtx.Lock()
+	vaultSize := lg.streams[0].currentFileVaultSize
+	lg.mtx.Unlock()
+	if vaultSize != int64(len(data)) {
+		t.Errorf("unexpected vault size. [%v/%v]", vaultSize, len(data))
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	for run := 1; run <= 2; run++ {
+		e, err := NewEngine(Options{
+			Prefix:           "Test",
+			Directory:        dir,
+			MaxFileVaultSize: minFileVaultSize,
+			Truncate:         true,
+		})
+		if err != nil {
+			t.Fatalf("unable to initialize. [%v]", err)
+		}
+		e.Info(now, "Message of run "+strconv.Itoa(run), true)
+		e.Info(now, "Second message of run "+strconv.Itoa(run), true)
+
+		// The discarded content must not be accounted in the vault size
+		lg := e.(*engine)
+		lg.mtx.Lock()
+		vaultSize := lg.streams[0].currentFileVaultSize
+		lg.mtx.Unlock()
+		e.Destroy()
+
+		data := readLogFiles(t, dir)
+		expected := "Message of run " + strconv.Itoa(run) + "\nSecond message of run " + strconv.Itoa(run) + "\n"
+		if data != expected {
+			t.Fatalf("unexpected content. [%q]", data)
+		}
+		if vaultSize != int64(len(expected)) {
+			t.Errorf("unexpected vault size. [%v]", vaultSize)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	dir := t.TempDir()
+
+	// Zstandard requires a registered compressor
+	_, err := NewEngine(Options{
+		Directory:         dir,
+		CompressionFormat: CompressionZstd,
+	})
+	if err == nil {
+		t.Fatalf("unregistered compressor was accepted")
+	}
+	RegisterCompressor(CompressionZstd, func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	})
+	defer RegisterCompressor(CompressionZstd, nil)
+
+	for _, format := range []CompressionFormat{CompressionGzip, CompressionZstd} {
+		dir = t.TempDir()
+
+		e, err2 := NewEngine(Options{
+			Prefix:            "Test",
+			Directory:         dir,
+			MaxFileSize:       minFileSize,
+			MaxFiles:          3,
+			CompressionFormat: format,
+		})
+		if err2 != nil {
+			t.Fatalf("unable to initialize. [%v]", err2)
+		}
+
+		// With the minimum file size, each message causes a rotation
+		msg := strings.Repeat("x", minFileSize/2+1)
+		for i := 0; i < 5; i++ {
+			e.Info(time.Now(), msg, true)
+		}
+		e.Destroy()
+
+		// The rotated files are compressed and counted by the purge, the active one is kept as is
+		files, _ := filepath.Glob(filepath.Join(dir, "*"))
+		if len(files) != 3 || !strings.HasSuffix(files[0], "-003.log"+format.extension()) ||
+			!strings.HasSuffix(files[1], "-004.log"+format.extension()) || !strings.HasSuffix(files[2], "-005.log") {
+			t.Fatalf("unexpected files. [%v]", files)
+		}
+
+		f, err2 := os.Open(files[1])
+		if err2 != nil {
+			t.Fatalf("unable to open file. [%v]", err2)
+		}
+		r, err2 := gzip.NewReader(f)
+		if err2 != nil {
+			t.Fatalf("unable to decompress file. [%v]", err2)
+		}
+		data, err2 := io.ReadAll(r)
+		_ = f.Close()
+		if err2 != nil || string(data) != msg+newLine {
+			t.Errorf("unexpected content. [%v]", err2)
+		}
+
+		// A restarted process continues the index after the compressed files
+		e, err2 = NewEngine(Options{
+			Prefix:            "Test",
+			Directory:         dir,
+			MaxFileSize:       minFileSize,
+			CompressionFormat: format,
+		})
+		if err2 != nil {
+			t.Fatalf("unable to initialize. [%v]", err2)
+		}
+		e.Info(time.Now(), "This is an information message sample", false)
+		e.Destroy()
+		if _, err2 = os.Stat(strings.Replace(files[2], "-005.log", "-006.log", 1)); err2 != nil {
+			t.Errorf("index not continued. [%v]", err2)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	currentLinkSuffix = ".log"
+)
+
+//------------------------------------------------------------------------------
+
+// updateCurrentLink points the symbolic link to the active file. The link is replaced atomically by
+// renaming a temporary one, so readers never find it missing.
+func updateCurrentLink(linkName string, target string) error {
+	tempName := linkName + ".tmp"
+
+	_ = os.Remove(tempName)
+	err := os.Symlink(filepath.Base(target), tempName)
+	if err == nil {
+		err = os.Rename(tempName, linkName)
+		if err != nil {
+			_ = os.Remove(tempName)
+		}
+	}
+	return err
+}
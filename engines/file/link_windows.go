@@ -0,0 +1,29 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	currentLinkSuffix = ".current"
+)
+
+//------------------------------------------------------------------------------
+
+// updateCurrentLink writes the name of the active file into a text file because creating symbolic
+// links on Windows requires special privileges.
+func updateCurrentLink(linkName string, target string) error {
+	tempName := linkName + ".tmp"
+
+	err := os.WriteFile(tempName, []byte(filepath.Base(target)), 0644)
+	if err == nil {
+		err = os.Rename(tempName, linkName)
+		if err != nil {
+			_ = os.Remove(tempName)
+		}
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	tokenPrefix = "{prefix}"
+	tokenDate   = "{date}"
+	tokenTime   = "{time}"
+	tokenIndex  = "{index}"
+	tokenHost   = "{host}"
+	tokenPid    = "{pid}"
+)
+
+//------------------------------------------------------------------------------
+
+var (
+	patternTokenRegex = regexp.MustCompile(`\{[a-z]+\}`)
+)
+
+//------------------------------------------------------------------------------
+
+// validateFilenamePattern checks the pattern only contains known tokens and includes the ones needed to
+// generate a new filename on each rotation.
+func validateFilenamePattern(pattern string, sizeRotation bool) error {
+	for _, token := range patternTokenRegex.FindAllString(pattern, -1) {
+		switch token {
+		case tokenPrefix, tokenDate, tokenTime, tokenIndex, tokenHost, tokenPid:
+		default:
+			return fmt.Errorf("unknown filename pattern token \"%v\"", token)
+		}
+	}
+	if strings.ContainsAny(pattern, `/\`) {
+		return errors.New("filename pattern cannot contain path separators")
+	}
+	if !strings.Contains(pattern, tokenPrefix) {
+		return errors.New("filename pattern must contain the " + tokenPrefix + " token")
+	}
+	if !strings.Contains(pattern, tokenDate) {
+		return errors.New("filename pattern must contain the " + tokenDate + " token")
+	}
+	if sizeRotation && !strings.Contains(pattern, tokenIndex) {
+		return errors.New("filename pattern must contain the " + tokenIndex + " token if the file size is limited")
+	}
+	return nil
+}
+
+// compileFilenamePattern creates an expression that matches the names of the files generated by the pattern
+// for the given prefix.
+func compileFilenamePattern(pattern string, prefix string, host string) *regexp.Regexp {
+	sb := strings.Builder{}
+	_, _ = sb.WriteString("^")
+
+	lastIdx := 0
+	for _, loc := range patternTokenRegex.FindAllStringIndex(pattern, -1) {
+		_, _ = sb.WriteString(regexp.QuoteMeta(strings.ToLower(pattern[lastIdx:loc[0]])))
+		switch pattern[loc[0]:loc[1]] {
+		case tokenPrefix:
+			_, _ = sb.WriteString(regexp.QuoteMeta(strings.ToLower(prefix)))
+		case tokenDate:
+			_, _ = sb.WriteString(`\d{4}-\d{2}-\d{2}`)
+		case tokenTime:
+			_, _ = sb.WriteString(`\d{6}`)
+		case tokenIndex, tokenPid:
+			_, _ = sb.WriteString(`\d+`)
+		case tokenHost:
+			_, _ = sb.WriteString(regexp.QuoteMeta(strings.ToLower(host)))
+		}
+		lastIdx = loc[1]
+	}
+	_, _ = sb.WriteString(regexp.QuoteMeta(strings.ToLower(pattern[lastIdx:])))
+	_, _ = sb.WriteString(`\.log$`)
+
+	return regexp.MustCompile(sb.String())
+}
+
+// formatFilenamePattern returns the base name of a file, without the extension, generated by the pattern.
+func formatFilenamePattern(pattern string, prefix string, host string, pid int, index int, now time.Time) string {
+	r := strings.NewReplacer(
+		tokenPrefix, prefix,
+		tokenDate, now.Format("2006-01-02"),
+		tokenTime, now.Format("150405"),
+		tokenIndex, fmt.Sprintf("%03d", index),
+		tokenHost, host,
+		tokenPid, strconv.Itoa(pid),
+	)
+	return strings.ToLower(r.Replace(pattern))
+}
@@ -0,0 +1,390 @@
+package http
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	nethttp "net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mxmauro/logger/engines"
+	"github.com/mxmauro/resetevent"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = 5 * time.Second
+	defaultTimeout       = 10 * time.Second
+	defaultMaxQueueSize  = 10000
+
+	minRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff = 30 * time.Second
+
+	flushTimeout = 5 * time.Second
+)
+
+//------------------------------------------------------------------------------
+
+// Options specifies the HTTP engine settings to use when it is created.
+type Options struct {
+	// URL of the endpoint that receives the log entries.
+	URL string `json:"url,omitempty"`
+
+	// HTTP method to use. Defaults to POST.
+	Method string `json:"method,omitempty"`
+
+	// Additional headers to send on each request.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Maximum amount of entries to send in a single request. Defaults to 100.
+	BatchSize uint `json:"batchSize,omitempty"`
+
+	// Maximum time to wait before sending an incomplete batch. Defaults to 5 seconds.
+	FlushInterval time.Duration `json:"flushInterval,omitempty"`
+
+	// Timeout of each request. Defaults to 10 seconds.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// Set the maximum amount of entries to keep in memory if the endpoint cannot be reached.
+	// When exceeded, the oldest entries are dropped.
+	MaxQueueSize uint `json:"queueSize,omitempty"`
+
+	// Optional time zone of the timestamps added to text messages instead of the one set in the logger. JSON
+	// messages already carry the timestamp added by the logger.
+	TimeZone *time.Location `json:"-"`
+}
+
+type engine struct {
+	url             string
+	method          string
+	headers         map[string]string
+	batchSize       int
+	flushInterval   time.Duration
+	client          *nethttp.Client
+	timeLayout      string
+	location        *time.Location
+	mtx             sync.Mutex
+	queue           *list.List
+	queueAvailEv    *resetevent.AutoResetEvent
+	queueEmptyEv    *resetevent.ManualResetEvent
+	maxQueueSize    uint
+	lastSendFailed  atomic.Bool
+	shutdownOnce    sync.Once
+	wg              sync.WaitGroup
+	workerCtx       context.Context
+	workerCancelCtx context.CancelFunc
+}
+
+//------------------------------------------------------------------------------
+
+func NewEngine(opts Options) (engines.Engine, error) {
+	if len(opts.URL) == 0 {
+		return nil, errors.New("invalid url")
+	}
+
+	// Create HTTP adapter
+	lg := &engine{
+		url:           opts.URL,
+		method:        strings.ToUpper(opts.Method),
+		headers:       make(map[string]string),
+		batchSize:     int(opts.BatchSize),
+		flushInterval: opts.FlushInterval,
+		client: &nethttp.Client{
+			Timeout: opts.Timeout,
+		},
+		timeLayout:   engines.DefaultTimeLayout,
+		location:     opts.TimeZone,
+		mtx:          sync.Mutex{},
+		queue:        list.New(),
+		queueAvailEv: resetevent.NewAutoResetEvent(),
+		queueEmptyEv: resetevent.NewManualResetEvent(),
+		maxQueueSize: opts.MaxQueueSize,
+		shutdownOnce: sync.Once{},
+		wg:           sync.WaitGroup{},
+	}
+	if len(lg.method) == 0 {
+		lg.method = nethttp.MethodPost
+	}
+	for k, v := range opts.Headers {
+		lg.headers[k] = v
+	}
+	if opts.BatchSize == 0 {
+		lg.batchSize = defaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		lg.flushInterval = defaultFlushInterval
+	}
+	if opts.Timeout <= 0 {
+		lg.client.Timeout = defaultTimeout
+	}
+	if opts.MaxQueueSize == 0 {
+		lg.maxQueueSize = defaultMaxQueueSize
+	}
+
+	lg.queueEmptyEv.Set()
+
+	lg.workerCtx, lg.workerCancelCtx = context.WithCancel(context.Background())
+
+	// Create a background messenger worker
+	lg.wg.Add(1)
+	go lg.messengerWorker()
+
+	// Done
+	return lg, nil
+}
+
+func (lg *engine) Class() string {
+	return "http"
+}
+
+func (lg *engine) Destroy() {
+	lg.shutdownOnce.Do(func() {
+		// Stop worker
+		lg.workerCancelCtx()
+
+		// Wait until exits
+		lg.wg.Wait()
+
+		lg.workerCtx = nil
+		lg.workerCancelCtx = nil
+
+		// Flush queued entries
+		lg.flushQueue()
+		lg.queueEmptyEv.Set()
+	})
+}
+
+func (lg *engine) SetTimeLayout(layout string) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	lg.timeLayout = layout
+}
+
+// Flush sends all the queued entries and waits until they are delivered or the flush timeout expires.
+func (lg *engine) Flush() {
+	ctx, cancelCtx := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancelCtx()
+
+	lg.queueAvailEv.Set()
+	_ = lg.queueEmptyEv.Wait(ctx)
+}
+
+// Healthy returns false if the last attempt to deliver entries failed.
+func (lg *engine) Healthy() bool {
+	return !lg.lastSendFailed.Load()
+}
+
+// QueueDepth returns the amount of entries waiting to be delivered.
+func (lg *engine) QueueDepth() int {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	return lg.queue.Len()
+}
+
+func (lg *engine) Success(now time.Time, msg string, raw bool, sendSuccessAtErrorLogLevel bool) {
+	if sendSuccessAtErrorLogLevel {
+		lg.queueEntry(now, "error", msg, raw)
+	} else {
+		lg.queueEntry(now, "success", msg, raw)
+	}
+}
+
+func (lg *engine) Error(now time.Time, msg string, raw bool) {
+	lg.queueEntry(now, "error", msg, raw)
+}
+
+func (lg *engine) Warning(now time.Time, msg string, raw bool) {
+	lg.queueEntry(now, "warning", msg, raw)
+}
+
+func (lg *engine) Info(now time.Time, msg string, raw bool) {
+	lg.queueEntry(now, "info", msg, raw)
+}
+
+func (lg *engine) Debug(now time.Time, msg string, raw bool) {
+	lg.queueEntry(now, "debug", msg, raw)
+}
+
+func (lg *engine) queueEntry(now time.Time, level string, msg string, raw bool) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	// Build the entry. JSON messages already contain the timestamp and level.
+	if !raw {
+		sb := strings.Builder{}
+
+		ts := engines.FormatTimestamp(engines.InLocation(now, lg.location), lg.timeLayout)
+		if !engines.IsNumericTimeLayout(lg.timeLayout) {
+			ts = strconv.Quote(ts)
+		}
+		b, _ := json.Marshal(msg)
+
+		_, _ = sb.WriteString(`{"timestamp":`)
+		_, _ = sb.WriteString(ts)
+		_, _ = sb.WriteString(`,"level":"`)
+		_, _ = sb.WriteString(level)
+		_, _ = sb.WriteString(`","message":`)
+		_, _ = sb.Write(b)
+		_, _ = sb.WriteString(`}`)
+		msg = sb.String()
+	}
+
+	// Add to queue
+	for uint(lg.queue.Len()) >= lg.maxQueueSize {
+		lg.queue.Remove(lg.queue.Front())
+	}
+	lg.queue.PushBack(msg)
+	lg.queueEmptyEv.Reset()
+
+	// Wake up worker if a batch is complete
+	if lg.queue.Len() >= lg.batchSize {
+		lg.queueAvailEv.Set()
+	}
+}
+
+// peekBatch returns the oldest queued entries without removing them from the queue.
+func (lg *engine) peekBatch() []*list.Element {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	batch := make([]*list.Element, 0, lg.batchSize)
+	for elem := lg.queue.Front(); elem != nil && len(batch) < lg.batchSize; elem = elem.Next() {
+		batch = append(batch, elem)
+	}
+	if len(batch) == 0 {
+		// Signal waiters that all entries were processed
+		lg.queueEmptyEv.Set()
+	}
+	return batch
+}
+
+// removeBatch removes the delivered entries from the queue. Entries dropped meanwhile are ignored.
+func (lg *engine) removeBatch(batch []*list.Element) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	for _, elem := range batch {
+		lg.queue.Remove(elem)
+	}
+}
+
+// The messenger worker do actual entries delivery. The intention of this goroutine, is to
+// avoid halting the routine that sends the message if there are network issues.
+func (lg *engine) messengerWorker() {
+	defer lg.wg.Done()
+
+	ticker := time.NewTicker(lg.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lg.workerCtx.Done():
+			return
+
+		case <-ticker.C:
+		case <-lg.queueAvailEv.WaitCh():
+		}
+
+		backoff := minRetryBackoff
+		for {
+			batch := lg.peekBatch()
+			if len(batch) == 0 {
+				break
+			}
+
+			// Send entries to the endpoint
+			err := lg.send(lg.workerCtx, batch)
+			lg.lastSendFailed.Store(err != nil)
+			if err == nil {
+				lg.removeBatch(batch)
+				backoff = minRetryBackoff
+				continue
+			}
+
+			// On error, wait and retry
+			select {
+			case <-lg.workerCtx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+		}
+	}
+}
+
+func (lg *engine) flushQueue() {
+	ctx, cancelCtx := context.WithDeadline(context.Background(), time.Now().Add(flushTimeout))
+	defer cancelCtx()
+
+	for {
+		batch := lg.peekBatch()
+		if len(batch) == 0 {
+			break // Reached the end
+		}
+
+		// Send entries to the endpoint
+		err := lg.send(ctx, batch)
+		lg.lastSendFailed.Store(err != nil)
+		if err != nil {
+			break // Stop on error
+		}
+		lg.removeBatch(batch)
+	}
+}
+
+func (lg *engine) send(ctx context.Context, batch []*list.Element) error {
+	// Build the JSON array
+	buf := bytes.Buffer{}
+	_ = buf.WriteByte('[')
+	for idx, elem := range batch {
+		if idx > 0 {
+			_ = buf.WriteByte(',')
+		}
+		_, _ = buf.WriteString(elem.Value.(string))
+	}
+	_ = buf.WriteByte(']')
+
+	// Create the request
+	req, err := nethttp.NewRequestWithContext(ctx, lg.method, lg.url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range lg.headers {
+		req.Header.Set(k, v)
+	}
+
+	// Send it
+	resp, err := lg.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("unexpected response status code " + strconv.Itoa(resp.StatusCode))
+	}
+
+	// Done
+	return nil
+}
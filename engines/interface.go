@@ -1,6 +1,8 @@
 package engines
 
 import (
+	"context"
+	"io"
 	"time"
 )
 
@@ -16,6 +18,13 @@ const (
 	LogTypeDebug
 )
 
+// CallerInfo describes the source code location that emitted a message.
+type CallerInfo struct {
+	File     string
+	Line     int
+	Function string
+}
+
 type Engine interface {
 	Destroy()
 
@@ -25,3 +34,77 @@ type Engine interface {
 	Info(now time.Time, msg string, raw bool)
 	Debug(now time.Time, msg string, raw bool)
 }
+
+// Flusher is an optional interface implemented by engines that buffer or queue messages.
+type Flusher interface {
+	Flush()
+}
+
+// Drainer is an optional interface implemented by engines that queue messages, for graceful shutdowns.
+type Drainer interface {
+	// Drain stops accepting new messages and waits until the queued ones are delivered or the context
+	// expires. New messages are accepted again when it returns. It returns the amount of messages that were
+	// not delivered.
+	Drain(ctx context.Context) (int, error)
+}
+
+// TimeLayoutSetter is an optional interface implemented by engines that format timestamps. The logger
+// calls it when the engine is added and every time the layout changes.
+type TimeLayoutSetter interface {
+	SetTimeLayout(layout string)
+}
+
+// TimePrecisionSetter is an optional interface implemented by engines that use a fixed timestamp format
+// instead of the logger layout. The logger calls it when the engine is added with the amount of fractional
+// second digits to use.
+type TimePrecisionSetter interface {
+	SetTimePrecision(digits int)
+}
+
+// TrailingZerosTrimmer is an optional interface implemented by engines that use a fixed timestamp format.
+// The logger calls it when the engine is added if the trailing zeros of the fractional seconds must be
+// omitted.
+type TrailingZerosTrimmer interface {
+	SetTrimTrailingZeros(trim bool)
+}
+
+// CallerAware is an optional interface implemented by engines that want to receive the caller information
+// as a separate item. If the logger is set to include it, this method is called instead of the level ones
+// and the message does not contain the caller appended to it.
+type CallerAware interface {
+	LogWithCaller(logType LogType, now time.Time, msg string, raw bool, caller *CallerInfo)
+}
+
+// StreamWriter is an optional interface implemented by engines that write to shared streams, like the
+// standard output. The logger uses it to detect engines that would print the same message twice.
+type StreamWriter interface {
+	Streams() []io.Writer
+}
+
+// ErrorReporter is an optional interface implemented by engines that keep track of the last error found
+// while delivering messages.
+type ErrorReporter interface {
+	LastError() (error, time.Time)
+}
+
+// HealthReporter is an optional interface implemented by engines that deliver messages over the network,
+// so their status can be checked, for example, from a readiness probe.
+type HealthReporter interface {
+	// Healthy returns false if the last attempt to deliver messages failed.
+	Healthy() bool
+
+	// QueueDepth returns the amount of messages waiting to be delivered.
+	QueueDepth() int
+}
+
+// DropCounter is an optional interface implemented by engines that discard messages when their queue is full.
+type DropCounter interface {
+	// DroppedMessages returns the amount of messages discarded because the queue was full.
+	DroppedMessages() uint64
+}
+
+// Validator is an optional interface implemented by engines that can check their configuration, for
+// example, that a directory is writable or a server is reachable, without delivering messages.
+type Validator interface {
+	Validate(ctx context.Context) error
+}
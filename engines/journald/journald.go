@@ -0,0 +1,294 @@
+package journald
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mxmauro/logger/engines"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	priorityError   = 3
+	priorityWarning = 4
+	priorityNotice  = 5
+	priorityInfo    = 6
+	priorityDebug   = 7
+
+	// DefaultSocketPath is the location of the systemd journal native protocol socket.
+	DefaultSocketPath = "/run/systemd/journal/socket"
+)
+
+//------------------------------------------------------------------------------
+
+// ErrNotAvailable is returned when the journal socket does not exist, for example, on hosts without systemd.
+var ErrNotAvailable = errors.New("journald socket not available")
+
+//------------------------------------------------------------------------------
+
+// Options specifies the journald settings to use when it is created.
+type Options struct {
+	// Application name to use as the syslog identifier. Defaults to the binary name.
+	AppName string `json:"appName,omitempty"`
+
+	// Path to the journal socket. Defaults to DefaultSocketPath.
+	SocketPath string `json:"socketPath,omitempty"`
+
+	// Default 128-bit message identifier, in hexadecimal form, to attach to every message.
+	MessageID string `json:"messageId,omitempty"`
+
+	// Optional message identifiers to attach to the messages of a specific type. They override MessageID.
+	MessageIDs MessageIDs `json:"messageIds,omitempty"`
+}
+
+// MessageIDs specifies the message identifier to use for each message type.
+type MessageIDs struct {
+	Error   string `json:"error,omitempty"`
+	Warning string `json:"warning,omitempty"`
+	Info    string `json:"info,omitempty"`
+	Debug   string `json:"debug,omitempty"`
+	Success string `json:"success,omitempty"`
+}
+
+type engine struct {
+	conn       net.Conn
+	appName    string
+	messageIDs [5]string
+}
+
+//------------------------------------------------------------------------------
+
+func NewEngine(opts Options) (engines.Engine, error) {
+	var err error
+
+	if len(opts.AppName) == 0 {
+		// If no application name was given, use the base name of the executable.
+		opts.AppName, err = os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		opts.AppName = filepath.Base(opts.AppName)
+
+		extLen := len(filepath.Ext(opts.AppName))
+		if len(opts.AppName) > extLen {
+			opts.AppName = opts.AppName[:(len(opts.AppName) - extLen)]
+		}
+	}
+	if len(opts.SocketPath) == 0 {
+		opts.SocketPath = DefaultSocketPath
+	}
+
+	// Create journald adapter
+	lg := &engine{
+		appName: opts.AppName,
+	}
+
+	// Validate and store message identifiers
+	for idx, id := range []string{
+		opts.MessageIDs.Success, opts.MessageIDs.Error, opts.MessageIDs.Warning,
+		opts.MessageIDs.Info, opts.MessageIDs.Debug,
+	} {
+		if len(id) == 0 {
+			id = opts.MessageID
+		}
+		if len(id) > 0 {
+			lg.messageIDs[idx], err = normalizeMessageID(id)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Check the journal is present
+	_, err = os.Stat(opts.SocketPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotAvailable
+		}
+		return nil, err
+	}
+
+	// Connect to the journal
+	lg.conn, err = net.DialUnix("unixgram", nil, &net.UnixAddr{
+		Name: opts.SocketPath,
+		Net:  "unixgram",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Done
+	return lg, nil
+}
+
+func (lg *engine) Class() string {
+	return "journald"
+}
+
+func (lg *engine) Destroy() {
+	if lg.conn != nil {
+		_ = lg.conn.Close()
+		lg.conn = nil
+	}
+}
+
+func (lg *engine) Success(_ time.Time, msg string, raw bool, sendSuccessAtErrorLogLevel bool) {
+	if sendSuccessAtErrorLogLevel {
+		lg.send(engines.LogTypeSuccess, priorityError, msg, raw, nil)
+	} else {
+		lg.send(engines.LogTypeSuccess, priorityNotice, msg, raw, nil)
+	}
+}
+
+func (lg *engine) Error(_ time.Time, msg string, raw bool) {
+	lg.send(engines.LogTypeError, priorityError, msg, raw, nil)
+}
+
+func (lg *engine) Warning(_ time.Time, msg string, raw bool) {
+	lg.send(engines.LogTypeWarning, priorityWarning, msg, raw, nil)
+}
+
+func (lg *engine) Info(_ time.Time, msg string, raw bool) {
+	lg.send(engines.LogTypeInfo, priorityInfo, msg, raw, nil)
+}
+
+func (lg *engine) Debug(_ time.Time, msg string, raw bool) {
+	lg.send(engines.LogTypeDebug, priorityDebug, msg, raw, nil)
+}
+
+// LogWithCaller sends the message along with the CODE_FILE, CODE_LINE and CODE_FUNC fields.
+func (lg *engine) LogWithCaller(logType engines.LogType, _ time.Time, msg string, raw bool, caller *engines.CallerInfo) {
+	switch logType {
+	case engines.LogTypeSuccess:
+		lg.send(logType, priorityNotice, msg, raw, caller)
+	case engines.LogTypeError:
+		lg.send(logType, priorityError, msg, raw, caller)
+	case engines.LogTypeWarning:
+		lg.send(logType, priorityWarning, msg, raw, caller)
+	case engines.LogTypeInfo:
+		lg.send(logType, priorityInfo, msg, raw, caller)
+	case engines.LogTypeDebug:
+		lg.send(logType, priorityDebug, msg, raw, caller)
+	}
+}
+
+func (lg *engine) send(logType engines.LogType, priority int, msg string, raw bool, caller *engines.CallerInfo) {
+	sb := strings.Builder{}
+
+	appendField(&sb, "PRIORITY", strconv.Itoa(priority))
+	appendField(&sb, "SYSLOG_IDENTIFIER", lg.appName)
+	if id := lg.messageIDs[logType]; len(id) > 0 {
+		appendField(&sb, "MESSAGE_ID", id)
+	}
+	if caller != nil {
+		appendField(&sb, "CODE_FILE", caller.File)
+		appendField(&sb, "CODE_LINE", strconv.Itoa(caller.Line))
+		appendField(&sb, "CODE_FUNC", caller.Function)
+	}
+	appendField(&sb, "MESSAGE", strings.TrimSuffix(msg, "\n"))
+	if raw {
+		appendJSONFields(&sb, msg)
+	}
+
+	_, _ = lg.conn.Write([]byte(sb.String()))
+}
+
+// appendField encodes a field using the journal native protocol. Values containing new line characters
+// are written in the binary-safe form.
+func appendField(sb *strings.Builder, name string, value string) {
+	_, _ = sb.WriteString(name)
+	if strings.IndexByte(value, '\n') < 0 {
+		_ = sb.WriteByte('=')
+		_, _ = sb.WriteString(value)
+	} else {
+		var size [8]byte
+
+		binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+		_ = sb.WriteByte('\n')
+		_, _ = sb.Write(size[:])
+		_, _ = sb.WriteString(value)
+	}
+	_ = sb.WriteByte('\n')
+}
+
+// appendJSONFields adds the top-level keys of a JSON object as journal fields. Keys are converted to valid
+// field names and the ones that would replace the fields set by the engine are skipped.
+func appendJSONFields(sb *strings.Builder, msg string) {
+	obj := make(map[string]json.RawMessage)
+	if json.Unmarshal([]byte(msg), &obj) != nil {
+		return
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		name := fieldName(k)
+		if len(name) == 0 || isReservedField(name) {
+			continue
+		}
+
+		var value string
+		if json.Unmarshal(obj[k], &value) != nil {
+			value = string(obj[k]) // Not a string, use the JSON representation
+		}
+		appendField(sb, name, value)
+	}
+}
+
+// fieldName converts a key into a valid journal field name, which can only contain uppercase letters,
+// digits and underscores, and cannot start with an underscore or a digit.
+func fieldName(key string) string {
+	b := make([]byte, 0, len(key))
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			b = append(b, c-'a'+'A')
+		case (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9'):
+			b = append(b, c)
+		default:
+			b = append(b, '_')
+		}
+	}
+	name := strings.TrimLeft(string(b), "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+func isReservedField(name string) bool {
+	switch name {
+	case "MESSAGE", "MESSAGE_ID", "PRIORITY", "SYSLOG_IDENTIFIER", "CODE_FILE", "CODE_LINE", "CODE_FUNC":
+		return true
+	}
+	return false
+}
+
+// normalizeMessageID verifies the identifier is a 128-bit hexadecimal value, optionally in UUID form, and
+// returns it in the lowercase form journald uses.
+func normalizeMessageID(id string) (string, error) {
+	s := strings.ReplaceAll(id, "-", "")
+	if len(s) != 32 {
+		return "", errors.New("invalid journald message id \"" + id + "\"")
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", errors.New("invalid journald message id \"" + id + "\"")
+	}
+	return strings.ToLower(s), nil
+}
@@ -0,0 +1,459 @@
+package kafka
+
+import (
+	"container/list"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mxmauro/logger/engines"
+	"github.com/mxmauro/resetevent"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	defaultBatchSize    = 100
+	defaultLinger       = 100 * time.Millisecond
+	defaultTimeout      = 10 * time.Second
+	defaultMaxQueueSize = 10000
+
+	minRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff = 30 * time.Second
+
+	flushTimeout = 5 * time.Second
+
+	levelSuccess = "success"
+	levelError   = "error"
+	levelWarning = "warning"
+	levelInfo    = "info"
+	levelDebug   = "debug"
+)
+
+//------------------------------------------------------------------------------
+
+// Options specifies the Kafka engine settings to use when it is created.
+type Options struct {
+	// Addresses of the bootstrap brokers, as host:port.
+	Brokers []string `json:"brokers,omitempty"`
+
+	// Topic to produce the messages to.
+	Topic string `json:"topic,omitempty"`
+
+	// Key of the messages, used to select the partition. Defaults to the host name.
+	Key string `json:"key,omitempty"`
+
+	// Optional name of a top-level field of JSON messages to use as the key instead. Messages without it use
+	// the default key.
+	KeyField string `json:"keyField,omitempty"`
+
+	// Wait until all the in-sync replicas receive the messages instead of only the partition leader.
+	WaitForAll bool `json:"waitForAll,omitempty"`
+
+	// Use a TLS connection.
+	UseTls bool `json:"useTls,omitempty"`
+
+	// An optional pointer to a tls.Config object to provide the TLS configuration for use. Implies UseTls.
+	TlsConfig *tls.Config `json:"-"`
+
+	// Optional SASL credentials.
+	SASL *SASLOptions `json:"sasl,omitempty"`
+
+	// Maximum amount of messages to send in a single request. Defaults to 100.
+	BatchSize uint `json:"batchSize,omitempty"`
+
+	// Maximum time to wait before sending an incomplete batch. Defaults to 100 milliseconds.
+	Linger time.Duration `json:"linger,omitempty"`
+
+	// Timeout of each request. Defaults to 10 seconds.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// Set the maximum amount of messages to keep in memory if the brokers cannot be reached.
+	// When exceeded, the oldest messages are dropped.
+	MaxQueueSize uint `json:"queueSize,omitempty"`
+
+	// Optional time zone of the timestamps added to text messages instead of the one set in the logger. JSON
+	// messages already carry the timestamp added by the logger.
+	TimeZone *time.Location `json:"-"`
+
+	// An optional function to establish the connections instead of the default dialer.
+	DialFunc func(ctx context.Context, network, addr string) (net.Conn, error) `json:"-"`
+}
+
+type engine struct {
+	producer        *producer
+	key             []byte
+	keyField        string
+	batchSize       int
+	linger          time.Duration
+	timeLayout      string
+	location        *time.Location
+	mtx             sync.Mutex
+	queue           *list.List
+	queueAvailEv    *resetevent.AutoResetEvent
+	queueEmptyEv    *resetevent.ManualResetEvent
+	maxQueueSize    uint
+	dropped         atomic.Uint64
+	lastSendFailed  atomic.Bool
+	shutdownOnce    sync.Once
+	wg              sync.WaitGroup
+	workerCtx       context.Context
+	workerCancelCtx context.CancelFunc
+}
+
+//------------------------------------------------------------------------------
+
+func NewEngine(opts Options) (engines.Engine, error) {
+	if len(opts.Brokers) == 0 {
+		return nil, errors.New("no brokers specified")
+	}
+	for _, broker := range opts.Brokers {
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			return nil, errors.New("invalid broker address \"" + broker + "\"")
+		}
+	}
+	if len(opts.Topic) == 0 {
+		return nil, errors.New("invalid topic")
+	}
+	if len(opts.Key) == 0 {
+		opts.Key, _ = os.Hostname()
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.DialFunc == nil {
+		dialer := &net.Dialer{}
+		opts.DialFunc = dialer.DialContext
+	}
+
+	// Create Kafka adapter
+	lg := &engine{
+		location: opts.TimeZone,
+		producer: &producer{
+			bootstrap: opts.Brokers,
+			topic:     opts.Topic,
+			timeout:   opts.Timeout,
+			acks:      1,
+			dialFunc:  opts.DialFunc,
+			conns:     make(map[int32]*brokerConn),
+		},
+		key:          []byte(opts.Key),
+		keyField:     opts.KeyField,
+		batchSize:    int(opts.BatchSize),
+		linger:       opts.Linger,
+		mtx:          sync.Mutex{},
+		queue:        list.New(),
+		queueAvailEv: resetevent.NewAutoResetEvent(),
+		queueEmptyEv: resetevent.NewManualResetEvent(),
+		maxQueueSize: opts.MaxQueueSize,
+		shutdownOnce: sync.Once{},
+		wg:           sync.WaitGroup{},
+	}
+	if opts.WaitForAll {
+		lg.producer.acks = -1
+	}
+	if opts.TlsConfig != nil {
+		lg.producer.tlsConfig = opts.TlsConfig
+	} else if opts.UseTls {
+		lg.producer.tlsConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	if opts.SASL != nil {
+		sasl := *opts.SASL
+		if len(sasl.Mechanism) == 0 {
+			sasl.Mechanism = SASLMechanismPlain
+		}
+		if _, err := newSASLExchange(&sasl); err != nil {
+			return nil, err
+		}
+		lg.producer.sasl = &sasl
+	}
+	if opts.BatchSize == 0 {
+		lg.batchSize = defaultBatchSize
+	}
+	if opts.Linger <= 0 {
+		lg.linger = defaultLinger
+	}
+	if opts.MaxQueueSize == 0 {
+		lg.maxQueueSize = defaultMaxQueueSize
+	}
+
+	lg.queueEmptyEv.Set()
+
+	lg.workerCtx, lg.workerCancelCtx = context.WithCancel(context.Background())
+
+	// Create a background messenger worker
+	lg.wg.Add(1)
+	go lg.messengerWorker()
+
+	// Done
+	return lg, nil
+}
+
+func (lg *engine) Class() string {
+	return "kafka"
+}
+
+func (lg *engine) Destroy() {
+	lg.shutdownOnce.Do(func() {
+		// Stop worker
+		lg.workerCancelCtx()
+
+		// Wait until exits
+		lg.wg.Wait()
+
+		lg.workerCtx = nil
+		lg.workerCancelCtx = nil
+
+		// Flush queued messages
+		lg.flushQueue()
+		lg.queueEmptyEv.Set()
+
+		lg.producer.close()
+	})
+}
+
+func (lg *engine) SetTimeLayout(layout string) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	lg.timeLayout = layout
+}
+
+// Flush sends all the queued messages and waits until they are delivered or the flush timeout expires.
+func (lg *engine) Flush() {
+	ctx, cancelCtx := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancelCtx()
+
+	lg.queueAvailEv.Set()
+	_ = lg.queueEmptyEv.Wait(ctx)
+}
+
+// Healthy returns false if the last attempt to deliver messages failed.
+func (lg *engine) Healthy() bool {
+	return !lg.lastSendFailed.Load()
+}
+
+// QueueDepth returns the amount of messages waiting to be delivered.
+func (lg *engine) QueueDepth() int {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	return lg.queue.Len()
+}
+
+// DroppedMessages returns the amount of messages discarded because the queue was full.
+func (lg *engine) DroppedMessages() uint64 {
+	return lg.dropped.Load()
+}
+
+func (lg *engine) Success(now time.Time, msg string, raw bool, sendSuccessAtErrorLogLevel bool) {
+	if sendSuccessAtErrorLogLevel {
+		lg.queueMessage(now, levelError, msg, raw)
+	} else {
+		lg.queueMessage(now, levelSuccess, msg, raw)
+	}
+}
+
+func (lg *engine) Error(now time.Time, msg string, raw bool) {
+	lg.queueMessage(now, levelError, msg, raw)
+}
+
+func (lg *engine) Warning(now time.Time, msg string, raw bool) {
+	lg.queueMessage(now, levelWarning, msg, raw)
+}
+
+func (lg *engine) Info(now time.Time, msg string, raw bool) {
+	lg.queueMessage(now, levelInfo, msg, raw)
+}
+
+func (lg *engine) Debug(now time.Time, msg string, raw bool) {
+	lg.queueMessage(now, levelDebug, msg, raw)
+}
+
+func (lg *engine) queueMessage(now time.Time, level string, msg string, raw bool) {
+	r := record{
+		key:       lg.key,
+		timestamp: now,
+	}
+	if raw && len(lg.keyField) > 0 {
+		r.key = lg.keyFromMessage(msg)
+	}
+
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	// Build the message. JSON messages already contain the timestamp and level.
+	if !raw {
+		sb := strings.Builder{}
+
+		ts := engines.FormatTimestamp(engines.InLocation(now, lg.location), lg.timeLayout)
+		if !engines.IsNumericTimeLayout(lg.timeLayout) {
+			ts = strconv.Quote(ts)
+		}
+		b, _ := json.Marshal(msg)
+
+		_, _ = sb.WriteString(`{"timestamp":`)
+		_, _ = sb.WriteString(ts)
+		_, _ = sb.WriteString(`,"level":"`)
+		_, _ = sb.WriteString(level)
+		_, _ = sb.WriteString(`","message":`)
+		_, _ = sb.Write(b)
+		_, _ = sb.WriteString(`}`)
+		msg = sb.String()
+	}
+	r.value = []byte(msg)
+
+	// Add to queue
+	for uint(lg.queue.Len()) >= lg.maxQueueSize {
+		lg.queue.Remove(lg.queue.Front())
+		lg.dropped.Add(1)
+	}
+	lg.queue.PushBack(&r)
+	lg.queueEmptyEv.Reset()
+
+	// Wake up worker if a batch is complete
+	if lg.queue.Len() >= lg.batchSize {
+		lg.queueAvailEv.Set()
+	}
+}
+
+// keyFromMessage returns the value of the key field of a JSON message, or the default key if not present.
+func (lg *engine) keyFromMessage(msg string) []byte {
+	obj := make(map[string]json.RawMessage)
+	if json.Unmarshal([]byte(msg), &obj) == nil {
+		if v, ok := obj[lg.keyField]; ok {
+			var s string
+
+			if json.Unmarshal(v, &s) == nil {
+				return []byte(s)
+			}
+			return v
+		}
+	}
+	return lg.key
+}
+
+// peekBatch returns the oldest queued messages without removing them from the queue.
+func (lg *engine) peekBatch() []*list.Element {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	batch := make([]*list.Element, 0, lg.batchSize)
+	for elem := lg.queue.Front(); elem != nil && len(batch) < lg.batchSize; elem = elem.Next() {
+		batch = append(batch, elem)
+	}
+	if len(batch) == 0 {
+		// Signal waiters that all messages were processed
+		lg.queueEmptyEv.Set()
+	}
+	return batch
+}
+
+// removeBatch removes the delivered messages from the queue. Messages dropped meanwhile are ignored.
+func (lg *engine) removeBatch(batch []*list.Element) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	for _, elem := range batch {
+		lg.queue.Remove(elem)
+	}
+}
+
+// The messenger worker do actual messages delivery. The intention of this goroutine, is to
+// avoid halting the routine that sends the message if there are network issues.
+func (lg *engine) messengerWorker() {
+	defer lg.wg.Done()
+
+	ticker := time.NewTicker(lg.linger)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lg.workerCtx.Done():
+			return
+
+		case <-ticker.C:
+		case <-lg.queueAvailEv.WaitCh():
+		}
+
+		backoff := minRetryBackoff
+		for {
+			batch := lg.peekBatch()
+			if len(batch) == 0 {
+				break
+			}
+
+			// Send messages to the brokers
+			err := lg.send(lg.workerCtx, batch)
+			lg.lastSendFailed.Store(err != nil)
+			if err == nil {
+				lg.removeBatch(batch)
+				backoff = minRetryBackoff
+				continue
+			}
+
+			// On error, wait and retry
+			select {
+			case <-lg.workerCtx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+		}
+	}
+}
+
+func (lg *engine) flushQueue() {
+	ctx, cancelCtx := context.WithDeadline(context.Background(), time.Now().Add(flushTimeout))
+	defer cancelCtx()
+
+	for {
+		batch := lg.peekBatch()
+		if len(batch) == 0 {
+			break // Reached the end
+		}
+
+		// Send messages to the brokers
+		err := lg.send(ctx, batch)
+		lg.lastSendFailed.Store(err != nil)
+		if err != nil {
+			break // Stop on error
+		}
+		lg.removeBatch(batch)
+	}
+}
+
+func (lg *engine) send(ctx context.Context, batch []*list.Element) error {
+	partitions, err := lg.producer.partitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Assign the messages to partitions
+	records := make(map[int32][]record)
+	for _, elem := range batch {
+		r := elem.Value.(*record)
+		partition := int32(partitionForKey(r.key, partitions))
+		records[partition] = append(records[partition], *r)
+	}
+
+	return lg.producer.produce(ctx, records)
+}
@@ -0,0 +1,458 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	clientID = "mxmauro-logger"
+
+	maxResponseSize = 64 * 1048576
+)
+
+//------------------------------------------------------------------------------
+
+// BrokerError is returned when a broker rejects a request.
+type BrokerError struct {
+	Code    int16
+	Message string
+}
+
+// producer sends record batches to the partition leaders. It is not safe for concurrent use.
+type producer struct {
+	bootstrap   []string
+	topic       string
+	tlsConfig   *tls.Config
+	sasl        *SASLOptions
+	timeout     time.Duration
+	acks        int16
+	dialFunc    func(ctx context.Context, network, addr string) (net.Conn, error)
+	conns       map[int32]*brokerConn
+	brokerAddrs map[int32]string
+	leaders     []int32
+}
+
+type brokerConn struct {
+	conn          net.Conn
+	correlationID int32
+}
+
+//------------------------------------------------------------------------------
+
+func (e *BrokerError) Error() string {
+	s := "kafka error " + strconv.Itoa(int(e.Code))
+	if len(e.Message) > 0 {
+		s += ": " + e.Message
+	}
+	return s
+}
+
+func (p *producer) close() {
+	for id, bc := range p.conns {
+		_ = bc.conn.Close()
+		delete(p.conns, id)
+	}
+}
+
+// produce sends the records, already assigned to partitions, to their leaders. On failure, the whole set
+// must be sent again, so records may be delivered more than once.
+func (p *producer) produce(ctx context.Context, records map[int32][]record) error {
+	// Group the partitions by leader
+	byLeader := make(map[int32][]int32)
+	for partition := range records {
+		leader := p.leaders[partition]
+		if leader < 0 {
+			p.leaders = nil
+			return errors.New("leader not available for partition " + strconv.Itoa(int(partition)))
+		}
+		byLeader[leader] = append(byLeader[leader], partition)
+	}
+
+	for leader, partitions := range byLeader {
+		// Build the request
+		e := encoder{}
+		e.nullString() // Transactional ID
+		e.int16(p.acks)
+		e.int32(int32(p.timeout.Milliseconds()))
+		e.int32(1)
+		e.string(p.topic)
+		e.int32(int32(len(partitions)))
+		for _, partition := range partitions {
+			e.int32(partition)
+			e.bytes(encodeRecordBatch(records[partition]))
+		}
+
+		// Send it
+		bc, err := p.getConn(ctx, leader)
+		if err == nil {
+			var resp []byte
+
+			resp, err = p.roundTrip(ctx, leader, bc, apiKeyProduce, apiVersionProduce, e.b)
+			if err == nil {
+				err = parseProduceResponse(resp)
+			}
+		}
+		if err != nil {
+			var brokerErr *BrokerError
+
+			if !errors.As(err, &brokerErr) || isMetadataError(brokerErr.Code) {
+				p.leaders = nil
+			}
+			return err
+		}
+	}
+
+	// Done
+	return nil
+}
+
+// partitions returns the amount of partitions of the topic, refreshing the cluster metadata if needed.
+func (p *producer) partitions(ctx context.Context) (int, error) {
+	if len(p.leaders) == 0 {
+		err := p.refreshMetadata(ctx)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p.leaders), nil
+}
+
+// refreshMetadata retrieves the brokers and the partition leaders of the topic from the first broker that
+// answers, trying the known ones first and then the bootstrap list.
+func (p *producer) refreshMetadata(ctx context.Context) error {
+	var lastErr error
+
+	e := encoder{}
+	e.int32(1)
+	e.string(p.topic)
+	e.int8(1) // Allow auto topic creation
+
+	candidates := make([]int32, 0, len(p.conns)+len(p.bootstrap))
+	for id := range p.conns {
+		candidates = append(candidates, id)
+	}
+	for idx := range p.bootstrap {
+		candidates = append(candidates, bootstrapID(idx))
+	}
+
+	for _, id := range candidates {
+		bc, err := p.getConn(ctx, id)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp, err := p.roundTrip(ctx, id, bc, apiKeyMetadata, apiVersionMetadata, e.b)
+		if err == nil {
+			err = p.parseMetadataResponse(resp)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		// Done
+		return nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no brokers available")
+	}
+	return lastErr
+}
+
+func (p *producer) parseMetadataResponse(resp []byte) error {
+	d := decoder{
+		b: resp,
+	}
+
+	_ = d.int32() // Throttle time
+	brokerAddrs := make(map[int32]string)
+	for count := d.arrayLen(); count > 0; count-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		_ = d.string() // Rack
+		brokerAddrs[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	_ = d.string() // Cluster ID
+	_ = d.int32()  // Controller ID
+
+	var leaders []int32
+	topicErr := int16(0)
+	for count := d.arrayLen(); count > 0; count-- {
+		errCode := d.int16()
+		name := d.string()
+		_ = d.int8() // Is internal
+		partitions := make(map[int32]int32)
+		maxPartition := int32(-1)
+		for pCount := d.arrayLen(); pCount > 0; pCount-- {
+			_ = d.int16() // Error code
+			partition := d.int32()
+			partitions[partition] = d.int32()
+			if partition > maxPartition {
+				maxPartition = partition
+			}
+			for rCount := d.arrayLen(); rCount > 0; rCount-- {
+				_ = d.int32() // Replica
+			}
+			for iCount := d.arrayLen(); iCount > 0; iCount-- {
+				_ = d.int32() // In-sync replica
+			}
+		}
+		if name != p.topic {
+			continue
+		}
+
+		topicErr = errCode
+		leaders = make([]int32, maxPartition+1)
+		for idx := range leaders {
+			leaders[idx] = -1
+		}
+		for partition, leader := range partitions {
+			if partition >= 0 {
+				leaders[partition] = leader
+			}
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if topicErr != 0 {
+		return &BrokerError{
+			Code:    topicErr,
+			Message: "unable to get the topic metadata",
+		}
+	}
+	if len(leaders) == 0 {
+		return errors.New("topic not found")
+	}
+
+	// Close connections to brokers that left the cluster
+	for id, bc := range p.conns {
+		if id >= 0 {
+			if addr, ok := brokerAddrs[id]; !ok || addr != p.brokerAddrs[id] {
+				_ = bc.conn.Close()
+				delete(p.conns, id)
+			}
+		}
+	}
+	p.brokerAddrs = brokerAddrs
+	p.leaders = leaders
+
+	// Done
+	return nil
+}
+
+func parseProduceResponse(resp []byte) error {
+	d := decoder{
+		b: resp,
+	}
+
+	for count := d.arrayLen(); count > 0; count-- {
+		_ = d.string() // Topic
+		for pCount := d.arrayLen(); pCount > 0; pCount-- {
+			partition := d.int32()
+			errCode := d.int16()
+			_ = d.int64() // Base offset
+			_ = d.int64() // Log append time
+			if errCode != 0 && d.err == nil {
+				return &BrokerError{
+					Code:    errCode,
+					Message: "unable to produce to partition " + strconv.Itoa(int(partition)),
+				}
+			}
+		}
+	}
+	return d.err
+}
+
+// getConn returns the connection to the broker, establishing it if needed. Bootstrap brokers use
+// negative identifiers.
+func (p *producer) getConn(ctx context.Context, id int32) (*brokerConn, error) {
+	var addr string
+
+	if bc, ok := p.conns[id]; ok {
+		return bc, nil
+	}
+
+	if id < 0 {
+		addr = p.bootstrap[-id-1]
+	} else {
+		var ok bool
+
+		addr, ok = p.brokerAddrs[id]
+		if !ok {
+			return nil, errors.New("unknown broker " + strconv.Itoa(int(id)))
+		}
+	}
+
+	dialCtx, cancelDialCtx := context.WithTimeout(ctx, p.timeout)
+	defer cancelDialCtx()
+
+	conn, err := p.dialFunc(dialCtx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if p.tlsConfig != nil {
+		tlsConfig := p.tlsConfig
+		if len(tlsConfig.ServerName) == 0 {
+			host, _, _ := net.SplitHostPort(addr)
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = host
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		err = tlsConn.HandshakeContext(dialCtx)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	bc := &brokerConn{
+		conn: conn,
+	}
+	p.conns[id] = bc
+
+	if p.sasl != nil {
+		err = p.authenticate(ctx, id, bc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Done
+	return bc, nil
+}
+
+func (p *producer) authenticate(ctx context.Context, id int32, bc *brokerConn) error {
+	var challenge []byte
+
+	x, err := newSASLExchange(p.sasl)
+	if err != nil {
+		p.closeConn(id)
+		return err
+	}
+
+	// Select the mechanism
+	e := encoder{}
+	e.string(p.sasl.Mechanism)
+	resp, err := p.roundTrip(ctx, id, bc, apiKeySaslHandshake, apiVersionSaslHandshake, e.b)
+	if err != nil {
+		return err
+	}
+	d := decoder{
+		b: resp,
+	}
+	if errCode := d.int16(); errCode != 0 {
+		p.closeConn(id)
+		return &BrokerError{
+			Code:    errCode,
+			Message: "SASL mechanism not enabled",
+		}
+	}
+
+	// Run the exchange
+	for !x.done() {
+		msg, err2 := x.next(challenge)
+		if err2 != nil {
+			p.closeConn(id)
+			return err2
+		}
+		if msg == nil {
+			break
+		}
+
+		e = encoder{}
+		e.bytes(msg)
+		resp, err = p.roundTrip(ctx, id, bc, apiKeySaslAuthenticate, apiVersionSaslAuthenticate, e.b)
+		if err != nil {
+			return err
+		}
+		d = decoder{
+			b: resp,
+		}
+		errCode := d.int16()
+		errMsg := d.string()
+		challenge = d.bytes()
+		if d.err != nil {
+			p.closeConn(id)
+			return d.err
+		}
+		if errCode != 0 {
+			p.closeConn(id)
+			return &BrokerError{
+				Code:    errCode,
+				Message: errMsg,
+			}
+		}
+	}
+
+	// Done
+	return nil
+}
+
+// roundTrip sends a request and waits for its response. On network errors, the connection is closed.
+func (p *producer) roundTrip(
+	ctx context.Context, id int32, bc *brokerConn, apiKey int16, apiVersion int16, body []byte,
+) ([]byte, error) {
+	bc.correlationID += 1
+	req := encodeRequest(apiKey, apiVersion, bc.correlationID, clientID, body)
+
+	deadline := time.Now().Add(p.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = bc.conn.SetDeadline(deadline)
+
+	_, err := bc.conn.Write(req)
+	if err == nil {
+		var header [8]byte
+
+		_, err = io.ReadFull(bc.conn, header[:])
+		if err == nil {
+			size := binary.BigEndian.Uint32(header[:4])
+			if size < 4 || size > maxResponseSize {
+				err = errors.New("invalid response size")
+			} else if int32(binary.BigEndian.Uint32(header[4:])) != bc.correlationID {
+				err = errors.New("unexpected correlation id")
+			} else {
+				resp := make([]byte, size-4)
+				_, err = io.ReadFull(bc.conn, resp)
+				if err == nil {
+					return resp, nil
+				}
+			}
+		}
+	}
+
+	p.closeConn(id)
+	return nil, err
+}
+
+func (p *producer) closeConn(id int32) {
+	if bc, ok := p.conns[id]; ok {
+		_ = bc.conn.Close()
+		delete(p.conns, id)
+	}
+}
+
+func bootstrapID(idx int) int32 {
+	return int32(-idx - 1)
+}
+
+func isMetadataError(code int16) bool {
+	switch code {
+	case errUnknownTopicOrPartition, errLeaderNotAvailable, errNotLeaderForPartition:
+		return true
+	}
+	return false
+}
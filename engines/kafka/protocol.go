@@ -0,0 +1,282 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	apiKeyProduce          = 0
+	apiKeyMetadata         = 3
+	apiKeySaslHandshake    = 17
+	apiKeySaslAuthenticate = 36
+
+	apiVersionProduce          = 3
+	apiVersionMetadata         = 4
+	apiVersionSaslHandshake    = 1
+	apiVersionSaslAuthenticate = 0
+
+	recordBatchMagic = 2
+
+	// Error codes that require refreshing the cluster metadata
+	errUnknownTopicOrPartition = 3
+	errLeaderNotAvailable      = 5
+	errNotLeaderForPartition   = 6
+)
+
+//------------------------------------------------------------------------------
+
+var (
+	crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+	errShortResponse = errors.New("short response")
+)
+
+//------------------------------------------------------------------------------
+
+// encoder builds Kafka protocol messages.
+type encoder struct {
+	b []byte
+}
+
+// decoder parses Kafka protocol messages. After the first failure, all reads return zero values and the
+// error is kept.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+type record struct {
+	key       []byte
+	value     []byte
+	timestamp time.Time
+}
+
+//------------------------------------------------------------------------------
+
+func (e *encoder) int8(v int8) {
+	e.b = append(e.b, byte(v))
+}
+
+func (e *encoder) int16(v int16) {
+	e.b = binary.BigEndian.AppendUint16(e.b, uint16(v))
+}
+
+func (e *encoder) int32(v int32) {
+	e.b = binary.BigEndian.AppendUint32(e.b, uint32(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.b = binary.BigEndian.AppendUint64(e.b, uint64(v))
+}
+
+func (e *encoder) varint(v int64) {
+	e.b = binary.AppendVarint(e.b, v)
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) nullString() {
+	e.int16(-1)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// varintBytes writes a length-prefixed byte slice as used inside record batches. Nil is encoded as null.
+func (e *encoder) varintBytes(b []byte) {
+	if b == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(b)))
+	e.b = append(e.b, b...)
+}
+
+func (d *decoder) need(n int) bool {
+	if d.err != nil {
+		return false
+	}
+	if len(d.b) < n {
+		d.err = errShortResponse
+		return false
+	}
+	return true
+}
+
+func (d *decoder) int8() int8 {
+	if !d.need(1) {
+		return 0
+	}
+	v := int8(d.b[0])
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) int16() int16 {
+	if !d.need(2) {
+		return 0
+	}
+	v := int16(binary.BigEndian.Uint16(d.b))
+	d.b = d.b[2:]
+	return v
+}
+
+func (d *decoder) int32() int32 {
+	if !d.need(4) {
+		return 0
+	}
+	v := int32(binary.BigEndian.Uint32(d.b))
+	d.b = d.b[4:]
+	return v
+}
+
+func (d *decoder) int64() int64 {
+	if !d.need(8) {
+		return 0
+	}
+	v := int64(binary.BigEndian.Uint64(d.b))
+	d.b = d.b[8:]
+	return v
+}
+
+func (d *decoder) string() string {
+	l := int(d.int16())
+	if l <= 0 || !d.need(l) {
+		return ""
+	}
+	s := string(d.b[:l])
+	d.b = d.b[l:]
+	return s
+}
+
+func (d *decoder) bytes() []byte {
+	l := int(d.int32())
+	if l <= 0 || !d.need(l) {
+		return nil
+	}
+	b := d.b[:l]
+	d.b = d.b[l:]
+	return b
+}
+
+// arrayLen returns the amount of items of an array. Null arrays are returned as empty.
+func (d *decoder) arrayLen() int {
+	l := int(d.int32())
+	if l < 0 {
+		return 0
+	}
+	// Each item takes at least one byte
+	if d.err == nil && l > len(d.b) {
+		d.err = errShortResponse
+		return 0
+	}
+	return l
+}
+
+// encodeRequest builds a request with its size prefix and the header.
+func encodeRequest(apiKey int16, apiVersion int16, correlationID int32, clientID string, body []byte) []byte {
+	e := encoder{
+		b: make([]byte, 4, 64+len(body)),
+	}
+	e.int16(apiKey)
+	e.int16(apiVersion)
+	e.int32(correlationID)
+	e.string(clientID)
+	e.b = append(e.b, body...)
+	binary.BigEndian.PutUint32(e.b, uint32(len(e.b)-4))
+	return e.b
+}
+
+// encodeRecordBatch builds a version 2 record batch without compression.
+func encodeRecordBatch(records []record) []byte {
+	firstTimestamp := records[0].timestamp.UnixMilli()
+	maxTimestamp := firstTimestamp
+	for _, r := range records {
+		if ts := r.timestamp.UnixMilli(); ts > maxTimestamp {
+			maxTimestamp = ts
+		}
+	}
+
+	e := encoder{}
+	e.int64(0)  // Base offset
+	e.int32(0)  // Batch length, set below
+	e.int32(-1) // Partition leader epoch
+	e.int8(recordBatchMagic)
+	e.int32(0) // CRC, set below
+	crcStart := len(e.b)
+	e.int16(0) // Attributes
+	e.int32(int32(len(records) - 1))
+	e.int64(firstTimestamp)
+	e.int64(maxTimestamp)
+	e.int64(-1) // Producer ID
+	e.int16(-1) // Producer epoch
+	e.int32(-1) // Base sequence
+	e.int32(int32(len(records)))
+	for idx, r := range records {
+		re := encoder{}
+		re.int8(0) // Attributes
+		re.varint(r.timestamp.UnixMilli() - firstTimestamp)
+		re.varint(int64(idx))
+		re.varintBytes(r.key)
+		re.varintBytes(r.value)
+		re.varint(0) // Headers
+
+		e.varint(int64(len(re.b)))
+		e.b = append(e.b, re.b...)
+	}
+
+	binary.BigEndian.PutUint32(e.b[8:], uint32(len(e.b)-12))
+	binary.BigEndian.PutUint32(e.b[crcStart-4:], crc32.Checksum(e.b[crcStart:], crc32cTable))
+	return e.b
+}
+
+// murmur2 is the hash used by the default Java client partitioner, so records with the same key land on
+// the same partition regardless of the producer.
+func murmur2(data []byte) uint32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+	for ; len(data) >= 4; data = data[4:] {
+		k := binary.LittleEndian.Uint32(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	switch len(data) {
+	case 3:
+		h ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
+
+// partitionForKey selects the partition the same way as the default Java client partitioner.
+func partitionForKey(key []byte, partitions int) int {
+	return int((murmur2(key) & 0x7fffffff) % uint32(partitions))
+}
@@ -0,0 +1,27 @@
+package kafka
+
+import (
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+
+func TestMurmur2(t *testing.T) {
+	// Values of the Java client test suite
+	tests := []struct {
+		key      string
+		expected int32
+	}{
+		{"21", -973932308},
+		{"foobar", -790332482},
+		{"a-little-bit-long-string", -985981536},
+		{"a-little-bit-longer-string", -1486304829},
+		{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", -58897971},
+		{"abc", 479470107},
+	}
+	for _, test := range tests {
+		if h := int32(murmur2([]byte(test.key))); h != test.expected {
+			t.Errorf("unexpected hash for \"%v\". [%v]", test.key, h)
+		}
+	}
+}
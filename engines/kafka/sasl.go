@@ -0,0 +1,192 @@
+package kafka
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	SASLMechanismPlain       = "PLAIN"
+	SASLMechanismScramSHA256 = "SCRAM-SHA-256"
+	SASLMechanismScramSHA512 = "SCRAM-SHA-512"
+)
+
+//------------------------------------------------------------------------------
+
+// SASLOptions specifies the credentials to authenticate against the brokers.
+type SASLOptions struct {
+	// Mechanism to use: SASLMechanismPlain, SASLMechanismScramSHA256 or SASLMechanismScramSHA512.
+	// Defaults to PLAIN.
+	Mechanism string `json:"mechanism,omitempty"`
+
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// saslExchange runs the client side of an authentication exchange. Each step receives the last server
+// message, nil on the first call, and returns the next client message.
+type saslExchange interface {
+	next(challenge []byte) ([]byte, error)
+	done() bool
+}
+
+type plainExchange struct {
+	opts *SASLOptions
+	sent bool
+}
+
+type scramExchange struct {
+	hashFn          func() hash.Hash
+	opts            *SASLOptions
+	step            int
+	clientNonce     string
+	clientFirstBare string
+	serverSignature []byte
+}
+
+//------------------------------------------------------------------------------
+
+func newSASLExchange(opts *SASLOptions) (saslExchange, error) {
+	switch opts.Mechanism {
+	case SASLMechanismPlain:
+		return &plainExchange{
+			opts: opts,
+		}, nil
+
+	case SASLMechanismScramSHA256:
+		return newScramExchange(opts, sha256.New)
+
+	case SASLMechanismScramSHA512:
+		return newScramExchange(opts, sha512.New)
+	}
+	return nil, errors.New("unsupported SASL mechanism")
+}
+
+func (x *plainExchange) next(_ []byte) ([]byte, error) {
+	x.sent = true
+	return []byte("\x00" + x.opts.Username + "\x00" + x.opts.Password), nil
+}
+
+func (x *plainExchange) done() bool {
+	return x.sent
+}
+
+func newScramExchange(opts *SASLOptions, hashFn func() hash.Hash) (*scramExchange, error) {
+	nonce := make([]byte, 24)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scramExchange{
+		hashFn:      hashFn,
+		opts:        opts,
+		clientNonce: base64.RawStdEncoding.EncodeToString(nonce),
+	}, nil
+}
+
+// next implements the SCRAM exchange described in RFC 5802.
+func (x *scramExchange) next(challenge []byte) ([]byte, error) {
+	x.step += 1
+	switch x.step {
+	case 1:
+		username := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(x.opts.Username)
+		x.clientFirstBare = "n=" + username + ",r=" + x.clientNonce
+		return []byte("n,," + x.clientFirstBare), nil
+
+	case 2:
+		serverFirst := string(challenge)
+		attrs := parseScramAttributes(serverFirst)
+		nonce := attrs["r"]
+		salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+		if err != nil {
+			return nil, errors.New("invalid SCRAM salt")
+		}
+		iterations, err := strconv.Atoi(attrs["i"])
+		if err != nil || iterations <= 0 {
+			return nil, errors.New("invalid SCRAM iteration count")
+		}
+		if !strings.HasPrefix(nonce, x.clientNonce) {
+			return nil, errors.New("invalid SCRAM nonce")
+		}
+
+		clientFinalWithoutProof := "c=biws,r=" + nonce
+		authMessage := x.clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof
+
+		saltedPassword := pbkdf2([]byte(x.opts.Password), salt, iterations, x.hashFn)
+		clientKey := x.hmac(saltedPassword, "Client Key")
+		h := x.hashFn()
+		_, _ = h.Write(clientKey)
+		storedKey := h.Sum(nil)
+		clientSignature := x.hmac(storedKey, authMessage)
+		proof := make([]byte, len(clientKey))
+		for idx := range clientKey {
+			proof[idx] = clientKey[idx] ^ clientSignature[idx]
+		}
+		x.serverSignature = x.hmac(x.hmac(saltedPassword, "Server Key"), authMessage)
+
+		return []byte(clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+
+	case 3:
+		attrs := parseScramAttributes(string(challenge))
+		if e, ok := attrs["e"]; ok {
+			return nil, errors.New("SCRAM authentication failed: " + e)
+		}
+		signature, err := base64.StdEncoding.DecodeString(attrs["v"])
+		if err != nil || !hmac.Equal(signature, x.serverSignature) {
+			return nil, errors.New("invalid SCRAM server signature")
+		}
+		return nil, nil
+	}
+	return nil, errors.New("unexpected SCRAM message")
+}
+
+func (x *scramExchange) done() bool {
+	return x.step >= 3
+}
+
+func (x *scramExchange) hmac(key []byte, data string) []byte {
+	h := hmac.New(x.hashFn, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func parseScramAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(part, "=")
+		if ok {
+			attrs[k] = v
+		}
+	}
+	return attrs
+}
+
+// pbkdf2 derives a key as described in RFC 8018 with a length equal to the hash size.
+func pbkdf2(password []byte, salt []byte, iterations int, hashFn func() hash.Hash) []byte {
+	prf := hmac.New(hashFn, password)
+	_, _ = prf.Write(salt)
+	_, _ = prf.Write([]byte{0, 0, 0, 1})
+	u := prf.Sum(nil)
+
+	key := make([]byte, len(u))
+	copy(key, u)
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		_, _ = prf.Write(u)
+		u = prf.Sum(u[:0])
+		for idx := range key {
+			key[idx] ^= u[idx]
+		}
+	}
+	return key
+}
@@ -0,0 +1,42 @@
+package kafka
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+//------------------------------------------------------------------------------
+
+func TestPBKDF2(t *testing.T) {
+	key := pbkdf2([]byte("password"), []byte("salt"), 2, sha256.New)
+	if hex.EncodeToString(key) != "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43" {
+		t.Errorf("unexpected key. [%x]", key)
+	}
+}
+
+func TestScramSHA256(t *testing.T) {
+	// The example exchange of RFC 7677
+	x := &scramExchange{
+		hashFn: sha256.New,
+		opts: &SASLOptions{
+			Username: "user",
+			Password: "pencil",
+		},
+		clientNonce: "rOprNGfwEbeRWgbNEkqO",
+	}
+
+	msg, err := x.next(nil)
+	if err != nil || string(msg) != "n,,n=user,r=rOprNGfwEbeRWgbNEkqO" {
+		t.Fatalf("unexpected client first message. [%s]", msg)
+	}
+	msg, err = x.next([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+	if err != nil || string(msg) != "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,"+
+		"p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=" {
+		t.Fatalf("unexpected client final message. [%s]", msg)
+	}
+	_, err = x.next([]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="))
+	if err != nil || !x.done() {
+		t.Fatalf("server signature was not accepted. [%v]", err)
+	}
+}
@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"sync"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	defaultCapacity = 1000
+)
+
+//------------------------------------------------------------------------------
+
+// Options specifies the memory engine settings to use when it is created.
+type Options struct {
+	// Maximum amount of entries to keep. Oldest entries are evicted when exceeded. Defaults to 1000.
+	Capacity uint `json:"capacity,omitempty"`
+}
+
+// Entry is a log entry stored in memory.
+type Entry struct {
+	Level     string    `json:"level"`
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+
+	// Raw indicates the message is a JSON object that already contains the level and timestamp.
+	Raw bool `json:"raw,omitempty"`
+}
+
+// Engine keeps the most recent log entries in a ring buffer.
+type Engine struct {
+	mtx     sync.RWMutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+//------------------------------------------------------------------------------
+
+// NewEngine creates a new memory engine.
+func NewEngine(opts Options) *Engine {
+	if opts.Capacity == 0 {
+		opts.Capacity = defaultCapacity
+	}
+
+	// Create memory adapter
+	lg := &Engine{
+		mtx:     sync.RWMutex{},
+		entries: make([]Entry, opts.Capacity),
+	}
+
+	// Done
+	return lg
+}
+
+func (lg *Engine) Class() string {
+	return "memory"
+}
+
+func (lg *Engine) Destroy() {
+	// Do nothing
+}
+
+func (lg *Engine) Success(now time.Time, msg string, raw bool, sendSuccessAtErrorLogLevel bool) {
+	if sendSuccessAtErrorLogLevel {
+		lg.add(now, "error", msg, raw)
+	} else {
+		lg.add(now, "success", msg, raw)
+	}
+}
+
+func (lg *Engine) Error(now time.Time, msg string, raw bool) {
+	lg.add(now, "error", msg, raw)
+}
+
+func (lg *Engine) Warning(now time.Time, msg string, raw bool) {
+	lg.add(now, "warning", msg, raw)
+}
+
+func (lg *Engine) Info(now time.Time, msg string, raw bool) {
+	lg.add(now, "info", msg, raw)
+}
+
+func (lg *Engine) Debug(now time.Time, msg string, raw bool) {
+	lg.add(now, "debug", msg, raw)
+}
+
+// Snapshot returns a copy of the stored entries, from the oldest to the newest.
+func (lg *Engine) Snapshot() []Entry {
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	if !lg.full {
+		return append([]Entry{}, lg.entries[:lg.next]...)
+	}
+
+	snapshot := make([]Entry, 0, len(lg.entries))
+	snapshot = append(snapshot, lg.entries[lg.next:]...)
+	snapshot = append(snapshot, lg.entries[:lg.next]...)
+	return snapshot
+}
+
+func (lg *Engine) add(now time.Time, level string, msg string, raw bool) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	// Store the entry overwriting the oldest one if the buffer is full
+	lg.entries[lg.next] = Entry{
+		Level:     level,
+		Timestamp: now,
+		Message:   msg,
+		Raw:       raw,
+	}
+	lg.next += 1
+	if lg.next == len(lg.entries) {
+		lg.next = 0
+		lg.full = true
+	}
+}
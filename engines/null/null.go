@@ -0,0 +1,48 @@
+package null
+
+import (
+	"time"
+
+	"github.com/mxmauro/logger/engines"
+)
+
+//------------------------------------------------------------------------------
+
+type engine struct {
+}
+
+//------------------------------------------------------------------------------
+
+// NewEngine creates a new engine that discards all messages. It is useful for tests and to benchmark the
+// logger without doing I/O.
+func NewEngine() engines.Engine {
+	return &engine{}
+}
+
+func (lg *engine) Class() string {
+	return "null"
+}
+
+func (lg *engine) Destroy() {
+	// Do nothing
+}
+
+func (lg *engine) Success(_ time.Time, _ string, _ bool, _ bool) {
+	// Do nothing
+}
+
+func (lg *engine) Error(_ time.Time, _ string, _ bool) {
+	// Do nothing
+}
+
+func (lg *engine) Warning(_ time.Time, _ string, _ bool) {
+	// Do nothing
+}
+
+func (lg *engine) Info(_ time.Time, _ string, _ bool) {
+	// Do nothing
+}
+
+func (lg *engine) Debug(_ time.Time, _ string, _ bool) {
+	// Do nothing
+}
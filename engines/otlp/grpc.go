@@ -0,0 +1,93 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	exportPath      = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+	grpcContentType = "application/grpc"
+)
+
+//------------------------------------------------------------------------------
+
+// StatusError is returned when the collector rejects a request with a gRPC status other than OK.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+//------------------------------------------------------------------------------
+
+func (e *StatusError) Error() string {
+	s := "grpc status " + strconv.Itoa(e.Code)
+	if len(e.Message) > 0 {
+		s += ": " + e.Message
+	}
+	return s
+}
+
+// sendExportRequest sends the request as a unary gRPC call over HTTP/2.
+func sendExportRequest(ctx context.Context, client *http.Client, u string, headers map[string]string, msg []byte) error {
+	// Add the gRPC message prefix, an uncompressed flag and the length
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	body = append(body, msg...)
+
+	// Create the request
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", grpcContentType)
+	req.Header.Set("TE", "trailers")
+
+	// Send it
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.ProtoMajor != 2 {
+		return errors.New("the collector does not support HTTP/2")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("unexpected response status code " + strconv.Itoa(resp.StatusCode))
+	}
+
+	// The status is sent in the trailers or, if the response has no body, in the headers
+	status := resp.Trailer.Get("Grpc-Status")
+	grpcMessage := resp.Trailer.Get("Grpc-Message")
+	if len(status) == 0 {
+		status = resp.Header.Get("Grpc-Status")
+		grpcMessage = resp.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		code, err2 := strconv.Atoi(status)
+		if err2 != nil {
+			return errors.New("invalid grpc status")
+		}
+		grpcMessage, _ = url.PathUnescape(grpcMessage)
+		return &StatusError{
+			Code:    code,
+			Message: grpcMessage,
+		}
+	}
+
+	// Done
+	return nil
+}
@@ -0,0 +1,394 @@
+package otlp
+
+import (
+	"container/list"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mxmauro/logger/engines"
+	"github.com/mxmauro/resetevent"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	defaultEndpoint      = "localhost:4317"
+	defaultBatchSize     = 512
+	defaultFlushInterval = 5 * time.Second
+	defaultTimeout       = 10 * time.Second
+	defaultMaxQueueSize  = 10000
+
+	minRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff = 30 * time.Second
+
+	flushTimeout = 5 * time.Second
+
+	scopeName = "github.com/mxmauro/logger"
+
+	levelSuccess = "SUCCESS"
+	levelError   = "ERROR"
+	levelWarning = "WARNING"
+	levelInfo    = "INFO"
+	levelDebug   = "DEBUG"
+)
+
+//------------------------------------------------------------------------------
+
+// Options specifies the OTLP engine settings to use when it is created.
+type Options struct {
+	// Address of the collector gRPC endpoint, as host:port. Defaults to localhost:4317.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Connect to the collector without TLS. Requires Go 1.24 or later.
+	Insecure bool `json:"insecure,omitempty"`
+
+	// An optional pointer to a tls.Config object to provide the TLS configuration for use.
+	TlsConfig *tls.Config `json:"-"`
+
+	// Additional headers to send on each request, for example, authentication ones.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Name of the service to add to the resource attributes. Defaults to the binary name.
+	ServiceName string `json:"serviceName,omitempty"`
+
+	// Additional resource attributes. The host name is added if not present.
+	ResourceAttributes map[string]string `json:"resourceAttributes,omitempty"`
+
+	// Maximum amount of records to send in a single request. Defaults to 512.
+	BatchSize uint `json:"batchSize,omitempty"`
+
+	// Maximum time to wait before sending an incomplete batch. Defaults to 5 seconds.
+	FlushInterval time.Duration `json:"flushInterval,omitempty"`
+
+	// Timeout of each request. Defaults to 10 seconds.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// Set the maximum amount of records to keep in memory if the collector cannot be reached.
+	// When exceeded, the oldest records are dropped.
+	MaxQueueSize uint `json:"queueSize,omitempty"`
+}
+
+type engine struct {
+	url             string
+	headers         map[string]string
+	resource        []byte
+	batchSize       int
+	flushInterval   time.Duration
+	client          *http.Client
+	mtx             sync.Mutex
+	queue           *list.List
+	queueAvailEv    *resetevent.AutoResetEvent
+	queueEmptyEv    *resetevent.ManualResetEvent
+	maxQueueSize    uint
+	lastSendFailed  atomic.Bool
+	shutdownOnce    sync.Once
+	wg              sync.WaitGroup
+	workerCtx       context.Context
+	workerCancelCtx context.CancelFunc
+}
+
+//------------------------------------------------------------------------------
+
+func NewEngine(opts Options) (engines.Engine, error) {
+	var tr *http.Transport
+	var err error
+
+	if len(opts.Endpoint) == 0 {
+		opts.Endpoint = defaultEndpoint
+	} else if strings.Contains(opts.Endpoint, "/") {
+		return nil, errors.New("invalid endpoint")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	// Create the transport
+	if opts.Insecure {
+		tr, err = newInsecureTransport()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		tr = &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			ForceAttemptHTTP2: true,
+		}
+		if opts.TlsConfig != nil {
+			tr.TLSClientConfig = opts.TlsConfig.Clone()
+		} else {
+			tr.TLSClientConfig = &tls.Config{
+				MinVersion: tls.VersionTLS12,
+			}
+		}
+	}
+
+	// Create OTLP adapter
+	lg := &engine{
+		headers:       opts.Headers,
+		resource:      newResource(resourceAttributes(opts)),
+		batchSize:     int(opts.BatchSize),
+		flushInterval: opts.FlushInterval,
+		client: &http.Client{
+			Transport: tr,
+			Timeout:   opts.Timeout,
+		},
+		mtx:          sync.Mutex{},
+		queue:        list.New(),
+		queueAvailEv: resetevent.NewAutoResetEvent(),
+		queueEmptyEv: resetevent.NewManualResetEvent(),
+		maxQueueSize: opts.MaxQueueSize,
+		shutdownOnce: sync.Once{},
+		wg:           sync.WaitGroup{},
+	}
+	if opts.Insecure {
+		lg.url = "http://" + opts.Endpoint + exportPath
+	} else {
+		lg.url = "https://" + opts.Endpoint + exportPath
+	}
+	if opts.BatchSize == 0 {
+		lg.batchSize = defaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		lg.flushInterval = defaultFlushInterval
+	}
+	if opts.MaxQueueSize == 0 {
+		lg.maxQueueSize = defaultMaxQueueSize
+	}
+
+	lg.queueEmptyEv.Set()
+
+	lg.workerCtx, lg.workerCancelCtx = context.WithCancel(context.Background())
+
+	// Create a background messenger worker
+	lg.wg.Add(1)
+	go lg.messengerWorker()
+
+	// Done
+	return lg, nil
+}
+
+func (lg *engine) Class() string {
+	return "otlp"
+}
+
+func (lg *engine) Destroy() {
+	lg.shutdownOnce.Do(func() {
+		// Stop worker
+		lg.workerCancelCtx()
+
+		// Wait until exits
+		lg.wg.Wait()
+
+		lg.workerCtx = nil
+		lg.workerCancelCtx = nil
+
+		// Flush queued records
+		lg.flushQueue()
+		lg.queueEmptyEv.Set()
+
+		lg.client.CloseIdleConnections()
+	})
+}
+
+// Flush sends all the queued records and waits until they are delivered or the flush timeout expires.
+func (lg *engine) Flush() {
+	ctx, cancelCtx := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancelCtx()
+
+	lg.queueAvailEv.Set()
+	_ = lg.queueEmptyEv.Wait(ctx)
+}
+
+// Healthy returns false if the last attempt to deliver records failed.
+func (lg *engine) Healthy() bool {
+	return !lg.lastSendFailed.Load()
+}
+
+// QueueDepth returns the amount of records waiting to be delivered.
+func (lg *engine) QueueDepth() int {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	return lg.queue.Len()
+}
+
+func (lg *engine) Success(now time.Time, msg string, raw bool, sendSuccessAtErrorLogLevel bool) {
+	if sendSuccessAtErrorLogLevel {
+		lg.queueRecord(now, severityError, levelError, msg, raw)
+	} else {
+		lg.queueRecord(now, severityInfo, levelSuccess, msg, raw)
+	}
+}
+
+func (lg *engine) Error(now time.Time, msg string, raw bool) {
+	lg.queueRecord(now, severityError, levelError, msg, raw)
+}
+
+func (lg *engine) Warning(now time.Time, msg string, raw bool) {
+	lg.queueRecord(now, severityWarn, levelWarning, msg, raw)
+}
+
+func (lg *engine) Info(now time.Time, msg string, raw bool) {
+	lg.queueRecord(now, severityInfo, levelInfo, msg, raw)
+}
+
+func (lg *engine) Debug(now time.Time, msg string, raw bool) {
+	lg.queueRecord(now, severityDebug, levelDebug, msg, raw)
+}
+
+func (lg *engine) queueRecord(now time.Time, severity int, severityText string, msg string, raw bool) {
+	record := newRecord(now, severity, severityText, msg, raw)
+
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	// Add to queue
+	for uint(lg.queue.Len()) >= lg.maxQueueSize {
+		lg.queue.Remove(lg.queue.Front())
+	}
+	lg.queue.PushBack(record)
+	lg.queueEmptyEv.Reset()
+
+	// Wake up worker if a batch is complete
+	if lg.queue.Len() >= lg.batchSize {
+		lg.queueAvailEv.Set()
+	}
+}
+
+// peekBatch returns the oldest queued records without removing them from the queue.
+func (lg *engine) peekBatch() []*list.Element {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	batch := make([]*list.Element, 0, lg.batchSize)
+	for elem := lg.queue.Front(); elem != nil && len(batch) < lg.batchSize; elem = elem.Next() {
+		batch = append(batch, elem)
+	}
+	if len(batch) == 0 {
+		// Signal waiters that all records were processed
+		lg.queueEmptyEv.Set()
+	}
+	return batch
+}
+
+// removeBatch removes the delivered records from the queue. Records dropped meanwhile are ignored.
+func (lg *engine) removeBatch(batch []*list.Element) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	for _, elem := range batch {
+		lg.queue.Remove(elem)
+	}
+}
+
+// The messenger worker do actual records delivery. The intention of this goroutine, is to
+// avoid halting the routine that sends the message if there are network issues.
+func (lg *engine) messengerWorker() {
+	defer lg.wg.Done()
+
+	ticker := time.NewTicker(lg.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lg.workerCtx.Done():
+			return
+
+		case <-ticker.C:
+		case <-lg.queueAvailEv.WaitCh():
+		}
+
+		backoff := minRetryBackoff
+		for {
+			batch := lg.peekBatch()
+			if len(batch) == 0 {
+				break
+			}
+
+			// Send records to the collector
+			err := lg.send(lg.workerCtx, batch)
+			lg.lastSendFailed.Store(err != nil)
+			if err == nil {
+				lg.removeBatch(batch)
+				backoff = minRetryBackoff
+				continue
+			}
+
+			// On error, wait and retry
+			select {
+			case <-lg.workerCtx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+		}
+	}
+}
+
+func (lg *engine) flushQueue() {
+	ctx, cancelCtx := context.WithDeadline(context.Background(), time.Now().Add(flushTimeout))
+	defer cancelCtx()
+
+	for {
+		batch := lg.peekBatch()
+		if len(batch) == 0 {
+			break // Reached the end
+		}
+
+		// Send records to the collector
+		err := lg.send(ctx, batch)
+		lg.lastSendFailed.Store(err != nil)
+		if err != nil {
+			break // Stop on error
+		}
+		lg.removeBatch(batch)
+	}
+}
+
+func (lg *engine) send(ctx context.Context, batch []*list.Element) error {
+	records := make([][]byte, 0, len(batch))
+	for _, elem := range batch {
+		records = append(records, elem.Value.([]byte))
+	}
+
+	return sendExportRequest(ctx, lg.client, lg.url, lg.headers, newExportRequest(lg.resource, scopeName, records))
+}
+
+// resourceAttributes returns the resource attributes to send, including the service and host names.
+func resourceAttributes(opts Options) map[string]string {
+	attrs := make(map[string]string)
+	for k, v := range opts.ResourceAttributes {
+		attrs[k] = v
+	}
+
+	if len(opts.ServiceName) > 0 {
+		attrs["service.name"] = opts.ServiceName
+	} else if _, ok := attrs["service.name"]; !ok {
+		exe, err := os.Executable()
+		if err == nil {
+			attrs["service.name"] = strings.TrimSuffix(filepath.Base(exe), filepath.Ext(exe))
+		}
+	}
+	if _, ok := attrs["host.name"]; !ok {
+		hostname, err := os.Hostname()
+		if err == nil {
+			attrs["host.name"] = hostname
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,71 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+//------------------------------------------------------------------------------
+
+// Protocol buffers wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+//------------------------------------------------------------------------------
+
+// protoBuffer is a minimal protocol buffers encoder. Embedded messages are encoded in their own buffer and
+// appended as bytes fields.
+type protoBuffer struct {
+	b []byte
+}
+
+//------------------------------------------------------------------------------
+
+func (pb *protoBuffer) Bytes() []byte {
+	return pb.b
+}
+
+func (pb *protoBuffer) appendTag(field int, wireType int) {
+	pb.appendVarint(uint64(field<<3 | wireType))
+}
+
+func (pb *protoBuffer) appendVarint(v uint64) {
+	pb.b = binary.AppendUvarint(pb.b, v)
+}
+
+func (pb *protoBuffer) appendVarintField(field int, v uint64) {
+	pb.appendTag(field, wireVarint)
+	pb.appendVarint(v)
+}
+
+func (pb *protoBuffer) appendBoolField(field int, v bool) {
+	if v {
+		pb.appendVarintField(field, 1)
+	} else {
+		pb.appendVarintField(field, 0)
+	}
+}
+
+func (pb *protoBuffer) appendFixed64Field(field int, v uint64) {
+	pb.appendTag(field, wireFixed64)
+	pb.b = binary.LittleEndian.AppendUint64(pb.b, v)
+}
+
+func (pb *protoBuffer) appendDoubleField(field int, v float64) {
+	pb.appendFixed64Field(field, math.Float64bits(v))
+}
+
+func (pb *protoBuffer) appendBytesField(field int, v []byte) {
+	pb.appendTag(field, wireBytes)
+	pb.appendVarint(uint64(len(v)))
+	pb.b = append(pb.b, v...)
+}
+
+func (pb *protoBuffer) appendStringField(field int, v string) {
+	pb.appendTag(field, wireBytes)
+	pb.appendVarint(uint64(len(v)))
+	pb.b = append(pb.b, v...)
+}
@@ -0,0 +1,164 @@
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+// OTLP severity numbers
+const (
+	severityDebug = 5
+	severityInfo  = 9
+	severityWarn  = 13
+	severityError = 17
+)
+
+//------------------------------------------------------------------------------
+
+// newRecord encodes a message as an OTLP LogRecord. The top-level fields of JSON messages become record
+// attributes, except the timestamp and level ones added by the logger, which are replaced by the record
+// ones, and the message one, which is used as the record body.
+func newRecord(now time.Time, severity int, severityText string, msg string, raw bool) []byte {
+	var body *protoBuffer
+
+	attributes := make([]*protoBuffer, 0)
+	if raw {
+		obj, ok := decodeObject(msg)
+		if ok {
+			keys := sortedKeys(obj)
+			for _, k := range keys {
+				switch k {
+				case "timestamp", "level":
+					continue
+				case "message":
+					if s, isString := obj[k].(string); isString {
+						body = encodeAnyValue(s)
+						continue
+					}
+				}
+				attributes = append(attributes, encodeKeyValue(k, obj[k]))
+			}
+		} else {
+			body = encodeAnyValue(msg)
+		}
+	} else {
+		body = encodeAnyValue(msg)
+	}
+
+	record := protoBuffer{}
+	record.appendFixed64Field(1, uint64(now.UnixNano()))
+	record.appendVarintField(2, uint64(severity))
+	record.appendStringField(3, severityText)
+	if body != nil {
+		record.appendBytesField(5, body.Bytes())
+	}
+	for _, attr := range attributes {
+		record.appendBytesField(6, attr.Bytes())
+	}
+	record.appendFixed64Field(11, uint64(now.UnixNano()))
+	return record.Bytes()
+}
+
+// newResource encodes the OTLP Resource with the given attributes.
+func newResource(attributes map[string]string) []byte {
+	resource := protoBuffer{}
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		resource.appendBytesField(1, encodeKeyValue(k, attributes[k]).Bytes())
+	}
+	return resource.Bytes()
+}
+
+// newExportRequest encodes an ExportLogsServiceRequest containing the given records.
+func newExportRequest(resource []byte, scopeName string, records [][]byte) []byte {
+	scope := protoBuffer{}
+	scope.appendStringField(1, scopeName)
+
+	scopeLogs := protoBuffer{}
+	scopeLogs.appendBytesField(1, scope.Bytes())
+	for _, record := range records {
+		scopeLogs.appendBytesField(2, record)
+	}
+
+	resourceLogs := protoBuffer{}
+	resourceLogs.appendBytesField(1, resource)
+	resourceLogs.appendBytesField(2, scopeLogs.Bytes())
+
+	req := protoBuffer{}
+	req.appendBytesField(1, resourceLogs.Bytes())
+	return req.Bytes()
+}
+
+func decodeObject(msg string) (map[string]interface{}, bool) {
+	obj := make(map[string]interface{})
+
+	dec := json.NewDecoder(bytes.NewReader([]byte(msg)))
+	dec.UseNumber()
+	if dec.Decode(&obj) != nil {
+		return nil, false
+	}
+	return obj, true
+}
+
+func encodeKeyValue(key string, value interface{}) *protoBuffer {
+	kv := &protoBuffer{}
+	kv.appendStringField(1, key)
+	kv.appendBytesField(2, encodeAnyValue(value).Bytes())
+	return kv
+}
+
+// encodeAnyValue converts a decoded JSON value into an OTLP AnyValue.
+func encodeAnyValue(value interface{}) *protoBuffer {
+	v := &protoBuffer{}
+
+	switch val := value.(type) {
+	case string:
+		v.appendStringField(1, val)
+
+	case bool:
+		v.appendBoolField(2, val)
+
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			v.appendVarintField(3, uint64(i))
+		} else if f, err2 := val.Float64(); err2 == nil {
+			v.appendDoubleField(4, f)
+		} else {
+			v.appendStringField(1, val.String())
+		}
+
+	case []interface{}:
+		arr := protoBuffer{}
+		for _, item := range val {
+			arr.appendBytesField(1, encodeAnyValue(item).Bytes())
+		}
+		v.appendBytesField(5, arr.Bytes())
+
+	case map[string]interface{}:
+		kvList := protoBuffer{}
+		for _, k := range sortedKeys(val) {
+			kvList.appendBytesField(1, encodeKeyValue(k, val[k]).Bytes())
+		}
+		v.appendBytesField(6, kvList.Bytes())
+	}
+
+	// NOTE: A null value is encoded as an empty AnyValue
+	return v
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,19 @@
+//go:build go1.24
+
+package otlp
+
+import (
+	"net/http"
+)
+
+//------------------------------------------------------------------------------
+
+// newInsecureTransport creates a transport that uses unencrypted HTTP/2 with prior knowledge.
+func newInsecureTransport() (*http.Transport, error) {
+	tr := &http.Transport{
+		Proxy:     http.ProxyFromEnvironment,
+		Protocols: &http.Protocols{},
+	}
+	tr.Protocols.SetUnencryptedHTTP2(true)
+	return tr, nil
+}
@@ -0,0 +1,15 @@
+//go:build !go1.24
+
+package otlp
+
+import (
+	"errors"
+	"net/http"
+)
+
+//------------------------------------------------------------------------------
+
+// newInsecureTransport fails because unencrypted HTTP/2 is not supported by the standard library before Go 1.24.
+func newInsecureTransport() (*http.Transport, error) {
+	return nil, errors.New("insecure connections require go 1.24 or later")
+}
@@ -0,0 +1,170 @@
+package prometheus
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mxmauro/logger/engines"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	levelError = iota
+	levelWarning
+	levelInfo
+	levelDebug
+	levelSuccess
+)
+
+//------------------------------------------------------------------------------
+
+// Options specifies the metrics engine settings to use when it is created.
+type Options struct {
+	// Optional namespace to prefix the metric names with, like "myapp" for myapp_log_messages_total.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Optional labels with fixed values to add to the metrics, like the component name.
+	ConstLabels map[string]string `json:"constLabels,omitempty"`
+
+	// Also track a histogram of the size of the messages, in bytes, per level.
+	TrackMessageSize bool `json:"trackMessageSize,omitempty"`
+
+	// Set the buckets of the message size histogram. Defaults to 64 bytes to 1Mb in powers of 4.
+	SizeBuckets []float64 `json:"sizeBuckets,omitempty"`
+
+	// Set where the metrics are registered. Defaults to prometheus.DefaultRegisterer.
+	Registerer prom.Registerer `json:"-"`
+}
+
+type engine struct {
+	counters [5]prom.Counter
+	sizes    [5]prom.Observer
+}
+
+//------------------------------------------------------------------------------
+
+var (
+	levelNames = [5]string{"error", "warning", "info", "debug", "success"}
+)
+
+//------------------------------------------------------------------------------
+
+// NewEngine creates an engine that does not output messages but counts them per level. If the metrics were
+// already registered, for example, by another logger, the existing ones are used.
+func NewEngine(opts Options) (engines.Engine, error) {
+	registerer := opts.Registerer
+	if registerer == nil {
+		registerer = prom.DefaultRegisterer
+	}
+
+	counterVec := prom.NewCounterVec(prom.CounterOpts{
+		Namespace:   opts.Namespace,
+		Name:        "log_messages_total",
+		Help:        "Total number of log messages by level.",
+		ConstLabels: opts.ConstLabels,
+	}, []string{"level"})
+	err := register(registerer, counterVec, func(existing prom.Collector) (ok bool) {
+		counterVec, ok = existing.(*prom.CounterVec)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Create metrics adapter
+	lg := &engine{}
+	for idx, name := range levelNames {
+		lg.counters[idx] = counterVec.WithLabelValues(name)
+	}
+
+	if opts.TrackMessageSize {
+		buckets := opts.SizeBuckets
+		if len(buckets) == 0 {
+			buckets = prom.ExponentialBuckets(64, 4, 8)
+		}
+
+		histogramVec := prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        "log_message_size_bytes",
+			Help:        "Size of the log messages by level.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     buckets,
+		}, []string{"level"})
+		err = register(registerer, histogramVec, func(existing prom.Collector) (ok bool) {
+			histogramVec, ok = existing.(*prom.HistogramVec)
+			return
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for idx, name := range levelNames {
+			lg.sizes[idx] = histogramVec.WithLabelValues(name)
+		}
+	}
+
+	// Done
+	return lg, nil
+}
+
+func (lg *engine) Class() string {
+	return "prometheus"
+}
+
+// Destroy does nothing. The metrics stay registered so their values are not lost if the engine is added
+// again.
+func (lg *engine) Destroy() {
+	// Do nothing
+}
+
+func (lg *engine) Success(_ time.Time, msg string, _ bool, sendSuccessAtErrorLogLevel bool) {
+	if sendSuccessAtErrorLogLevel {
+		lg.observe(levelError, msg)
+	} else {
+		lg.observe(levelSuccess, msg)
+	}
+}
+
+func (lg *engine) Error(_ time.Time, msg string, _ bool) {
+	lg.observe(levelError, msg)
+}
+
+func (lg *engine) Warning(_ time.Time, msg string, _ bool) {
+	lg.observe(levelWarning, msg)
+}
+
+func (lg *engine) Info(_ time.Time, msg string, _ bool) {
+	lg.observe(levelInfo, msg)
+}
+
+func (lg *engine) Debug(_ time.Time, msg string, _ bool) {
+	lg.observe(levelDebug, msg)
+}
+
+func (lg *engine) observe(level int, msg string) {
+	lg.counters[level].Inc()
+	if lg.sizes[level] != nil {
+		lg.sizes[level].Observe(float64(len(msg)))
+	}
+}
+
+// register registers the collector or, if an equivalent one is already registered, passes it to the
+// reuse callback, which returns false if it is not of the expected type.
+func register(registerer prom.Registerer, c prom.Collector, reuse func(existing prom.Collector) bool) error {
+	err := registerer.Register(c)
+	if err != nil {
+		var alreadyRegistered prom.AlreadyRegisteredError
+
+		if !errors.As(err, &alreadyRegistered) {
+			return err
+		}
+		if !reuse(alreadyRegistered.ExistingCollector) {
+			return errors.New("a different collector is registered with the same metric name")
+		}
+	}
+
+	// Done
+	return nil
+}
@@ -0,0 +1,83 @@
+package engines
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// -----------------------------------------------------------------------------
+
+const hexDigits = "0123456789abcdef"
+
+// -----------------------------------------------------------------------------
+
+// EscapeControlChars replaces the control characters of the text with escape sequences, like \n or \x1b, so
+// they cannot forge additional lines or be interpreted by terminals. Tabs are kept as is, and line feeds too
+// if keepNewLines is set.
+func EscapeControlChars(s string, keepNewLines bool) string {
+	return sanitizeControlChars(s, keepNewLines, false)
+}
+
+// StripControlChars removes the control characters of the text like EscapeControlChars escapes them.
+func StripControlChars(s string, keepNewLines bool) string {
+	return sanitizeControlChars(s, keepNewLines, true)
+}
+
+func sanitizeControlChars(s string, keepNewLines bool, strip bool) string {
+	// Most messages do not have control characters
+	start := indexControlChar(s, keepNewLines)
+	if start < 0 {
+		return s
+	}
+
+	sb := strings.Builder{}
+	sb.Grow(len(s) + 8)
+	_, _ = sb.WriteString(s[:start])
+	for idx := start; idx < len(s); {
+		r, size := utf8.DecodeRuneInString(s[idx:])
+		if !isControlChar(r, size, s[idx], keepNewLines) {
+			_, _ = sb.WriteString(s[idx : idx+size])
+		} else if !strip {
+			switch {
+			case r == '\n':
+				_, _ = sb.WriteString(`\n`)
+			case r == '\r':
+				_, _ = sb.WriteString(`\r`)
+			case size == 1:
+				// ASCII control characters and the bytes of invalid UTF-8 sequences
+				_, _ = sb.WriteString(`\x`)
+				_ = sb.WriteByte(hexDigits[s[idx]>>4])
+				_ = sb.WriteByte(hexDigits[s[idx]&0x0F])
+			default:
+				_, _ = sb.WriteString(`\u00`)
+				_, _ = sb.WriteString(strconv.FormatInt(int64(r), 16))
+			}
+		}
+		idx += size
+	}
+	return sb.String()
+}
+
+func indexControlChar(s string, keepNewLines bool) int {
+	for idx := 0; idx < len(s); {
+		r, size := utf8.DecodeRuneInString(s[idx:])
+		if isControlChar(r, size, s[idx], keepNewLines) {
+			return idx
+		}
+		idx += size
+	}
+	return -1
+}
+
+// isControlChar returns true for the C0 and C1 control characters, except the tab and, optionally, the line
+// feed. Invalid bytes in the C1 range are included because some terminals interpret them too.
+func isControlChar(r rune, size int, b byte, keepNewLines bool) bool {
+	if r == utf8.RuneError && size == 1 {
+		return b >= 0x80 && b <= 0x9F
+	}
+	if r == '\t' || (r == '\n' && keepNewLines) {
+		return false
+	}
+	return r < 0x20 || (r >= 0x7F && r <= 0x9F)
+}
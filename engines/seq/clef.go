@@ -0,0 +1,54 @@
+package seq
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+// newEvent converts a message into a compact log event format (CLEF) document. The top-level fields of JSON
+// messages become event properties, except the timestamp and level ones added by the logger, which are
+// replaced by the CLEF ones, and the message one, which is used as the event message.
+func newEvent(now time.Time, level string, msg string, raw bool) string {
+	event := make(map[string]json.RawMessage)
+
+	if raw {
+		obj := make(map[string]json.RawMessage)
+		if json.Unmarshal([]byte(msg), &obj) == nil {
+			for k, v := range obj {
+				switch k {
+				case "timestamp", "level":
+					continue
+				case "message":
+					var s string
+					if json.Unmarshal(v, &s) == nil {
+						event["@m"] = v
+						continue
+					}
+				}
+
+				// Property names starting with @ are escaped by doubling it
+				if strings.HasPrefix(k, "@") {
+					k = "@" + k
+				}
+				event[k] = v
+			}
+		} else {
+			event["@m"] = marshalString(msg)
+		}
+	} else {
+		event["@m"] = marshalString(msg)
+	}
+	event["@t"] = marshalString(now.UTC().Format(time.RFC3339Nano))
+	event["@l"] = marshalString(level)
+
+	b, _ := json.Marshal(event)
+	return string(b)
+}
+
+func marshalString(s string) json.RawMessage {
+	b, _ := json.Marshal(s)
+	return b
+}
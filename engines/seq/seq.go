@@ -0,0 +1,349 @@
+package seq
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mxmauro/logger/engines"
+	"github.com/mxmauro/resetevent"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = 5 * time.Second
+	defaultTimeout       = 10 * time.Second
+	defaultMaxQueueSize  = 10000
+
+	minRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff = 30 * time.Second
+
+	flushTimeout = 5 * time.Second
+
+	ingestionPath = "/api/events/raw?clef"
+	contentType   = "application/vnd.serilog.clef"
+	apiKeyHeader  = "X-Seq-ApiKey"
+
+	levelDebug       = "Debug"
+	levelInformation = "Information"
+	levelWarning     = "Warning"
+	levelError       = "Error"
+)
+
+//------------------------------------------------------------------------------
+
+// Options specifies the Seq engine settings to use when it is created.
+type Options struct {
+	// Base URL of the Seq server, for example, http://localhost:5341.
+	URL string `json:"url,omitempty"`
+
+	// Optional API key to send with each request.
+	APIKey string `json:"apiKey,omitempty"`
+
+	// Maximum amount of events to send in a single request. Defaults to 100.
+	BatchSize uint `json:"batchSize,omitempty"`
+
+	// Maximum time to wait before sending an incomplete batch. Defaults to 5 seconds.
+	FlushInterval time.Duration `json:"flushInterval,omitempty"`
+
+	// Timeout of each request. Defaults to 10 seconds.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// Set the maximum amount of events to keep in memory if the server cannot be reached.
+	// When exceeded, the oldest events are dropped.
+	MaxQueueSize uint `json:"queueSize,omitempty"`
+}
+
+type engine struct {
+	url             string
+	apiKey          string
+	batchSize       int
+	flushInterval   time.Duration
+	client          *http.Client
+	mtx             sync.Mutex
+	queue           *list.List
+	queueAvailEv    *resetevent.AutoResetEvent
+	queueEmptyEv    *resetevent.ManualResetEvent
+	maxQueueSize    uint
+	lastSendFailed  atomic.Bool
+	shutdownOnce    sync.Once
+	wg              sync.WaitGroup
+	workerCtx       context.Context
+	workerCancelCtx context.CancelFunc
+}
+
+//------------------------------------------------------------------------------
+
+func NewEngine(opts Options) (engines.Engine, error) {
+	if len(opts.URL) == 0 {
+		return nil, errors.New("invalid url")
+	}
+
+	// Create Seq adapter
+	lg := &engine{
+		url:           strings.TrimSuffix(opts.URL, "/") + ingestionPath,
+		apiKey:        opts.APIKey,
+		batchSize:     int(opts.BatchSize),
+		flushInterval: opts.FlushInterval,
+		client: &http.Client{
+			Timeout: opts.Timeout,
+		},
+		mtx:          sync.Mutex{},
+		queue:        list.New(),
+		queueAvailEv: resetevent.NewAutoResetEvent(),
+		queueEmptyEv: resetevent.NewManualResetEvent(),
+		maxQueueSize: opts.MaxQueueSize,
+		shutdownOnce: sync.Once{},
+		wg:           sync.WaitGroup{},
+	}
+	if opts.BatchSize == 0 {
+		lg.batchSize = defaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		lg.flushInterval = defaultFlushInterval
+	}
+	if opts.Timeout <= 0 {
+		lg.client.Timeout = defaultTimeout
+	}
+	if opts.MaxQueueSize == 0 {
+		lg.maxQueueSize = defaultMaxQueueSize
+	}
+
+	lg.queueEmptyEv.Set()
+
+	lg.workerCtx, lg.workerCancelCtx = context.WithCancel(context.Background())
+
+	// Create a background messenger worker
+	lg.wg.Add(1)
+	go lg.messengerWorker()
+
+	// Done
+	return lg, nil
+}
+
+func (lg *engine) Class() string {
+	return "seq"
+}
+
+func (lg *engine) Destroy() {
+	lg.shutdownOnce.Do(func() {
+		// Stop worker
+		lg.workerCancelCtx()
+
+		// Wait until exits
+		lg.wg.Wait()
+
+		lg.workerCtx = nil
+		lg.workerCancelCtx = nil
+
+		// Flush queued events
+		lg.flushQueue()
+		lg.queueEmptyEv.Set()
+	})
+}
+
+// Flush sends all the queued events and waits until they are delivered or the flush timeout expires.
+func (lg *engine) Flush() {
+	ctx, cancelCtx := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancelCtx()
+
+	lg.queueAvailEv.Set()
+	_ = lg.queueEmptyEv.Wait(ctx)
+}
+
+// Healthy returns false if the last attempt to deliver events failed.
+func (lg *engine) Healthy() bool {
+	return !lg.lastSendFailed.Load()
+}
+
+// QueueDepth returns the amount of events waiting to be delivered.
+func (lg *engine) QueueDepth() int {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	return lg.queue.Len()
+}
+
+func (lg *engine) Success(now time.Time, msg string, raw bool, sendSuccessAtErrorLogLevel bool) {
+	if sendSuccessAtErrorLogLevel {
+		lg.queueEvent(now, levelError, msg, raw)
+	} else {
+		lg.queueEvent(now, levelInformation, msg, raw)
+	}
+}
+
+func (lg *engine) Error(now time.Time, msg string, raw bool) {
+	lg.queueEvent(now, levelError, msg, raw)
+}
+
+func (lg *engine) Warning(now time.Time, msg string, raw bool) {
+	lg.queueEvent(now, levelWarning, msg, raw)
+}
+
+func (lg *engine) Info(now time.Time, msg string, raw bool) {
+	lg.queueEvent(now, levelInformation, msg, raw)
+}
+
+func (lg *engine) Debug(now time.Time, msg string, raw bool) {
+	lg.queueEvent(now, levelDebug, msg, raw)
+}
+
+func (lg *engine) queueEvent(now time.Time, level string, msg string, raw bool) {
+	event := newEvent(now, level, msg, raw)
+
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	// Add to queue
+	for uint(lg.queue.Len()) >= lg.maxQueueSize {
+		lg.queue.Remove(lg.queue.Front())
+	}
+	lg.queue.PushBack(event)
+	lg.queueEmptyEv.Reset()
+
+	// Wake up worker if a batch is complete
+	if lg.queue.Len() >= lg.batchSize {
+		lg.queueAvailEv.Set()
+	}
+}
+
+// peekBatch returns the oldest queued events without removing them from the queue.
+func (lg *engine) peekBatch() []*list.Element {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	batch := make([]*list.Element, 0, lg.batchSize)
+	for elem := lg.queue.Front(); elem != nil && len(batch) < lg.batchSize; elem = elem.Next() {
+		batch = append(batch, elem)
+	}
+	if len(batch) == 0 {
+		// Signal waiters that all events were processed
+		lg.queueEmptyEv.Set()
+	}
+	return batch
+}
+
+// removeBatch removes the delivered events from the queue. Events dropped meanwhile are ignored.
+func (lg *engine) removeBatch(batch []*list.Element) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	for _, elem := range batch {
+		lg.queue.Remove(elem)
+	}
+}
+
+// The messenger worker do actual events delivery. The intention of this goroutine, is to
+// avoid halting the routine that sends the message if there are network issues.
+func (lg *engine) messengerWorker() {
+	defer lg.wg.Done()
+
+	ticker := time.NewTicker(lg.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lg.workerCtx.Done():
+			return
+
+		case <-ticker.C:
+		case <-lg.queueAvailEv.WaitCh():
+		}
+
+		backoff := minRetryBackoff
+		for {
+			batch := lg.peekBatch()
+			if len(batch) == 0 {
+				break
+			}
+
+			// Send events to the server
+			err := lg.send(lg.workerCtx, batch)
+			lg.lastSendFailed.Store(err != nil)
+			if err == nil {
+				lg.removeBatch(batch)
+				backoff = minRetryBackoff
+				continue
+			}
+
+			// On error, wait and retry
+			select {
+			case <-lg.workerCtx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+		}
+	}
+}
+
+func (lg *engine) flushQueue() {
+	ctx, cancelCtx := context.WithDeadline(context.Background(), time.Now().Add(flushTimeout))
+	defer cancelCtx()
+
+	for {
+		batch := lg.peekBatch()
+		if len(batch) == 0 {
+			break // Reached the end
+		}
+
+		// Send events to the server
+		err := lg.send(ctx, batch)
+		lg.lastSendFailed.Store(err != nil)
+		if err != nil {
+			break // Stop on error
+		}
+		lg.removeBatch(batch)
+	}
+}
+
+func (lg *engine) send(ctx context.Context, batch []*list.Element) error {
+	// Build the newline-delimited CLEF payload
+	buf := bytes.Buffer{}
+	for _, elem := range batch {
+		_, _ = buf.WriteString(elem.Value.(string))
+		_ = buf.WriteByte('\n')
+	}
+
+	// Create the request
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, lg.url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if len(lg.apiKey) > 0 {
+		req.Header.Set(apiKeyHeader, lg.apiKey)
+	}
+
+	// Send it
+	resp, err := lg.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("unexpected response status code " + strconv.Itoa(resp.StatusCode))
+	}
+
+	// Done
+	return nil
+}
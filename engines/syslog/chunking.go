@@ -0,0 +1,161 @@
+package syslog
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// NOTE: Message chunking is NOT part of any syslog standard. It is an opt-in extension, only useful when the
+//       receiver is able to reassemble the datagrams, like the Reassembler below does.
+//
+// Each chunk starts with the following header, all integers in big endian:
+//       magic (2 bytes: 0x1E 0x1F) + version (1 byte) + message id (8 bytes) + index (2 bytes) + total (2 bytes)
+
+//------------------------------------------------------------------------------
+
+const (
+	chunkMagic0       = 0x1E
+	chunkMagic1       = 0x1F
+	chunkVersion      = 1
+	chunkHeaderLength = 15
+
+	// MinChunkSize is the minimum allowed datagram size when chunking is enabled.
+	MinChunkSize = 64
+
+	defaultReassemblerTimeout = 30 * time.Second
+)
+
+//------------------------------------------------------------------------------
+
+// Reassembler rebuilds the messages split by the syslog engine when chunking is enabled.
+type Reassembler struct {
+	mtx     sync.Mutex
+	timeout time.Duration
+	pending map[uint64]*pendingMessage
+}
+
+type pendingMessage struct {
+	chunks   [][]byte
+	received int
+	created  time.Time
+}
+
+//------------------------------------------------------------------------------
+
+// NewReassembler creates a new reassembler. Incomplete messages older than the given timeout are discarded.
+func NewReassembler(timeout time.Duration) *Reassembler {
+	if timeout <= 0 {
+		timeout = defaultReassemblerTimeout
+	}
+	return &Reassembler{
+		mtx:     sync.Mutex{},
+		timeout: timeout,
+		pending: make(map[uint64]*pendingMessage),
+	}
+}
+
+// Add processes a received datagram. It returns the full message when the last missing chunk arrives.
+// Datagrams without the chunk header are returned as is.
+func (r *Reassembler) Add(datagram []byte) ([]byte, bool, error) {
+	if !IsChunk(datagram) {
+		return datagram, true, nil
+	}
+	if len(datagram) < chunkHeaderLength || datagram[2] != chunkVersion {
+		return nil, false, errors.New("invalid chunk header")
+	}
+
+	id := binary.BigEndian.Uint64(datagram[3:11])
+	index := int(binary.BigEndian.Uint16(datagram[11:13]))
+	total := int(binary.BigEndian.Uint16(datagram[13:15]))
+	if total == 0 || index >= total {
+		return nil, false, errors.New("invalid chunk header")
+	}
+
+	// Lock access
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	// Discard expired messages
+	now := time.Now()
+	for k, pm := range r.pending {
+		if now.Sub(pm.created) > r.timeout {
+			delete(r.pending, k)
+		}
+	}
+
+	pm, ok := r.pending[id]
+	if !ok {
+		pm = &pendingMessage{
+			chunks:  make([][]byte, total),
+			created: now,
+		}
+		r.pending[id] = pm
+	} else if len(pm.chunks) != total {
+		delete(r.pending, id)
+		return nil, false, errors.New("chunk total mismatch")
+	}
+	if pm.chunks[index] == nil {
+		pm.chunks[index] = append([]byte{}, datagram[chunkHeaderLength:]...)
+		pm.received += 1
+	}
+	if pm.received < total {
+		return nil, false, nil
+	}
+
+	// Got all the chunks
+	delete(r.pending, id)
+
+	size := 0
+	for _, chunk := range pm.chunks {
+		size += len(chunk)
+	}
+	msg := make([]byte, 0, size)
+	for _, chunk := range pm.chunks {
+		msg = append(msg, chunk...)
+	}
+
+	// Done
+	return msg, true, nil
+}
+
+// IsChunk returns true if the datagram starts with the chunk header magic.
+func IsChunk(datagram []byte) bool {
+	return len(datagram) >= 2 && datagram[0] == chunkMagic0 && datagram[1] == chunkMagic1
+}
+
+//------------------------------------------------------------------------------
+
+// maxChunkedMessageLength returns the length of the largest message that the chunk header can describe
+// when split into chunks of the given size.
+func maxChunkedMessageLength(chunkSize int) int {
+	return math.MaxUint16 * (chunkSize - chunkHeaderLength)
+}
+
+// splitMessage splits the message into chunks of, at most, the given size including the header. The message
+// must not be longer than maxChunkedMessageLength.
+func splitMessage(msg []byte, id uint64, chunkSize int) [][]byte {
+	payloadSize := chunkSize - chunkHeaderLength
+	total := (len(msg) + payloadSize - 1) / payloadSize
+
+	chunks := make([][]byte, 0, total)
+	for index := 0; index < total; index++ {
+		start := index * payloadSize
+		end := start + payloadSize
+		if end > len(msg) {
+			end = len(msg)
+		}
+
+		chunk := make([]byte, chunkHeaderLength, chunkHeaderLength+end-start)
+		chunk[0] = chunkMagic0
+		chunk[1] = chunkMagic1
+		chunk[2] = chunkVersion
+		binary.BigEndian.PutUint64(chunk[3:11], id)
+		binary.BigEndian.PutUint16(chunk[11:13], uint16(index))
+		binary.BigEndian.PutUint16(chunk[13:15], uint16(total))
+		chunks = append(chunks, append(chunk, msg[start:end]...))
+	}
+	return chunks
+}
@@ -0,0 +1,242 @@
+package syslog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// NOTE: The spool keeps the messages that could not be delivered in a set of files, so they survive outages
+//       longer than the in-memory queue allows and also application restarts. Each record is stored as its
+//       length (4 bytes, big endian) followed by the message. Files are read back in order and deleted once
+//       all their messages are delivered. If the application stops while a file is being replayed, the whole
+//       file is sent again on the next start, so delivery is at-least-once.
+
+//------------------------------------------------------------------------------
+
+const (
+	spoolFileExt         = ".spool"
+	spoolFileSize        = 1024 * 1024
+	defaultMaxSpoolSize  = 64 * 1024 * 1024
+	spoolRecordHeaderLen = 4
+)
+
+//------------------------------------------------------------------------------
+
+type spool struct {
+	mtx       sync.Mutex
+	dir       string
+	maxSize   int64
+	files     []spoolFile
+	totalSize int64
+	nextSeq   uint64
+	w         *os.File
+	records   []string
+	readPos   int
+}
+
+type spoolFile struct {
+	name string
+	size int64
+}
+
+//------------------------------------------------------------------------------
+
+func newSpool(dir string, maxSize uint64) (*spool, error) {
+	sp := &spool{
+		mtx:     sync.Mutex{},
+		dir:     dir,
+		maxSize: int64(maxSize),
+		files:   make([]spoolFile, 0),
+	}
+	if maxSize == 0 {
+		sp.maxSize = defaultMaxSpoolSize
+	} else if maxSize < spoolFileSize {
+		sp.maxSize = spoolFileSize
+	}
+
+	// Create the directory if it does not exist
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the files left by a previous run
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolFileExt) {
+			continue
+		}
+		seq, err2 := strconv.ParseUint(strings.TrimSuffix(name, spoolFileExt), 16, 64)
+		if err2 != nil {
+			continue
+		}
+		fi, err2 := entry.Info()
+		if err2 != nil {
+			continue
+		}
+
+		sp.files = append(sp.files, spoolFile{
+			name: name,
+			size: fi.Size(),
+		})
+		sp.totalSize += fi.Size()
+		if seq >= sp.nextSeq {
+			sp.nextSeq = seq + 1
+		}
+	}
+	slices.SortFunc(sp.files, func(a, b spoolFile) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	// Done
+	return sp, nil
+}
+
+// close closes the file being written. Pending messages are kept for the next run.
+func (sp *spool) close() {
+	// Lock access
+	sp.mtx.Lock()
+	defer sp.mtx.Unlock()
+
+	sp.closeWriter()
+}
+
+func (sp *spool) isEmpty() bool {
+	// Lock access
+	sp.mtx.Lock()
+	defer sp.mtx.Unlock()
+
+	return len(sp.files) == 0
+}
+
+// append adds a message at the end of the spool. If the spool exceeds its maximum size, the oldest files
+// are deleted.
+func (sp *spool) append(msg string) error {
+	var err error
+
+	// Lock access
+	sp.mtx.Lock()
+	defer sp.mtx.Unlock()
+
+	// Start a new file if needed
+	if sp.w == nil || sp.files[len(sp.files)-1].size >= spoolFileSize {
+		sp.closeWriter()
+
+		name := fmt.Sprintf("%016x", sp.nextSeq) + spoolFileExt
+		sp.w, err = os.OpenFile(filepath.Join(sp.dir, name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		sp.nextSeq += 1
+		sp.files = append(sp.files, spoolFile{
+			name: name,
+		})
+	}
+
+	// Write the record
+	b := make([]byte, spoolRecordHeaderLen+len(msg))
+	binary.BigEndian.PutUint32(b, uint32(len(msg)))
+	copy(b[spoolRecordHeaderLen:], msg)
+	n, err := sp.w.Write(b)
+	sp.files[len(sp.files)-1].size += int64(n)
+	sp.totalSize += int64(n)
+	if err != nil {
+		return err
+	}
+
+	// Delete the oldest files if the spool is too big
+	for sp.totalSize > sp.maxSize && len(sp.files) > 1 {
+		sp.removeOldest()
+	}
+
+	// Done
+	return nil
+}
+
+// peek returns the oldest message without removing it.
+func (sp *spool) peek() (string, bool) {
+	// Lock access
+	sp.mtx.Lock()
+	defer sp.mtx.Unlock()
+
+	for sp.readPos >= len(sp.records) {
+		if len(sp.files) == 0 {
+			return "", false
+		}
+
+		// Stop writing to the file about to be read so it does not change
+		if len(sp.files) == 1 {
+			sp.closeWriter()
+		}
+
+		// Load the messages of the oldest file
+		sp.records = sp.records[:0]
+		sp.readPos = 0
+		b, err := os.ReadFile(filepath.Join(sp.dir, sp.files[0].name))
+		if err == nil {
+			sp.records = parseSpoolRecords(b, sp.records)
+		}
+		if len(sp.records) == 0 {
+			sp.removeOldest() // Skip empty or unreadable files
+		}
+	}
+
+	return sp.records[sp.readPos], true
+}
+
+// commit removes the message returned by peek.
+func (sp *spool) commit() {
+	// Lock access
+	sp.mtx.Lock()
+	defer sp.mtx.Unlock()
+
+	if sp.readPos < len(sp.records) {
+		sp.readPos += 1
+		if sp.readPos == len(sp.records) {
+			sp.removeOldest()
+		}
+	}
+}
+
+func (sp *spool) removeOldest() {
+	if len(sp.files) == 1 {
+		sp.closeWriter()
+	}
+
+	_ = os.Remove(filepath.Join(sp.dir, sp.files[0].name))
+	sp.totalSize -= sp.files[0].size
+	sp.files = sp.files[1:]
+
+	// Discard the loaded messages, they belong to the removed file
+	sp.records = sp.records[:0]
+	sp.readPos = 0
+}
+
+func (sp *spool) closeWriter() {
+	if sp.w != nil {
+		_ = sp.w.Close()
+		sp.w = nil
+	}
+}
+
+func parseSpoolRecords(b []byte, records []string) []string {
+	for len(b) >= spoolRecordHeaderLen {
+		recordLen := int(binary.BigEndian.Uint32(b))
+		if len(b)-spoolRecordHeaderLen < recordLen {
+			break // Incomplete record, the application stopped while writing it
+		}
+		records = append(records, string(b[spoolRecordHeaderLen:spoolRecordHeaderLen+recordLen]))
+		b = b[spoolRecordHeaderLen+recordLen:]
+	}
+	return records
+}
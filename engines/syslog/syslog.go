@@ -4,14 +4,20 @@ import (
 	"container/list"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"math"
+	"math/rand"
 	"net"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/mxmauro/logger/engines"
 	"github.com/mxmauro/resetevent"
@@ -25,20 +31,101 @@ const (
 	severityInformational = 6
 	severityDebug         = 7
 
-	facilityUser = 1
+	maxFacility = 23
 
 	defaultMaxMessageQueueSize = 1024
 
-	flushTimeout = 5 * time.Second
+	defaultOverflowTimeout = time.Second
+
+	defaultMaxMessageLengthRFC3164 = 1024
+	defaultMaxMessageLengthRFC5424 = 2048
+
+	truncatedMarker = "..."
+
+	// RFC 5424 allows up to microseconds in timestamps
+	maxTimeFracDigits = 6
+
+	defaultFlushTimeout = 5 * time.Second
+
+	minSpoolRetryBackoff = 500 * time.Millisecond
+	maxSpoolRetryBackoff = 30 * time.Second
+
+	maxAppNameLength = 48
+	maxProcIDLength  = 128
+	maxMsgIDLength   = 32
+
+	defaultFallbackThreshold     = 3
+	defaultFallbackRetryInterval = 10 * time.Second
+)
+
+const (
+	// FramingNonTransparent delimits each message sent over TCP with a trailing new line character.
+	FramingNonTransparent Framing = 0
+
+	// FramingOctetCounting prefixes each message sent over TCP with its length as described in RFC 5425/6587.
+	FramingOctetCounting Framing = 1
+)
+
+const (
+	// OverflowDropOldest drops the oldest queued message to make room for the new one.
+	OverflowDropOldest OverflowPolicy = 0
+
+	// OverflowDropNewest drops the new message if the queue is full.
+	OverflowDropNewest OverflowPolicy = 1
+
+	// OverflowBlockWithTimeout makes the caller wait for room in the queue up to the overflow timeout. If
+	// the queue is still full, the new message is dropped.
+	OverflowBlockWithTimeout OverflowPolicy = 2
+)
+
+// Standard facilities. The kernel facility, zero, is not listed because user processes cannot use it.
+const (
+	FacilityUser     Facility = 1
+	FacilityMail     Facility = 2
+	FacilityDaemon   Facility = 3
+	FacilityAuth     Facility = 4
+	FacilitySyslog   Facility = 5
+	FacilityLPR      Facility = 6
+	FacilityNews     Facility = 7
+	FacilityUUCP     Facility = 8
+	FacilityCron     Facility = 9
+	FacilityAuthPriv Facility = 10
+	FacilityFTP      Facility = 11
+	FacilityNTP      Facility = 12
+	FacilityAudit    Facility = 13
+	FacilityAlert    Facility = 14
+	FacilityClock    Facility = 15
+	FacilityLocal0   Facility = 16
+	FacilityLocal1   Facility = 17
+	FacilityLocal2   Facility = 18
+	FacilityLocal3   Facility = 19
+	FacilityLocal4   Facility = 20
+	FacilityLocal5   Facility = 21
+	FacilityLocal6   Facility = 22
+	FacilityLocal7   Facility = 23
+)
+
+//------------------------------------------------------------------------------
+
+var (
+	newlineEscaper = strings.NewReplacer("\r\n", `\n`, "\n", `\n`, "\r", `\r`)
 )
 
 //------------------------------------------------------------------------------
 
 // Options specifies the syslog settings to use when it is created.
 type Options struct {
-	// Application name to use. Defaults to the binary name.
+	// Application name to use. Defaults to the binary name. Like ProcID and MsgID, it can only contain
+	// printable ASCII characters without spaces.
 	AppName string `json:"appName,omitempty"`
 
+	// Process identifier to send in RFC 5424 messages, up to 128 characters. Defaults to the process ID.
+	ProcID string `json:"procId,omitempty"`
+
+	// Message type identifier to send in RFC 5424 messages, like "AUDIT", up to 32 characters. If not set, the
+	// nil value "-" is sent.
+	MsgID string `json:"msgId,omitempty"`
+
 	// Syslog server host name.
 	Host string `json:"host,omitempty"`
 
@@ -54,26 +141,159 @@ type Options struct {
 	// Send messages in the new RFC 5424 format instead of the original RFC 3164 specification.
 	UseRFC5424 bool `json:"useRFC5424,omitempty"`
 
+	// Set the facility of the messages, from 1 to 23. Zero selects the default, FacilityUser, because the
+	// kernel facility is reserved to the operating system.
+	Facility Facility `json:"facility,omitempty"`
+
 	// Set the maximum amount of messages to keep in memory if connection to the server is lost.
 	MaxMessageQueueSize uint `json:"queueSize,omitempty"`
 
-	// TLSConfig optionally provides a TLS configuration for use.
+	// Set what to do when the queue is full. Defaults to OverflowDropOldest. Not used if a spool directory is
+	// set because the oldest messages are moved to the spool instead.
+	OverflowPolicy OverflowPolicy `json:"overflowPolicy,omitempty"`
+
+	// Set the maximum time a caller waits for room in the queue when OverflowBlockWithTimeout is used.
+	// Defaults to 1 second.
+	OverflowTimeout time.Duration `json:"overflowTimeout,omitempty"`
+
+	// Set the message framing method to use on TCP connections. Defaults to non-transparent framing.
+	Framing Framing `json:"framing,omitempty"`
+
+	// Replace the line breaks inside messages with a literal \n when non-transparent framing is used on TCP,
+	// so multi-line messages, like stack traces, are received as a single event. Octet-counting framing
+	// always sends them as is.
+	EscapeNewlines bool `json:"escapeNewlines,omitempty"`
+
+	// Optional time zone of the timestamps in the message headers instead of the one set in the logger. RFC 5424
+	// timestamps include the offset, while RFC 3164 ones do not.
+	TimeZone *time.Location `json:"-"`
+
+	// Set the maximum length of a message, including its header but not the framing. Longer messages are
+	// truncated and end with an ellipsis. Defaults to 1024 bytes for RFC 3164 and 2048 for RFC 5424, or no
+	// limit if chunking is enabled. Zero means no limit.
+	MaxMessageLength *uint `json:"maxMessageLength,omitempty"`
+
+	// Split messages larger than this size into multiple datagrams. Only used with UDP. This is a non-standard
+	// extension and requires a receiver able to reassemble them, see Reassembler. As up to 65535 chunks are
+	// sent, longer messages are truncated and reported to OnError. Zero disables it.
+	ChunkSize uint `json:"chunkSize,omitempty"`
+
+	// Close TCP connections after this period without writes, so the next message is sent over a new one
+	// instead of a connection silently dropped by a firewall. Zero disables it.
+	IdleTimeout time.Duration `json:"idleTimeout,omitempty"`
+
+	// Set the maximum time to wait for a connection to be established. Zero means no timeout.
+	DialTimeout time.Duration `json:"dialTimeout,omitempty"`
+
+	// Set the interval between TCP keep-alive probes, used to detect dropped peers. Zero uses the system default.
+	KeepAlivePeriod time.Duration `json:"keepAlivePeriod,omitempty"`
+
+	// Set the maximum time to wait for a message to be written so a stuck connection does not block the
+	// delivery of the rest. Zero means no timeout.
+	WriteTimeout time.Duration `json:"writeTimeout,omitempty"`
+
+	// Set the maximum time to wait for the queued messages to be delivered when the engine is flushed or
+	// destroyed. Defaults to 5 seconds.
+	FlushTimeout time.Duration `json:"flushTimeout,omitempty"`
+
+	// Optional directory where messages are stored when they cannot be delivered or the in-memory queue is
+	// full. They are sent, in order, once the server is reachable again, even after a restart.
+	SpoolDir string `json:"spoolDir,omitempty"`
+
+	// Set the maximum size of the spool directory. When exceeded, the oldest messages are deleted.
+	// Defaults to 64Mb.
+	MaxSpoolSize uint64 `json:"maxSpoolSize,omitempty"`
+
+	// TLSConfig optionally provides a TLS configuration for use. If set, the certificate and server name
+	// fields below are ignored.
 	TlsConfig *tls.Config
+
+	// Optional PEM encoded client certificate and private key files to authenticate with the server.
+	ClientCertFile string `json:"clientCertFile,omitempty"`
+	ClientKeyFile  string `json:"clientKeyFile,omitempty"`
+
+	// Optional PEM encoded CA certificates file used to verify the server instead of the system ones.
+	CAFile string `json:"caFile,omitempty"`
+
+	// Optional name to verify in the server certificate. Defaults to the host.
+	ServerName string `json:"serverName,omitempty"`
+
+	// DialFunc optionally provides a custom function to establish the connection to the server.
+	// If a secure connection is requested, the returned connection is wrapped in a TLS client.
+	DialFunc func(ctx context.Context, network, addr string) (net.Conn, error) `json:"-"`
+
+	// Optional engine, like a console one, that receives the messages instead of the server while it cannot be
+	// reached. It is owned by this engine and destroyed along with it.
+	FallbackEngine engines.Engine `json:"-"`
+
+	// Set the amount of consecutive delivery failures after which messages are sent to the fallback engine.
+	// Defaults to 3.
+	FallbackThreshold uint `json:"fallbackThreshold,omitempty"`
+
+	// Set how often to check if the server is reachable again while the fallback engine is used.
+	// Defaults to 10 seconds.
+	FallbackRetryInterval time.Duration `json:"fallbackRetryInterval,omitempty"`
+
+	// Optional callback invoked when a connection to the server is established, including reconnections.
+	OnConnect func(remote net.Addr) `json:"-"`
+
+	// Optional callback invoked when the server cannot be reached or a message cannot be written. Like
+	// OnConnect, it is called from the delivery goroutine and must not log to this engine.
+	OnError func(err error) `json:"-"`
 }
 
+// Framing defines how messages are delimited on stream-based transports.
+type Framing uint
+
+// OverflowPolicy defines what to do when the queue of messages waiting to be sent is full.
+type OverflowPolicy uint
+
+// Facility defines the type of program sending the messages as described in RFC 5424.
+type Facility uint
+
 type engine struct {
 	conn            net.Conn
 	appName         string
 	serverAddress   string
 	useTcp          bool
 	tlsConfig       *tls.Config
+	dialFunc        func(ctx context.Context, network, addr string) (net.Conn, error)
 	useRFC5424      bool
+	facility        Facility
+	timeLayout5424  string
+	trimZeros       bool
+	location        *time.Location
+	framing         Framing
+	escapeNewlines  bool
+	chunkSize       int
+	maxMsgLen       int
+	nextChunkID     uint64
+	idleTimeout     time.Duration
+	dialTimeout     time.Duration
+	keepAlivePeriod time.Duration
+	writeTimeout    time.Duration
+	flushTimeout    time.Duration
 	hostname        string
-	pid             int
+	procID          string
+	msgID           string
 	mtx             sync.Mutex
 	queue           *list.List
 	queueAvailEv    *resetevent.AutoResetEvent
+	queueEmptyEv    *resetevent.ManualResetEvent
 	maxQueueSize    uint
+	overflowPolicy  OverflowPolicy
+	overflowTimeout time.Duration
+	queueSpaceEv    *resetevent.AutoResetEvent
+	dropped         atomic.Uint64
+	draining        atomic.Int32
+	spool           *spool
+	lastSendFailed  atomic.Bool
+	sendFailures    atomic.Uint32
+	fallback        engines.Engine
+	fallbackLimit   uint32
+	fallbackRetry   time.Duration
+	onConnect       func(remote net.Addr)
+	onError         func(err error)
 	shutdownOnce    sync.Once
 	wg              sync.WaitGroup
 	workerCtx       context.Context
@@ -97,37 +317,134 @@ func NewEngine(opts Options) (engines.Engine, error) {
 		if len(opts.AppName) > extLen {
 			opts.AppName = opts.AppName[:(len(opts.AppName) - extLen)]
 		}
+		opts.AppName = sanitizeHeaderField(opts.AppName, maxAppNameLength)
+	} else if err := validateHeaderField("application name", opts.AppName, maxAppNameLength); err != nil {
+		return nil, err
+	}
+	if len(opts.ProcID) > 0 {
+		if err := validateHeaderField("process identifier", opts.ProcID, maxProcIDLength); err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.MsgID) > 0 {
+		if err := validateHeaderField("message identifier", opts.MsgID, maxMsgIDLength); err != nil {
+			return nil, err
+		}
 	}
 
 	// Create Syslog adapter
 	lg := &engine{
-		appName:      opts.AppName,
-		useTcp:       opts.UseTcp,
-		useRFC5424:   opts.UseRFC5424,
-		pid:          os.Getpid(),
-		mtx:          sync.Mutex{},
-		queue:        list.New(),
-		queueAvailEv: resetevent.NewAutoResetEvent(),
-		maxQueueSize: opts.MaxMessageQueueSize,
-		shutdownOnce: sync.Once{},
-		wg:           sync.WaitGroup{},
+		appName:         opts.AppName,
+		useTcp:          opts.UseTcp || opts.UseTls,
+		useRFC5424:      opts.UseRFC5424,
+		facility:        opts.Facility,
+		timeLayout5424:  "2006-01-02T15:04:05.000Z07:00",
+		location:        opts.TimeZone,
+		framing:         opts.Framing,
+		escapeNewlines:  opts.EscapeNewlines,
+		chunkSize:       int(opts.ChunkSize),
+		idleTimeout:     opts.IdleTimeout,
+		dialTimeout:     opts.DialTimeout,
+		writeTimeout:    opts.WriteTimeout,
+		flushTimeout:    opts.FlushTimeout,
+		keepAlivePeriod: opts.KeepAlivePeriod,
+		nextChunkID:     rand.Uint64(),
+		dialFunc:        opts.DialFunc,
+		procID:          opts.ProcID,
+		msgID:           opts.MsgID,
+		onConnect:       opts.OnConnect,
+		onError:         opts.OnError,
+		mtx:             sync.Mutex{},
+		queue:           list.New(),
+		queueAvailEv:    resetevent.NewAutoResetEvent(),
+		queueEmptyEv:    resetevent.NewManualResetEvent(),
+		maxQueueSize:    opts.MaxMessageQueueSize,
+		overflowPolicy:  opts.OverflowPolicy,
+		overflowTimeout: opts.OverflowTimeout,
+		queueSpaceEv:    resetevent.NewAutoResetEvent(),
+		shutdownOnce:    sync.Once{},
+		wg:              sync.WaitGroup{},
 	}
 	if opts.MaxMessageQueueSize == 0 {
 		lg.maxQueueSize = defaultMaxMessageQueueSize
 	}
 
-	lg.workerCtx, lg.workerCancelCtx = context.WithCancel(context.Background())
+	if opts.FlushTimeout == 0 {
+		lg.flushTimeout = defaultFlushTimeout
+	}
+
+	if opts.OverflowPolicy > OverflowBlockWithTimeout {
+		return nil, errors.New("invalid overflow policy")
+	}
+	if opts.OverflowTimeout == 0 {
+		lg.overflowTimeout = defaultOverflowTimeout
+	}
+
+	if opts.Facility == 0 {
+		lg.facility = FacilityUser
+	} else if opts.Facility > maxFacility {
+		return nil, errors.New("invalid facility")
+	}
+
+	if opts.Framing > FramingOctetCounting {
+		return nil, errors.New("invalid framing")
+	}
+
+	if opts.ChunkSize > 0 && opts.ChunkSize < MinChunkSize {
+		return nil, errors.New("chunk size too small")
+	}
+
+	if opts.MaxMessageLength != nil {
+		lg.maxMsgLen = int(*opts.MaxMessageLength)
+	} else if opts.ChunkSize == 0 {
+		if opts.UseRFC5424 {
+			lg.maxMsgLen = defaultMaxMessageLengthRFC5424
+		} else {
+			lg.maxMsgLen = defaultMaxMessageLengthRFC3164
+		}
+	}
 
 	if opts.UseTls {
 		if opts.TlsConfig != nil {
 			lg.tlsConfig = opts.TlsConfig.Clone()
 		} else {
-			lg.tlsConfig = &tls.Config{
-				MinVersion: 2,
+			var err error
+
+			lg.tlsConfig, err = newTlsConfig(opts)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(opts.SpoolDir) > 0 {
+		var err error
+
+		lg.spool, err = newSpool(opts.SpoolDir, opts.MaxSpoolSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.FallbackEngine != nil {
+		lg.fallback = opts.FallbackEngine
+		lg.fallbackLimit = defaultFallbackThreshold
+		if opts.FallbackThreshold > 0 {
+			if opts.FallbackThreshold > math.MaxUint32 {
+				return nil, errors.New("invalid fallback threshold")
 			}
+			lg.fallbackLimit = uint32(opts.FallbackThreshold)
+		}
+		lg.fallbackRetry = defaultFallbackRetryInterval
+		if opts.FallbackRetryInterval > 0 {
+			lg.fallbackRetry = opts.FallbackRetryInterval
 		}
 	}
 
+	lg.queueEmptyEv.Set()
+
+	lg.workerCtx, lg.workerCancelCtx = context.WithCancel(context.Background())
+
 	// Set the server host
 	if len(opts.Host) > 0 {
 		lg.serverAddress = opts.Host
@@ -153,6 +470,14 @@ func NewEngine(opts Options) (engines.Engine, error) {
 	// Set the client host name
 	lg.hostname, _ = os.Hostname()
 
+	// Set the header fields, using the nil value for the missing ones
+	if len(lg.procID) == 0 {
+		lg.procID = strconv.Itoa(os.Getpid())
+	}
+	if len(lg.msgID) == 0 {
+		lg.msgID = "-"
+	}
+
 	// Create a background messenger worker
 	lg.wg.Add(1)
 	go lg.messengerWorker()
@@ -167,6 +492,13 @@ func (lg *engine) Class() string {
 
 func (lg *engine) Destroy() {
 	lg.shutdownOnce.Do(func() {
+		ctx, cancelCtx := context.WithTimeout(context.Background(), lg.flushTimeout)
+		defer cancelCtx()
+
+		// Stop accepting new messages for good and let the worker deliver the queued ones
+		lg.draining.Add(1)
+		_, _ = lg.Drain(ctx)
+
 		// Stop worker
 		lg.workerCancelCtx()
 
@@ -176,75 +508,301 @@ func (lg *engine) Destroy() {
 		lg.workerCtx = nil
 		lg.workerCancelCtx = nil
 
-		// Flush queued messages
-		lg.flushQueue()
+		// Move the undelivered messages to the spool, if any
+		lg.flushQueue(ctx)
+		lg.queueEmptyEv.Set()
 
 		// Disconnect from the network
 		lg.disconnect()
+
+		if lg.spool != nil {
+			lg.spool.close()
+		}
+
+		if lg.fallback != nil {
+			lg.fallback.Destroy()
+		}
 	})
 }
 
+// Drain stops accepting new messages and waits until the queued ones are delivered or the context expires,
+// for example, to deliver all of them during a graceful shutdown before calling Destroy. New messages are
+// accepted again when it returns. It returns the amount of messages still in the queue. Messages stored in
+// the spool are not included.
+func (lg *engine) Drain(ctx context.Context) (int, error) {
+	lg.draining.Add(1)
+	defer lg.draining.Add(-1)
+
+	// Wake up the worker in case it is waiting
+	lg.queueAvailEv.Set()
+
+	err := lg.queueEmptyEv.Wait(ctx)
+
+	// Lock access
+	lg.mtx.Lock()
+	remaining := lg.queue.Len()
+	lg.mtx.Unlock()
+
+	if remaining == 0 {
+		return 0, nil
+	}
+	if err == nil {
+		// Messages queued while draining started
+		err = errors.New("queue not empty")
+	}
+	return remaining, err
+}
+
+// Flush waits until all the queued messages are delivered or the flush timeout expires.
+func (lg *engine) Flush() {
+	ctx, cancelCtx := context.WithTimeout(context.Background(), lg.flushTimeout)
+	defer cancelCtx()
+
+	_ = lg.queueEmptyEv.Wait(ctx)
+
+	if flusher, ok := lg.fallback.(engines.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Validate checks the server is reachable by establishing a new connection, including the TLS handshake
+// if a secure connection is used, and closing it without sending messages.
+func (lg *engine) Validate(ctx context.Context) error {
+	conn, err := lg.dial(ctx)
+	if err != nil {
+		return err
+	}
+	_ = conn.Close()
+
+	// Done
+	return nil
+}
+
+// Healthy returns false if the last attempt to send a message failed or there are messages in the spool.
+func (lg *engine) Healthy() bool {
+	return !lg.lastSendFailed.Load() && (lg.spool == nil || lg.spool.isEmpty())
+}
+
+// QueueDepth returns the amount of messages waiting in memory to be sent. Messages in the spool are not
+// included.
+func (lg *engine) QueueDepth() int {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	return lg.queue.Len()
+}
+
+// SetTimePrecision sets the amount of fractional second digits of RFC 5424 timestamps.
+func (lg *engine) SetTimePrecision(digits int) {
+	if digits > maxTimeFracDigits {
+		digits = maxTimeFracDigits
+	}
+
+	lg.timeLayout5424 = "2006-01-02T15:04:05"
+	if digits > 0 {
+		lg.timeLayout5424 += "." + strings.Repeat("0", digits)
+	}
+	lg.timeLayout5424 += "Z07:00"
+	if lg.trimZeros {
+		lg.timeLayout5424 = engines.LayoutWithTrimmedZeros(lg.timeLayout5424)
+	}
+
+	if setter, ok := lg.fallback.(engines.TimePrecisionSetter); ok {
+		setter.SetTimePrecision(digits)
+	}
+}
+
+// SetTrimTrailingZeros sets if the trailing zeros of the fractional seconds of RFC 5424 timestamps are
+// omitted, which the RFC allows.
+func (lg *engine) SetTrimTrailingZeros(trim bool) {
+	lg.trimZeros = trim
+	if trim {
+		lg.timeLayout5424 = engines.LayoutWithTrimmedZeros(lg.timeLayout5424)
+	} else {
+		lg.timeLayout5424 = strings.ReplaceAll(lg.timeLayout5424, "9", "0")
+	}
+
+	if trimmer, ok := lg.fallback.(engines.TrailingZerosTrimmer); ok {
+		trimmer.SetTrimTrailingZeros(trim)
+	}
+}
+
+// SetTimeLayout passes the logger time layout to the fallback engine. Syslog timestamps have a fixed format.
+func (lg *engine) SetTimeLayout(layout string) {
+	if setter, ok := lg.fallback.(engines.TimeLayoutSetter); ok {
+		setter.SetTimeLayout(layout)
+	}
+}
+
+// usingFallback returns true if messages must be sent to the fallback engine.
+func (lg *engine) usingFallback() bool {
+	return lg.fallback != nil && lg.sendFailures.Load() >= lg.fallbackLimit
+}
+
+// DroppedMessages returns the amount of messages discarded because the queue was full or they were sent
+// after Drain was called.
+func (lg *engine) DroppedMessages() uint64 {
+	return lg.dropped.Load()
+}
+
 func (lg *engine) Success(now time.Time, msg string, raw bool, sendSuccessAtErrorLogLevel bool) {
+	if lg.usingFallback() {
+		lg.fallback.Success(now, msg, raw, sendSuccessAtErrorLogLevel)
+		return
+	}
 	if sendSuccessAtErrorLogLevel {
-		lg.writeString(facilityUser, severityError, now, msg, raw)
+		lg.writeString(severityError, now, msg, raw)
 	} else {
-		lg.writeString(facilityUser, severityInformational, now, msg, raw)
+		lg.writeString(severityInformational, now, msg, raw)
 	}
 }
 
 func (lg *engine) Error(now time.Time, msg string, raw bool) {
-	lg.writeString(facilityUser, severityError, now, msg, raw)
+	if lg.usingFallback() {
+		lg.fallback.Error(now, msg, raw)
+		return
+	}
+	lg.writeString(severityError, now, msg, raw)
 }
 
 func (lg *engine) Warning(now time.Time, msg string, raw bool) {
-	lg.writeString(facilityUser, severityWarning, now, msg, raw)
+	if lg.usingFallback() {
+		lg.fallback.Warning(now, msg, raw)
+		return
+	}
+	lg.writeString(severityWarning, now, msg, raw)
 }
 
 func (lg *engine) Info(now time.Time, msg string, raw bool) {
-	lg.writeString(facilityUser, severityInformational, now, msg, raw)
+	if lg.usingFallback() {
+		lg.fallback.Info(now, msg, raw)
+		return
+	}
+	lg.writeString(severityInformational, now, msg, raw)
 }
 
 func (lg *engine) Debug(now time.Time, msg string, raw bool) {
-	lg.writeString(facilityUser, severityDebug, now, msg, raw)
+	if lg.usingFallback() {
+		lg.fallback.Debug(now, msg, raw)
+		return
+	}
+	lg.writeString(severityDebug, now, msg, raw)
 }
 
-func (lg *engine) writeString(facility int, severity int, now time.Time, msg string, _ bool) {
+func (lg *engine) writeString(severity int, now time.Time, msg string, _ bool) {
 	// Establish priority
-	priority := (facility * 8) + severity
+	priority := (int(lg.facility) * 8) + severity
 
-	// Remove or add new line depending on the transport protocol
-	if lg.useTcp {
-		if !strings.HasSuffix(msg, "\n") {
-			msg = msg + "\n"
-		}
-	} else {
-		msg = strings.TrimSuffix(msg, "\n")
+	now = engines.InLocation(now, lg.location)
+
+	msg = strings.TrimSuffix(msg, "\n")
+
+	// Embedded line breaks would split the message into several events if non-transparent framing is used
+	if lg.escapeNewlines && lg.useTcp && lg.framing == FramingNonTransparent {
+		msg = newlineEscaper.Replace(msg)
 	}
 
-	// Format and queue the message
+	// Format the message
 	// NOTE: We don't need to care here about the message type because level and timestamp are in separate fields.
+	var header string
 	if !lg.useRFC5424 {
-		lg.queueMessage("<" + strconv.Itoa(priority) + ">" + now.Format("Jan _2 15:04:05") + " " +
-			lg.hostname + " " + msg)
+		header = "<" + strconv.Itoa(priority) + ">" + now.Format("Jan _2 15:04:05") + " " + lg.hostname + " "
 	} else {
-		lg.queueMessage("<" + strconv.Itoa(priority) + ">1 " + now.Format("2006-02-01T15:04:05Z") + " " +
-			lg.hostname + " " + lg.appName + " " + strconv.Itoa(lg.pid) + " - - " + msg)
+		header = "<" + strconv.Itoa(priority) + ">1 " + now.Format(lg.timeLayout5424) + " " +
+			lg.hostname + " " + lg.appName + " " + lg.procID + " " + lg.msgID + " - "
+	}
+	msg = header + lg.truncateMessage(msg, len(header))
+
+	// Add the new line if non-transparent framing is used
+	if lg.useTcp && lg.framing == FramingNonTransparent {
+		msg = msg + "\n"
+	}
+
+	// Prefix the message with its length if octet-counting framing is used
+	if lg.useTcp && lg.framing == FramingOctetCounting {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	// Queue the message
+	lg.queueMessage(msg)
+}
+
+// truncateMessage shortens the message, which follows a header of the given length, to fit the maximum
+// message length. The header is always preserved.
+func (lg *engine) truncateMessage(msg string, headerLen int) string {
+	if lg.maxMsgLen == 0 || headerLen+len(msg) <= lg.maxMsgLen {
+		return msg
 	}
+
+	avail := lg.maxMsgLen - headerLen - len(truncatedMarker)
+	if avail < 0 {
+		avail = 0
+	}
+
+	// Do not split multibyte characters
+	for avail > 0 && !utf8.RuneStart(msg[avail]) {
+		avail -= 1
+	}
+	return msg[:avail] + truncatedMarker
 }
 
 func (lg *engine) queueMessage(msg string) {
-	// Lock access
-	lg.mtx.Lock()
-	defer lg.mtx.Unlock()
+	var waitCtx context.Context
 
-	// Add to queue
-	if uint(lg.queue.Len()) > lg.maxQueueSize {
-		elem := lg.queue.Front()
-		if elem != nil {
-			lg.queue.Remove(elem)
+	// Once draining, new messages are discarded
+	if lg.draining.Load() > 0 {
+		lg.dropped.Add(1)
+		return
+	}
+
+	for {
+		// Lock access
+		lg.mtx.Lock()
+
+		// Add to queue. If full, the overflow policy is applied unless the oldest message can be moved to
+		// the spool.
+		if uint(lg.queue.Len()) >= lg.maxQueueSize {
+			if lg.spool == nil && lg.overflowPolicy != OverflowDropOldest {
+				if lg.overflowPolicy == OverflowDropNewest || (waitCtx != nil && waitCtx.Err() != nil) {
+					lg.mtx.Unlock()
+					lg.dropped.Add(1)
+					return
+				}
+
+				// Wait for room without holding the lock so the worker can dequeue messages
+				lg.mtx.Unlock()
+				if waitCtx == nil {
+					var cancelWaitCtx context.CancelFunc
+
+					waitCtx, cancelWaitCtx = context.WithTimeout(context.Background(), lg.overflowTimeout)
+					defer cancelWaitCtx()
+				}
+				_ = lg.queueSpaceEv.Wait(waitCtx)
+				continue
+			}
+
+			elem := lg.queue.Front()
+			if elem != nil {
+				lg.queue.Remove(elem)
+				if lg.spool != nil {
+					_ = lg.spool.append(elem.Value.(string))
+				} else {
+					lg.dropped.Add(1)
+				}
+			}
 		}
+		lg.queue.PushBack(msg)
+		lg.queueEmptyEv.Reset()
+
+		// If there is still room, let other waiting callers continue
+		if uint(lg.queue.Len()) < lg.maxQueueSize {
+			lg.queueSpaceEv.Set()
+		}
+
+		lg.mtx.Unlock()
+		break
 	}
-	lg.queue.PushBack(msg)
 
 	// Wake up worker if needed
 	lg.queueAvailEv.Set()
@@ -257,45 +815,177 @@ func (lg *engine) dequeueMessage() (string, bool) {
 
 	elem := lg.queue.Front()
 	if elem == nil {
+		// Signal waiters that all messages were processed
+		lg.queueEmptyEv.Set()
 		return "", false
 	}
 
 	lg.queue.Remove(elem)
+
+	// Wake up a caller waiting for room in the queue
+	lg.queueSpaceEv.Set()
+
 	return elem.Value.(string), true
 }
 
 // The messenger worker do actual message delivery. The intention of this goroutine, is to
 // avoid halting the routine that sends the message if there are network issues.
 func (lg *engine) messengerWorker() {
+	var idleTimer *time.Timer
+	var idleCh <-chan time.Time
+	var retryTimer *time.Timer
+	var retryCh <-chan time.Time
+	var fallbackCh <-chan time.Time
+
 	defer lg.wg.Done()
 
+	// While the fallback engine is used, periodically check if the server is reachable again
+	if lg.fallback != nil {
+		fallbackTicker := time.NewTicker(lg.fallbackRetry)
+		defer fallbackTicker.Stop()
+		fallbackCh = fallbackTicker.C
+	}
+
+	defer func() {
+		if idleTimer != nil {
+			idleTimer.Stop()
+		}
+		if retryTimer != nil {
+			retryTimer.Stop()
+		}
+	}()
+
+	// Send the messages spooled by a previous run
+	drainSpool := lg.spool != nil && !lg.spool.isEmpty()
+	if drainSpool {
+		lg.queueAvailEv.Set()
+	}
+
+	retryBackoff := minSpoolRetryBackoff
 	for {
 		select {
 		case <-lg.workerCtx.Done():
 			return
 
+		case <-idleCh:
+			// Close the idle connection
+			lg.disconnect()
+			idleCh = nil
+			continue
+
+		case <-retryCh:
+			retryCh = nil
+			drainSpool = true
+
+		case <-fallbackCh:
+			if !lg.usingFallback() || lg.connect(lg.workerCtx) != nil {
+				continue
+			}
+			lg.sendFailures.Store(0)
+			lg.lastSendFailed.Store(false)
+			drainSpool = lg.spool != nil
+
 		case <-lg.queueAvailEv.WaitCh():
-			for {
-				msg, ok := lg.dequeueMessage()
-				if !ok {
-					break
+		}
+
+		if !lg.deliverMessages(lg.workerCtx, drainSpool) {
+			return
+		}
+		drainSpool = false
+
+		// If messages remain in the spool, retry later
+		if lg.spool != nil && !lg.spool.isEmpty() {
+			if retryCh == nil {
+				if retryTimer == nil {
+					retryTimer = time.NewTimer(retryBackoff)
+				} else {
+					retryTimer.Reset(retryBackoff)
 				}
+				retryCh = retryTimer.C
 
-				// Send message to server
-				err := lg.writeBytes(lg.workerCtx, []byte(msg))
+				retryBackoff *= 2
+				if retryBackoff > maxSpoolRetryBackoff {
+					retryBackoff = maxSpoolRetryBackoff
+				}
+			}
+		} else {
+			retryBackoff = minSpoolRetryBackoff
+		}
 
-				// Handle error
-				if err != nil && errors.Is(err, context.Canceled) {
-					return
+		// Restart the idle timer
+		if lg.useTcp && lg.idleTimeout > 0 && lg.conn != nil {
+			if idleTimer == nil {
+				idleTimer = time.NewTimer(lg.idleTimeout)
+			} else {
+				if !idleTimer.Stop() {
+					select {
+					case <-idleTimer.C:
+					default:
+					}
 				}
+				idleTimer.Reset(lg.idleTimeout)
 			}
+			idleCh = idleTimer.C
 		}
 	}
 }
 
-func (lg *engine) flushQueue() {
-	ctx, cancelCtx := context.WithDeadline(context.Background(), time.Now().Add(flushTimeout))
-	defer cancelCtx()
+// deliverMessages sends the queued messages. If the spool is in use, the spooled messages are sent first,
+// if drainSpool is set, and, while it is not empty, the queued messages are added to it to keep the order.
+// It returns false if the context was canceled.
+func (lg *engine) deliverMessages(ctx context.Context, drainSpool bool) bool {
+	if lg.spool != nil && drainSpool {
+		for {
+			msg, ok := lg.spool.peek()
+			if !ok {
+				break
+			}
+			err := lg.sendMessage(ctx, []byte(msg))
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					return false
+				}
+				break
+			}
+			lg.spool.commit()
+		}
+	}
+
+	for {
+		msg, ok := lg.dequeueMessage()
+		if !ok {
+			break
+		}
+
+		if lg.spool != nil && !lg.spool.isEmpty() {
+			_ = lg.spool.append(msg)
+			continue
+		}
+
+		// Send message to server
+		err := lg.sendMessage(ctx, []byte(msg))
+
+		// Handle error
+		if err != nil {
+			if lg.spool != nil {
+				_ = lg.spool.append(msg)
+			}
+			if errors.Is(err, context.Canceled) {
+				return false
+			}
+		}
+	}
+
+	// Done
+	return true
+}
+
+func (lg *engine) flushQueue(ctx context.Context) {
+	if lg.spool != nil {
+		// Send the spooled messages first and keep the ones that cannot be delivered for the next run
+		_ = lg.deliverMessages(ctx, true)
+		return
+	}
 
 	for {
 		// Dequeue next message
@@ -304,9 +994,10 @@ func (lg *engine) flushQueue() {
 			break // Reached the end
 		}
 		lg.queue.Remove(elem)
+		lg.queueSpaceEv.Set()
 
 		// Send message to server
-		err := lg.writeBytes(ctx, []byte(elem.Value.(string)))
+		err := lg.sendMessage(ctx, []byte(elem.Value.(string)))
 		if err != nil {
 			break // Stop on error
 		}
@@ -314,26 +1005,112 @@ func (lg *engine) flushQueue() {
 }
 
 func (lg *engine) connect(ctx context.Context) error {
-	var err error
-
 	lg.disconnect()
 
+	conn, err := lg.dial(ctx)
+	if err != nil {
+		lg.notifyError(err)
+		return err
+	}
+	lg.conn = conn
+	lg.notifyConnect(conn.RemoteAddr())
+
+	// Done
+	return nil
+}
+
+func (lg *engine) dial(ctx context.Context) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+
+	network := "udp"
 	if lg.useTcp {
-		if lg.tlsConfig != nil {
-			dialer := tls.Dialer{
-				Config: lg.tlsConfig,
+		network = "tcp"
+	}
+
+	if lg.dialTimeout > 0 {
+		var cancelCtx context.CancelFunc
+
+		ctx, cancelCtx = context.WithTimeout(ctx, lg.dialTimeout)
+		defer cancelCtx()
+	}
+
+	if lg.dialFunc != nil {
+		conn, err = lg.dialFunc(ctx, network, lg.serverAddress)
+		if err == nil && lg.keepAlivePeriod > 0 {
+			if tcpConn, ok := conn.(*net.TCPConn); ok {
+				_ = tcpConn.SetKeepAlive(true)
+				_ = tcpConn.SetKeepAlivePeriod(lg.keepAlivePeriod)
 			}
-			lg.conn, err = dialer.DialContext(ctx, "tcp", lg.serverAddress)
-		} else {
-			dialer := net.Dialer{}
-			lg.conn, err = dialer.DialContext(ctx, "tcp", lg.serverAddress)
 		}
+		if err == nil && lg.useTcp && lg.tlsConfig != nil {
+			tlsConn := tls.Client(conn, lg.getClientTlsConfig())
+			err = tlsConn.HandshakeContext(ctx)
+			if err != nil {
+				_ = conn.Close()
+				conn = nil
+			} else {
+				conn = tlsConn
+			}
+		}
+	} else if lg.useTcp && lg.tlsConfig != nil {
+		dialer := tls.Dialer{
+			NetDialer: &net.Dialer{
+				KeepAlive: lg.keepAlivePeriod,
+			},
+			Config: lg.tlsConfig,
+		}
+		conn, err = dialer.DialContext(ctx, network, lg.serverAddress)
 	} else {
-		dialer := net.Dialer{}
-		lg.conn, err = dialer.DialContext(ctx, "udp", lg.serverAddress)
+		dialer := net.Dialer{
+			KeepAlive: lg.keepAlivePeriod,
+		}
+		conn, err = dialer.DialContext(ctx, network, lg.serverAddress)
 	}
 
-	return err
+	return conn, err
+}
+
+// newTlsConfig creates the TLS configuration from the certificate files and server name of the options.
+func newTlsConfig(opts Options) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: opts.ServerName,
+	}
+
+	if len(opts.ClientCertFile) > 0 || len(opts.ClientKeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate. [%w]", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(opts.CAFile) > 0 {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load CA certificates. [%w]", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no CA certificates found")
+		}
+	}
+
+	// Done
+	return cfg, nil
+}
+
+// getClientTlsConfig returns the TLS configuration to use when wrapping connections created by a
+// custom dialer. Like tls.Dialer does, it sets the server name from the address if not specified.
+func (lg *engine) getClientTlsConfig() *tls.Config {
+	if len(lg.tlsConfig.ServerName) > 0 {
+		return lg.tlsConfig
+	}
+
+	cfg := lg.tlsConfig.Clone()
+	cfg.ServerName, _, _ = net.SplitHostPort(lg.serverAddress)
+	return cfg
 }
 
 func (lg *engine) disconnect() {
@@ -343,11 +1120,41 @@ func (lg *engine) disconnect() {
 	}
 }
 
+// sendMessage sends the message to the server splitting it in chunks if needed.
+func (lg *engine) sendMessage(ctx context.Context, b []byte) error {
+	if lg.useTcp || lg.chunkSize == 0 || len(b) <= lg.chunkSize {
+		return lg.writeBytes(ctx, b)
+	}
+
+	// The chunk header cannot describe larger messages, so they are truncated instead of being lost
+	if maxLen := maxChunkedMessageLength(lg.chunkSize); len(b) > maxLen {
+		avail := maxLen - len(truncatedMarker)
+		for avail > 0 && !utf8.RuneStart(b[avail]) {
+			avail -= 1
+		}
+		b = append(b[:avail:avail], truncatedMarker...)
+		lg.notifyError(errors.New("message too large to be split in chunks, truncated"))
+	}
+
+	lg.nextChunkID += 1
+	for _, chunk := range splitMessage(b, lg.nextChunkID, lg.chunkSize) {
+		err := lg.writeBytes(ctx, chunk)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Done
+	return nil
+}
+
 func (lg *engine) writeBytes(ctx context.Context, b []byte) error {
 	// Send the message if connected
 	if lg.conn != nil {
-		_, err := lg.conn.Write(b)
+		err := lg.write(b)
 		if err == nil {
+			lg.lastSendFailed.Store(false)
+			lg.sendFailures.Store(0)
 			return nil
 		}
 	}
@@ -355,12 +1162,80 @@ func (lg *engine) writeBytes(ctx context.Context, b []byte) error {
 	// On error or if disconnected, try to connect
 	err := lg.connect(ctx)
 	if err == nil {
-		_, err = lg.conn.Write(b)
+		err = lg.write(b)
 		if err != nil {
 			lg.disconnect()
+			lg.notifyError(err)
 		}
 	}
+	lg.lastSendFailed.Store(err != nil)
+	if err == nil {
+		lg.sendFailures.Store(0)
+	} else if lg.sendFailures.Load() < math.MaxUint32 {
+		lg.sendFailures.Add(1)
+	}
 
 	// Done
 	return err
 }
+
+// notifyConnect calls the OnConnect callback, if any, ignoring its panics.
+func (lg *engine) notifyConnect(remote net.Addr) {
+	if lg.onConnect == nil {
+		return
+	}
+	defer func() {
+		_ = recover()
+	}()
+
+	lg.onConnect(remote)
+}
+
+// notifyError calls the OnError callback, if any, ignoring its panics.
+func (lg *engine) notifyError(err error) {
+	if lg.onError == nil {
+		return
+	}
+	defer func() {
+		_ = recover()
+	}()
+
+	lg.onError(err)
+}
+
+func (lg *engine) write(b []byte) error {
+	if lg.writeTimeout > 0 {
+		_ = lg.conn.SetWriteDeadline(time.Now().Add(lg.writeTimeout))
+	}
+	_, err := lg.conn.Write(b)
+	return err
+}
+
+// validateHeaderField checks the value of an RFC 5424 header field only contains printable ASCII characters,
+// without spaces, and does not exceed the maximum length.
+func validateHeaderField(name string, value string, maxLen int) error {
+	if len(value) > maxLen {
+		return fmt.Errorf("%v too long (maximum is %d characters)", name, maxLen)
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] < 33 || value[i] > 126 {
+			return fmt.Errorf("invalid character in %v", name)
+		}
+	}
+	return nil
+}
+
+// sanitizeHeaderField replaces the characters not allowed in RFC 5424 header fields with underscores and
+// truncates the value to the maximum length.
+func sanitizeHeaderField(value string, maxLen int) string {
+	b := []byte(value)
+	for i := range b {
+		if b[i] < 33 || b[i] > 126 {
+			b[i] = '_'
+		}
+	}
+	if len(b) > maxLen {
+		b = b[:maxLen]
+	}
+	return string(b)
+}
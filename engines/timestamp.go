@@ -0,0 +1,115 @@
+package engines
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+
+const (
+	// DefaultTimeLayout is the layout used to format timestamps if none is specified.
+	DefaultTimeLayout = "2006-01-02 15:04:05.000"
+
+	// TimeLayoutEpoch is a special layout that formats timestamps as the number of seconds since the Unix epoch.
+	TimeLayoutEpoch = "@epoch"
+
+	// TimeLayoutEpochMillis is a special layout that formats timestamps as the number of milliseconds since
+	// the Unix epoch.
+	TimeLayoutEpochMillis = "@epochms"
+)
+
+// -----------------------------------------------------------------------------
+
+// FormatTimestamp formats the timestamp using the given layout. Besides the standard time package
+// layouts, it also accepts the special epoch layouts. An empty layout selects the default one.
+func FormatTimestamp(now time.Time, layout string) string {
+	switch layout {
+	case "":
+		return now.Format(DefaultTimeLayout)
+	case TimeLayoutEpoch:
+		return strconv.FormatInt(now.Unix(), 10)
+	case TimeLayoutEpochMillis:
+		return strconv.FormatInt(now.UnixMilli(), 10)
+	}
+	return now.Format(layout)
+}
+
+// InLocation returns the timestamp in the given time zone or unchanged if it is nil. Engines use it to
+// display the time in their own time zone.
+func InLocation(now time.Time, loc *time.Location) time.Time {
+	if loc != nil {
+		return now.In(loc)
+	}
+	return now
+}
+
+// LayoutWithPrecision returns the layout with its fractional seconds changed to the given amount of digits.
+// Zero digits removes them. Layouts without fractional seconds, like the epoch ones, are returned as is. An
+// empty layout is handled as the default one.
+func LayoutWithPrecision(layout string, digits int) string {
+	if IsNumericTimeLayout(layout) {
+		return layout
+	}
+	if len(layout) == 0 {
+		layout = DefaultTimeLayout
+	}
+
+	start, end := fractionalSeconds(layout)
+	if start < 0 {
+		return layout
+	}
+	frac := ""
+	if digits > 0 {
+		frac = layout[start:start+1] + strings.Repeat(layout[start+1:start+2], digits)
+	}
+	return layout[:start] + frac + layout[end:]
+}
+
+// LayoutWithTrimmedZeros returns the layout with its fractional seconds changed to omit the trailing zeros,
+// and the separator if all of them are zero. Layouts without fractional seconds are returned as is. An empty
+// layout is handled as the default one.
+func LayoutWithTrimmedZeros(layout string) string {
+	if IsNumericTimeLayout(layout) {
+		return layout
+	}
+	if len(layout) == 0 {
+		layout = DefaultTimeLayout
+	}
+
+	start, end := fractionalSeconds(layout)
+	if start < 0 {
+		return layout
+	}
+	return layout[:start+1] + strings.Repeat("9", end-start-1) + layout[end:]
+}
+
+// fractionalSeconds locates the fractional seconds that follow the seconds element of the layout, including
+// the separator. It returns -1 if the layout does not have them.
+func fractionalSeconds(layout string) (int, int) {
+	start := strings.Index(layout, "05")
+	for start >= 0 {
+		start += 2
+		end := start + 1
+		if end < len(layout) && (layout[start] == '.' || layout[start] == ',') &&
+			(layout[end] == '0' || layout[end] == '9') {
+			for end < len(layout) && layout[end] == layout[start+1] {
+				end += 1
+			}
+			return start, end
+		}
+
+		idx := strings.Index(layout[start:], "05")
+		if idx < 0 {
+			break
+		}
+		start += idx
+	}
+	return -1, -1
+}
+
+// IsNumericTimeLayout returns true if the layout produces a plain number.
+func IsNumericTimeLayout(layout string) bool {
+	return layout == TimeLayoutEpoch || layout == TimeLayoutEpochMillis
+}
@@ -0,0 +1,110 @@
+package logger
+
+import (
+	"sync"
+)
+
+//------------------------------------------------------------------------------
+
+// Entry accumulates the fields of a structured message that is emitted as a JSON object by one of its level
+// methods, like lg.Entry().Str("user", id).Int("count", n).Error("failed"). Entries are single-use: once a
+// level method is called, the entry is recycled and must not be used again.
+type Entry struct {
+	lg            *Logger
+	keysAndValues []interface{}
+}
+
+//------------------------------------------------------------------------------
+
+var entryPool = sync.Pool{
+	New: func() interface{} {
+		return &Entry{
+			keysAndValues: make([]interface{}, 0, 16),
+		}
+	},
+}
+
+//------------------------------------------------------------------------------
+
+// Entry returns a new entry to build a structured message.
+func (lg *Logger) Entry() *Entry {
+	e := entryPool.Get().(*Entry)
+	e.lg = lg
+	return e
+}
+
+// Str adds a string field.
+func (e *Entry) Str(key string, value string) *Entry {
+	return e.Any(key, value)
+}
+
+// Int adds an integer field.
+func (e *Entry) Int(key string, value int) *Entry {
+	return e.Any(key, value)
+}
+
+// Bool adds a boolean field.
+func (e *Entry) Bool(key string, value bool) *Entry {
+	return e.Any(key, value)
+}
+
+// Float adds a floating point field.
+func (e *Entry) Float(key string, value float64) *Entry {
+	return e.Any(key, value)
+}
+
+// Err adds the message of the error under the error key. Nil errors are ignored.
+func (e *Entry) Err(err error) *Entry {
+	if err == nil {
+		return e
+	}
+	return e.Any("error", err)
+}
+
+// Any adds a field with a value of any type, encoded as JSON. If a key is repeated, the last value is used.
+func (e *Entry) Any(key string, value interface{}) *Entry {
+	e.keysAndValues = append(e.keysAndValues, key, value)
+	return e
+}
+
+// Success emits the entry as a success message.
+func (e *Entry) Success(msg string) {
+	e.lg.Successw(msg, e.keysAndValues...)
+	e.release()
+}
+
+// Error emits the entry as an error message.
+func (e *Entry) Error(msg string) {
+	e.lg.Errorw(msg, e.keysAndValues...)
+	e.release()
+}
+
+// Warning emits the entry as a warning message.
+func (e *Entry) Warning(msg string) {
+	e.lg.Warningw(msg, e.keysAndValues...)
+	e.release()
+}
+
+// Info emits the entry as an information message.
+func (e *Entry) Info(msg string) {
+	e.lg.Infow(msg, e.keysAndValues...)
+	e.release()
+}
+
+// Debug emits the entry as a debug message with the given debug level.
+func (e *Entry) Debug(level uint, msg string) {
+	e.lg.Debugw(level, msg, e.keysAndValues...)
+	e.release()
+}
+
+// release returns the entry to the pool. Entries with many fields are not kept to avoid holding large
+// buffers.
+func (e *Entry) release() {
+	e.lg = nil
+	if cap(e.keysAndValues) > 256 {
+		return
+	}
+	clear(e.keysAndValues)
+	e.keysAndValues = e.keysAndValues[:0]
+	entryPool.Put(e)
+}
@@ -0,0 +1,20 @@
+package logger
+
+//------------------------------------------------------------------------------
+
+// Filter is a function that decides if a message is emitted. It receives the message already formatted,
+// that is, the text or the JSON encoded object, without the timestamp, level and caller fields.
+type Filter func(level LogLevel, msg string, isJSON bool) bool
+
+//------------------------------------------------------------------------------
+
+// SetFilter sets a function that is called for every message that passes the level gate. If it returns
+// false, the message is dropped. Pass nil to remove it. The filter is called while the logger is locked
+// for reading, so it must not change the logger settings.
+func (lg *Logger) SetFilter(fn Filter) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	lg.filter = fn
+}
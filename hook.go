@@ -0,0 +1,73 @@
+package logger
+
+import (
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+// Hook is a function called for each emitted message, for example, to update metrics or to attach the
+// message to a tracing span. The message is the one passed to the logger, without the timestamp, level
+// and caller fields.
+type Hook func(level LogLevel, msg string, isJSON bool, t time.Time)
+
+// HookHandle identifies an added hook so it can be removed.
+type HookHandle uint64
+
+type hookEntry struct {
+	handle HookHandle
+	fn     Hook
+}
+
+//------------------------------------------------------------------------------
+
+// AddHook adds a function to call for every message that passes the level gate, before it is sent to the
+// engines. Hooks are called synchronously, in the order they were added, and panics inside them are ignored.
+// Hooks must not add or remove hooks.
+func (lg *Logger) AddHook(fn Hook) HookHandle {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	lg.nextHookHandle += 1
+	lg.hooks = append(lg.hooks, hookEntry{
+		handle: lg.nextHookHandle,
+		fn:     fn,
+	})
+
+	// Done
+	return lg.nextHookHandle
+}
+
+// RemoveHook removes a hook added with AddHook. It returns false if the hook was not found.
+func (lg *Logger) RemoveHook(handle HookHandle) bool {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	for idx, h := range lg.hooks {
+		if h.handle == handle {
+			lg.hooks = append(lg.hooks[:idx:idx], lg.hooks[idx+1:]...)
+			return true
+		}
+	}
+
+	// Not found
+	return false
+}
+
+// runHooks calls the hooks. The caller must hold the read lock.
+func (lg *Logger) runHooks(_type logType, msg string, isJSON bool, now time.Time) {
+	level := logTypeLevel(_type, lg.successLevel)
+	for _, h := range lg.hooks {
+		callHook(h.fn, level, msg, isJSON, now)
+	}
+}
+
+func callHook(fn Hook, level LogLevel, msg string, isJSON bool, now time.Time) {
+	defer func() {
+		_ = recover()
+	}()
+
+	fn(level, msg, isJSON, now)
+}
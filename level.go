@@ -0,0 +1,155 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//------------------------------------------------------------------------------
+
+// ParseLogLevel converts a level name into a LogLevel. Names are case-insensitive.
+func ParseLogLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "quiet":
+		return LogLevelQuiet, nil
+	case "error":
+		return LogLevelError, nil
+	case "warning", "warn":
+		return LogLevelWarning, nil
+	case "info":
+		return LogLevelInfo, nil
+	case "debug":
+		return LogLevelDebug, nil
+	}
+	return LogLevelQuiet, fmt.Errorf("unrecognized log level \"%v\" (expected quiet, error, warning, info or debug)", s)
+}
+
+// String returns the name of the level.
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelQuiet:
+		return "quiet"
+	case LogLevelError:
+		return "error"
+	case LogLevelWarning:
+		return "warning"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelDebug:
+		return "debug"
+	}
+	return fmt.Sprintf("LogLevel(%d)", uint(l))
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (l LogLevel) MarshalText() ([]byte, error) {
+	if l > LogLevelDebug {
+		return nil, fmt.Errorf("invalid log level %d", uint(l))
+	}
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (l *LogLevel) UnmarshalText(text []byte) error {
+	level, err := ParseLogLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. Besides level names, it also accepts
+// the numeric values used by previous versions.
+func (l *LogLevel) UnmarshalJSON(data []byte) error {
+	var num uint
+
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+
+		err := json.Unmarshal(data, &s)
+		if err != nil {
+			return err
+		}
+		return l.UnmarshalText([]byte(s))
+	}
+
+	err := json.Unmarshal(data, &num)
+	if err != nil {
+		return err
+	}
+	if LogLevel(num) > LogLevelDebug {
+		return fmt.Errorf("invalid log level %d", num)
+	}
+	*l = LogLevel(num)
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// Log emits a message with the given level, for code that receives it as a value, like adapters of other
+// logging libraries. Debug messages are emitted with debug level zero, see LogDebug. Quiet and unknown levels
+// are ignored.
+func (lg *Logger) Log(level LogLevel, obj interface{}) {
+	switch level {
+	case LogLevelError:
+		lg.Error(obj)
+	case LogLevelWarning:
+		lg.Warning(obj)
+	case LogLevelInfo:
+		lg.Info(obj)
+	case LogLevelDebug:
+		lg.Debug(0, obj)
+	}
+}
+
+// Logf emits a formatted message with the given level like Log does.
+func (lg *Logger) Logf(level LogLevel, format string, args ...interface{}) {
+	switch level {
+	case LogLevelError:
+		lg.Errorf(format, args...)
+	case LogLevelWarning:
+		lg.Warningf(format, args...)
+	case LogLevelInfo:
+		lg.Infof(format, args...)
+	case LogLevelDebug:
+		lg.Debugf(0, format, args...)
+	}
+}
+
+// LogDebug emits a message with the given level like Log does but using the specified debug level.
+func (lg *Logger) LogDebug(level LogLevel, debugLevel uint, obj interface{}) {
+	if level == LogLevelDebug {
+		lg.Debug(debugLevel, obj)
+		return
+	}
+	lg.Log(level, obj)
+}
+
+// Level returns the current minimum level and debug level of the messages to emit.
+func (lg *Logger) Level() (LogLevel, uint) {
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	return lg.logLevel, lg.debugLogLevel
+}
+
+// Enabled returns true if a message with the given level, and debug level for debug messages, would be
+// emitted, so callers can avoid building expensive messages. Messages are not emitted if there are no
+// engines or hooks. The filter, sampling and deduplication are not considered because they depend on the
+// message.
+func (lg *Logger) Enabled(level LogLevel, debugLevel uint) bool {
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	if level == LogLevelQuiet || level > LogLevelDebug || lg.logLevel < level {
+		return false
+	}
+	if level == LogLevelDebug && lg.debugLogLevel < debugLevel {
+		return false
+	}
+	return len(lg.engines) > 0 || len(lg.hooks) > 0
+}
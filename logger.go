@@ -1,12 +1,32 @@
 package logger
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"reflect"
+	"regexp"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/mxmauro/logger/engines"
+	"github.com/mxmauro/logger/engines/cloudwatch"
 	"github.com/mxmauro/logger/engines/console"
 	"github.com/mxmauro/logger/engines/file"
+	"github.com/mxmauro/logger/engines/http"
+	"github.com/mxmauro/logger/engines/journald"
+	"github.com/mxmauro/logger/engines/kafka"
+	"github.com/mxmauro/logger/engines/memory"
+	"github.com/mxmauro/logger/engines/null"
+	"github.com/mxmauro/logger/engines/otlp"
+	"github.com/mxmauro/logger/engines/prometheus"
+	"github.com/mxmauro/logger/engines/seq"
 	"github.com/mxmauro/logger/engines/syslog"
 )
 
@@ -14,12 +34,44 @@ import (
 
 // Logger is the object that controls logging.
 type Logger struct {
-	mtx                        sync.RWMutex
-	engines                    []engines.Engine
-	logLevel                   LogLevel
-	debugLogLevel              uint
-	useLocalTime               bool
-	sendSuccessAtErrorLogLevel bool
+	mtx                    sync.RWMutex
+	engines                []engines.Engine
+	logLevel               LogLevel
+	debugLogLevel          uint
+	levelGate              atomic.Pointer[levelGate]
+	levelRevertTimer       *time.Timer
+	levelRevertSeq         uint64
+	savedLogLevel          LogLevel
+	savedDebugLogLevel     uint
+	useLocalTime           bool
+	location               *time.Location
+	successLevel           LogLevel
+	debugSampleRate        float64
+	includeCaller          bool
+	attachStackTrace       bool
+	stackTraceMaxFrames    int
+	timeLayout             string
+	timePrecision          TimePrecision
+	trimTrailingZeros      bool
+	schemaVersion          string
+	fields                 string
+	wrapStrings            bool
+	deduplicateStreams     bool
+	sampler                *sampler
+	deduplicator           *deduplicator
+	redactor               *redactor
+	sanitizeControlChars   bool
+	controlCharsAction     ControlCharsAction
+	activeGoroutines       sync.Map
+	async                  *asyncQueue
+	goroutineDumpMaxSize   int
+	goroutineDumpWriter    io.Writer
+	filter                 Filter
+	hooks                  []hookEntry
+	nextHookHandle         HookHandle
+	destroyed              atomic.Bool
+	disableNoEngineWarning bool
+	noEngineWarning        sync.Once
 }
 
 // Options specifies the logger settings to use when initialized.
@@ -36,11 +88,152 @@ type Options struct {
 	// By default, success messages are sent at "Info" log level but you can change it
 	// to send them along with error messages.
 	SendSuccessAtErrorLogLevel bool `json:"successAtErrorLogLevel,omitempty"`
+
+	// Set the log level of success messages, for example, LogLevelWarning to emit them even if info messages
+	// are not, or LogLevelQuiet to never emit them. Defaults to LogLevelInfo, or LogLevelError if
+	// SendSuccessAtErrorLogLevel is set. Hooks, filters and deduplication see success messages at this level,
+	// and engines receive them as errors if it is LogLevelError.
+	SuccessLevel *LogLevel `json:"successLevel,omitempty"`
+
+	// Set the fraction, between 0.0 and 1.0, of debug messages to emit. Each call is sampled
+	// independently so bursts are not preserved. Zero disables sampling.
+	DebugSampleRate float64 `json:"debugSampleRate,omitempty"`
+
+	// Include the file name and line number of the caller in the output.
+	IncludeCaller bool `json:"includeCaller,omitempty"`
+
+	// Attach the call stack to error messages, as a "stack" field in JSON messages or as additional lines in
+	// text ones.
+	AttachStackTrace bool `json:"attachStackTrace,omitempty"`
+
+	// Set the maximum amount of frames of the attached call stacks. Defaults to 32.
+	StackTraceMaxFrames uint `json:"stackTraceMaxFrames,omitempty"`
+
+	// Set the layout used to format timestamps. Besides the standard time package layouts, the special
+	// TimeLayoutEpoch and TimeLayoutEpochMillis values are accepted. Defaults to "2006-01-02 15:04:05.000".
+	TimeLayout string `json:"timeLayout,omitempty"`
+
+	// Set the precision of the fractional seconds of timestamps. It changes the fractional seconds of the
+	// time layout, if it has them, and of the RFC 5424 syslog timestamps, limited to microseconds by the RFC.
+	// Defaults to TimePrecisionMillis, which keeps the time layout as is.
+	TimePrecision TimePrecision `json:"timePrecision,omitempty"`
+
+	// Omit the trailing zeros of the fractional seconds of timestamps, and the separator if all of them are
+	// zero, for parsers expecting variable length fractions. Timestamps have a fixed width by default.
+	TrimTrailingZeros bool `json:"trimTrailingZeros,omitempty"`
+
+	// Set the version of the record format to add as the schema_version field of JSON messages so parsers of
+	// long-lived archives can handle format changes. Text messages are not affected.
+	SchemaVersion string `json:"schemaVersion,omitempty"`
+
+	// Static fields, like the service name or the environment, to add to every JSON message. Values that
+	// cannot be encoded as JSON are ignored.
+	Fields map[string]interface{} `json:"fields,omitempty"`
+
+	// Send text messages as JSON objects, with the text in the message field, so they also carry the static
+	// fields. Only applies if Fields is not empty. Defaults to true.
+	WrapStrings *bool `json:"wrapStrings,omitempty"`
+
+	// Do not add engines that write to a stream, like the standard output, already used by another engine.
+	// AddEngine destroys them and returns ErrDuplicateStream. If not set, a warning is printed to the standard
+	// error instead.
+	DeduplicateStreams bool `json:"deduplicateStreams,omitempty"`
+
+	// Limit the amount of repeated messages emitted on each interval. Disabled by default.
+	Sampling *Sampling `json:"sampling,omitempty"`
+
+	// Collapse consecutive identical messages into a summary with the amount of repetitions. Disabled by default.
+	Deduplication *Deduplication `json:"deduplication,omitempty"`
+
+	// Replace the values of these keys in JSON messages, at any depth, with "***". Keys are case-insensitive.
+	RedactKeys []string `json:"redactKeys,omitempty"`
+
+	// Replace the parts of text messages and JSON string values that match this expression with "***".
+	RedactPattern *regexp.Regexp `json:"-"`
+
+	// Neutralize the control characters of text messages, like line breaks or terminal escape sequences, so
+	// untrusted values cannot forge log entries. JSON messages are not affected because encoding escapes them.
+	SanitizeControlChars bool `json:"sanitizeControlChars,omitempty"`
+
+	// Set what to do with the control characters when SanitizeControlChars is set. Defaults to
+	// ControlCharsEscape.
+	ControlCharsAction ControlCharsAction `json:"controlCharsAction,omitempty"`
+
+	// Deliver messages to the engines from a background goroutine so callers are not blocked by slow engines.
+	// What happens if the buffer is full depends on AsyncOverflowPolicy.
+	Async bool `json:"async,omitempty"`
+
+	// Set the amount of messages the asynchronous mode can hold before dropping them. Defaults to 1024.
+	AsyncBufferSize uint `json:"asyncBufferSize,omitempty"`
+
+	// Set what to do when the asynchronous mode buffer is full. Defaults to OverflowDropNewest.
+	AsyncOverflowPolicy OverflowPolicy `json:"asyncOverflowPolicy,omitempty"`
+
+	// In asynchronous mode, discard messages that waited in the buffer longer than this period, for example,
+	// because an engine was stuck, instead of delivering obsolete messages. Zero disables it.
+	MaxRecordAge time.Duration `json:"maxRecordAge,omitempty"`
+
+	// Set the maximum size of the dumps generated by DumpGoroutines. Larger dumps are truncated.
+	// Defaults to 1MB.
+	GoroutineDumpMaxSize uint `json:"goroutineDumpMaxSize,omitempty"`
+
+	// Optional writer where DumpGoroutines sends the dumps instead of logging them at debug level.
+	GoroutineDumpWriter io.Writer `json:"-"`
+
+	// Do not print a warning to the standard error the first time a message is logged while no engine is
+	// added. Set it for loggers that intentionally discard everything.
+	DisableNoEngineWarning bool `json:"disableNoEngineWarning,omitempty"`
+}
+
+// Stats contains counters useful to monitor the logger.
+type Stats struct {
+	// Amount of messages dropped by the sampler.
+	SampledOut uint64 `json:"sampledOut"`
+
+	// Capacity of the asynchronous mode buffer.
+	AsyncBufferSize int `json:"asyncBufferSize"`
+
+	// Amount of messages waiting in the asynchronous mode buffer.
+	AsyncBuffered int `json:"asyncBuffered"`
+
+	// Maximum amount of messages the asynchronous mode buffer held at once.
+	AsyncHighWaterMark int `json:"asyncHighWaterMark"`
+
+	// Amount of messages dropped because the asynchronous mode buffer was full.
+	AsyncDropped uint64 `json:"asyncDropped"`
+
+	// Amount of messages discarded because they waited in the asynchronous mode buffer for too long.
+	AsyncDroppedStale uint64 `json:"asyncDroppedStale"`
+}
+
+// EngineHealth contains the status of an engine that delivers messages over the network.
+type EngineHealth struct {
+	// False if the last attempt to deliver messages failed.
+	Healthy bool `json:"healthy"`
+
+	// Amount of messages waiting to be delivered.
+	QueueDepth int `json:"queueDepth"`
+
+	// Amount of messages discarded because the queue was full, for engines that keep track of it.
+	Dropped uint64 `json:"dropped,omitempty"`
+}
+
+// Loggable is implemented by types that choose what is logged when they are passed to the logging
+// methods, for example, a user returning only its identifier. The returned value is logged instead, as a
+// text message if it is a string or as a JSON object if it is a struct or a map.
+type Loggable interface {
+	LogValue() interface{}
 }
 
 // LogLevel defines the level of message verbosity.
 type LogLevel uint
 
+// TimePrecision defines the amount of fractional second digits of timestamps.
+type TimePrecision uint
+
+// ControlCharsAction defines how the control characters of text messages are neutralized.
+type ControlCharsAction uint
+
 // -----------------------------------------------------------------------------
 
 const (
@@ -51,64 +244,178 @@ const (
 	LogLevelDebug   LogLevel = 4
 )
 
+const (
+	TimePrecisionMillis  TimePrecision = 0
+	TimePrecisionSeconds TimePrecision = 1
+	TimePrecisionMicros  TimePrecision = 2
+	TimePrecisionNanos   TimePrecision = 3
+)
+
+const (
+	// ControlCharsEscape replaces the control characters with escape sequences, like \n or \x1b.
+	ControlCharsEscape ControlCharsAction = 0
+
+	// ControlCharsStrip removes the control characters.
+	ControlCharsStrip ControlCharsAction = 1
+)
+
+const (
+	TimeLayoutDefault     = engines.DefaultTimeLayout
+	TimeLayoutRFC3339     = "2006-01-02T15:04:05.000Z07:00"
+	TimeLayoutEpoch       = engines.TimeLayoutEpoch
+	TimeLayoutEpochMillis = engines.TimeLayoutEpochMillis
+)
+
 //------------------------------------------------------------------------------
 
 var (
-	defaultLoggerInit = sync.Once{}
-	defaultLogger     *Logger
+	defaultLoggerMtx = sync.Mutex{}
+	defaultLogger    atomic.Pointer[Logger]
+)
+
+const (
+	defaultGoroutineDumpMaxSize = 1024 * 1024
+	defaultStackTraceMaxFrames  = 32
 )
 
+// ErrDestroyed is returned when an engine is added to a destroyed logger.
+var ErrDestroyed = errors.New("logger destroyed")
+
+// ErrDuplicateStream is returned, if DeduplicateStreams is set, when an engine writing to an already used
+// stream is added. The engine is destroyed and must not be used.
+var ErrDuplicateStream = errors.New("engine writes to an already used stream")
+
+// ExitFunc is the function called by Fatal to terminate the application. Tests can replace it.
+var ExitFunc = os.Exit
+
 //------------------------------------------------------------------------------
 
-// Default returns a logger that only outputs error and warnings to the console.
+// Default returns the package default logger. Unless replaced with SetDefault, it is a logger that only
+// outputs to the console, created on first use.
 func Default() *Logger {
-	defaultLoggerInit.Do(func() {
-		defaultLogger = Create(Options{
+	lg := defaultLogger.Load()
+	if lg != nil {
+		return lg
+	}
+
+	// Lock access
+	defaultLoggerMtx.Lock()
+	defer defaultLoggerMtx.Unlock()
+
+	lg = defaultLogger.Load()
+	if lg == nil {
+		lg = Create(Options{
 			Level: LogLevelInfo,
 		})
-		defaultLogger.AddConsoleEngine(console.Options{})
+		_ = lg.AddConsoleEngine(console.Options{})
+		defaultLogger.Store(lg)
+	}
+
+	// Done
+	return lg
+}
+
+// SetDefault replaces the logger returned by Default. The previous default logger can be destroyed
+// afterwards. If nil, a new console logger is created on the next call to Default.
+func SetDefault(lg *Logger) {
+	// Lock access
+	defaultLoggerMtx.Lock()
+	defer defaultLoggerMtx.Unlock()
+
+	defaultLogger.Store(lg)
+}
+
+// Discard returns a new logger that processes messages at the debug level but discards them. It is useful
+// to pass to code under test and for benchmarks. A new instance is returned on each call.
+func Discard() *Logger {
+	lg := Create(Options{
+		Level:      LogLevelDebug,
+		DebugLevel: math.MaxUint,
 	})
-	return defaultLogger
+	_ = lg.AddEngine(null.NewEngine())
+	return lg
 }
 
 // Create creates a new logger.
 func Create(opts Options) *Logger {
+	successLevel := LogLevelInfo
+	if opts.SuccessLevel != nil {
+		successLevel = *opts.SuccessLevel
+	} else if opts.SendSuccessAtErrorLogLevel {
+		successLevel = LogLevelError
+	}
+
 	// Create logger
 	lg := &Logger{
-		mtx:                        sync.RWMutex{},
-		engines:                    make([]engines.Engine, 0),
-		logLevel:                   opts.Level,
-		debugLogLevel:              opts.DebugLevel,
-		useLocalTime:               opts.UseLocalTime,
-		sendSuccessAtErrorLogLevel: opts.SendSuccessAtErrorLogLevel,
+		mtx:                    sync.RWMutex{},
+		engines:                make([]engines.Engine, 0),
+		logLevel:               opts.Level,
+		debugLogLevel:          opts.DebugLevel,
+		useLocalTime:           opts.UseLocalTime,
+		debugSampleRate:        opts.DebugSampleRate,
+		includeCaller:          opts.IncludeCaller,
+		attachStackTrace:       opts.AttachStackTrace,
+		stackTraceMaxFrames:    int(opts.StackTraceMaxFrames),
+		timePrecision:          opts.TimePrecision,
+		trimTrailingZeros:      opts.TrimTrailingZeros,
+		schemaVersion:          opts.SchemaVersion,
+		fields:                 marshalFields(opts.Fields),
+		deduplicateStreams:     opts.DeduplicateStreams,
+		sampler:                newSampler(opts.Sampling),
+		successLevel:           successLevel,
+		deduplicator:           newDeduplicator(opts.Deduplication, successLevel),
+		redactor:               newRedactor(opts.RedactKeys, opts.RedactPattern),
+		sanitizeControlChars:   opts.SanitizeControlChars,
+		controlCharsAction:     opts.ControlCharsAction,
+		goroutineDumpMaxSize:   int(opts.GoroutineDumpMaxSize),
+		goroutineDumpWriter:    opts.GoroutineDumpWriter,
+		disableNoEngineWarning: opts.DisableNoEngineWarning,
+	}
+	if opts.GoroutineDumpMaxSize == 0 {
+		lg.goroutineDumpMaxSize = defaultGoroutineDumpMaxSize
+	}
+	if opts.StackTraceMaxFrames == 0 {
+		lg.stackTraceMaxFrames = defaultStackTraceMaxFrames
+	}
+	lg.setLevel(opts.Level, opts.DebugLevel)
+	lg.timeLayout = lg.applyTimeFormat(opts.TimeLayout)
+	if len(lg.fields) > 0 {
+		lg.wrapStrings = opts.WrapStrings == nil || *opts.WrapStrings
+	}
+	if opts.Async {
+		lg.async = newAsyncQueue(lg, opts.AsyncBufferSize, opts.AsyncOverflowPolicy, opts.MaxRecordAge)
 	}
 
 	// Done
 	return lg
 }
 
-// Destroy shuts down the logger.
+// Destroy shuts down the logger. It is safe to call it more than once, and messages sent afterwards are
+// discarded.
 func (lg *Logger) Destroy() {
-	// Lock access
-	lg.mtx.Lock()
-	defer lg.mtx.Unlock()
+	_ = lg.destroy(0)
+}
 
-	// The default logger cannot be destroyed
-	if lg == defaultLogger {
-		return
-	}
+// DestroyWithTimeout shuts down the logger like Destroy does but destroys the engines concurrently and
+// returns when the timeout expires even if some of them are still delivering their pending messages. The
+// engines that did not finish are reported to the standard error. A zero timeout waits for all of them.
+func (lg *Logger) DestroyWithTimeout(d time.Duration) {
+	_ = lg.destroy(d)
+}
 
-	// Destroy all engines
-	for _, engine := range lg.engines {
-		engine.Destroy()
-	}
-	lg.engines = nil
+// Close destroys the logger like Destroy does, so it can be used as an io.Closer. It returns the errors
+// the engines had while delivering the last messages, if any.
+func (lg *Logger) Close() error {
+	return lg.destroy(0)
 }
 
 // AddConsoleEngine adds a console output to the logger.
-func (lg *Logger) AddConsoleEngine(opts console.Options) {
-	engine := console.NewEngine(opts)
-	_ = lg.AddEngine(engine)
+func (lg *Logger) AddConsoleEngine(opts console.Options) error {
+	engine, err := console.NewEngine(opts)
+	if err != nil {
+		return err
+	}
+	return lg.AddEngine(engine)
 }
 
 // AddFileEngine adds a file-based output to the logger.
@@ -129,6 +436,78 @@ func (lg *Logger) AddSysLogEngine(opts syslog.Options) error {
 	return lg.AddEngine(engine)
 }
 
+// AddHTTPEngine adds the engine that sends the output to an HTTP endpoint.
+func (lg *Logger) AddHTTPEngine(opts http.Options) error {
+	engine, err := http.NewEngine(opts)
+	if err != nil {
+		return err
+	}
+	return lg.AddEngine(engine)
+}
+
+// AddSeqEngine adds the engine that sends the output to a Seq server.
+func (lg *Logger) AddSeqEngine(opts seq.Options) error {
+	engine, err := seq.NewEngine(opts)
+	if err != nil {
+		return err
+	}
+	return lg.AddEngine(engine)
+}
+
+// AddCloudWatchEngine adds the engine that sends the output to AWS CloudWatch Logs.
+func (lg *Logger) AddCloudWatchEngine(opts cloudwatch.Options) error {
+	engine, err := cloudwatch.NewEngine(opts)
+	if err != nil {
+		return err
+	}
+	return lg.AddEngine(engine)
+}
+
+// AddKafkaEngine adds the engine that produces the output to a Kafka topic.
+func (lg *Logger) AddKafkaEngine(opts kafka.Options) error {
+	engine, err := kafka.NewEngine(opts)
+	if err != nil {
+		return err
+	}
+	return lg.AddEngine(engine)
+}
+
+// AddOTLPEngine adds the engine that exports the output to an OpenTelemetry collector over OTLP/gRPC.
+func (lg *Logger) AddOTLPEngine(opts otlp.Options) error {
+	engine, err := otlp.NewEngine(opts)
+	if err != nil {
+		return err
+	}
+	return lg.AddEngine(engine)
+}
+
+// AddMemoryEngine adds an engine that keeps the most recent messages in memory. Use the returned engine
+// to retrieve them.
+func (lg *Logger) AddMemoryEngine(opts memory.Options) *memory.Engine {
+	engine := memory.NewEngine(opts)
+	_ = lg.AddEngine(engine)
+	return engine
+}
+
+// AddPrometheusEngine adds an engine that does not output messages but counts them, per level, in
+// Prometheus metrics.
+func (lg *Logger) AddPrometheusEngine(opts prometheus.Options) error {
+	engine, err := prometheus.NewEngine(opts)
+	if err != nil {
+		return err
+	}
+	return lg.AddEngine(engine)
+}
+
+// AddJournaldEngine adds the engine that sends the output to the systemd journal.
+func (lg *Logger) AddJournaldEngine(opts journald.Options) error {
+	engine, err := journald.NewEngine(opts)
+	if err != nil {
+		return err
+	}
+	return lg.AddEngine(engine)
+}
+
 func (lg *Logger) AddEngine(engine engines.Engine) error {
 	if engine == nil {
 		return errors.New("invalid engine")
@@ -137,37 +516,319 @@ func (lg *Logger) AddEngine(engine engines.Engine) error {
 	// Lock access
 	lg.mtx.Lock()
 	defer lg.mtx.Unlock()
+	if lg.async != nil {
+		lg.async.lock()
+		defer lg.async.unlock()
+	}
+
+	if lg.destroyed.Load() {
+		engine.Destroy()
+		return ErrDestroyed
+	}
+
+	// Check if the engine writes to the same streams than others
+	if lg.usesSameStreams(engine) {
+		if lg.deduplicateStreams {
+			engine.Destroy()
+			return ErrDuplicateStream
+		}
+		_, _ = fmt.Fprintln(os.Stderr, "logger: warning: an engine writing to an already used stream was added")
+	}
 
 	// Add engine
+	if setter, ok := engine.(engines.TimeLayoutSetter); ok {
+		setter.SetTimeLayout(lg.timeLayout)
+	}
+	if setter, ok := engine.(engines.TimePrecisionSetter); ok {
+		setter.SetTimePrecision(lg.timePrecision.digits())
+	}
+	if lg.trimTrailingZeros {
+		if trimmer, ok := engine.(engines.TrailingZerosTrimmer); ok {
+			trimmer.SetTrimTrailingZeros(true)
+		}
+	}
 	lg.engines = append(lg.engines, engine)
 
 	// Done
 	return nil
 }
 
-// SetLogLevel sets the minimum level for all messages.
+// RemoveEngine removes the given engine from the logger and destroys it. It returns false if the engine
+// was not added to this logger.
+func (lg *Logger) RemoveEngine(engine engines.Engine) bool {
+	if engine == nil || !reflect.TypeOf(engine).Comparable() {
+		return false
+	}
+
+	// Deliver the queued messages first so the engine receives them
+	if lg.async != nil {
+		lg.async.flush()
+	}
+
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+	if lg.async != nil {
+		lg.async.lock()
+		defer lg.async.unlock()
+	}
+
+	// Find and remove the engine
+	for idx, e := range lg.engines {
+		if e == engine {
+			lg.engines = append(lg.engines[:idx:idx], lg.engines[idx+1:]...)
+			engine.Destroy()
+			return true
+		}
+	}
+
+	// Not found
+	return false
+}
+
+// HasEngines returns true if at least one engine is added to the logger.
+func (lg *Logger) HasEngines() bool {
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	return len(lg.engines) > 0
+}
+
+// Engines returns a copy of the list of engines added to the logger.
+func (lg *Logger) Engines() []engines.Engine {
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	return append([]engines.Engine{}, lg.engines...)
+}
+
+// Flush delivers any message buffered or queued by the engines.
+func (lg *Logger) Flush() {
+	// Wait until the queued messages are delivered
+	if lg.async != nil {
+		lg.async.flush()
+	}
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	for _, engine := range lg.engines {
+		if flusher, ok := engine.(engines.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+}
+
+// Drain flushes the logger like Flush does but waits until the engines that queue messages, like the syslog
+// one, deliver theirs or the context expires, for graceful shutdowns that can take longer than the engines
+// flush timeout. Those engines discard the messages sent while draining and accept them again when it
+// returns. It returns an error with the amount of undelivered messages of each engine.
+func (lg *Logger) Drain(ctx context.Context) error {
+	if lg.async != nil {
+		lg.async.flush()
+	}
+
+	// Drain a copy of the engine list so the lock is not held while waiting
+	errs := make([]error, 0)
+	for _, engine := range lg.Engines() {
+		if drainer, ok := engine.(engines.Drainer); ok {
+			remaining, err := drainer.Drain(ctx)
+			if remaining > 0 {
+				errs = append(errs, fmt.Errorf("%v engine: %d messages not delivered: %w", engineClass(engine),
+					remaining, err))
+			}
+		} else if flusher, ok := engine.(engines.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+
+	// Done
+	return errors.Join(errs...)
+}
+
+// Stats returns the current logger counters.
+func (lg *Logger) Stats() Stats {
+	stats := Stats{}
+	if lg.sampler != nil {
+		stats.SampledOut = lg.sampler.dropped.Load()
+	}
+	if lg.async != nil {
+		stats.AsyncBufferSize = cap(lg.async.ch)
+		stats.AsyncBuffered = len(lg.async.ch)
+		stats.AsyncHighWaterMark = int(lg.async.highWaterMark.Load())
+		stats.AsyncDropped = lg.async.dropped.Load()
+		stats.AsyncDroppedStale = lg.async.droppedStale.Load()
+	}
+	return stats
+}
+
+// Health returns the status of the engines that deliver messages over the network, keyed by the engine class.
+// If several engines of the same class were added, the next ones are keyed as "class#2", "class#3" and so on.
+func (lg *Logger) Health() map[string]EngineHealth {
+	health := make(map[string]EngineHealth)
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	names := engineNames(lg.engines)
+	for idx, engine := range lg.engines {
+		if reporter, ok := engine.(engines.HealthReporter); ok {
+			h := EngineHealth{
+				Healthy:    reporter.Healthy(),
+				QueueDepth: reporter.QueueDepth(),
+			}
+			if counter, ok := engine.(engines.DropCounter); ok {
+				h.Dropped = counter.DroppedMessages()
+			}
+			health[names[idx]] = h
+		}
+	}
+	return health
+}
+
+// LastError returns the most recent error reported by the engines, and when it happened, if any.
+func (lg *Logger) LastError() (error, time.Time) {
+	var lastErr error
+	var lastErrAt time.Time
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	for _, engine := range lg.engines {
+		if reporter, ok := engine.(engines.ErrorReporter); ok {
+			err, at := reporter.LastError()
+			if err != nil && (lastErr == nil || at.After(lastErrAt)) {
+				lastErr = err
+				lastErrAt = at
+			}
+		}
+	}
+
+	// Done
+	return lastErr, lastErrAt
+}
+
+// Validate checks the engines that support it can deliver messages, for example, that the file engine
+// directory is writable and the syslog server is reachable, without emitting any message. It returns an
+// error describing every misconfigured engine.
+func (lg *Logger) Validate(ctx context.Context) error {
+	var errs []error
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	for _, engine := range lg.engines {
+		if validator, ok := engine.(engines.Validator); ok {
+			err := validator.Validate(ctx)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%v engine: %w", engineClass(engine), err))
+			}
+		}
+	}
+
+	// Done
+	return errors.Join(errs...)
+}
+
+// SetLogLevel sets the minimum level for all messages. It also cancels a pending revert scheduled by
+// SetLogLevelFor.
 func (lg *Logger) SetLogLevel(level LogLevel, debugLevel uint) {
 	// Lock access
 	lg.mtx.Lock()
 	defer lg.mtx.Unlock()
 
-	lg.logLevel = level
-	lg.debugLogLevel = debugLevel
+	lg.stopLevelRevert()
+	lg.setLevel(level, debugLevel)
+}
+
+// SetLogLevelFor sets the minimum level for all messages during the given duration and then reverts to the
+// previous one. Calling it again before the duration elapses replaces the pending revert, but the level that
+// was active before the first call is still the one restored. A zero duration makes the change permanent, like
+// SetLogLevel.
+func (lg *Logger) SetLogLevelFor(level LogLevel, debugLevel uint, d time.Duration) {
+	if d <= 0 {
+		lg.SetLogLevel(level, debugLevel)
+		return
+	}
+
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	if lg.levelRevertTimer != nil {
+		lg.levelRevertTimer.Stop()
+	} else {
+		lg.savedLogLevel = lg.logLevel
+		lg.savedDebugLogLevel = lg.debugLogLevel
+	}
+	lg.setLevel(level, debugLevel)
+
+	lg.levelRevertSeq += 1
+	seq := lg.levelRevertSeq
+	lg.levelRevertTimer = time.AfterFunc(d, func() {
+		lg.onLevelRevert(seq)
+	})
+}
+
+// SetTimeMode changes the time zone of the timestamps of the following messages. If useLocal is false, UTC is
+// used. Else, loc specifies the location to use or, if nil, the local computer time is used.
+func (lg *Logger) SetTimeMode(useLocal bool, loc *time.Location) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	lg.useLocalTime = useLocal
+	lg.location = nil
+	if useLocal {
+		lg.location = loc
+	}
+}
+
+// SetTimeLayout sets the layout used to format timestamps.
+func (lg *Logger) SetTimeLayout(layout string) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+	if lg.async != nil {
+		lg.async.lock()
+		defer lg.async.unlock()
+	}
+
+	lg.timeLayout = lg.applyTimeFormat(layout)
+	for _, engine := range lg.engines {
+		if setter, ok := engine.(engines.TimeLayoutSetter); ok {
+			setter.SetTimeLayout(lg.timeLayout)
+		}
+	}
 }
 
 // Success emits a success message into the configured targets.
-// If a string is passed, output format will be in DATE [LEVEL] MESSAGE.
-// If a struct is passed, output will be in json with level and timestamp fields automatically added.
+// If a string or scalar value is passed, output format will be in DATE [LEVEL] MESSAGE.
+// If a struct, map or slice is passed, output will be in json with level and timestamp fields automatically added.
 func (lg *Logger) Success(obj interface{}) {
+	if !lg.mayEmit(lg.successLevel, 0) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(obj, "SUCCESS")
+		return
+	}
+	defer lg.leaveLog(gid)
+
 	// Lock access
 	lg.mtx.RLock()
 	defer lg.mtx.RUnlock()
 
-	minLogLevel := LogLevelInfo
-	if lg.sendSuccessAtErrorLogLevel {
-		minLogLevel = LogLevelError
-	}
-	if lg.logLevel < minLogLevel {
+	if !lg.successEnabled() {
 		return
 	}
 
@@ -175,9 +836,21 @@ func (lg *Logger) Success(obj interface{}) {
 }
 
 // Error emits an error message into the configured targets.
-// If a string is passed, output format will be in DATE [LEVEL] MESSAGE.
-// If a struct is passed, output will be in json with level and timestamp fields automatically added.
+// If a string or scalar value is passed, output format will be in DATE [LEVEL] MESSAGE.
+// If a struct, map or slice is passed, output will be in json with level and timestamp fields automatically added.
 func (lg *Logger) Error(obj interface{}) {
+	if !lg.mayEmit(LogLevelError, 0) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(obj, "ERROR")
+		return
+	}
+	defer lg.leaveLog(gid)
+
 	// Lock access
 	lg.mtx.RLock()
 	defer lg.mtx.RUnlock()
@@ -190,9 +863,21 @@ func (lg *Logger) Error(obj interface{}) {
 }
 
 // Warning emits a warning message into the configured targets.
-// If a string is passed, output format will be in DATE [LEVEL] MESSAGE.
-// If a struct is passed, output will be in json with level and timestamp fields automatically added.
+// If a string or scalar value is passed, output format will be in DATE [LEVEL] MESSAGE.
+// If a struct, map or slice is passed, output will be in json with level and timestamp fields automatically added.
 func (lg *Logger) Warning(obj interface{}) {
+	if !lg.mayEmit(LogLevelWarning, 0) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(obj, "WARNING")
+		return
+	}
+	defer lg.leaveLog(gid)
+
 	// Lock access
 	lg.mtx.RLock()
 	defer lg.mtx.RUnlock()
@@ -205,9 +890,21 @@ func (lg *Logger) Warning(obj interface{}) {
 }
 
 // Info emits an information message into the configured targets.
-// If a string is passed, output format will be in DATE [LEVEL] MESSAGE.
-// If a struct is passed, output will be in json with level and timestamp fields automatically added.
+// If a string or scalar value is passed, output format will be in DATE [LEVEL] MESSAGE.
+// If a struct, map or slice is passed, output will be in json with level and timestamp fields automatically added.
 func (lg *Logger) Info(obj interface{}) {
+	if !lg.mayEmit(LogLevelInfo, 0) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(obj, "INFO")
+		return
+	}
+	defer lg.leaveLog(gid)
+
 	// Lock access
 	lg.mtx.RLock()
 	defer lg.mtx.RUnlock()
@@ -220,9 +917,21 @@ func (lg *Logger) Info(obj interface{}) {
 }
 
 // Debug emits a debug message into the configured targets.
-// If a string is passed, output format will be in DATE [LEVEL] MESSAGE.
-// If a struct is passed, output will be in json with level and timestamp fields automatically added.
+// If a string or scalar value is passed, output format will be in DATE [LEVEL] MESSAGE.
+// If a struct, map or slice is passed, output will be in json with level and timestamp fields automatically added.
 func (lg *Logger) Debug(level uint, obj interface{}) {
+	if !lg.mayEmit(LogLevelDebug, level) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(obj, "DEBUG")
+		return
+	}
+	defer lg.leaveLog(gid)
+
 	// Lock access
 	lg.mtx.RLock()
 	defer lg.mtx.RUnlock()
@@ -230,6 +939,175 @@ func (lg *Logger) Debug(level uint, obj interface{}) {
 	if lg.logLevel < LogLevelDebug || lg.debugLogLevel < level {
 		return
 	}
+	if lg.debugSampleRate > 0 && lg.debugSampleRate < 1 && rand.Float64() >= lg.debugSampleRate {
+		return
+	}
 
 	lg.log(obj, "debug", logTypeDebug)
 }
+
+// Successf emits a success message into the configured targets using a format string. The message is formatted
+// only if it is going to be emitted.
+func (lg *Logger) Successf(format string, args ...interface{}) {
+	if !lg.mayEmit(lg.successLevel, 0) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(fmt.Sprintf(format, args...), "SUCCESS")
+		return
+	}
+	defer lg.leaveLog(gid)
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	if !lg.successEnabled() {
+		return
+	}
+
+	lg.log(fmt.Sprintf(format, args...), "success", logTypeSuccess)
+}
+
+// Errorf emits an error message into the configured targets using a format string. The message is formatted
+// only if it is going to be emitted.
+func (lg *Logger) Errorf(format string, args ...interface{}) {
+	if !lg.mayEmit(LogLevelError, 0) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(fmt.Sprintf(format, args...), "ERROR")
+		return
+	}
+	defer lg.leaveLog(gid)
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	if lg.logLevel < LogLevelError {
+		return
+	}
+
+	lg.log(fmt.Sprintf(format, args...), "error", logTypeError)
+}
+
+// Warningf emits a warning message into the configured targets using a format string. The message is formatted
+// only if it is going to be emitted.
+func (lg *Logger) Warningf(format string, args ...interface{}) {
+	if !lg.mayEmit(LogLevelWarning, 0) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(fmt.Sprintf(format, args...), "WARNING")
+		return
+	}
+	defer lg.leaveLog(gid)
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	if lg.logLevel < LogLevelWarning {
+		return
+	}
+
+	lg.log(fmt.Sprintf(format, args...), "warning", logTypeWarning)
+}
+
+// Infof emits an information message into the configured targets using a format string. The message is formatted
+// only if it is going to be emitted.
+func (lg *Logger) Infof(format string, args ...interface{}) {
+	if !lg.mayEmit(LogLevelInfo, 0) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(fmt.Sprintf(format, args...), "INFO")
+		return
+	}
+	defer lg.leaveLog(gid)
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	if lg.logLevel < LogLevelInfo {
+		return
+	}
+
+	lg.log(fmt.Sprintf(format, args...), "info", logTypeInfo)
+}
+
+// Debugf emits a debug message into the configured targets using a format string. The message is formatted
+// only if it is going to be emitted.
+func (lg *Logger) Debugf(level uint, format string, args ...interface{}) {
+	if !lg.mayEmit(LogLevelDebug, level) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(fmt.Sprintf(format, args...), "DEBUG")
+		return
+	}
+	defer lg.leaveLog(gid)
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	if lg.logLevel < LogLevelDebug || lg.debugLogLevel < level {
+		return
+	}
+	if lg.debugSampleRate > 0 && lg.debugSampleRate < 1 && rand.Float64() >= lg.debugSampleRate {
+		return
+	}
+
+	lg.log(fmt.Sprintf(format, args...), "debug", logTypeDebug)
+}
+
+// DumpGoroutines captures the stack traces of all the goroutines and logs them at debug level or sends them
+// to the configured writer. It is useful to diagnose hangs, for example, when a signal is received.
+func (lg *Logger) DumpGoroutines() {
+	buf := make([]byte, lg.goroutineDumpMaxSize)
+	n := runtime.Stack(buf, true)
+	dump := string(buf[:n])
+	if n == len(buf) {
+		dump += "\n... truncated ..."
+	}
+	dump = "goroutine dump:\n" + dump
+
+	if lg.goroutineDumpWriter != nil {
+		_, _ = io.WriteString(lg.goroutineDumpWriter, dump+"\n")
+		return
+	}
+	lg.Debug(0, dump)
+}
+
+// Fatal emits an error message into the configured targets, flushes them and terminates the application
+// by calling ExitFunc with exit code 1.
+func (lg *Logger) Fatal(obj interface{}) {
+	lg.Error(obj)
+	lg.Flush()
+	ExitFunc(1)
+}
+
+// Panic emits an error message into the configured targets, flushes them and panics with the given object.
+func (lg *Logger) Panic(obj interface{}) {
+	lg.Error(obj)
+	lg.Flush()
+	panic(obj)
+}
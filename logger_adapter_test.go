@@ -0,0 +1,108 @@
+package logger_test
+
+import (
+	"testing"
+
+	"github.com/mxmauro/logger"
+	"github.com/mxmauro/logger/adapters"
+)
+
+//------------------------------------------------------------------------------
+
+// grpcLoggerV2 mirrors the grpclog.LoggerV2 interface.
+type grpcLoggerV2 interface {
+	Info(args ...interface{})
+	Infoln(args ...interface{})
+	Infof(format string, args ...interface{})
+	Warning(args ...interface{})
+	Warningln(args ...interface{})
+	Warningf(format string, args ...interface{})
+	Error(args ...interface{})
+	Errorln(args ...interface{})
+	Errorf(format string, args ...interface{})
+	Fatal(args ...interface{})
+	Fatalln(args ...interface{})
+	Fatalf(format string, args ...interface{})
+	V(l int) bool
+}
+
+//------------------------------------------------------------------------------
+
+func TestStdLogger(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelDebug,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	adapters.NewStdLogger(lg).Printf("connection %v established", 1)
+	_, _ = adapters.NewWriter(lg, logger.LogLevelWarning).Write([]byte("slow query\n"))
+	_, _ = adapters.NewWriter(lg, logger.LogLevelDebug).Write([]byte("\n"))
+
+	if len(rec.entries) != 2 {
+		t.Fatalf("unexpected messages. [%v]", rec.entries)
+	}
+	if rec.entries[0].level != "info" || rec.entries[0].msg != "connection 1 established" {
+		t.Errorf("unexpected message. [%+v]", rec.entries[0])
+	}
+	if rec.entries[1].level != "warning" || rec.entries[1].msg != "slow query" {
+		t.Errorf("unexpected message. [%+v]", rec.entries[1])
+	}
+}
+
+func TestGRPCLogger(t *testing.T) {
+	exitCode := -1
+	oldExitFunc := logger.ExitFunc
+	logger.ExitFunc = func(code int) {
+		exitCode = code
+	}
+	defer func() {
+		logger.ExitFunc = oldExitFunc
+	}()
+
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelDebug,
+		DebugLevel: 2,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	var gl grpcLoggerV2 = adapters.NewGRPCLogger(lg)
+	gl.Info("channel ", "created")
+	gl.Warningln("transport", "closing")
+	gl.Errorf("stream %v failed", 3)
+	gl.Fatal("unrecoverable")
+
+	expected := []struct {
+		level string
+		msg   string
+	}{
+		{"info", "channel created"},
+		{"warning", "transport closing"},
+		{"error", "stream 3 failed"},
+		{"error", "unrecoverable"},
+	}
+	if len(rec.entries) != len(expected) {
+		t.Fatalf("unexpected messages. [%v]", rec.entries)
+	}
+	for idx, entry := range rec.entries {
+		if entry.level != expected[idx].level || entry.msg != expected[idx].msg {
+			t.Errorf("unexpected message. [%+v]", entry)
+		}
+	}
+	if exitCode != 1 {
+		t.Errorf("unexpected exit code. [%v]", exitCode)
+	}
+
+	if !gl.V(0) || !gl.V(2) || gl.V(3) {
+		t.Errorf("unexpected verbosity")
+	}
+	lg.SetLogLevel(logger.LogLevelInfo, 0)
+	if !gl.V(0) || gl.V(1) {
+		t.Errorf("unexpected verbosity")
+	}
+}
@@ -0,0 +1,60 @@
+package logger_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/mxmauro/logger"
+	"github.com/mxmauro/logger/engines/capture"
+)
+
+//------------------------------------------------------------------------------
+
+func TestCapture(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	c := capture.NewEngine()
+	err := lg.AddEngine(c)
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	if c.LastMessage() != "" || c.ContainsLevel("error") {
+		t.Fatalf("unexpected entries. [%v]", c.Entries())
+	}
+
+	lg.Info("message 1")
+	lg.Error(JsonMessage{
+		Message: "message 2",
+	})
+
+	entries := c.Entries()
+	if len(entries) != 2 || entries[0].Level != "info" || entries[0].Msg != "message 1" || entries[0].Raw {
+		t.Fatalf("unexpected entries. [%v]", entries)
+	}
+	if !entries[1].Raw || entries[1].Time.IsZero() {
+		t.Errorf("unexpected entry. [%v]", entries[1])
+	}
+	if !c.ContainsLevel("error") || c.ContainsLevel("warning") || c.LastMessage() != entries[1].Msg {
+		t.Errorf("unexpected entries. [%v]", entries)
+	}
+
+	// Concurrent messages are all recorded
+	c.Reset()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			lg.Warning("concurrent message")
+		}()
+	}
+	wg.Wait()
+	if entries = c.Entries(); len(entries) != 10 {
+		t.Errorf("unexpected number of entries. [%v]", len(entries))
+	}
+}
@@ -0,0 +1,138 @@
+package logger_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mxmauro/logger"
+	"github.com/mxmauro/logger/engines/cloudwatch"
+)
+
+//------------------------------------------------------------------------------
+
+func TestCloudWatch(t *testing.T) {
+	type logEvent struct {
+		Timestamp int64  `json:"timestamp"`
+		Message   string `json:"message"`
+	}
+
+	mtx := sync.Mutex{}
+	calls := make([]string, 0)
+	events := make([]logEvent, 0)
+	groupExists := false
+	streamExists := false
+	sequenceTokens := make([]string, 0)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/logs/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		req := struct {
+			LogGroupName  string     `json:"logGroupName"`
+			LogStreamName string     `json:"logStreamName"`
+			LogEvents     []logEvent `json:"logEvents"`
+			SequenceToken string     `json:"sequenceToken"`
+		}{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		writeError := func(errType string) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"com.amazonaws.logs#` + errType + `","message":"error"}`))
+		}
+
+		operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "Logs_20140328.")
+		calls = append(calls, operation)
+		switch operation {
+		case "CreateLogGroup":
+			groupExists = true
+
+		case "CreateLogStream":
+			if !groupExists {
+				writeError("ResourceNotFoundException")
+				return
+			}
+			streamExists = true
+
+		case "PutLogEvents":
+			if !streamExists || req.LogGroupName != "group" || req.LogStreamName != "stream" {
+				writeError("ResourceNotFoundException")
+				return
+			}
+			sequenceTokens = append(sequenceTokens, req.SequenceToken)
+			events = append(events, req.LogEvents...)
+			_, _ = w.Write([]byte(`{"nextSequenceToken":"token` + string(rune('0'+len(sequenceTokens))) + `"}`))
+
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddCloudWatchEngine(cloudwatch.Options{
+		LogGroup:      "group",
+		LogStream:     "stream",
+		Region:        "eu-west-1",
+		Endpoint:      server.URL,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Error("This is an error message sample")
+	lg.Info(map[string]interface{}{
+		"message": "This is an information message sample",
+	})
+	lg.Flush()
+
+	lg.Warning("This is a warning message sample")
+	lg.Flush()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	// The group and stream must be created on first use
+	expectedCalls := "PutLogEvents,CreateLogStream,CreateLogGroup,CreateLogStream,PutLogEvents,PutLogEvents"
+	if strings.Join(calls, ",") != expectedCalls {
+		t.Errorf("unexpected calls. [%v]", calls)
+	}
+	if len(sequenceTokens) != 2 || sequenceTokens[0] != "" || sequenceTokens[1] != "token1" {
+		t.Errorf("unexpected sequence tokens. [%v]", sequenceTokens)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("unexpected number of events. [%v]", len(events))
+	}
+	for idx, expected := range []string{
+		`"level":"error","message":"This is an error message sample"}`,
+		`"level":"info","message":"This is an information message sample"}`,
+		`"level":"warning","message":"This is a warning message sample"}`,
+	} {
+		if !strings.HasSuffix(events[idx].Message, expected) {
+			t.Errorf("unexpected event. [%v]", events[idx].Message)
+		}
+		if time.Since(time.UnixMilli(events[idx].Timestamp)) > time.Minute {
+			t.Errorf("unexpected event timestamp. [%v]", events[idx].Timestamp)
+		}
+	}
+}
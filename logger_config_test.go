@@ -0,0 +1,85 @@
+package logger_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mxmauro/logger"
+	"github.com/mxmauro/logger/engines/console"
+	"github.com/mxmauro/logger/engines/file"
+)
+
+//------------------------------------------------------------------------------
+
+func TestFromConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	doc := `{
+		"level": "warning",
+		"fields": { "service": "api" },
+		"engines": [
+			{ "type": "file", "options": { "prefix": "Config", "dir": ` + jsonQuote(dir) + ` } }
+		]
+	}`
+
+	var cfg logger.Config
+	err := json.Unmarshal([]byte(doc), &cfg)
+	if err != nil {
+		t.Fatalf("unable to decode configuration. [%v]", err)
+	}
+	if _, ok := cfg.Engines[0].Options.(*file.Options); !ok {
+		t.Fatalf("unexpected options type. [%T]", cfg.Engines[0].Options)
+	}
+
+	lg, err := logger.FromConfig(cfg)
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+	lg.Warning("This is a warning message sample")
+	lg.Info("This is an information message sample which should not be written")
+	lg.Destroy()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "config*.log"))
+	if len(files) != 1 {
+		t.Fatalf("log file not found. [%v]", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), `"message":"This is a warning message sample"`) ||
+		!strings.Contains(string(data), `"service":"api"`) || strings.Contains(string(data), "information") {
+		t.Errorf("unexpected log file content. [%q]", string(data))
+	}
+}
+
+func TestFromConfigErrors(t *testing.T) {
+	for _, doc := range []string{
+		`{"engines": [{"type": "carrier-pigeon"}]}`,
+		`{"engines": [{"type": "file", "options": {"directory": "./logs"}}]}`,
+	} {
+		var cfg logger.Config
+		if err := json.Unmarshal([]byte(doc), &cfg); err == nil {
+			t.Errorf("invalid configuration accepted. [%v]", doc)
+		}
+	}
+
+	// Options not matching the engine type and options rejected by the engine
+	for _, ec := range []logger.EngineConfig{
+		{Type: "file", Options: console.Options{}},
+		{Type: "console", Options: console.Options{LevelColors: map[string]string{"info": "purple"}}},
+	} {
+		lg, err := logger.FromConfig(logger.Config{
+			Engines: []logger.EngineConfig{ec},
+		})
+		if err == nil {
+			lg.Destroy()
+			t.Errorf("invalid engine configuration accepted. [%+v]", ec)
+		}
+	}
+}
+
+func jsonQuote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
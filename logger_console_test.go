@@ -0,0 +1,474 @@
+package logger_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/mxmauro/logger"
+	"github.com/mxmauro/logger/engines/console"
+)
+
+//------------------------------------------------------------------------------
+
+func TestConsoleTheme(t *testing.T) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	forceColor := true
+
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelDebug,
+		DebugLevel: 1,
+	})
+	defer lg.Destroy()
+
+	lg.AddConsoleEngine(console.Options{
+		ForceColor: &forceColor,
+		Theme: console.Theme{
+			Error:   []color.Attribute{color.FgRed},
+			Warning: []color.Attribute{color.FgMagenta},
+			Info:    []color.Attribute{color.FgBlue},
+			Debug:   []color.Attribute{color.FgWhite},
+			Success: []color.Attribute{color.FgGreen},
+		},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+
+	lg.Error("This is an error message sample")
+	lg.Warning("This is a warning message sample")
+	lg.Info("This is an information message sample")
+	lg.Debug(1, "This is a debug message sample at level 1 which should be printed")
+	lg.Success("This is a success message sample")
+
+	checks := []struct {
+		output   string
+		expected string
+	}{
+		{stderr.String(), "\x1b[31m[ERROR]\x1b[0m This is an error message sample"},
+		{stderr.String(), "\x1b[35m[WARN]\x1b[0m This is a warning message sample"},
+		{stdout.String(), "\x1b[34m[INFO]\x1b[0m This is an information message sample"},
+		{stdout.String(), "\x1b[37m[DEBUG]\x1b[0m This is a debug message sample"},
+		{stdout.String(), "\x1b[32m[SUCCESS]\x1b[0m This is a success message sample"},
+	}
+	for _, check := range checks {
+		if !strings.Contains(check.output, check.expected) {
+			t.Errorf("expected colored output not found. [%q]", check.expected)
+		}
+	}
+}
+
+func TestConsoleColorFullLine(t *testing.T) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+
+	for _, forceColor := range []bool{true, false} {
+		stdout.Reset()
+		stderr.Reset()
+
+		lg := logger.Create(logger.Options{
+			Level:      logger.LogLevelInfo,
+			TimeLayout: "15:04",
+		})
+
+		lg.AddConsoleEngine(console.Options{
+			ForceColor:    &forceColor,
+			ColorFullLine: true,
+			Theme: console.Theme{
+				Info: []color.Attribute{color.FgBlue},
+			},
+			Stdout: &stdout,
+			Stderr: &stderr,
+		})
+
+		lg.Info("This is an information message sample")
+		lg.Error("This is an error message sample")
+		lg.Destroy()
+
+		if forceColor {
+			line := stdout.String()
+			if !strings.HasPrefix(line, "\x1b[34m") ||
+				!strings.HasSuffix(line, " [INFO] This is an information message sample\x1b[0m\n") {
+				t.Errorf("the whole line was not colored. [%q]", line)
+			}
+			if !strings.HasPrefix(stderr.String(), "\x1b[6;97;41m") {
+				t.Errorf("unexpected error line color. [%q]", stderr.String())
+			}
+		} else if strings.Contains(stdout.String()+stderr.String(), "\x1b[") {
+			t.Errorf("colors found in output. [%q]", stdout.String())
+		}
+	}
+}
+
+func TestConsoleForceNoColor(t *testing.T) {
+	stdout := bytes.Buffer{}
+	forceColor := false
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	lg.AddConsoleEngine(console.Options{
+		ForceColor: &forceColor,
+		Stdout:     &stdout,
+	})
+
+	lg.Info("This is an information message sample")
+
+	if strings.Contains(stdout.String(), "\x1b[") || !strings.Contains(stdout.String(), "[INFO]") {
+		t.Errorf("unexpected output. [%q]", stdout.String())
+	}
+}
+
+func TestConsoleDeduplicateStreams(t *testing.T) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+
+	lg := logger.Create(logger.Options{
+		Level:              logger.LogLevelDebug,
+		DebugLevel:         1,
+		DeduplicateStreams: true,
+	})
+	defer lg.Destroy()
+
+	for i := 0; i < 2; i++ {
+		err := lg.AddConsoleEngine(console.Options{
+			DisableColor: true,
+			Stdout:       &stdout,
+			Stderr:       &stderr,
+		})
+		if i == 0 && err != nil {
+			t.Fatalf("unable to add engine. [%v]", err)
+		} else if i == 1 && !errors.Is(err, logger.ErrDuplicateStream) {
+			t.Fatalf("duplicated engine was not rejected. [%v]", err)
+		}
+	}
+
+	lg.Error("This is an error message sample")
+	lg.Info("This is an information message sample")
+
+	if n := strings.Count(stderr.String(), "\n"); n != 1 {
+		t.Errorf("unexpected number of lines in stderr. [%v]", n)
+	}
+	if n := strings.Count(stdout.String(), "\n"); n != 1 {
+		t.Errorf("unexpected number of lines in stdout. [%v]", n)
+	}
+}
+
+func TestConsoleSystemdPrefix(t *testing.T) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelDebug,
+		DebugLevel: 1,
+	})
+	defer lg.Destroy()
+
+	lg.AddConsoleEngine(console.Options{
+		DisableColor:  true,
+		SystemdPrefix: true,
+		Stdout:        &stdout,
+		Stderr:        &stderr,
+	})
+
+	lg.Error("This is an error message sample")
+	lg.Warning("This is a warning message sample")
+	lg.Info("This is an information message sample")
+	lg.Debug(1, "This is a debug message sample")
+	lg.Success("This is a success message sample")
+	lg.Info(JsonMessage{
+		Message: "This is a JSON message sample",
+	})
+
+	stderrLines := strings.Split(strings.TrimSuffix(stderr.String(), "\n"), "\n")
+	stdoutLines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	if len(stderrLines) != 2 || len(stdoutLines) != 4 {
+		t.Fatalf("unexpected output. [%q / %q]", stderr.String(), stdout.String())
+	}
+	checks := []struct {
+		line   string
+		prefix string
+		level  string
+	}{
+		{stderrLines[0], "<3>", "[ERROR]"},
+		{stderrLines[1], "<4>", "[WARN]"},
+		{stdoutLines[0], "<6>", "[INFO]"},
+		{stdoutLines[1], "<7>", "[DEBUG]"},
+		{stdoutLines[2], "<5>", "[SUCCESS]"},
+		{stdoutLines[3], "<6>", `"level":"info"`},
+	}
+	for _, check := range checks {
+		if !strings.HasPrefix(check.line, check.prefix) || !strings.Contains(check.line, check.level) {
+			t.Errorf("unexpected line. [%q]", check.line)
+		}
+	}
+}
+
+func TestConsoleFlushBufferedWriter(t *testing.T) {
+	output := bytes.Buffer{}
+	w := bufio.NewWriter(&output)
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	lg.AddConsoleEngine(console.Options{
+		DisableColor: true,
+		Stdout:       w,
+		Stderr:       w,
+	})
+
+	lg.Info("This is an information message sample")
+	if w.Buffered() == 0 {
+		t.Fatalf("message was not buffered")
+	}
+
+	lg.Flush()
+	if w.Buffered() != 0 {
+		t.Errorf("buffer was not flushed. [%v]", w.Buffered())
+	}
+	if !strings.Contains(output.String(), "[INFO] This is an information message sample") {
+		t.Errorf("message not found. [%v]", output.String())
+	}
+}
+
+func TestConsolePretty(t *testing.T) {
+	for _, forceColor := range []bool{true, false} {
+		stdout := bytes.Buffer{}
+
+		lg := logger.Create(logger.Options{
+			Level: logger.LogLevelInfo,
+		})
+
+		lg.AddConsoleEngine(console.Options{
+			ForceColor: &forceColor,
+			Pretty:     true,
+			Stdout:     &stdout,
+			Stderr:     &bytes.Buffer{},
+		})
+
+		lg.Info(map[string]interface{}{
+			"count": 5,
+			"name":  "sample",
+			"ok":    true,
+		})
+		lg.Info("This is an information message sample")
+		lg.Destroy()
+
+		output := stdout.String()
+		if forceColor {
+			if !strings.Contains(output, "\n  \x1b[94m\"count\"\x1b[0m: \x1b[33m5\x1b[0m,\n") ||
+				!strings.Contains(output, "\x1b[32m\"sample\"\x1b[0m") || !strings.Contains(output, "\x1b[35mtrue\x1b[0m") {
+				t.Errorf("JSON message was not prettified. [%q]", output)
+			}
+		} else {
+			if !strings.Contains(output, `"count":5,"name":"sample","ok":true}`+"\n") {
+				t.Errorf("JSON message was not compact. [%q]", output)
+			}
+		}
+		if !strings.Contains(output, "This is an information message sample\n") {
+			t.Errorf("text message not found. [%q]", output)
+		}
+	}
+}
+
+func TestConsoleLevelColors(t *testing.T) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	forceColor := true
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddConsoleEngine(console.Options{
+		ForceColor: &forceColor,
+		LevelColors: map[string]string{
+			"warning": "magenta",
+			"Error":   "BrightWhite:blue",
+		},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Warning("This is a warning message sample")
+	lg.Error("This is an error message sample")
+	lg.Info("This is an information message sample")
+
+	output := stderr.String()
+	if !strings.Contains(output, "\x1b[35m[WARN]\x1b[0m") {
+		t.Errorf("unexpected warning color. [%q]", output)
+	}
+	if !strings.Contains(output, "\x1b[97;44m[ERROR]") {
+		t.Errorf("unexpected error color. [%q]", output)
+	}
+	// Levels not in the map keep the default colors
+	if !strings.Contains(stdout.String(), "\x1b[94m[INFO]\x1b[0m") {
+		t.Errorf("unexpected info color. [%q]", stdout.String())
+	}
+
+	// Unknown colors and levels must be rejected
+	for _, levelColors := range []map[string]string{{"info": "purple"}, {"info": "red:pink"}, {"fatal": "red"}} {
+		err = lg.AddConsoleEngine(console.Options{
+			LevelColors: levelColors,
+			Stdout:      io.Discard,
+		})
+		if err == nil {
+			t.Errorf("invalid level colors accepted. [%v]", levelColors)
+		}
+	}
+}
+
+func TestConsoleTimeZone(t *testing.T) {
+	stdout := bytes.Buffer{}
+	forceColor := false
+
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelInfo,
+		TimeLayout: "Z07:00",
+	})
+	defer lg.Destroy()
+
+	err := lg.AddConsoleEngine(console.Options{
+		ForceColor: &forceColor,
+		TimeZone:   time.FixedZone("UTC+5", 5*3600),
+		Stdout:     &stdout,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Info("This is an information message sample")
+	if !strings.HasPrefix(stdout.String(), "+05:00 [INFO] ") {
+		t.Errorf("timestamp not displayed in the engine time zone. [%q]", stdout.String())
+	}
+}
+
+func TestConsoleSingleStream(t *testing.T) {
+	for _, toStdout := range []bool{true, false} {
+		stdout := bytes.Buffer{}
+		stderr := bytes.Buffer{}
+
+		lg := logger.Create(logger.Options{
+			Level: logger.LogLevelInfo,
+		})
+
+		err := lg.AddConsoleEngine(console.Options{
+			DisableColor: true,
+			AllToStdout:  toStdout,
+			AllToStderr:  !toStdout,
+			Stdout:       &stdout,
+			Stderr:       &stderr,
+		})
+		if err != nil {
+			t.Fatalf("unable to initialize. [%v]", err)
+		}
+
+		lg.Error("This is an error message sample")
+		lg.Info("This is an information message sample")
+		lg.Destroy()
+
+		used, unused := stdout.String(), stderr.String()
+		if !toStdout {
+			used, unused = unused, used
+		}
+		if strings.Count(used, "\n") != 2 || len(unused) != 0 {
+			t.Errorf("messages not sent to a single stream. [%q / %q]", used, unused)
+		}
+	}
+
+	err := logger.Discard().AddConsoleEngine(console.Options{
+		AllToStdout: true,
+		AllToStderr: true,
+	})
+	if err == nil {
+		t.Errorf("conflicting options accepted")
+	}
+}
+
+func TestConsoleFormatter(t *testing.T) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddConsoleEngine(console.Options{
+		DisableColor:  true,
+		SystemdPrefix: true,
+		Formatter: func(_ time.Time, level string, msg string, raw bool) string {
+			if raw {
+				return level + " json " + msg
+			}
+			return level + " | " + msg
+		},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Warning("This is a warning message sample")
+	lg.Success("This is a success message sample")
+	lg.Info(JsonMessage{
+		Message: "This is a JSON message sample",
+	})
+
+	if stderr.String() != "<4>warning | This is a warning message sample\n" {
+		t.Errorf("unexpected formatted output. [%q]", stderr.String())
+	}
+	lines := strings.Split(stdout.String(), "\n")
+	if len(lines) != 3 || lines[0] != "<5>success | This is a success message sample" ||
+		!strings.HasPrefix(lines[1], "<6>info json {") || !strings.Contains(lines[1], "This is a JSON message sample") {
+		t.Errorf("unexpected formatted output. [%q]", stdout.String())
+	}
+}
+
+func TestConsoleControlChars(t *testing.T) {
+	for _, allow := range []bool{false, true} {
+		stdout := bytes.Buffer{}
+
+		lg := logger.Create(logger.Options{
+			Level: logger.LogLevelInfo,
+		})
+
+		err := lg.AddConsoleEngine(console.Options{
+			DisableColor:      true,
+			AllowControlChars: allow,
+			Formatter: func(_ time.Time, _ string, msg string, _ bool) string {
+				return msg
+			},
+			Stdout: &stdout,
+		})
+		if err != nil {
+			t.Fatalf("unable to initialize. [%v]", err)
+		}
+
+		// Escape sequences are neutralized by default but line breaks are kept
+		lg.Info("\x1b[2J\x1b[31mred\x1b[0m\r\nsecond line")
+		lg.Destroy()
+
+		expected := "\\x1b[2J\\x1b[31mred\\x1b[0m\\r\nsecond line\n"
+		if allow {
+			expected = "\x1b[2J\x1b[31mred\x1b[0m\r\nsecond line\n"
+		}
+		if stdout.String() != expected {
+			t.Errorf("unexpected output. [%q]", stdout.String())
+		}
+	}
+}
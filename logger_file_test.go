@@ -3,7 +3,11 @@ package logger_test
 import (
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mxmauro/logger"
 	"github.com/mxmauro/logger/engines/file"
@@ -63,3 +67,344 @@ func TestFileLogWithVaultLimit(t *testing.T) {
 		printTestMessages(lg)
 	}
 }
+
+func TestFileLogRotationMarkers(t *testing.T) {
+	dir, err := filepath.Abs(filepath.FromSlash("./testdata/logs"))
+	if err != nil {
+		t.Errorf("unable to get directory. [%v]", err)
+		return
+	}
+	_ = os.RemoveAll(dir)
+
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelDebug,
+		DebugLevel: 1,
+	})
+	defer lg.Destroy()
+
+	err = lg.AddFileEngine(file.Options{
+		Prefix:          "Test",
+		Directory:       "./testdata/logs",
+		MaxFileSize:     10 * 1024,
+		RotationMarkers: true,
+	})
+	if err != nil {
+		t.Errorf("unable to initialize. [%v]", err)
+		return
+	}
+
+	for i := 1; i <= 50; i++ {
+		printTestMessages(lg)
+	}
+	lg.Flush()
+
+	// Check the markers of the first two files
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Errorf("unable to read directory. [%v]", err)
+		return
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	slices.Sort(names)
+	if len(names) < 2 {
+		t.Errorf("files were not rotated")
+		return
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, names[0]))
+	if err != nil {
+		t.Errorf("unable to read file. [%v]", err)
+		return
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if strings.TrimSpace(lines[len(lines)-1]) != "--- rotated to "+names[1]+" ---" {
+		t.Errorf("rotated marker not found. [%v]", lines[len(lines)-1])
+	}
+
+	b, err = os.ReadFile(filepath.Join(dir, names[1]))
+	if err != nil {
+		t.Errorf("unable to read file. [%v]", err)
+		return
+	}
+	lines = strings.Split(strings.TrimSpace(string(b)), "\n")
+	if strings.TrimSpace(lines[0]) != "--- continued from "+names[0]+" ---" {
+		t.Errorf("continued marker not found. [%v]", lines[0])
+	}
+}
+
+func TestFileLogTiers(t *testing.T) {
+	dir, err := filepath.Abs(filepath.FromSlash("./testdata/logs"))
+	if err != nil {
+		t.Errorf("unable to get directory. [%v]", err)
+		return
+	}
+	_ = os.RemoveAll(dir)
+
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelDebug,
+		DebugLevel: 1,
+	})
+	defer lg.Destroy()
+
+	err = lg.AddFileEngine(file.Options{
+		Prefix:           "Hot",
+		Directory:        "./testdata/logs",
+		DaysToKeep:       1,
+		MaxFileSize:      10 * 1024,
+		MaxFileVaultSize: 100 * 1024,
+		Tiers: []file.Tier{
+			{
+				Prefix:      "Archive",
+				MaxLevel:    "info",
+				DaysToKeep:  90,
+				MaxFileSize: 10 * 1024,
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("unable to initialize. [%v]", err)
+		return
+	}
+
+	for i := 1; i <= 500; i++ {
+		printTestMessages(lg)
+	}
+	lg.Flush()
+
+	// Check the size and content of each tier
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Errorf("unable to read directory. [%v]", err)
+		return
+	}
+	hotSize := int64(0)
+	archiveSize := int64(0)
+	for _, entry := range entries {
+		fi, err2 := entry.Info()
+		if err2 != nil {
+			t.Errorf("unable to get file info. [%v]", err2)
+			return
+		}
+		if strings.HasPrefix(entry.Name(), "hot.") {
+			hotSize += fi.Size()
+		} else if strings.HasPrefix(entry.Name(), "archive.") {
+			archiveSize += fi.Size()
+
+			b, err3 := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err3 != nil {
+				t.Errorf("unable to read file. [%v]", err3)
+				return
+			}
+			if strings.Contains(string(b), "[DEBUG]") || strings.Contains(string(b), `"level":"debug"`) {
+				t.Errorf("debug messages found in archive tier")
+			}
+		}
+	}
+	if hotSize > 100*1024 {
+		t.Errorf("hot tier exceeds its vault size. [%v]", hotSize)
+	}
+	if archiveSize <= 100*1024 {
+		t.Errorf("archive tier files were purged. [%v]", archiveSize)
+	}
+}
+
+func TestFileLogTimeLayout(t *testing.T) {
+	dir, err := filepath.Abs(filepath.FromSlash("./testdata/logs"))
+	if err != nil {
+		t.Errorf("unable to get directory. [%v]", err)
+		return
+	}
+	_ = os.RemoveAll(dir)
+
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelInfo,
+		TimeLayout: logger.TimeLayoutRFC3339,
+	})
+	defer lg.Destroy()
+
+	err = lg.AddFileEngine(file.Options{
+		Prefix:    "Test",
+		Directory: "./testdata/logs",
+	})
+	if err != nil {
+		t.Errorf("unable to initialize. [%v]", err)
+		return
+	}
+
+	lg.Info("This is an information message sample")
+	lg.Flush()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(files) != 1 {
+		t.Errorf("unexpected number of files. [%v]", len(files))
+		return
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Errorf("unable to read file. [%v]", err)
+		return
+	}
+	fields := strings.SplitN(string(b), " ", 2)
+	if _, err = time.Parse(logger.TimeLayoutRFC3339, fields[0]); err != nil {
+		t.Errorf("timestamp does not follow the layout. [%v]", string(b))
+	}
+}
+
+func TestFileLogLastError(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+
+	// Use a regular file as the target directory so writes fail
+	err := os.WriteFile(dir, []byte{}, 0644)
+	if err != nil {
+		t.Fatalf("unable to create file. [%v]", err)
+	}
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelDebug,
+	})
+	defer lg.Destroy()
+
+	err = lg.AddFileEngine(file.Options{
+		Prefix:    "Test",
+		Directory: dir,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	if lastErr, _ := lg.LastError(); lastErr != nil {
+		t.Fatalf("unexpected error before writing. [%v]", lastErr)
+	}
+
+	before := time.Now()
+	lg.Info("This is an information message sample")
+
+	lastErr, at := lg.LastError()
+	if lastErr == nil {
+		t.Fatalf("write error was not recorded")
+	}
+	if at.Before(before) {
+		t.Errorf("unexpected error timestamp. [%v]", at)
+	}
+
+	// A successful write clears the error
+	_ = os.Remove(dir)
+	lg.Info("This is an information message sample")
+
+	if lastErr, _ = lg.LastError(); lastErr != nil {
+		t.Errorf("error was not cleared after a successful write. [%v]", lastErr)
+	}
+}
+
+func TestFileLogCurrentSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links are not used on Windows")
+	}
+
+	dir := t.TempDir()
+
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelDebug,
+		DebugLevel: 1,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddFileEngine(file.Options{
+		Prefix:         "Test",
+		Directory:      dir,
+		MaxFileSize:    10 * 1024,
+		CurrentSymlink: true,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	for i := 1; i <= 50; i++ {
+		printTestMessages(lg)
+	}
+	lg.Flush()
+
+	// The link must point to the newest file
+	names, _ := filepath.Glob(filepath.Join(dir, "test.*-*.log"))
+	slices.Sort(names)
+	if len(names) < 2 {
+		t.Fatalf("files were not rotated")
+	}
+
+	target, err := os.Readlink(filepath.Join(dir, "test.log"))
+	if err != nil {
+		t.Fatalf("unable to read link. [%v]", err)
+	}
+	if target != filepath.Base(names[len(names)-1]) {
+		t.Errorf("link does not point to the active file. [%v]", target)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "test.log.tmp")); err == nil {
+		t.Errorf("temporary link was not removed")
+	}
+}
+
+func TestFileLogPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not supported on Windows")
+	}
+
+	dir := filepath.Join(t.TempDir(), "logs")
+
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelDebug,
+		DebugLevel: 1,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddFileEngine(file.Options{
+		Prefix:    "Test",
+		Directory: dir,
+		FileMode:  0600,
+		DirMode:   0700,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	printTestMessages(lg)
+	lg.Flush()
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("unable to stat directory. [%v]", err)
+	}
+	if fi.Mode().Perm() != 0700 {
+		t.Errorf("unexpected directory mode. [%v]", fi.Mode().Perm())
+	}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "test.*.log"))
+	if len(names) == 0 {
+		t.Fatalf("log file not found")
+	}
+	fi, err = os.Stat(names[0])
+	if err != nil {
+		t.Fatalf("unable to stat file. [%v]", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("unexpected file mode. [%v]", fi.Mode().Perm())
+	}
+
+	// Modes that prevent the owner from writing or that are not permission bits must be rejected
+	err = lg.AddFileEngine(file.Options{
+		Directory: dir,
+		FileMode:  0400,
+	})
+	if err == nil {
+		t.Errorf("read-only file mode was accepted")
+	}
+	err = lg.AddFileEngine(file.Options{
+		Directory: dir,
+		DirMode:   os.ModeDir | 0755,
+	})
+	if err == nil {
+		t.Errorf("invalid directory mode was accepted")
+	}
+}
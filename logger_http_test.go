@@ -0,0 +1,92 @@
+package logger_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mxmauro/logger"
+	httpengine "github.com/mxmauro/logger/engines/http"
+)
+
+//------------------------------------------------------------------------------
+
+func TestHTTPBatchAndRetry(t *testing.T) {
+	var failures int32 = 2
+
+	mtx := sync.Mutex{}
+	batches := make([][]map[string]interface{}, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		batch := make([]map[string]interface{}, 0)
+		if err := json.Unmarshal(body, &batch); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mtx.Lock()
+		batches = append(batches, batch)
+		mtx.Unlock()
+	}))
+	defer server.Close()
+
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelDebug,
+		DebugLevel: 1,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddHTTPEngine(httpengine.Options{
+		URL: server.URL,
+		Headers: map[string]string{
+			"X-Api-Key": "secret",
+		},
+		BatchSize:     3,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Error("This is an error message sample")
+	lg.Warning("This is a warning message sample")
+	lg.Info(JsonMessage{
+		Message: "This is an information message sample",
+	})
+	lg.Debug(1, "This is a debug message sample at level 1 which should be printed")
+
+	// The first batch is sent when complete, the remaining entry is sent on flush
+	time.Sleep(3 * time.Second)
+	lg.Flush()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if len(batches) != 2 || len(batches[0]) != 3 || len(batches[1]) != 1 {
+		t.Fatalf("unexpected batches received. [%v]", batches)
+	}
+	if batches[0][0]["level"] != "error" || batches[0][0]["message"] != "This is an error message sample" {
+		t.Errorf("unexpected entry. [%v]", batches[0][0])
+	}
+	if batches[0][2]["level"] != "info" || batches[0][2]["message"] != "This is an information message sample" {
+		t.Errorf("unexpected entry. [%v]", batches[0][2])
+	}
+	if batches[1][0]["level"] != "debug" {
+		t.Errorf("unexpected entry. [%v]", batches[1][0])
+	}
+}
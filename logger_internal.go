@@ -1,11 +1,22 @@
 package logger
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/mxmauro/logger/engines"
 )
 
 //------------------------------------------------------------------------------
@@ -20,87 +31,569 @@ const (
 	logTypeDebug
 )
 
+type logRecord struct {
+	_type    logType
+	now      time.Time
+	msg      string
+	plainMsg string
+	raw      bool
+	caller   *engines.CallerInfo
+
+	// Used in asynchronous mode
+	enqueuedAt time.Time
+	flushedCh  chan struct{}
+}
+
+// shutdownTracker keeps the engines that are still being destroyed by DestroyWithTimeout.
+type shutdownTracker struct {
+	mtx     sync.Mutex
+	pending map[string]struct{}
+}
+
+// levelGate is a copy of the levels that can be read without locking.
+type levelGate struct {
+	logLevel      LogLevel
+	debugLogLevel uint
+}
+
 //------------------------------------------------------------------------------
 
+var (
+	packagePath = reflect.TypeOf(Logger{}).PkgPath()
+
+	loggableType = reflect.TypeOf((*Loggable)(nil)).Elem()
+)
+
+const (
+	// Maximum amount of nested LogValue calls, to avoid infinite loops
+	maxLogValueDepth = 8
+)
+
+//------------------------------------------------------------------------------
+
+// onLevelRevert restores the level saved by SetLogLevelFor unless the revert was replaced or canceled meanwhile.
+func (lg *Logger) onLevelRevert(seq uint64) {
+	// Lock access
+	lg.mtx.Lock()
+	defer lg.mtx.Unlock()
+
+	if lg.levelRevertTimer == nil || lg.levelRevertSeq != seq {
+		return
+	}
+	lg.levelRevertTimer = nil
+	lg.setLevel(lg.savedLogLevel, lg.savedDebugLogLevel)
+}
+
+// setLevel changes the minimum level of the messages to emit. The caller must hold the lock.
+func (lg *Logger) setLevel(level LogLevel, debugLevel uint) {
+	lg.logLevel = level
+	lg.debugLogLevel = debugLevel
+	lg.levelGate.Store(&levelGate{
+		logLevel:      level,
+		debugLogLevel: debugLevel,
+	})
+}
+
+// mayEmit returns false if a message of the given level is going to be discarded. It checks a copy of the
+// levels without locking, so filtered messages skip the re-entrancy guard and the lock. Messages that pass
+// are checked again once the lock is held.
+func (lg *Logger) mayEmit(level LogLevel, debugLevel uint) bool {
+	gate := lg.levelGate.Load()
+	if gate == nil {
+		return true // Not created with Create
+	}
+	return level != LogLevelQuiet && gate.logLevel >= level &&
+		(level != LogLevelDebug || gate.debugLogLevel >= debugLevel)
+}
+
+// successEnabled returns true if success messages must be emitted at the current level. The caller must hold
+// the lock.
+func (lg *Logger) successEnabled() bool {
+	return lg.successLevel != LogLevelQuiet && lg.logLevel >= lg.successLevel
+}
+
+// stopLevelRevert cancels the pending level revert, if any. The caller must hold the lock.
+func (lg *Logger) stopLevelRevert() {
+	if lg.levelRevertTimer != nil {
+		lg.levelRevertTimer.Stop()
+		lg.levelRevertTimer = nil
+	}
+}
+
+func (lg *Logger) destroy(timeout time.Duration) error {
+	// The active default logger cannot be destroyed
+	if lg == defaultLogger.Load() {
+		return nil
+	}
+
+	if !lg.destroyed.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	// Emit the pending summaries of repeated messages
+	if lg.deduplicator != nil {
+		summaries := lg.deduplicator.closeAll()
+		if len(summaries) > 0 {
+			lg.mtx.RLock()
+			for _, summary := range summaries {
+				lg.emit(summary.msg, summary.isJSON, summary.jsonLevel, summary._type, false)
+			}
+			lg.mtx.RUnlock()
+		}
+	}
+
+	if timeout <= 0 {
+		return lg.shutdown(nil)
+	}
+
+	// Shut down in the background so stuck engines do not block the caller beyond the timeout
+	tracker := &shutdownTracker{
+		pending: make(map[string]struct{}),
+	}
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- lg.shutdown(tracker)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-doneCh:
+		return err
+	case <-timer.C:
+	}
+
+	pending := tracker.pendingEngines()
+	if len(pending) == 0 {
+		pending = []string{"the queued messages"}
+	}
+	err := errors.New("shutdown timed out waiting for " + strings.Join(pending, ", "))
+	_, _ = fmt.Fprintln(os.Stderr, "logger: warning: "+err.Error())
+	return err
+}
+
+func (t *shutdownTracker) start(names []string) {
+	// Lock access
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for _, name := range names {
+		t.pending[name] = struct{}{}
+	}
+}
+
+func (t *shutdownTracker) finish(name string) {
+	// Lock access
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	delete(t.pending, name)
+}
+
+// pendingEngines returns the sorted names of the engines that did not finish yet.
+func (t *shutdownTracker) pendingEngines() []string {
+	// Lock access
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	names := make([]string, 0, len(t.pending))
+	for name := range t.pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// shutdown delivers the queued messages and destroys the engines. If a tracker is given, the engines are
+// destroyed concurrently and the tracker is updated as they finish.
+func (lg *Logger) shutdown(tracker *shutdownTracker) error {
+	// Deliver the queued messages
+	if lg.async != nil {
+		lg.async.destroy()
+	}
+
+	// Detach the engines so the lock is not held while they are destroyed, which can take long
+	lg.mtx.Lock()
+	lg.stopLevelRevert()
+	list := lg.engines
+	lg.engines = nil
+	lg.mtx.Unlock()
+
+	// Destroy all engines
+	if tracker != nil {
+		wg := sync.WaitGroup{}
+
+		names := engineNames(list)
+		tracker.start(names)
+		for idx, engine := range list {
+			wg.Add(1)
+			go func(engine engines.Engine, name string) {
+				defer wg.Done()
+
+				engine.Destroy()
+				tracker.finish(name)
+			}(engine, names[idx])
+		}
+		wg.Wait()
+	} else {
+		for _, engine := range list {
+			engine.Destroy()
+		}
+	}
+
+	// Collect the errors the engines had while delivering the last messages
+	errs := make([]error, 0)
+	for _, engine := range list {
+		if reporter, ok := engine.(engines.ErrorReporter); ok {
+			if err, _ := reporter.LastError(); err != nil {
+				errs = append(errs, fmt.Errorf("%v engine: %w", engineClass(engine), err))
+			}
+		}
+	}
+
+	// Done
+	return errors.Join(errs...)
+}
+
 func (lg *Logger) log(obj interface{}, jsonLevel string, _type logType) {
+	if lg.destroyed.Load() {
+		return
+	}
+
 	msg, isJSON, ok := parseObj(obj)
 	if !ok {
 		return
 	}
 
+	// Neutralize the control characters before the message is filtered and sent
+	if !isJSON && lg.sanitizeControlChars {
+		if lg.controlCharsAction == ControlCharsStrip {
+			msg = engines.StripControlChars(msg, false)
+		} else {
+			msg = engines.EscapeControlChars(msg, false)
+		}
+	}
+
+	// A logger without engines is usually a mistake, so warn about it once
+	if len(lg.engines) == 0 && len(lg.hooks) == 0 && !lg.disableNoEngineWarning {
+		lg.noEngineWarning.Do(func() {
+			_, _ = fmt.Fprintln(os.Stderr, "logger: warning: a message was logged but no engine is added")
+		})
+	}
+
+	// Drop the message if the filter says so
+	if lg.filter != nil && !lg.filter(logTypeLevel(_type, lg.successLevel), msg, isJSON) {
+		return
+	}
+
+	// Drop the message if the sampler says so
+	if lg.sampler != nil && !lg.sampler.check(_type, msg) {
+		return
+	}
+
+	// Collapse repeated messages
+	if lg.deduplicator != nil {
+		emit, summary := lg.deduplicator.check(_type, msg, isJSON, jsonLevel, lg.onDedupWindowClosed)
+		if summary != nil {
+			lg.emit(summary.msg, summary.isJSON, summary.jsonLevel, summary._type, false)
+		}
+		if !emit {
+			return
+		}
+	}
+
+	lg.emit(msg, isJSON, jsonLevel, _type, true)
+}
+
+// emit sends the message to the engines. The caller must hold the read lock. Summaries of repeated messages
+// are emitted without the caller information because they are not sent from the original location.
+func (lg *Logger) emit(msg string, isJSON bool, jsonLevel string, _type logType, withCaller bool) {
+	// Send text messages as JSON so they carry the static fields
+	if !isJSON && lg.wrapStrings {
+		b, _ := json.Marshal(msg)
+		msg = `{"message":` + string(b) + `}`
+		isJSON = true
+	}
+
+	// Mask sensitive data
+	if lg.redactor != nil {
+		if isJSON {
+			msg = lg.redactor.redactJSON(msg)
+		} else {
+			msg = lg.redactor.redactText(msg)
+		}
+	}
+
+	var caller *engines.CallerInfo
+	if lg.includeCaller && withCaller {
+		caller = getCaller()
+	}
+
+	var stack []string
+	if lg.attachStackTrace && _type == logTypeError && withCaller {
+		stack = getStackTrace(lg.stackTraceMaxFrames)
+	}
+
 	now := lg.getTimestamp()
+
+	if len(lg.hooks) > 0 {
+		lg.runHooks(_type, msg, isJSON, now)
+	}
+
 	raw := false
+	plainMsg := msg
 	if isJSON {
-		msg = addPayloadToJSON(msg, now, jsonLevel)
+		msg = lg.addPayloadToJSON(msg, now, jsonLevel, caller, stack)
+		plainMsg = msg
 		raw = true
+	} else {
+		if caller != nil {
+			msg += " (" + formatCaller(caller) + ")"
+		}
+		if len(stack) > 0 {
+			stackLines := "\n\t" + strings.Join(stack, "\n\t")
+			msg += stackLines
+			plainMsg += stackLines
+		}
 	}
 
+	rec := &logRecord{
+		_type:    _type,
+		now:      now,
+		msg:      msg,
+		plainMsg: plainMsg,
+		raw:      raw,
+		caller:   caller,
+	}
+
+	// In asynchronous mode, the background worker delivers the message
+	if lg.async != nil {
+		lg.async.enqueue(rec)
+		return
+	}
+	lg.dispatch(rec)
+}
+
+// onDedupWindowClosed emits the summary of the repeated messages when the deduplication window closes.
+func (lg *Logger) onDedupWindowClosed(_type logType) {
+	gid, ok := lg.enterLog()
+	if !ok {
+		return
+	}
+	defer lg.leaveLog(gid)
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	if lg.destroyed.Load() {
+		return // The summary is emitted by destroy
+	}
+
+	summary := lg.deduplicator.closeWindow(_type)
+	if summary != nil {
+		lg.emit(summary.msg, summary.isJSON, summary.jsonLevel, summary._type, false)
+	}
+}
+
+// dispatch sends the message to the engines. The caller must hold the read lock.
+func (lg *Logger) dispatch(rec *logRecord) {
+	for _, engine := range lg.engines {
+		// Engines that handle caller information receive it separately from the message
+		if rec.caller != nil {
+			if callerAware, ok := engine.(engines.CallerAware); ok {
+				callerType := engines.LogType(rec._type)
+				if rec._type == logTypeSuccess && lg.successLevel == LogLevelError {
+					callerType = engines.LogTypeError
+				}
+				callerAware.LogWithCaller(callerType, rec.now, rec.plainMsg, rec.raw, rec.caller)
+				continue
+			}
+		}
+
+		switch rec._type {
+		case logTypeSuccess:
+			engine.Success(rec.now, rec.msg, rec.raw, lg.successLevel == LogLevelError)
+		case logTypeError:
+			engine.Error(rec.now, rec.msg, rec.raw)
+		case logTypeWarning:
+			engine.Warning(rec.now, rec.msg, rec.raw)
+		case logTypeInfo:
+			engine.Info(rec.now, rec.msg, rec.raw)
+		case logTypeDebug:
+			engine.Debug(rec.now, rec.msg, rec.raw)
+		}
+	}
+}
+
+// usesSameStreams checks if the given engine writes to any stream already used by the added engines.
+func (lg *Logger) usesSameStreams(engine engines.Engine) bool {
+	sw, ok := engine.(engines.StreamWriter)
+	if !ok {
+		return false
+	}
+	for _, other := range lg.engines {
+		otherSw, ok2 := other.(engines.StreamWriter)
+		if !ok2 {
+			continue
+		}
+		for _, w := range sw.Streams() {
+			for _, otherW := range otherSw.Streams() {
+				if isSameStream(w, otherW) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// enterLog marks the current goroutine as being processing a message. It returns false if it already was,
+// which happens when an engine logs while processing another message.
+//
+// The goroutine is identified on every call, even when no other message is being processed, because a
+// nested call can only be detected if the outer one was registered. A counter of active calls does not help
+// here, it cannot tell a nested call from a concurrent one. Parsing the stack header costs a few microseconds,
+// see BenchmarkEnterLog, which is only paid by the messages that pass the level check in mayEmit.
+func (lg *Logger) enterLog() (uint64, bool) {
+	gid := getGoroutineID()
+	if _, loaded := lg.activeGoroutines.LoadOrStore(gid, struct{}{}); loaded {
+		return gid, false
+	}
+	return gid, true
+}
+
+func (lg *Logger) leaveLog(gid uint64) {
+	lg.activeGoroutines.Delete(gid)
+}
+
+// logTypeLevel returns the level of the given message type. Success messages are sent at the configured level.
+func logTypeLevel(_type logType, successLevel LogLevel) LogLevel {
 	switch _type {
 	case logTypeSuccess:
-		for _, engine := range lg.engines {
-			engine.Success(now, msg, raw, lg.sendSuccessAtErrorLogLevel)
-		}
+		return successLevel
 	case logTypeError:
-		for _, engine := range lg.engines {
-			engine.Error(now, msg, raw)
-		}
+		return LogLevelError
 	case logTypeWarning:
-		for _, engine := range lg.engines {
-			engine.Warning(now, msg, raw)
-		}
+		return LogLevelWarning
 	case logTypeInfo:
-		for _, engine := range lg.engines {
-			engine.Info(now, msg, raw)
-		}
-	case logTypeDebug:
-		for _, engine := range lg.engines {
-			engine.Debug(now, msg, raw)
-		}
+		return LogLevelInfo
 	}
+	return LogLevelDebug
 }
 
 func (lg *Logger) getTimestamp() time.Time {
 	now := time.Now()
 	if !lg.useLocalTime {
 		now = now.UTC()
+	} else if lg.location != nil {
+		now = now.In(lg.location)
 	}
 	return now
 }
 
+// digits returns the amount of fractional second digits of the precision.
+func (p TimePrecision) digits() int {
+	switch p {
+	case TimePrecisionSeconds:
+		return 0
+	case TimePrecisionMicros:
+		return 6
+	case TimePrecisionNanos:
+		return 9
+	}
+	return 3
+}
+
+// applyToLayout changes the fractional seconds of the layout to match the precision. The layout is kept
+// as is with the default precision so the default one is still used when empty.
+func (p TimePrecision) applyToLayout(layout string) string {
+	if p == TimePrecisionMillis {
+		return layout
+	}
+	return engines.LayoutWithPrecision(layout, p.digits())
+}
+
+// applyTimeFormat returns the layout with the fractional seconds changed by the precision and trimming
+// options.
+func (lg *Logger) applyTimeFormat(layout string) string {
+	layout = lg.timePrecision.applyToLayout(layout)
+	if lg.trimTrailingZeros {
+		layout = engines.LayoutWithTrimmedZeros(layout)
+	}
+	return layout
+}
+
 //------------------------------------------------------------------------------
 
 func parseObj(obj interface{}) (msg string, isJSON bool, ok bool) {
-	// Quick check for strings, structs or pointer to strings or structs
+	// Types implementing Loggable choose their own representation
+	for depth := 0; depth < maxLogValueDepth; depth++ {
+		loggable, isLoggable := asLoggable(obj)
+		if !isLoggable {
+			break
+		}
+		obj = loggable.LogValue()
+	}
+
+	// Pre-encoded JSON objects are used as is, other byte slices are treated as text
+	switch b := obj.(type) {
+	case json.RawMessage:
+		msg, isJSON = parseRawJSON(b)
+		return msg, isJSON, true
+	case []byte:
+		msg, isJSON = parseRawJSON(b)
+		return msg, isJSON, true
+	case error:
+		// Errors usually wrap unexported structs, so their message is logged instead of their fields
+		if refObj := reflect.ValueOf(b); refObj.Kind() != reflect.Ptr || !refObj.IsNil() {
+			msg, isJSON, ok = marshalError(b)
+			return
+		}
+	}
+
+	// Quick check for strings, structs, maps, slices, scalars or pointer to them
 	refObj := reflect.ValueOf(obj)
 	switch refObj.Kind() {
 	case reflect.Ptr:
 		if !refObj.IsNil() {
 			switch refObj.Elem().Kind() {
 			case reflect.String:
-				msg = *(obj.(*string))
+				msg = refObj.Elem().String()
 				ok = true
 
-			case reflect.Struct:
-				// Marshal struct
-				b, err := json.Marshal(obj)
-				if err == nil {
-					msg = string(b)
-					isJSON = true
+			case reflect.Struct, reflect.Map:
+				msg, isJSON, ok = marshalObj(obj)
+
+			case reflect.Slice, reflect.Array:
+				msg, isJSON, ok = marshalList(obj)
+
+			default:
+				if isScalarKind(refObj.Elem().Kind()) {
+					if stringer, isStringer := obj.(fmt.Stringer); isStringer {
+						msg = stringer.String()
+					} else {
+						msg = fmt.Sprint(refObj.Elem().Interface())
+					}
 					ok = true
 				}
 			}
 		}
 
 	case reflect.String:
-		msg = obj.(string)
+		msg = refObj.String()
 		ok = true
 
-	case reflect.Struct:
-		// Marshal struct
-		b, err := json.Marshal(obj)
-		if err == nil {
-			msg = string(b)
-			isJSON = true
+	case reflect.Struct, reflect.Map:
+		msg, isJSON, ok = marshalObj(obj)
+
+	case reflect.Slice, reflect.Array:
+		msg, isJSON, ok = marshalList(obj)
+
+	default:
+		if isScalarKind(refObj.Kind()) {
+			msg = fmt.Sprint(obj) // NOTE: This calls the String method if the type implements it.
 			ok = true
 		}
 	}
@@ -109,19 +602,319 @@ func parseObj(obj interface{}) (msg string, isJSON bool, ok bool) {
 	return
 }
 
-func addPayloadToJSON(s string, now time.Time, level string) string {
-	if len(s) < 2 || s[0] != '{' {
-		return s // Cannot modify if not an encoded object
+// asLoggable returns the object as a Loggable, also if it is a value whose pointer implements the interface.
+// Nil pointers are not considered because the method may not handle them.
+func asLoggable(obj interface{}) (Loggable, bool) {
+	if obj == nil {
+		return nil, false
+	}
+
+	refObj := reflect.ValueOf(obj)
+	if refObj.Kind() == reflect.Ptr && refObj.IsNil() {
+		return nil, false
+	}
+	if loggable, ok := obj.(Loggable); ok {
+		return loggable, true
 	}
+	if refObj.Kind() != reflect.Ptr && reflect.PointerTo(refObj.Type()).Implements(loggableType) {
+		ptr := reflect.New(refObj.Type())
+		ptr.Elem().Set(refObj)
+		return ptr.Interface().(Loggable), true
+	}
+	return nil, false
+}
+
+// NOTE: The json encoder sorts map keys, so the output of logging the same map is always deterministic.
+func marshalObj(obj interface{}) (msg string, isJSON bool, ok bool) {
+	b, err := json.Marshal(obj)
+	if err == nil {
+		msg = string(b)
+		if msg == "null" {
+			msg = "{}" // Nil maps are logged as empty objects
+		}
+		isJSON = true
+		ok = true
+	}
+	return
+}
+
+// parseRawJSON returns the content of the byte slice and true if it is a JSON object. Objects spanning
+// multiple lines are compacted.
+func parseRawJSON(b []byte) (string, bool) {
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) < 2 || trimmed[0] != '{' || !json.Valid(trimmed) {
+		return string(b), false
+	}
+	if bytes.ContainsAny(trimmed, "\r\n") {
+		buf := bytes.Buffer{}
+		if json.Compact(&buf, trimmed) == nil {
+			return buf.String(), true
+		}
+	}
+	return string(trimmed), true
+}
+
+// marshalList encodes slices and arrays wrapped in an object, under the data key, so the timestamp and level
+// can be added to it.
+func marshalList(obj interface{}) (msg string, isJSON bool, ok bool) {
+	b, err := json.Marshal(obj)
+	if err == nil {
+		msg = `{"data":` + string(b) + `}`
+		isJSON = true
+		ok = true
+	}
+	return
+}
+
+// marshalError encodes an error as an object with its message under the error key and, if it wraps other
+// errors, the messages of the chain under the causes key.
+func marshalError(err error) (msg string, isJSON bool, ok bool) {
+	obj := struct {
+		Error  string   `json:"error"`
+		Causes []string `json:"causes,omitempty"`
+	}{
+		Error: err.Error(),
+	}
+	for cause := errors.Unwrap(err); cause != nil; cause = errors.Unwrap(cause) {
+		obj.Causes = append(obj.Causes, cause.Error())
+	}
+	return marshalObj(obj)
+}
+
+// logNested prints messages logged while processing another message directly to the standard error.
+func logNested(obj interface{}, levelName string) {
+	msg, _, ok := parseObj(obj)
+	if ok {
+		_, _ = fmt.Fprintf(os.Stderr, "[NESTED %v] %v\n", levelName, msg)
+	}
+}
+
+// getGoroutineID returns the identifier of the current goroutine by parsing the header of its stack trace.
+// The digits are parsed in place to avoid allocations.
+func getGoroutineID() uint64 {
+	var buf [64]byte
+
+	n := runtime.Stack(buf[:], false)
+	id := uint64(0)
+	for idx := len("goroutine "); idx < n && buf[idx] >= '0' && buf[idx] <= '9'; idx++ {
+		id = id*10 + uint64(buf[idx]-'0')
+	}
+	return id
+}
+
+func isScalarKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	}
+	return false
+}
+
+// getCaller returns the first frame in the call stack that does not belong to this package.
+func getCaller() *engines.CallerInfo {
+	var pcs [16]uintptr
+
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !isPackageFunction(frame.Function) {
+			return &engines.CallerInfo{
+				File:     frame.File,
+				Line:     frame.Line,
+				Function: frame.Function,
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	return nil
+}
+
+func isSameStream(w1 io.Writer, w2 io.Writer) bool {
+	// Files are compared by pointer. Calling Fd would switch them to blocking mode.
+	if f1, ok := w1.(*os.File); ok {
+		f2, ok2 := w2.(*os.File)
+		return ok2 && f1 == f2
+	}
+
+	// Comparing writers whose type is not comparable would panic
+	t := reflect.TypeOf(w1)
+	return t != nil && t == reflect.TypeOf(w2) && t.Comparable() && w1 == w2
+}
+
+// engineNames returns the class of each engine. Repeated classes get a numeric suffix, like syslog#2.
+func engineNames(list []engines.Engine) []string {
+	names := make([]string, len(list))
+	used := make(map[string]struct{})
+	for idx, engine := range list {
+		class := engineClass(engine)
+		name := class
+		for n := 2; ; n++ {
+			if _, exists := used[name]; !exists {
+				break
+			}
+			name = class + "#" + strconv.Itoa(n)
+		}
+		used[name] = struct{}{}
+		names[idx] = name
+	}
+	return names
+}
+
+// engineClass returns the class name of the engine, or its type name if it does not provide one.
+func engineClass(engine engines.Engine) string {
+	if c, ok := engine.(interface{ Class() string }); ok {
+		return c.Class()
+	}
+	return reflect.TypeOf(engine).String()
+}
+
+// getStackTrace returns the call stack of the caller, skipping the logger frames, with one item per frame
+// containing the function name and its location.
+func getStackTrace(maxFrames int) []string {
+	pcs := make([]uintptr, maxFrames+16)
+
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	stack := make([]string, 0, maxFrames)
+	for len(stack) < maxFrames {
+		frame, more := frames.Next()
+		if len(stack) > 0 || !isPackageFunction(frame.Function) {
+			stack = append(stack, frame.Function+" ("+frame.File+":"+strconv.Itoa(frame.Line)+")")
+		}
+		if !more {
+			break
+		}
+	}
+	return stack
+}
+
+func formatCaller(caller *engines.CallerInfo) string {
+	return filepath.Base(caller.File) + ":" + strconv.Itoa(caller.Line)
+}
+
+func isPackageFunction(function string) bool {
+	return strings.HasPrefix(function, packagePath+".") || strings.HasPrefix(function, packagePath+"/")
+}
+
+// marshalFields encodes the static fields, sorted by key, as the members of a JSON object without the braces,
+// so they can be added to each message without encoding them again.
+func marshalFields(fields map[string]interface{}) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
 	sb := strings.Builder{}
-	_, _ = sb.WriteString(s[:1])
-	_, _ = sb.WriteString(fmt.Sprintf(`"timestamp":"%v","level":"%v"`, now.Format("2006-01-02 15:04:05.000"), level))
-	if s[1] != '}' {
-		_, _ = sb.WriteString(",") // Add the comma separator if not an empty json object
+	for _, k := range keys {
+		b, err := json.Marshal(fields[k])
+		if err != nil {
+			continue
+		}
+		key, _ := json.Marshal(k)
+		if sb.Len() > 0 {
+			_, _ = sb.WriteString(",")
+		}
+		_, _ = sb.Write(key)
+		_, _ = sb.WriteString(":")
+		_, _ = sb.Write(b)
+	}
+	return sb.String()
+}
+
+// addPayloadToJSON inserts the timestamp, level and the rest of the logger fields at the beginning of the
+// encoded object. The size of the result is computed first so its buffer is allocated once because the object
+// can be large.
+func (lg *Logger) addPayloadToJSON(s string, now time.Time, level string, caller *engines.CallerInfo, stack []string) string {
+	var schemaVersion, callerInfo, stackInfo []byte
+
+	// Skip the leading whitespace
+	start := 0
+	for start < len(s) && isJSONWhitespace(s[start]) {
+		start += 1
+	}
+	if len(s)-start < 2 || s[start] != '{' {
+		return s // Cannot modify if not an encoded object
 	}
-	_, _ = sb.WriteString(s[1:])
 
-	// Return modified string
+	// Encode the fields to insert and calculate the final size
+	timestamp := engines.FormatTimestamp(now, lg.timeLayout)
+	quoteTimestamp := !engines.IsNumericTimeLayout(lg.timeLayout)
+	size := len(`{"timestamp":`) + len(timestamp) + len(`,"level":""`) + len(level)
+	if quoteTimestamp {
+		size += 2
+	}
+	if len(lg.schemaVersion) > 0 {
+		schemaVersion, _ = json.Marshal(lg.schemaVersion)
+		size += len(`,"schema_version":`) + len(schemaVersion)
+	}
+	if len(lg.fields) > 0 {
+		size += 1 + len(lg.fields)
+	}
+	if caller != nil {
+		callerInfo, _ = json.Marshal(formatCaller(caller))
+		size += len(`,"caller":`) + len(callerInfo)
+	}
+	if len(stack) > 0 {
+		stackInfo, _ = json.Marshal(stack)
+		size += len(`,"stack":`) + len(stackInfo)
+	}
+
+	// Add the comma separator if not an empty json object
+	rest := s[start+1:]
+	addComma := false
+	for idx := 0; idx < len(rest) && rest[idx] != '}'; idx++ {
+		if !isJSONWhitespace(rest[idx]) {
+			addComma = true
+			size += 1
+			break
+		}
+	}
+	size += len(rest)
+
+	// Build the result
+	sb := strings.Builder{}
+	sb.Grow(size)
+	_, _ = sb.WriteString(`{"timestamp":`)
+	if quoteTimestamp {
+		_, _ = sb.WriteString(`"`)
+		_, _ = sb.WriteString(timestamp)
+		_, _ = sb.WriteString(`"`)
+	} else {
+		_, _ = sb.WriteString(timestamp)
+	}
+	_, _ = sb.WriteString(`,"level":"`)
+	_, _ = sb.WriteString(level)
+	_, _ = sb.WriteString(`"`)
+	if schemaVersion != nil {
+		_, _ = sb.WriteString(`,"schema_version":`)
+		_, _ = sb.Write(schemaVersion)
+	}
+	if len(lg.fields) > 0 {
+		_, _ = sb.WriteString(",")
+		_, _ = sb.WriteString(lg.fields)
+	}
+	if callerInfo != nil {
+		_, _ = sb.WriteString(`,"caller":`)
+		_, _ = sb.Write(callerInfo)
+	}
+	if stackInfo != nil {
+		_, _ = sb.WriteString(`,"stack":`)
+		_, _ = sb.Write(stackInfo)
+	}
+	if addComma {
+		_, _ = sb.WriteString(",")
+	}
+	_, _ = sb.WriteString(rest)
 	return sb.String()
 }
+
+func isJSONWhitespace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n'
+}
@@ -0,0 +1,166 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mxmauro/logger/engines"
+	"github.com/mxmauro/logger/engines/null"
+)
+
+//------------------------------------------------------------------------------
+
+func TestAddPayloadToJSON(t *testing.T) {
+	lg := &Logger{
+		timeLayout: TimeLayoutEpoch,
+	}
+	now := time.Unix(1700000000, 0)
+
+	tests := map[string]string{
+		`{"a":1}`:        `{"timestamp":1700000000,"level":"info","a":1}`,
+		" \n\t{\"a\":1}": `{"timestamp":1700000000,"level":"info","a":1}`,
+		`{}`:             `{"timestamp":1700000000,"level":"info"}`,
+		`{ }`:            `{"timestamp":1700000000,"level":"info" }`,
+		`[1,2]`:          `[1,2]`,
+		` {`:             ` {`,
+	}
+	for s, expected := range tests {
+		msg := lg.addPayloadToJSON(s, now, "info", nil, nil)
+		if msg != expected {
+			t.Errorf("unexpected result for %q. [%v]", s, msg)
+		}
+	}
+}
+
+func TestAddPayloadToJSONAllocations(t *testing.T) {
+	lg := &Logger{
+		timeLayout:    TimeLayoutDefault,
+		schemaVersion: "1",
+		fields:        `"service":"api"`,
+	}
+	now := time.Now()
+	s := `{"message":"` + strings.Repeat("x", 4096) + `"}`
+	stack := []string{"main.main()"}
+
+	msg := lg.addPayloadToJSON(s, now, "info", nil, stack)
+	if !strings.HasPrefix(msg, `{"timestamp":"`) ||
+		!strings.HasSuffix(msg, `,"schema_version":"1","service":"api","stack":["main.main()"],`+s[1:]) {
+		t.Fatalf("unexpected result. [%v]", msg)
+	}
+
+	// Besides the timestamp formatting, the result must be allocated once
+	lg.schemaVersion = ""
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = lg.addPayloadToJSON(s, now, "info", nil, nil)
+	})
+	if allocs > 2 {
+		t.Errorf("unexpected number of allocations. [%v]", allocs)
+	}
+}
+
+func TestGetGoroutineID(t *testing.T) {
+	id := getGoroutineID()
+	if id == 0 {
+		t.Fatalf("unable to get the goroutine id")
+	}
+
+	otherID := make(chan uint64)
+	go func() {
+		otherID <- getGoroutineID()
+	}()
+	if other := <-otherID; other == 0 || other == id {
+		t.Errorf("unexpected goroutine id. [%v / %v]", id, other)
+	}
+}
+
+func BenchmarkAddPayloadToJSON(b *testing.B) {
+	lg := &Logger{
+		timeLayout: TimeLayoutDefault,
+		fields:     `"service":"api"`,
+	}
+	now := time.Now()
+
+	items := make([]string, 2000)
+	for idx := range items {
+		items[idx] = fmt.Sprintf("item %d", idx)
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"message": "This is an information message sample",
+		"items":   items,
+	})
+	s := string(data)
+
+	b.Run("Concat", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = addPayloadToJSONConcat(lg, s, now, "info")
+		}
+	})
+	b.Run("Buffer", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = lg.addPayloadToJSON(s, now, "info", nil, nil)
+		}
+	})
+}
+
+func BenchmarkEnterLog(b *testing.B) {
+	lg := Create(Options{
+		Level: LogLevelInfo,
+	})
+	_ = lg.AddEngine(null.NewEngine())
+	defer lg.Destroy()
+
+	b.Run("Guard", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			gid, _ := lg.enterLog()
+			lg.leaveLog(gid)
+		}
+	})
+	b.Run("Info", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			lg.Info("This is an information message sample")
+		}
+	})
+}
+
+func BenchmarkFilteredDebug(b *testing.B) {
+	lg := Create(Options{
+		Level:                  LogLevelInfo,
+		DisableNoEngineWarning: true,
+	})
+	defer lg.Destroy()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			lg.Debugf(1, "This is a debug message sample %d", 1)
+		}
+	})
+}
+
+// addPayloadToJSONConcat is the previous implementation, which lets the builder grow, kept to compare the
+// allocations.
+func addPayloadToJSONConcat(lg *Logger, s string, now time.Time, level string) string {
+	if len(s) < 2 || s[0] != '{' {
+		return s
+	}
+
+	sb := strings.Builder{}
+	_, _ = sb.WriteString(s[:1])
+	_, _ = sb.WriteString(fmt.Sprintf(`"timestamp":"%v","level":"%v"`, engines.FormatTimestamp(now, lg.timeLayout), level))
+	if len(lg.fields) > 0 {
+		_, _ = sb.WriteString(`,`)
+		_, _ = sb.WriteString(lg.fields)
+	}
+	if s[1] != '}' {
+		_, _ = sb.WriteString(",")
+	}
+	_, _ = sb.WriteString(s[1:])
+	return sb.String()
+}
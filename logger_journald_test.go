@@ -0,0 +1,186 @@
+package logger_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mxmauro/logger"
+	"github.com/mxmauro/logger/engines/journald"
+)
+
+//------------------------------------------------------------------------------
+
+func TestJournaldFields(t *testing.T) {
+	conn, socketPath := createMockJournalSocket(t)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	lg := logger.Create(logger.Options{
+		Level:         logger.LogLevelDebug,
+		DebugLevel:    1,
+		IncludeCaller: true,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddJournaldEngine(journald.Options{
+		AppName:    "journald-test",
+		SocketPath: socketPath,
+		MessageID:  "0123456789ABCDEF0123456789abcdef",
+		MessageIDs: journald.MessageIDs{
+			Error: "fedcba98-7654-3210-fedc-ba9876543210",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Error("first line\nsecond line")
+	lg.Info("This is an information message sample")
+
+	fields := readJournalEntry(t, conn)
+	checkJournalField(t, fields, "PRIORITY", "3")
+	checkJournalField(t, fields, "SYSLOG_IDENTIFIER", "journald-test")
+	checkJournalField(t, fields, "MESSAGE_ID", "fedcba9876543210fedcba9876543210")
+	checkJournalField(t, fields, "MESSAGE", "first line\nsecond line")
+	if filepath.Base(fields["CODE_FILE"]) != "logger_journald_test.go" {
+		t.Errorf("unexpected CODE_FILE field. [%v]", fields["CODE_FILE"])
+	}
+	if !strings.HasSuffix(fields["CODE_FUNC"], ".TestJournaldFields") {
+		t.Errorf("unexpected CODE_FUNC field. [%v]", fields["CODE_FUNC"])
+	}
+	if len(fields["CODE_LINE"]) == 0 {
+		t.Errorf("missing CODE_LINE field")
+	}
+
+	fields = readJournalEntry(t, conn)
+	checkJournalField(t, fields, "PRIORITY", "6")
+	checkJournalField(t, fields, "MESSAGE_ID", "0123456789abcdef0123456789abcdef")
+	checkJournalField(t, fields, "MESSAGE", "This is an information message sample")
+}
+
+func TestJournaldInvalidMessageID(t *testing.T) {
+	conn, socketPath := createMockJournalSocket(t)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	for _, id := range []string{"1234", "0123456789abcdef0123456789abcdeg", "0123456789abcdef0123456789abcdef00"} {
+		_, err := journald.NewEngine(journald.Options{
+			SocketPath: socketPath,
+			MessageIDs: journald.MessageIDs{
+				Warning: id,
+			},
+		})
+		if err == nil {
+			t.Errorf("message id \"%v\" was accepted", id)
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+
+func createMockJournalSocket(t *testing.T) (*net.UnixConn, string) {
+	socketPath := filepath.Join(t.TempDir(), "journal.socket")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{
+		Name: socketPath,
+		Net:  "unixgram",
+	})
+	if err != nil {
+		t.Fatalf("unable to create mock journal socket. [%v]", err)
+	}
+	return conn, socketPath
+}
+
+func readJournalEntry(t *testing.T, conn *net.UnixConn) map[string]string {
+	buf := make([]byte, 65536)
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("unable to read journal entry. [%v]", err)
+	}
+	data := buf[:n]
+
+	fields := make(map[string]string)
+	for len(data) > 0 {
+		idx := strings.IndexAny(string(data), "=\n")
+		if idx < 0 {
+			t.Fatalf("malformed journal entry")
+		}
+		name := string(data[:idx])
+		if data[idx] == '=' {
+			data = data[idx+1:]
+			end := strings.IndexByte(string(data), '\n')
+			if end < 0 {
+				t.Fatalf("malformed journal entry")
+			}
+			fields[name] = string(data[:end])
+			data = data[end+1:]
+		} else {
+			data = data[idx+1:]
+			size := int(binary.LittleEndian.Uint64(data[:8]))
+			fields[name] = string(data[8 : 8+size])
+			data = data[8+size+1:]
+		}
+	}
+	return fields
+}
+
+func checkJournalField(t *testing.T, fields map[string]string, name string, expected string) {
+	if fields[name] != expected {
+		t.Errorf("unexpected %v field. [%q != %q]", name, fields[name], expected)
+	}
+}
+
+func TestJournaldJSONFields(t *testing.T) {
+	conn, socketPath := createMockJournalSocket(t)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddJournaldEngine(journald.Options{
+		AppName:    "journald-test",
+		SocketPath: socketPath,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Warning(map[string]interface{}{
+		"message":    "This is a warning message sample",
+		"user-id":    1234,
+		"request":    map[string]interface{}{"path": "/"},
+		"_transport": "forged",
+	})
+
+	fields := readJournalEntry(t, conn)
+	checkJournalField(t, fields, "PRIORITY", "4")
+	checkJournalField(t, fields, "LEVEL", "warning")
+	checkJournalField(t, fields, "USER_ID", "1234")
+	checkJournalField(t, fields, "REQUEST", `{"path":"/"}`)
+	checkJournalField(t, fields, "TRANSPORT", "forged")
+	if !strings.Contains(fields["MESSAGE"], `"message":"This is a warning message sample"`) {
+		t.Errorf("unexpected MESSAGE field. [%v]", fields["MESSAGE"])
+	}
+}
+
+func TestJournaldNotAvailable(t *testing.T) {
+	_, err := journald.NewEngine(journald.Options{
+		SocketPath: filepath.Join(t.TempDir(), "missing.socket"),
+	})
+	if !errors.Is(err, journald.ErrNotAvailable) {
+		t.Errorf("unexpected error. [%v]", err)
+	}
+}
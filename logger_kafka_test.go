@@ -0,0 +1,362 @@
+package logger_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/mxmauro/logger"
+	"github.com/mxmauro/logger/engines/kafka"
+)
+
+//------------------------------------------------------------------------------
+
+type mockKafkaRecord struct {
+	partition int32
+	key       string
+	value     string
+}
+
+type mockKafkaBroker struct {
+	listener net.Listener
+	topic    string
+	mtx      sync.Mutex
+	records  []mockKafkaRecord
+	wg       sync.WaitGroup
+}
+
+type kafkaReader struct {
+	b []byte
+}
+
+//------------------------------------------------------------------------------
+
+func TestKafka(t *testing.T) {
+	broker := newMockKafkaBroker(t, "logs")
+	defer broker.close()
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddKafkaEngine(kafka.Options{
+		Brokers:  []string{broker.listener.Addr().String()},
+		Topic:    "logs",
+		Key:      "default-key",
+		KeyField: "tenant",
+		SASL: &kafka.SASLOptions{
+			Username: "user",
+			Password: "pass",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Info("This is an info message sample")
+	lg.Error(map[string]interface{}{
+		"message": "This is an error message sample",
+		"tenant":  "acme",
+	})
+	lg.Flush()
+
+	broker.mtx.Lock()
+	defer broker.mtx.Unlock()
+
+	if len(broker.records) != 2 {
+		t.Fatalf("unexpected amount of records. [%v]", len(broker.records))
+	}
+
+	// Records of different partitions may arrive in any order
+	values := make(map[string]map[string]interface{})
+	for _, record := range broker.records {
+		msg := make(map[string]interface{})
+		_ = json.Unmarshal([]byte(record.value), &msg)
+		values[record.key] = msg
+	}
+	if msg := values["default-key"]; msg == nil || msg["level"] != "info" ||
+		msg["message"] != "This is an info message sample" {
+		t.Errorf("unexpected records. [%+v]", broker.records)
+	}
+	if msg := values["acme"]; msg == nil || msg["level"] != "error" || msg["tenant"] != "acme" {
+		t.Errorf("unexpected records. [%+v]", broker.records)
+	}
+}
+
+func TestKafkaDroppedMessages(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddKafkaEngine(kafka.Options{
+		Brokers:      []string{"kafka.invalid:9092"},
+		Topic:        "logs",
+		MaxQueueSize: 2,
+		DialFunc: func(_ context.Context, _, _ string) (net.Conn, error) {
+			return nil, errors.New("broker down")
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		lg.Info("This is an info message sample")
+	}
+
+	health := lg.Health()["kafka"]
+	if health.Dropped != 3 || health.QueueDepth != 2 {
+		t.Errorf("unexpected health. [%+v]", health)
+	}
+}
+
+func newMockKafkaBroker(t *testing.T, topic string) *mockKafkaBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen. [%v]", err)
+	}
+
+	b := &mockKafkaBroker{
+		listener: listener,
+		topic:    topic,
+		records:  make([]mockKafkaRecord, 0),
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+
+		for {
+			conn, err2 := listener.Accept()
+			if err2 != nil {
+				return
+			}
+			b.wg.Add(1)
+			go func() {
+				defer b.wg.Done()
+				b.serve(t, conn)
+			}()
+		}
+	}()
+	return b
+}
+
+func (b *mockKafkaBroker) close() {
+	_ = b.listener.Close()
+	b.wg.Wait()
+}
+
+func (b *mockKafkaBroker) serve(t *testing.T, conn net.Conn) {
+	var size [4]byte
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	authenticated := false
+	for {
+		_, err := io.ReadFull(conn, size[:])
+		if err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		_, err = io.ReadFull(conn, req)
+		if err != nil {
+			return
+		}
+
+		r := &kafkaReader{
+			b: req,
+		}
+		apiKey := r.int16()
+		_ = r.int16() // API version
+		correlationID := r.int32()
+		_ = r.string() // Client ID
+
+		resp := binary.BigEndian.AppendUint32(nil, uint32(correlationID))
+		switch apiKey {
+		case 17: // SaslHandshake
+			if r.string() != "PLAIN" {
+				t.Errorf("unexpected SASL mechanism")
+				return
+			}
+			resp = binary.BigEndian.AppendUint16(resp, 0)
+			resp = binary.BigEndian.AppendUint32(resp, 1)
+			resp = appendKafkaString(resp, "PLAIN")
+
+		case 36: // SaslAuthenticate
+			authenticated = string(r.bytes()) == "\x00user\x00pass"
+			if authenticated {
+				resp = binary.BigEndian.AppendUint16(resp, 0)
+			} else {
+				resp = binary.BigEndian.AppendUint16(resp, 58)
+			}
+			resp = binary.BigEndian.AppendUint16(resp, 0xFFFF)
+			resp = binary.BigEndian.AppendUint32(resp, 0)
+
+		case 3: // Metadata
+			if !authenticated {
+				t.Errorf("metadata requested without authentication")
+				return
+			}
+			host, port, _ := net.SplitHostPort(b.listener.Addr().String())
+			portNum, _ := strconv.Atoi(port)
+
+			resp = binary.BigEndian.AppendUint32(resp, 0) // Throttle time
+			resp = binary.BigEndian.AppendUint32(resp, 1)
+			resp = binary.BigEndian.AppendUint32(resp, 1) // Node ID
+			resp = appendKafkaString(resp, host)
+			resp = binary.BigEndian.AppendUint32(resp, uint32(portNum))
+			resp = binary.BigEndian.AppendUint16(resp, 0xFFFF) // Rack
+			resp = binary.BigEndian.AppendUint16(resp, 0xFFFF) // Cluster ID
+			resp = binary.BigEndian.AppendUint32(resp, 1)      // Controller ID
+			resp = binary.BigEndian.AppendUint32(resp, 1)
+			resp = binary.BigEndian.AppendUint16(resp, 0)
+			resp = appendKafkaString(resp, b.topic)
+			resp = append(resp, 0)
+			resp = binary.BigEndian.AppendUint32(resp, 2)
+			for partition := uint32(0); partition < 2; partition++ {
+				resp = binary.BigEndian.AppendUint16(resp, 0)
+				resp = binary.BigEndian.AppendUint32(resp, partition)
+				resp = binary.BigEndian.AppendUint32(resp, 1) // Leader
+				resp = binary.BigEndian.AppendUint32(resp, 1)
+				resp = binary.BigEndian.AppendUint32(resp, 1) // Replicas
+				resp = binary.BigEndian.AppendUint32(resp, 1)
+				resp = binary.BigEndian.AppendUint32(resp, 1) // In-sync replicas
+			}
+
+		case 0: // Produce
+			if !authenticated {
+				t.Errorf("produce requested without authentication")
+				return
+			}
+			_ = r.string() // Transactional ID
+			_ = r.int16()  // Acks
+			_ = r.int32()  // Timeout
+			partitions := make([]int32, 0)
+			for topics := r.int32(); topics > 0; topics-- {
+				_ = r.string()
+				for count := r.int32(); count > 0; count-- {
+					partition := r.int32()
+					if !b.parseRecordBatch(partition, r.bytes()) {
+						t.Errorf("invalid record batch")
+						return
+					}
+					partitions = append(partitions, partition)
+				}
+			}
+
+			resp = binary.BigEndian.AppendUint32(resp, 1)
+			resp = appendKafkaString(resp, b.topic)
+			resp = binary.BigEndian.AppendUint32(resp, uint32(len(partitions)))
+			for _, partition := range partitions {
+				resp = binary.BigEndian.AppendUint32(resp, uint32(partition))
+				resp = binary.BigEndian.AppendUint16(resp, 0)
+				resp = binary.BigEndian.AppendUint64(resp, 0)
+				resp = binary.BigEndian.AppendUint64(resp, 0xFFFFFFFFFFFFFFFF)
+			}
+			resp = binary.BigEndian.AppendUint32(resp, 0) // Throttle time
+
+		default:
+			t.Errorf("unexpected api key %v", apiKey)
+			return
+		}
+
+		_, err = conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(resp))), resp...))
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (b *mockKafkaBroker) parseRecordBatch(partition int32, batch []byte) bool {
+	if len(batch) < 61 || batch[16] != 2 {
+		return false
+	}
+	crc := binary.BigEndian.Uint32(batch[17:])
+	if crc != crc32.Checksum(batch[21:], crc32.MakeTable(crc32.Castagnoli)) {
+		return false
+	}
+
+	r := &kafkaReader{
+		b: batch[57:],
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for count := r.int32(); count > 0; count-- {
+		_ = r.varint() // Length
+		r.b = r.b[1:]  // Attributes
+		_ = r.varint() // Timestamp delta
+		_ = r.varint() // Offset delta
+		key := r.varintBytes()
+		value := r.varintBytes()
+		_ = r.varint() // Headers
+		b.records = append(b.records, mockKafkaRecord{
+			partition: partition,
+			key:       string(key),
+			value:     string(value),
+		})
+	}
+	return true
+}
+
+func (r *kafkaReader) int16() int16 {
+	v := int16(binary.BigEndian.Uint16(r.b))
+	r.b = r.b[2:]
+	return v
+}
+
+func (r *kafkaReader) int32() int32 {
+	v := int32(binary.BigEndian.Uint32(r.b))
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *kafkaReader) string() string {
+	l := int(r.int16())
+	if l < 0 {
+		return ""
+	}
+	s := string(r.b[:l])
+	r.b = r.b[l:]
+	return s
+}
+
+func (r *kafkaReader) bytes() []byte {
+	l := int(r.int32())
+	if l < 0 {
+		return nil
+	}
+	b := r.b[:l]
+	r.b = r.b[l:]
+	return b
+}
+
+func (r *kafkaReader) varint() int64 {
+	v, n := binary.Varint(r.b)
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *kafkaReader) varintBytes() []byte {
+	l := int(r.varint())
+	if l < 0 {
+		return nil
+	}
+	b := r.b[:l]
+	r.b = r.b[l:]
+	return b
+}
+
+func appendKafkaString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,200 @@
+package logger_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mxmauro/logger"
+	"github.com/mxmauro/logger/engines/capture"
+)
+
+//------------------------------------------------------------------------------
+
+func TestParseLogLevel(t *testing.T) {
+	tests := map[string]logger.LogLevel{
+		"quiet":   logger.LogLevelQuiet,
+		"ERROR":   logger.LogLevelError,
+		"Warning": logger.LogLevelWarning,
+		"warn":    logger.LogLevelWarning,
+		"info":    logger.LogLevelInfo,
+		" debug ": logger.LogLevelDebug,
+	}
+	for s, expected := range tests {
+		level, err := logger.ParseLogLevel(s)
+		if err != nil {
+			t.Errorf("unable to parse level. [%v]", err)
+		} else if level != expected {
+			t.Errorf("unexpected level for \"%v\". [%v]", s, level)
+		}
+	}
+
+	_, err := logger.ParseLogLevel("verbose")
+	if err == nil {
+		t.Errorf("invalid level was accepted")
+	}
+}
+
+func TestLogLevelJSON(t *testing.T) {
+	b, err := json.Marshal(logger.Options{
+		Level: logger.LogLevelWarning,
+	})
+	if err != nil {
+		t.Errorf("unable to marshal options. [%v]", err)
+		return
+	}
+	if string(b) != `{"level":"warning"}` {
+		t.Errorf("unexpected marshaled options. [%v]", string(b))
+	}
+
+	opts := logger.Options{}
+	err = json.Unmarshal(b, &opts)
+	if err != nil {
+		t.Errorf("unable to unmarshal options. [%v]", err)
+	} else if opts.Level != logger.LogLevelWarning {
+		t.Errorf("unexpected level. [%v]", opts.Level)
+	}
+
+	// Numeric values are still accepted
+	err = json.Unmarshal([]byte(`{"level":4}`), &opts)
+	if err != nil {
+		t.Errorf("unable to unmarshal options. [%v]", err)
+	} else if opts.Level != logger.LogLevelDebug {
+		t.Errorf("unexpected level. [%v]", opts.Level)
+	}
+
+	err = json.Unmarshal([]byte(`{"level":"loud"}`), &opts)
+	if err == nil {
+		t.Errorf("invalid level was accepted")
+	}
+}
+
+func TestSetLogLevelFor(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelWarning,
+	})
+	defer lg.Destroy()
+
+	c := capture.NewEngine()
+	err := lg.AddEngine(c)
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	// Elevate twice, the original level must be restored after the last duration
+	lg.SetLogLevelFor(logger.LogLevelInfo, 0, time.Hour)
+	lg.SetLogLevelFor(logger.LogLevelDebug, 1, 200*time.Millisecond)
+	lg.Debug(1, "debug message")
+	if !c.ContainsLevel("debug") {
+		t.Fatalf("level was not elevated")
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	c.Reset()
+	lg.Debug(1, "debug message")
+	lg.Info("info message")
+	if len(c.Entries()) != 0 {
+		t.Fatalf("level was not reverted. [%v]", c.Entries())
+	}
+
+	// SetLogLevel cancels the pending revert
+	lg.SetLogLevelFor(logger.LogLevelInfo, 0, 200*time.Millisecond)
+	lg.SetLogLevel(logger.LogLevelError, 0)
+	time.Sleep(400 * time.Millisecond)
+	lg.Warning("warning message")
+	if len(c.Entries()) != 0 {
+		t.Fatalf("level was reverted after SetLogLevel. [%v]", c.Entries())
+	}
+
+	// A zero duration is permanent
+	lg.SetLogLevelFor(logger.LogLevelInfo, 0, 0)
+	time.Sleep(100 * time.Millisecond)
+	lg.Info("info message")
+	if !c.ContainsLevel("info") {
+		t.Errorf("level was not changed")
+	}
+}
+
+func TestLogWithLevel(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelDebug,
+		DebugLevel: 1,
+	})
+	defer lg.Destroy()
+
+	c := capture.NewEngine()
+	err := lg.AddEngine(c)
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Log(logger.LogLevelError, "error message")
+	lg.Logf(logger.LogLevelWarning, "warning %v", "message")
+	lg.Log(logger.LogLevelInfo, "info message")
+	lg.Logf(logger.LogLevelDebug, "debug %v", "message")
+	lg.LogDebug(logger.LogLevelDebug, 1, "debug level 1 message")
+	lg.LogDebug(logger.LogLevelDebug, 2, "filtered debug message")
+	lg.Log(logger.LogLevelQuiet, "ignored message")
+
+	entries := c.Entries()
+	expected := []capture.Entry{
+		{Level: "error", Msg: "error message"},
+		{Level: "warning", Msg: "warning message"},
+		{Level: "info", Msg: "info message"},
+		{Level: "debug", Msg: "debug message"},
+		{Level: "debug", Msg: "debug level 1 message"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("unexpected messages. [%v]", entries)
+	}
+	for idx, entry := range entries {
+		if entry.Level != expected[idx].Level || entry.Msg != expected[idx].Msg {
+			t.Errorf("unexpected message. [%+v]", entry)
+		}
+	}
+
+	// The same gating as the level methods applies
+	c.Reset()
+	lg.SetLogLevel(logger.LogLevelWarning, 0)
+	lg.Log(logger.LogLevelInfo, "info message")
+	lg.Logf(logger.LogLevelDebug, "debug message")
+	if len(c.Entries()) != 0 {
+		t.Errorf("messages not filtered. [%v]", c.Entries())
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:                  logger.LogLevelDebug,
+		DebugLevel:             2,
+		DisableNoEngineWarning: true,
+	})
+	defer lg.Destroy()
+
+	// Nothing is emitted without engines
+	if lg.Enabled(logger.LogLevelError, 0) {
+		t.Errorf("enabled without engines")
+	}
+	_ = lg.AddEngine(capture.NewEngine())
+
+	level, debugLevel := lg.Level()
+	if level != logger.LogLevelDebug || debugLevel != 2 {
+		t.Errorf("unexpected level. [%v/%v]", level, debugLevel)
+	}
+	if !lg.Enabled(logger.LogLevelError, 0) || !lg.Enabled(logger.LogLevelDebug, 2) {
+		t.Errorf("level not enabled")
+	}
+	if lg.Enabled(logger.LogLevelDebug, 3) || lg.Enabled(logger.LogLevelQuiet, 0) {
+		t.Errorf("level enabled")
+	}
+
+	lg.SetLogLevel(logger.LogLevelWarning, 0)
+	level, debugLevel = lg.Level()
+	if level != logger.LogLevelWarning || debugLevel != 0 {
+		t.Errorf("unexpected level. [%v/%v]", level, debugLevel)
+	}
+	if !lg.Enabled(logger.LogLevelWarning, 0) || lg.Enabled(logger.LogLevelInfo, 0) ||
+		lg.Enabled(logger.LogLevelDebug, 0) {
+		t.Errorf("unexpected enabled levels")
+	}
+}
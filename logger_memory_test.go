@@ -0,0 +1,82 @@
+package logger_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/mxmauro/logger"
+	"github.com/mxmauro/logger/engines/memory"
+)
+
+//------------------------------------------------------------------------------
+
+func TestMemoryRingBuffer(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelDebug,
+		DebugLevel: 1,
+	})
+	defer lg.Destroy()
+
+	mem := lg.AddMemoryEngine(memory.Options{
+		Capacity: 3,
+	})
+
+	lg.Error("message 1")
+	lg.Warning("message 2")
+	if entries := mem.Snapshot(); len(entries) != 2 || entries[0].Level != "error" || entries[1].Message != "message 2" {
+		t.Fatalf("unexpected entries. [%v]", entries)
+	}
+
+	lg.Info("message 3")
+	lg.Debug(1, "message 4")
+	lg.Info(JsonMessage{
+		Message: "message 5",
+	})
+
+	entries := mem.Snapshot()
+	if len(entries) != 3 {
+		t.Fatalf("unexpected number of entries. [%v]", len(entries))
+	}
+	if entries[0].Message != "message 3" || entries[1].Message != "message 4" || entries[1].Level != "debug" {
+		t.Errorf("unexpected entries. [%v]", entries)
+	}
+	if !entries[2].Raw || entries[2].Level != "info" {
+		t.Errorf("unexpected entry. [%v]", entries[2])
+	}
+}
+
+func TestMemoryConcurrentAccess(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	mem := lg.AddMemoryEngine(memory.Options{
+		Capacity: 50,
+	})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				lg.Info("message " + strconv.Itoa(j))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				_ = mem.Snapshot()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if entries := mem.Snapshot(); len(entries) != 50 {
+		t.Errorf("unexpected number of entries. [%v]", len(entries))
+	}
+}
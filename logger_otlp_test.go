@@ -0,0 +1,189 @@
+package logger_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mxmauro/logger"
+	"github.com/mxmauro/logger/engines/otlp"
+)
+
+//------------------------------------------------------------------------------
+
+type protoMessage struct {
+	varints map[int][]uint64
+	bytes   map[int][][]byte
+}
+
+//------------------------------------------------------------------------------
+
+func TestOTLP(t *testing.T) {
+	mtx := sync.Mutex{}
+	requests := make([][]byte, 0)
+	calls := 0
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		if r.ProtoMajor != 2 || r.URL.Path != "/opentelemetry.proto.collector.logs.v1.LogsService/Export" ||
+			r.Header.Get("Content-Type") != "application/grpc" || r.Header.Get("Api-Key") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+
+		// Reject the first call to check retries
+		calls += 1
+		w.Header().Set("Content-Type", "application/grpc")
+		if calls == 1 {
+			w.Header().Set("Grpc-Status", "14")
+			w.Header().Set("Grpc-Message", "unavailable")
+			return
+		}
+
+		if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			w.Header().Set("Grpc-Status", "3")
+			return
+		}
+		requests = append(requests, body[5:])
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddOTLPEngine(otlp.Options{
+		Endpoint: strings.TrimPrefix(server.URL, "https://"),
+		TlsConfig: &tls.Config{
+			RootCAs: rootCAs,
+		},
+		Headers: map[string]string{
+			"Api-Key": "secret",
+		},
+		ServiceName: "test-service",
+		ResourceAttributes: map[string]string{
+			"deployment.environment": "test",
+		},
+		FlushInterval: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Info("This is an info message sample")
+	lg.Error(map[string]interface{}{
+		"message": "This is an error message sample",
+		"user":    "john",
+		"count":   3,
+	})
+	lg.Flush()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if len(requests) == 0 {
+		t.Fatalf("no records were delivered")
+	}
+
+	records := make([]protoMessage, 0)
+	var resource protoMessage
+	for _, req := range requests {
+		for _, resourceLogs := range decodeProtoMessage(req).bytes[1] {
+			rl := decodeProtoMessage(resourceLogs)
+			resource = decodeProtoMessage(rl.bytes[1][0])
+			for _, scopeLogs := range rl.bytes[2] {
+				for _, record := range decodeProtoMessage(scopeLogs).bytes[2] {
+					records = append(records, decodeProtoMessage(record))
+				}
+			}
+		}
+	}
+	if len(records) != 2 {
+		t.Fatalf("unexpected amount of records. [%v]", len(records))
+	}
+
+	resourceAttrs := decodeProtoAttributes(resource.bytes[1])
+	if string(resourceAttrs["service.name"].bytes[1][0]) != "test-service" ||
+		string(resourceAttrs["deployment.environment"].bytes[1][0]) != "test" {
+		t.Errorf("unexpected resource attributes")
+	}
+	if _, ok := resourceAttrs["host.name"]; !ok {
+		t.Errorf("host name not found in the resource attributes")
+	}
+
+	if records[0].varints[2][0] != 9 ||
+		string(decodeProtoMessage(records[0].bytes[5][0]).bytes[1][0]) != "This is an info message sample" {
+		t.Errorf("unexpected info record")
+	}
+
+	if records[1].varints[2][0] != 17 ||
+		string(decodeProtoMessage(records[1].bytes[5][0]).bytes[1][0]) != "This is an error message sample" {
+		t.Errorf("unexpected error record")
+	}
+	attrs := decodeProtoAttributes(records[1].bytes[6])
+	if string(attrs["user"].bytes[1][0]) != "john" || attrs["count"].varints[3][0] != 3 {
+		t.Errorf("unexpected error record attributes")
+	}
+	if _, ok := attrs["level"]; ok {
+		t.Errorf("level must not be added as an attribute")
+	}
+}
+
+func decodeProtoMessage(b []byte) protoMessage {
+	msg := protoMessage{
+		varints: make(map[int][]uint64),
+		bytes:   make(map[int][][]byte),
+	}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case 0:
+			v, n2 := binary.Uvarint(b)
+			b = b[n2:]
+			msg.varints[field] = append(msg.varints[field], v)
+		case 1:
+			msg.varints[field] = append(msg.varints[field], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case 2:
+			l, n2 := binary.Uvarint(b)
+			b = b[n2:]
+			msg.bytes[field] = append(msg.bytes[field], b[:l])
+			b = b[l:]
+		case 5:
+			msg.varints[field] = append(msg.varints[field], uint64(binary.LittleEndian.Uint32(b)))
+			b = b[4:]
+		default:
+			return msg
+		}
+	}
+	return msg
+}
+
+// decodeProtoAttributes returns the AnyValue of each KeyValue.
+func decodeProtoAttributes(keyValues [][]byte) map[string]protoMessage {
+	attrs := make(map[string]protoMessage)
+	for _, b := range keyValues {
+		kv := decodeProtoMessage(b)
+		attrs[string(kv.bytes[1][0])] = decodeProtoMessage(kv.bytes[2][0])
+	}
+	return attrs
+}
@@ -0,0 +1,66 @@
+package logger_test
+
+import (
+	"testing"
+
+	"github.com/mxmauro/logger"
+	"github.com/mxmauro/logger/engines/prometheus"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+//------------------------------------------------------------------------------
+
+func TestPrometheus(t *testing.T) {
+	registry := prom.NewRegistry()
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	for i := 0; i < 2; i++ {
+		// The second engine must reuse the already registered metrics
+		err := lg.AddPrometheusEngine(prometheus.Options{
+			Namespace:        "test",
+			TrackMessageSize: true,
+			Registerer:       registry,
+		})
+		if err != nil {
+			t.Fatalf("unable to initialize. [%v]", err)
+		}
+	}
+
+	lg.Error("This is an error message sample")
+	lg.Info("This is an information message sample")
+	lg.Info("1234")
+	lg.Debug(1, "This is a debug message sample which should not be counted")
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("unable to gather metrics. [%v]", err)
+	}
+
+	counts := make(map[string]float64)
+	sizes := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			level := metric.GetLabel()[0].GetValue()
+			switch family.GetName() {
+			case "test_log_messages_total":
+				counts[level] = metric.GetCounter().GetValue()
+			case "test_log_message_size_bytes":
+				sizes[level] = metric.GetHistogram().GetSampleSum()
+			default:
+				t.Errorf("unexpected metric. [%v]", family.GetName())
+			}
+		}
+	}
+
+	// Each message is counted once per engine
+	if counts["error"] != 2 || counts["info"] != 4 || counts["debug"] != 0 || counts["warning"] != 0 {
+		t.Errorf("unexpected counters. [%v]", counts)
+	}
+	if sizes["info"] != 2*float64(len("This is an information message sample")+len("1234")) {
+		t.Errorf("unexpected message sizes. [%v]", sizes)
+	}
+}
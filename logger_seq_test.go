@@ -0,0 +1,89 @@
+package logger_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mxmauro/logger"
+	"github.com/mxmauro/logger/engines/seq"
+)
+
+//------------------------------------------------------------------------------
+
+func TestSeq(t *testing.T) {
+	mtx := sync.Mutex{}
+	events := make([]map[string]interface{}, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/events/raw" || r.URL.RawQuery != "clef" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("X-Seq-ApiKey") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			event := make(map[string]interface{})
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			mtx.Lock()
+			events = append(events, event)
+			mtx.Unlock()
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddSeqEngine(seq.Options{
+		URL:           server.URL + "/",
+		APIKey:        "secret",
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Error("This is an error message sample")
+	lg.Info(map[string]interface{}{
+		"message": "This is an information message sample",
+		"user":    "john",
+		"@id":     5,
+	})
+	lg.Flush()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if len(events) != 2 {
+		t.Fatalf("unexpected number of events. [%v]", len(events))
+	}
+	if events[0]["@l"] != "Error" || events[0]["@m"] != "This is an error message sample" {
+		t.Errorf("unexpected event. [%v]", events[0])
+	}
+	if _, err = time.Parse(time.RFC3339Nano, events[0]["@t"].(string)); err != nil {
+		t.Errorf("unexpected event timestamp. [%v]", events[0]["@t"])
+	}
+	if events[1]["@l"] != "Information" || events[1]["@m"] != "This is an information message sample" ||
+		events[1]["user"] != "john" || events[1]["@@id"] != float64(5) {
+		t.Errorf("unexpected event. [%v]", events[1])
+	}
+	if _, found := events[1]["timestamp"]; found {
+		t.Errorf("logger fields were not removed. [%v]", events[1])
+	}
+}
@@ -1,15 +1,36 @@
 package logger_test
 
 import (
+	"bufio"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"io"
+	"math/big"
 	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	gosyslog "github.com/leodido/go-syslog/v4"
+	"github.com/leodido/go-syslog/v4/octetcounting"
 	"github.com/leodido/go-syslog/v4/rfc3164"
+	"github.com/leodido/go-syslog/v4/rfc5424"
 	"github.com/mxmauro/logger"
+	"github.com/mxmauro/logger/engines/memory"
 	"github.com/mxmauro/logger/engines/syslog"
 )
 
@@ -98,6 +119,172 @@ func TestSysLogTCP(t *testing.T) {
 	}
 }
 
+func TestSysLogTCPOctetCounting(t *testing.T) {
+	var serverErr error
+	var receivedCount int
+
+	wg := sync.WaitGroup{}
+
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	readyCh := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		receivedCount, serverErr = runMockSysLogOctetCountingServer(ctx, t, readyCh)
+	}()
+	<-readyCh
+
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelDebug,
+		DebugLevel: 1,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddSysLogEngine(syslog.Options{
+		Host:       "127.0.0.1",
+		Port:       6587,
+		UseTcp:     true,
+		UseRFC5424: true,
+		Framing:    syslog.FramingOctetCounting,
+	})
+	if err != nil {
+		t.Errorf("unable to initialize. [%v]", err)
+		cancelCtx()
+		wg.Wait()
+		return
+	}
+
+	printTestMessages(lg)
+
+	// Deliver all messages and close the connection so the server can process the last frame
+	lg.Destroy()
+
+	time.Sleep(1 * time.Second) // Let's give some time to process all
+	cancelCtx()
+	wg.Wait()
+
+	if serverErr != nil {
+		t.Errorf("server error. [%v]", serverErr)
+	}
+	if receivedCount != 8 {
+		t.Errorf("unexpected number of received messages. [%v]", receivedCount)
+	}
+}
+
+func TestSysLogRFC5424Timestamp(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{
+		IP: net.IPv4(127, 0, 0, 1),
+	})
+	if err != nil {
+		t.Fatalf("unable to create mock server. [%v]", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err = lg.AddSysLogEngine(syslog.Options{
+		Host:       "127.0.0.1",
+		Port:       uint16(conn.LocalAddr().(*net.UDPAddr).Port),
+		UseRFC5424: true,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Info("This is an information message sample")
+
+	buf := make([]byte, 4096)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("unable to read datagram. [%v]", err)
+	}
+
+	// The timestamp follows the priority and version, like in <14>1 2024-05-01T10:20:30Z
+	fields := strings.SplitN(string(buf[:n]), " ", 3)
+	if len(fields) < 3 {
+		t.Fatalf("unexpected message. [%v]", string(buf[:n]))
+	}
+	ts, err := time.Parse(time.RFC3339, fields[1])
+	if err != nil {
+		t.Fatalf("unable to parse timestamp. [%v]", err)
+	}
+	if d := time.Since(ts); d < -time.Minute || d > time.Minute {
+		t.Errorf("unexpected timestamp. [%v]", fields[1])
+	}
+}
+
+func TestSysLogInvalidFraming(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddSysLogEngine(syslog.Options{
+		Host:    "syslog.invalid",
+		UseTcp:  true,
+		Framing: syslog.FramingOctetCounting + 1,
+	})
+	if err == nil {
+		t.Fatalf("invalid framing was accepted")
+	}
+}
+
+func TestSysLogCustomDialer(t *testing.T) {
+	dialedNetwork := ""
+	dialedAddr := ""
+	linesCh := make(chan string, 16)
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddSysLogEngine(syslog.Options{
+		Host:   "syslog.invalid",
+		Port:   9999,
+		UseTcp: true,
+		DialFunc: func(_ context.Context, network, addr string) (net.Conn, error) {
+			dialedNetwork = network
+			dialedAddr = addr
+
+			// Route the connection to an in-memory mock server
+			client, server := net.Pipe()
+			go func() {
+				scanner := bufio.NewScanner(server)
+				for scanner.Scan() {
+					linesCh <- scanner.Text()
+				}
+			}()
+			return client, nil
+		},
+	})
+	if err != nil {
+		t.Errorf("unable to initialize. [%v]", err)
+		return
+	}
+
+	lg.Error("This is an error message sample")
+
+	select {
+	case line := <-linesCh:
+		if !strings.HasSuffix(line, "This is an error message sample") {
+			t.Errorf("unexpected message received. [%v]", line)
+		}
+	case <-time.After(3 * time.Second):
+		t.Errorf("message not received")
+	}
+	if dialedNetwork != "tcp" || dialedAddr != "syslog.invalid:9999" {
+		t.Errorf("unexpected dial parameters. [%v/%v]", dialedNetwork, dialedAddr)
+	}
+}
+
 //------------------------------------------------------------------------------
 // Private methods
 
@@ -309,6 +496,99 @@ func runMockSysLogTcpServer(ctx context.Context, t *testing.T) error {
 	return err
 }
 
+func runMockSysLogOctetCountingServer(ctx context.Context, t *testing.T, readyCh chan struct{}) (int, error) {
+	var listener *net.TCPListener
+
+	defer func() {
+		select {
+		case <-readyCh:
+		default:
+			close(readyCh)
+		}
+	}()
+
+	// Start TCP listener
+	tcpAddr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:6587")
+	if err != nil {
+		return 0, err
+	}
+
+	listener, err = net.ListenTCP("tcp", tcpAddr)
+	if err != nil {
+		return 0, err
+	}
+	close(readyCh)
+
+	// Launch listener loop
+	wg := sync.WaitGroup{}
+	errCh := make(chan error, 1)
+	mtx := sync.Mutex{}
+	activeConns := make([]net.Conn, 0)
+	receivedCount := 0
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			conn, err2 := listener.Accept()
+			if err2 != nil {
+				return
+			}
+
+			mtx.Lock()
+			activeConns = append(activeConns, conn)
+			mtx.Unlock()
+
+			// Launch connection loop
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				p := octetcounting.NewParser(gosyslog.WithListener(func(res *gosyslog.Result) {
+					if res.Error != nil {
+						select {
+						case errCh <- res.Error:
+						default:
+						}
+						return
+					}
+
+					m := res.Message.(*rfc5424.SyslogMessage)
+					if m.Message != nil {
+						t.Logf("MockSysLogServer received message: %v", *m.Message)
+					}
+
+					mtx.Lock()
+					receivedCount += 1
+					mtx.Unlock()
+				}))
+				p.Parse(conn)
+			}()
+		}
+	}()
+
+	// Wait until shutdown if requested or some error happens
+	select {
+	case <-ctx.Done():
+		err = nil
+	case err = <-errCh:
+	}
+
+	// Shut down
+	_ = listener.Close()
+	mtx.Lock()
+	for _, conn := range activeConns {
+		_ = conn.Close()
+	}
+	mtx.Unlock()
+
+	wg.Wait()
+
+	// Done
+	return receivedCount, err
+}
+
 func processMessage(t *testing.T, msg []byte) error {
 	// Parse the syslog message
 	p := rfc3164.NewParser()
@@ -324,3 +604,1295 @@ func processMessage(t *testing.T, msg []byte) error {
 
 	return nil
 }
+
+func TestSysLogUDPChunking(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{
+		IP: net.IPv4(127, 0, 0, 1),
+	})
+	if err != nil {
+		t.Fatalf("unable to create mock server. [%v]", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelDebug,
+	})
+	defer lg.Destroy()
+
+	err = lg.AddSysLogEngine(syslog.Options{
+		Host:      "127.0.0.1",
+		Port:      uint16(conn.LocalAddr().(*net.UDPAddr).Port),
+		ChunkSize: 1200,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	largeMsg := JsonMessage{
+		Message: strings.Repeat("0123456789abcdef", 4096),
+	}
+	lg.Info(largeMsg)
+	lg.Info("This is a small message")
+
+	expected, _ := json.Marshal(largeMsg)
+
+	reassembler := syslog.NewReassembler(0)
+	buf := make([]byte, 65536)
+	chunks := 0
+	msgs := make([]string, 0)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(msgs) < 2 {
+		n, err2 := conn.Read(buf)
+		if err2 != nil {
+			t.Fatalf("unable to read datagram. [%v]", err2)
+		}
+		if n > 1200 {
+			t.Fatalf("datagram too large. [%v]", n)
+		}
+		if syslog.IsChunk(buf[:n]) {
+			chunks += 1
+		}
+
+		msg, complete, err2 := reassembler.Add(buf[:n])
+		if err2 != nil {
+			t.Fatalf("unable to reassemble message. [%v]", err2)
+		}
+		if complete {
+			msgs = append(msgs, string(msg))
+		}
+	}
+
+	if chunks < 2 {
+		t.Errorf("message was not split. [%v chunks]", chunks)
+	}
+	if !strings.HasSuffix(msgs[0], string(expected)[1:]) {
+		t.Errorf("reassembled message mismatch")
+	}
+	if !strings.HasSuffix(msgs[1], "This is a small message") {
+		t.Errorf("unexpected message. [%v]", msgs[1])
+	}
+}
+
+func TestSysLogUDPChunkingTooLarge(t *testing.T) {
+	var onErrorErr atomic.Value
+
+	msgCh := make(chan []byte, 1)
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelDebug,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddSysLogEngine(syslog.Options{
+		Host:      "syslog.invalid",
+		ChunkSize: syslog.MinChunkSize,
+		DialFunc: func(_ context.Context, _, _ string) (net.Conn, error) {
+			// Route the datagrams to an in-memory reassembler
+			client, server := net.Pipe()
+			go func() {
+				reassembler := syslog.NewReassembler(0)
+				buf := make([]byte, 65536)
+				for {
+					n, err2 := server.Read(buf)
+					if err2 != nil {
+						return
+					}
+					msg, complete, _ := reassembler.Add(buf[:n])
+					if complete {
+						msgCh <- msg
+					}
+				}
+			}()
+			return client, nil
+		},
+		OnError: func(err error) {
+			onErrorErr.Store(err)
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	// The chunk header can describe up to 65535 chunks of 49 bytes
+	lg.Info(strings.Repeat("0123456789abcdef", 65536*49/16))
+
+	select {
+	case msg := <-msgCh:
+		if len(msg) != 65535*(syslog.MinChunkSize-15) || !strings.HasSuffix(string(msg), "...") {
+			t.Errorf("message was not truncated. [%v bytes]", len(msg))
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("message not received")
+	}
+	if onErrorErr.Load() == nil {
+		t.Errorf("truncation was not reported")
+	}
+}
+
+func TestSysLogTCPIdleTimeout(t *testing.T) {
+	type receivedLine struct {
+		connIdx int
+		line    string
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to create mock server. [%v]", err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	linesCh := make(chan receivedLine, 16)
+	closedCh := make(chan int, 16)
+	go func() {
+		for connIdx := 0; ; connIdx++ {
+			conn, err2 := listener.Accept()
+			if err2 != nil {
+				return
+			}
+			go func(conn net.Conn, connIdx int) {
+				defer func() {
+					_ = conn.Close()
+				}()
+
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					linesCh <- receivedLine{
+						connIdx: connIdx,
+						line:    scanner.Text(),
+					}
+				}
+				if scanner.Err() == nil {
+					closedCh <- connIdx // Clean close from the client
+				}
+			}(conn, connIdx)
+		}
+	}()
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err = lg.AddSysLogEngine(syslog.Options{
+		Host:        "127.0.0.1",
+		Port:        uint16(listener.Addr().(*net.TCPAddr).Port),
+		UseTcp:      true,
+		IdleTimeout: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	waitLine := func(expectedConnIdx int) {
+		select {
+		case rl := <-linesCh:
+			if rl.connIdx != expectedConnIdx {
+				t.Errorf("message received on an unexpected connection. [%v]", rl.connIdx)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("message not received")
+		}
+	}
+
+	lg.Info("This is an information message sample")
+	waitLine(0)
+
+	// Idle past the timeout, the client must close the connection
+	select {
+	case connIdx := <-closedCh:
+		if connIdx != 0 {
+			t.Errorf("unexpected connection closed. [%v]", connIdx)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("idle connection was not closed")
+	}
+
+	// The next message must be sent over a new connection
+	lg.Info("This is an information message sample")
+	waitLine(1)
+}
+
+func TestSysLogTimeouts(t *testing.T) {
+	var dialCount int
+	var dialWithDeadline bool
+
+	linesCh := make(chan string, 16)
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddSysLogEngine(syslog.Options{
+		Host:         "syslog.invalid",
+		Port:         9999,
+		UseTcp:       true,
+		DialTimeout:  time.Second,
+		WriteTimeout: 200 * time.Millisecond,
+		DialFunc: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			dialCount += 1
+			_, dialWithDeadline = ctx.Deadline()
+
+			client, server := net.Pipe()
+			if dialCount > 1 {
+				go func() {
+					scanner := bufio.NewScanner(server)
+					for scanner.Scan() {
+						linesCh <- scanner.Text()
+					}
+				}()
+			}
+			// Else the first server never reads, so writes to it get stuck
+			return client, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	// The write of the first message gets stuck and must time out, so the next one is sent over a new connection
+	lg.Error("This message is lost")
+	lg.Error("This is an error message sample")
+
+	select {
+	case line := <-linesCh:
+		if !strings.HasSuffix(line, "This is an error message sample") {
+			t.Errorf("unexpected message received. [%v]", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("message not received")
+	}
+	if !dialWithDeadline {
+		t.Errorf("dial timeout was not applied")
+	}
+}
+
+func TestSysLogMaxMessageLength(t *testing.T) {
+	maxLen := uint(128)
+	hostname, _ := os.Hostname()
+
+	tests := []struct {
+		name           string
+		useRFC5424     bool
+		maxLen         *uint
+		expectedMaxLen int
+		headerPrefix   string
+	}{
+		{"RFC 3164 default", false, nil, 1024, "<11>"},
+		{"RFC 5424 default", true, nil, 2048, "<11>1 "},
+		{"custom", false, &maxLen, 128, "<11>"},
+	}
+	for _, test := range tests {
+		linesCh := make(chan string, 16)
+
+		lg := logger.Create(logger.Options{
+			Level: logger.LogLevelInfo,
+		})
+
+		err := lg.AddSysLogEngine(syslog.Options{
+			AppName:          "test",
+			Host:             "syslog.invalid",
+			UseTcp:           true,
+			UseRFC5424:       test.useRFC5424,
+			MaxMessageLength: test.maxLen,
+			DialFunc: func(_ context.Context, _, _ string) (net.Conn, error) {
+				client, server := net.Pipe()
+				go func() {
+					scanner := bufio.NewScanner(server)
+					scanner.Buffer(make([]byte, 65536), 65536)
+					for scanner.Scan() {
+						linesCh <- scanner.Text()
+					}
+				}()
+				return client, nil
+			},
+		})
+		if err != nil {
+			lg.Destroy()
+			t.Fatalf("unable to initialize. [%v]", err)
+		}
+
+		lg.Error(strings.Repeat("x", 4096))
+
+		select {
+		case line := <-linesCh:
+			if len(line) != test.expectedMaxLen {
+				t.Errorf("unexpected message length for %v. [%v]", test.name, len(line))
+			}
+			if !strings.HasPrefix(line, test.headerPrefix) || !strings.Contains(line, " "+hostname+" ") {
+				t.Errorf("header was not preserved for %v. [%v]", test.name, line)
+			}
+			if !strings.HasSuffix(line, "x...") {
+				t.Errorf("truncation marker not found for %v. [%v]", test.name, line)
+			}
+		case <-time.After(3 * time.Second):
+			t.Errorf("message not received for %v", test.name)
+		}
+
+		lg.Destroy()
+	}
+}
+
+func TestSysLogSpool(t *testing.T) {
+	var up atomic.Bool
+
+	spoolDir := t.TempDir()
+	linesCh := make(chan string, 16)
+
+	opts := syslog.Options{
+		Host:     "syslog.invalid",
+		UseTcp:   true,
+		SpoolDir: spoolDir,
+		DialFunc: func(_ context.Context, _, _ string) (net.Conn, error) {
+			if !up.Load() {
+				return nil, errors.New("server down")
+			}
+
+			client, server := net.Pipe()
+			go func() {
+				scanner := bufio.NewScanner(server)
+				for scanner.Scan() {
+					linesCh <- scanner.Text()
+				}
+			}()
+			return client, nil
+		},
+	}
+
+	expectMessages := func(messages ...string) {
+		for _, msg := range messages {
+			select {
+			case line := <-linesCh:
+				if !strings.HasSuffix(line, msg) {
+					t.Fatalf("unexpected message received. [%v]", line)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("message not received. [%v]", msg)
+			}
+		}
+	}
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	err := lg.AddSysLogEngine(opts)
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	// While the server is down, messages are spooled and delivered in order once it is back
+	lg.Error("Message #1")
+	lg.Error("Message #2")
+	lg.Error("Message #3")
+	time.Sleep(200 * time.Millisecond)
+
+	files, _ := os.ReadDir(spoolDir)
+	if len(files) == 0 {
+		t.Fatalf("messages were not spooled")
+	}
+
+	up.Store(true)
+	expectMessages("Message #1", "Message #2", "Message #3")
+
+	// Messages spooled when the engine is destroyed are delivered by the next instance
+	up.Store(false)
+	lg.Error("Message #4")
+	lg.Destroy()
+
+	up.Store(true)
+	lg = logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err = lg.AddSysLogEngine(opts)
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+	lg.Error("Message #5")
+	expectMessages("Message #4", "Message #5")
+}
+
+func TestSysLogTLSClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	// Create a CA and the server and client certificates signed by it
+	caCert, caKey := createTestCertificate(t, "Test CA", nil, nil, nil)
+	serverCert, serverKey := createTestCertificate(t, "syslog.test", []string{"syslog.test"}, caCert, caKey)
+	clientCert, clientKey := createTestCertificate(t, "client", nil, caCert, caKey)
+
+	caFile := writeTestPEM(t, dir, "ca.pem", "CERTIFICATE", caCert.Raw)
+	clientCertFile := writeTestPEM(t, dir, "client.pem", "CERTIFICATE", clientCert.Raw)
+	clientKeyFile := writeTestPEM(t, dir, "client.key", "PRIVATE KEY", clientKey)
+
+	caPool := x509.NewCertPool()
+	caPool.AddCert(caCert)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{
+			{
+				Certificate: [][]byte{serverCert.Raw},
+				PrivateKey:  serverKey,
+			},
+		},
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  caPool,
+	})
+	if err != nil {
+		t.Fatalf("unable to listen. [%v]", err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	linesCh := make(chan string, 16)
+	peerCh := make(chan string, 1)
+	go func() {
+		conn, err2 := listener.Accept()
+		if err2 != nil {
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		tlsConn := conn.(*tls.Conn)
+		if tlsConn.Handshake() != nil {
+			return
+		}
+		peerCh <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			linesCh <- scanner.Text()
+		}
+	}()
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+
+	// Missing files must be reported
+	err = lg.AddSysLogEngine(syslog.Options{
+		Host:           "127.0.0.1",
+		Port:           uint16(portNum),
+		UseTls:         true,
+		ClientCertFile: filepath.Join(dir, "missing.pem"),
+		ClientKeyFile:  clientKeyFile,
+	})
+	if err == nil {
+		t.Fatalf("missing client certificate was accepted")
+	}
+
+	err = lg.AddSysLogEngine(syslog.Options{
+		Host:           "127.0.0.1",
+		Port:           uint16(portNum),
+		UseTls:         true,
+		ClientCertFile: clientCertFile,
+		ClientKeyFile:  clientKeyFile,
+		CAFile:         caFile,
+		ServerName:     "syslog.test",
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Error("This is an error message sample")
+
+	select {
+	case cn := <-peerCh:
+		if cn != "client" {
+			t.Errorf("unexpected client certificate. [%v]", cn)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("connection not established")
+	}
+	select {
+	case line := <-linesCh:
+		if !strings.HasSuffix(line, "This is an error message sample") {
+			t.Errorf("unexpected message received. [%v]", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("message not received")
+	}
+}
+
+func createTestCertificate(
+	t *testing.T, cn string, dnsNames []string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey,
+) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key. [%v]", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject: pkix.Name{
+			CommonName: cn,
+		},
+		DNSNames:    dnsNames,
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent = template
+		parentKey = key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("unable to create certificate. [%v]", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("unable to parse certificate. [%v]", err)
+	}
+	return cert, key
+}
+
+func writeTestPEM(t *testing.T, dir string, name string, blockType string, content any) string {
+	b, ok := content.([]byte)
+	if !ok {
+		var err error
+
+		b, err = x509.MarshalPKCS8PrivateKey(content)
+		if err != nil {
+			t.Fatalf("unable to marshal key. [%v]", err)
+		}
+	}
+
+	filename := filepath.Join(dir, name)
+	err := os.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: b}), 0600)
+	if err != nil {
+		t.Fatalf("unable to write file. [%v]", err)
+	}
+	return filename
+}
+
+func TestSysLogHealth(t *testing.T) {
+	var up atomic.Bool
+	var servers []net.Conn
+	var serversMtx sync.Mutex
+
+	up.Store(true)
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	for i := 0; i < 2; i++ {
+		err := lg.AddSysLogEngine(syslog.Options{
+			Host:   "syslog.invalid",
+			UseTcp: true,
+			DialFunc: func(_ context.Context, _, _ string) (net.Conn, error) {
+				if !up.Load() {
+					return nil, errors.New("server down")
+				}
+
+				client, server := net.Pipe()
+				go func() {
+					_, _ = io.Copy(io.Discard, server)
+				}()
+				serversMtx.Lock()
+				servers = append(servers, server)
+				serversMtx.Unlock()
+				return client, nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("unable to initialize. [%v]", err)
+		}
+	}
+
+	lg.Error("This is an error message sample")
+	lg.Flush()
+
+	health := lg.Health()
+	if len(health) != 2 || !health["syslog"].Healthy || !health["syslog#2"].Healthy {
+		t.Fatalf("unexpected health status. [%v]", health)
+	}
+
+	// Messages cannot be delivered while the server is down
+	up.Store(false)
+	serversMtx.Lock()
+	for _, server := range servers {
+		_ = server.Close()
+	}
+	serversMtx.Unlock()
+	lg.Error("This is an error message sample")
+	lg.Flush()
+
+	health = lg.Health()
+	if health["syslog"].Healthy || health["syslog"].QueueDepth != 0 {
+		t.Errorf("unexpected health status. [%v]", health)
+	}
+}
+
+func TestSysLogFacility(t *testing.T) {
+	tests := []struct {
+		name           string
+		facility       syslog.Facility
+		expectedPrefix string
+	}{
+		{"default", 0, "<11>"},
+		{"local0", syslog.FacilityLocal0, "<131>"},
+		{"daemon", syslog.FacilityDaemon, "<27>"},
+	}
+	for _, test := range tests {
+		linesCh := make(chan string, 16)
+
+		lg := logger.Create(logger.Options{
+			Level: logger.LogLevelInfo,
+		})
+
+		err := lg.AddSysLogEngine(syslog.Options{
+			AppName:  "test",
+			Host:     "syslog.invalid",
+			UseTcp:   true,
+			Facility: test.facility,
+			DialFunc: func(_ context.Context, _, _ string) (net.Conn, error) {
+				client, server := net.Pipe()
+				go func() {
+					scanner := bufio.NewScanner(server)
+					for scanner.Scan() {
+						linesCh <- scanner.Text()
+					}
+				}()
+				return client, nil
+			},
+		})
+		if err != nil {
+			lg.Destroy()
+			t.Fatalf("unable to initialize. [%v]", err)
+		}
+
+		lg.Error("This is an error message sample")
+
+		select {
+		case line := <-linesCh:
+			if !strings.HasPrefix(line, test.expectedPrefix) {
+				t.Errorf("unexpected priority for %v. [%v]", test.name, line)
+			}
+		case <-time.After(3 * time.Second):
+			t.Errorf("message not received for %v", test.name)
+		}
+
+		lg.Destroy()
+	}
+
+	// Invalid facilities must be rejected
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddSysLogEngine(syslog.Options{
+		Host:     "syslog.invalid",
+		UseTcp:   true,
+		Facility: 24,
+	})
+	if err == nil {
+		t.Fatalf("invalid facility was accepted")
+	}
+}
+
+func TestSysLogOverflowPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   syslog.OverflowPolicy
+		expected []string
+	}{
+		{"drop oldest", syslog.OverflowDropOldest, []string{"Message #1", "Message #4", "Message #5"}},
+		{"drop newest", syslog.OverflowDropNewest, []string{"Message #1", "Message #2", "Message #3"}},
+		{"block", syslog.OverflowBlockWithTimeout, []string{"Message #1", "Message #2", "Message #3"}},
+	}
+	for _, test := range tests {
+		dialingCh := make(chan struct{}, 1)
+		releaseCh := make(chan struct{})
+		linesCh := make(chan string, 16)
+
+		lg := logger.Create(logger.Options{
+			Level: logger.LogLevelInfo,
+		})
+
+		err := lg.AddSysLogEngine(syslog.Options{
+			Host:                "syslog.invalid",
+			UseTcp:              true,
+			MaxMessageQueueSize: 2,
+			OverflowPolicy:      test.policy,
+			OverflowTimeout:     200 * time.Millisecond,
+			DialFunc: func(_ context.Context, _, _ string) (net.Conn, error) {
+				// Keep the worker busy until the queue is filled
+				dialingCh <- struct{}{}
+				<-releaseCh
+
+				client, server := net.Pipe()
+				go func() {
+					scanner := bufio.NewScanner(server)
+					for scanner.Scan() {
+						linesCh <- scanner.Text()
+					}
+				}()
+				return client, nil
+			},
+		})
+		if err != nil {
+			lg.Destroy()
+			t.Fatalf("unable to initialize. [%v]", err)
+		}
+
+		lg.Error("Message #1")
+		<-dialingCh
+
+		startTime := time.Now()
+		for i := 2; i <= 5; i++ {
+			lg.Error("Message #" + strconv.Itoa(i))
+		}
+		elapsed := time.Since(startTime)
+		if test.policy == syslog.OverflowBlockWithTimeout && elapsed < 400*time.Millisecond {
+			t.Errorf("callers were not blocked for %v. [%v]", test.name, elapsed)
+		} else if test.policy != syslog.OverflowBlockWithTimeout && elapsed > 100*time.Millisecond {
+			t.Errorf("callers were blocked for %v. [%v]", test.name, elapsed)
+		}
+
+		if dropped := lg.Health()["syslog"].Dropped; dropped != 2 {
+			t.Errorf("unexpected amount of dropped messages for %v. [%v]", test.name, dropped)
+		}
+
+		close(releaseCh)
+		for _, msg := range test.expected {
+			select {
+			case line := <-linesCh:
+				if !strings.HasSuffix(line, msg) {
+					t.Errorf("unexpected message received for %v. [%v]", test.name, line)
+				}
+			case <-time.After(3 * time.Second):
+				t.Errorf("message not received for %v. [%v]", test.name, msg)
+			}
+		}
+
+		lg.Destroy()
+	}
+}
+
+func TestSysLogOverflowBlockUntilRoom(t *testing.T) {
+	dialingCh := make(chan struct{}, 1)
+	releaseCh := make(chan struct{})
+	linesCh := make(chan string, 16)
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddSysLogEngine(syslog.Options{
+		Host:                "syslog.invalid",
+		UseTcp:              true,
+		MaxMessageQueueSize: 1,
+		OverflowPolicy:      syslog.OverflowBlockWithTimeout,
+		OverflowTimeout:     5 * time.Second,
+		DialFunc: func(_ context.Context, _, _ string) (net.Conn, error) {
+			dialingCh <- struct{}{}
+			<-releaseCh
+
+			client, server := net.Pipe()
+			go func() {
+				scanner := bufio.NewScanner(server)
+				for scanner.Scan() {
+					linesCh <- scanner.Text()
+				}
+			}()
+			return client, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Error("Message #1")
+	<-dialingCh
+	lg.Error("Message #2")
+
+	// The caller waits until the worker makes room for the message
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(releaseCh)
+	}()
+	lg.Error("Message #3")
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case line := <-linesCh:
+			if !strings.HasSuffix(line, "Message #"+strconv.Itoa(i)) {
+				t.Errorf("unexpected message received. [%v]", line)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("message not received. [%v]", i)
+		}
+	}
+	if dropped := lg.Health()["syslog"].Dropped; dropped != 0 {
+		t.Errorf("unexpected amount of dropped messages. [%v]", dropped)
+	}
+}
+
+func TestSysLogEscapeNewlines(t *testing.T) {
+	linesCh := make(chan string, 16)
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddSysLogEngine(syslog.Options{
+		Host:           "syslog.invalid",
+		UseTcp:         true,
+		EscapeNewlines: true,
+		DialFunc: func(_ context.Context, _, _ string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				scanner := bufio.NewScanner(server)
+				for scanner.Scan() {
+					linesCh <- scanner.Text()
+				}
+			}()
+			return client, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Error("panic: runtime error\ngoroutine 1 [running]:\r\nmain.main()\n")
+	lg.Error("This is an error message sample")
+
+	expected := []string{
+		`panic: runtime error\ngoroutine 1 [running]:\nmain.main()`,
+		"This is an error message sample",
+	}
+	for _, msg := range expected {
+		select {
+		case line := <-linesCh:
+			if !strings.HasSuffix(line, msg) {
+				t.Errorf("unexpected message received. [%v]", line)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("message not received. [%v]", msg)
+		}
+	}
+}
+
+func TestSysLogTimePrecision(t *testing.T) {
+	linesCh := make(chan string, 16)
+
+	lg := logger.Create(logger.Options{
+		Level:         logger.LogLevelInfo,
+		TimePrecision: logger.TimePrecisionNanos,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddSysLogEngine(syslog.Options{
+		Host:       "syslog.invalid",
+		UseTcp:     true,
+		UseRFC5424: true,
+		DialFunc: func(_ context.Context, _, _ string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				scanner := bufio.NewScanner(server)
+				for scanner.Scan() {
+					linesCh <- scanner.Text()
+				}
+			}()
+			return client, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Error("This is an error message sample")
+
+	// RFC 5424 limits the fractional seconds to microseconds
+	select {
+	case line := <-linesCh:
+		if !regexp.MustCompile(`^<11>1 [^ ]+T\d\d:\d\d:\d\d\.\d{6}(Z|[+-]\d\d:\d\d) `).MatchString(line) {
+			t.Errorf("unexpected timestamp. [%v]", line)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("message not received")
+	}
+}
+
+func TestSysLogFlushTimeout(t *testing.T) {
+	releaseCh := make(chan struct{})
+	defer close(releaseCh)
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+
+	err := lg.AddSysLogEngine(syslog.Options{
+		Host:         "syslog.invalid",
+		UseTcp:       true,
+		FlushTimeout: 200 * time.Millisecond,
+		DialFunc: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			// Simulate an unresponsive server
+			select {
+			case <-releaseCh:
+			case <-ctx.Done():
+			}
+			return nil, errors.New("server down")
+		},
+	})
+	if err != nil {
+		lg.Destroy()
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Error("This is an error message sample")
+	lg.Error("This is an error message sample")
+
+	startTime := time.Now()
+	lg.Flush()
+	if elapsed := time.Since(startTime); elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("unexpected flush time. [%v]", elapsed)
+	}
+
+	startTime = time.Now()
+	lg.Destroy()
+	if elapsed := time.Since(startTime); elapsed > 2*time.Second {
+		t.Errorf("unexpected shutdown time. [%v]", elapsed)
+	}
+}
+
+func TestSysLogTimeZone(t *testing.T) {
+	linesCh := make(chan string, 16)
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddSysLogEngine(syslog.Options{
+		Host:       "syslog.invalid",
+		UseTcp:     true,
+		UseRFC5424: true,
+		TimeZone:   time.FixedZone("UTC-3", -3*3600),
+		DialFunc: func(_ context.Context, _, _ string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				scanner := bufio.NewScanner(server)
+				for scanner.Scan() {
+					linesCh <- scanner.Text()
+				}
+			}()
+			return client, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Error("This is an error message sample")
+
+	select {
+	case line := <-linesCh:
+		if !regexp.MustCompile(`^<11>1 [^ ]+-03:00 `).MatchString(line) {
+			t.Errorf("timestamp not in the engine time zone. [%v]", line)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("message not received")
+	}
+}
+
+func TestSysLogFallbackEngine(t *testing.T) {
+	var serverDown atomic.Bool
+
+	linesCh := make(chan string, 16)
+	fallback := memory.NewEngine(memory.Options{})
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	serverDown.Store(true)
+	err := lg.AddSysLogEngine(syslog.Options{
+		Host:                  "syslog.invalid",
+		UseTcp:                true,
+		FallbackEngine:        fallback,
+		FallbackThreshold:     2,
+		FallbackRetryInterval: 50 * time.Millisecond,
+		DialFunc: func(_ context.Context, _, _ string) (net.Conn, error) {
+			if serverDown.Load() {
+				return nil, errors.New("server down")
+			}
+			client, server := net.Pipe()
+			go func() {
+				scanner := bufio.NewScanner(server)
+				for scanner.Scan() {
+					linesCh <- scanner.Text()
+				}
+			}()
+			return client, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	// Two failed deliveries make the engine switch to the fallback
+	lg.Error("This is an error message sample")
+	lg.Flush()
+	lg.Error("This is another error message sample")
+	lg.Flush()
+
+	lg.Warning("This is a warning message sample")
+	entries := fallback.Snapshot()
+	if len(entries) != 1 || entries[0].Level != "warning" || entries[0].Message != "This is a warning message sample" {
+		t.Fatalf("message not sent to the fallback engine. [%+v]", entries)
+	}
+
+	// Once the server is reachable again, messages are sent to it
+	serverDown.Store(false)
+	time.Sleep(200 * time.Millisecond)
+
+	lg.Info("This is an information message sample")
+	select {
+	case line := <-linesCh:
+		if !strings.HasSuffix(line, "This is an information message sample") {
+			t.Errorf("unexpected message. [%v]", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("message not sent to the server")
+	}
+	if n := len(fallback.Snapshot()); n != 1 {
+		t.Errorf("unexpected messages in the fallback engine. [%v]", n)
+	}
+}
+
+func TestSysLogHeaderFields(t *testing.T) {
+	linesCh := make(chan string, 16)
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddSysLogEngine(syslog.Options{
+		AppName:    "billing",
+		ProcID:     "worker-7",
+		MsgID:      "AUDIT",
+		Host:       "syslog.invalid",
+		UseTcp:     true,
+		UseRFC5424: true,
+		DialFunc: func(_ context.Context, _, _ string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				scanner := bufio.NewScanner(server)
+				for scanner.Scan() {
+					linesCh <- scanner.Text()
+				}
+			}()
+			return client, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Info("This is an information message sample")
+
+	select {
+	case line := <-linesCh:
+		_m, err2 := rfc5424.NewParser().Parse([]byte(line))
+		if err2 != nil {
+			t.Fatalf("unable to parse message. [%v / %v]", err2, line)
+		}
+		m := _m.(*rfc5424.SyslogMessage)
+		if m.Appname == nil || *m.Appname != "billing" || m.ProcID == nil || *m.ProcID != "worker-7" ||
+			m.MsgID == nil || *m.MsgID != "AUDIT" {
+			t.Errorf("unexpected header fields. [%v]", line)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("message not received")
+	}
+
+	// Values with spaces, non-ASCII characters or too long must be rejected
+	for _, opts := range []syslog.Options{
+		{AppName: "my app"},
+		{ProcID: "12\t34"},
+		{MsgID: "ÉVÉNEMENT"},
+		{MsgID: strings.Repeat("X", 33)},
+	} {
+		opts.Host = "syslog.invalid"
+		if err = lg.AddSysLogEngine(opts); err == nil {
+			t.Errorf("invalid header field accepted. [%+v]", opts)
+		}
+	}
+}
+
+func TestSysLogDrain(t *testing.T) {
+	releaseCh := make(chan struct{})
+	linesCh := make(chan string, 16)
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	err := lg.AddSysLogEngine(syslog.Options{
+		Host:   "syslog.invalid",
+		UseTcp: true,
+		DialFunc: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			// Simulate a slow server
+			select {
+			case <-releaseCh:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			client, server := net.Pipe()
+			go func() {
+				scanner := bufio.NewScanner(server)
+				for scanner.Scan() {
+					linesCh <- scanner.Text()
+				}
+			}()
+			return client, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		lg.Info("This is information message sample #" + strconv.Itoa(i))
+	}
+
+	// Messages sent while draining are discarded, and the logger is not locked meanwhile
+	lockedCh := make(chan struct{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		lg.Info("This is a message sample sent while draining")
+		lg.SetLogLevel(logger.LogLevelInfo, 0)
+		close(lockedCh)
+	}()
+
+	ctx, cancelCtx := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	err = lg.Drain(ctx)
+	cancelCtx()
+	if err == nil || !strings.Contains(err.Error(), "messages not delivered") {
+		t.Fatalf("unexpected drain result. [%v]", err)
+	}
+	select {
+	case <-lockedCh:
+	default:
+		t.Errorf("logger locked while draining")
+	}
+
+	// Messages are accepted again once it returns
+	lg.Info("This is information message sample #4")
+
+	close(releaseCh)
+	err = lg.Drain(context.Background())
+	if err != nil {
+		t.Fatalf("unable to drain. [%v]", err)
+	}
+
+	for i := 1; i <= 4; i++ {
+		select {
+		case line := <-linesCh:
+			if !strings.HasSuffix(line, "#"+strconv.Itoa(i)) {
+				t.Errorf("unexpected message. [%v]", line)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("message not received")
+		}
+	}
+	if health := lg.Health()["syslog"]; health.Dropped != 1 {
+		t.Errorf("unexpected dropped messages. [%+v]", health)
+	}
+}
+
+func TestSysLogConnectionCallbacks(t *testing.T) {
+	var serverDown atomic.Bool
+
+	linesCh := make(chan string, 16)
+	connectCh := make(chan net.Addr, 16)
+	errorCh := make(chan error, 16)
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	serverDown.Store(true)
+	err := lg.AddSysLogEngine(syslog.Options{
+		Host:   "syslog.invalid",
+		UseTcp: true,
+		DialFunc: func(_ context.Context, _, _ string) (net.Conn, error) {
+			if serverDown.Load() {
+				return nil, errors.New("server down")
+			}
+			client, server := net.Pipe()
+			go func() {
+				scanner := bufio.NewScanner(server)
+				for scanner.Scan() {
+					linesCh <- scanner.Text()
+				}
+			}()
+			return client, nil
+		},
+		OnConnect: func(remote net.Addr) {
+			connectCh <- remote
+		},
+		OnError: func(err error) {
+			errorCh <- err
+			panic("callback panics must not stop the delivery")
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	lg.Error("This is an error message sample")
+	select {
+	case err = <-errorCh:
+		if err.Error() != "server down" {
+			t.Errorf("unexpected error. [%v]", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("error callback not invoked")
+	}
+
+	// Once reachable, the new connection is reported
+	serverDown.Store(false)
+	lg.Info("This is an information message sample")
+	select {
+	case remote := <-connectCh:
+		if remote == nil || remote.String() != "pipe" {
+			t.Errorf("unexpected remote address. [%v]", remote)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("connect callback not invoked")
+	}
+	select {
+	case line := <-linesCh:
+		if !strings.HasSuffix(line, "This is an information message sample") {
+			t.Errorf("unexpected message. [%v]", line)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("message not sent to the server")
+	}
+}
@@ -1,10 +1,29 @@
 package logger_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mxmauro/logger"
+	"github.com/mxmauro/logger/engines"
 	"github.com/mxmauro/logger/engines/console"
+	"github.com/mxmauro/logger/engines/file"
+	"github.com/mxmauro/logger/engines/syslog"
 )
 
 //------------------------------------------------------------------------------
@@ -13,6 +32,40 @@ func TestDefault(t *testing.T) {
 	printTestMessages(logger.Default())
 }
 
+func TestSetDefault(t *testing.T) {
+	original := logger.Default()
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	logger.SetDefault(lg)
+	defer logger.SetDefault(original)
+
+	if logger.Default() != lg {
+		t.Fatalf("default logger was not replaced")
+	}
+	logger.Default().Info("This is an information message sample")
+	if len(rec.entries) != 1 {
+		t.Errorf("message was not sent to the new default logger")
+	}
+
+	// The active default logger cannot be destroyed
+	lg.Destroy()
+	if rec.destroyCount != 0 {
+		t.Errorf("active default logger was destroyed")
+	}
+
+	// Once replaced, it can
+	logger.SetDefault(original)
+	lg.Destroy()
+	if rec.destroyCount != 1 {
+		t.Errorf("previous default logger was not destroyed")
+	}
+}
+
 func TestLevelOverride(t *testing.T) {
 	lg := logger.Create(logger.Options{
 		Level: logger.LogLevelDebug,
@@ -25,9 +78,1437 @@ func TestLevelOverride(t *testing.T) {
 	printTestMessages(lg)
 }
 
+func TestFatal(t *testing.T) {
+	exitCode := -1
+	oldExitFunc := logger.ExitFunc
+	logger.ExitFunc = func(code int) {
+		exitCode = code
+	}
+	defer func() {
+		logger.ExitFunc = oldExitFunc
+	}()
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelError,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	lg.Fatal("This is a fatal message sample")
+
+	if exitCode != 1 {
+		t.Errorf("unexpected exit code. [%v]", exitCode)
+	}
+	if len(rec.entries) != 1 || rec.entries[0].level != "error" {
+		t.Errorf("fatal message was not sent as error")
+	}
+	if rec.flushCount != 1 {
+		t.Errorf("engines were not flushed")
+	}
+}
+
+func TestPanic(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelError,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Errorf("panic was not raised")
+		} else if s, ok := r.(string); !ok || s != "This is a panic message sample" {
+			t.Errorf("unexpected panic value. [%v]", r)
+		}
+		if len(rec.entries) != 1 || rec.entries[0].level != "error" {
+			t.Errorf("panic message was not sent as error")
+		}
+	}()
+
+	lg.Panic("This is a panic message sample")
+}
+
+func TestDebugSampleRate(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:           logger.LogLevelDebug,
+		DebugLevel:      1,
+		DebugSampleRate: 0.1,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	for i := 0; i < 10000; i++ {
+		lg.Debug(1, "This is a sampled debug message sample")
+		lg.Info("This is an information message sample")
+	}
+
+	debugCount := 0
+	infoCount := 0
+	for _, entry := range rec.entries {
+		switch entry.level {
+		case "debug":
+			debugCount += 1
+		case "info":
+			infoCount += 1
+		}
+	}
+	if debugCount < 700 || debugCount > 1300 {
+		t.Errorf("unexpected number of sampled debug messages. [%v]", debugCount)
+	}
+	if infoCount != 10000 {
+		t.Errorf("information messages must not be sampled. [%v]", infoCount)
+	}
+}
+
+func TestIncludeCaller(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:         logger.LogLevelDebug,
+		DebugLevel:    1,
+		IncludeCaller: true,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	_, _, line, _ := runtime.Caller(0)
+	lg.Error("This is an error message sample")
+	lg.Warning("This is a warning message sample")
+	lg.Info("This is an information message sample")
+	lg.Debug(1, "This is a debug message sample at level 1 which should be printed")
+	lg.Success("This is a success message sample")
+	lg.Error(JsonMessage{
+		Message: "This is an error message sample",
+	})
+
+	if len(rec.entries) != 6 {
+		t.Errorf("unexpected number of messages. [%v]", len(rec.entries))
+		return
+	}
+	for idx, entry := range rec.entries[:5] {
+		suffix := " (logger_test.go:" + strconv.Itoa(line+idx+1) + ")"
+		if !strings.HasSuffix(entry.msg, suffix) {
+			t.Errorf("caller not found in message. [%v]", entry.msg)
+		}
+	}
+	if !strings.Contains(rec.entries[5].msg, `"caller":"logger_test.go:`+strconv.Itoa(line+6)+`"`) {
+		t.Errorf("caller not found in message. [%v]", rec.entries[5].msg)
+	}
+}
+
+func TestMapDeterministicOrder(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	fields := map[string]interface{}{
+		"zulu":    1,
+		"alpha":   "a",
+		"mike":    true,
+		"charlie": map[string]interface{}{"y": 2, "x": 1},
+		"bravo":   nil,
+	}
+	lg.Info(fields)
+	lg.Info(&fields)
+
+	if len(rec.entries) != 2 {
+		t.Errorf("unexpected number of messages. [%v]", len(rec.entries))
+		return
+	}
+	const expected = `"level":"info","alpha":"a","bravo":null,"charlie":{"x":1,"y":2},"mike":true,"zulu":1}`
+	for _, entry := range rec.entries {
+		idx := strings.Index(entry.msg, `"level"`)
+		if !entry.raw || idx < 0 || entry.msg[idx:] != expected {
+			t.Errorf("unexpected map output. [%v]", entry.msg)
+		}
+	}
+	if rec.entries[0].msg[strings.Index(rec.entries[0].msg, `"level"`):] !=
+		rec.entries[1].msg[strings.Index(rec.entries[1].msg, `"level"`):] {
+		t.Errorf("map output is not deterministic")
+	}
+}
+
+func TestTimeLayout(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelInfo,
+		TimeLayout: logger.TimeLayoutEpochMillis,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	lg.Info(JsonMessage{
+		Message: "This is an information message sample",
+	})
+	lg.SetTimeLayout(logger.TimeLayoutRFC3339)
+	lg.Info(JsonMessage{
+		Message: "This is an information message sample",
+	})
+
+	if len(rec.entries) != 2 {
+		t.Errorf("unexpected number of messages. [%v]", len(rec.entries))
+		return
+	}
+	expected := `{"timestamp":` + strconv.FormatInt(rec.entries[0].now.UnixMilli(), 10) + `,`
+	if !strings.HasPrefix(rec.entries[0].msg, expected) {
+		t.Errorf("unexpected epoch timestamp. [%v]", rec.entries[0].msg)
+	}
+	expected = `{"timestamp":"` + rec.entries[1].now.Format(logger.TimeLayoutRFC3339) + `",`
+	if !strings.HasPrefix(rec.entries[1].msg, expected) {
+		t.Errorf("unexpected RFC 3339 timestamp. [%v]", rec.entries[1].msg)
+	}
+}
+
+func TestTimePrecision(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	forceColor := false
+
+	lg := logger.Create(logger.Options{
+		Level:         logger.LogLevelInfo,
+		TimePrecision: logger.TimePrecisionMicros,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+	lg.AddConsoleEngine(console.Options{
+		ForceColor: &forceColor,
+		Stdout:     stdout,
+	})
+
+	lg.Info(JsonMessage{
+		Message: "This is an information message sample",
+	})
+	lg.Info("This is an information message sample")
+	lg.SetTimeLayout(logger.TimeLayoutRFC3339)
+	lg.Info(JsonMessage{
+		Message: "This is an information message sample",
+	})
+
+	if len(rec.entries) != 3 {
+		t.Fatalf("unexpected number of messages. [%v]", len(rec.entries))
+	}
+	if !regexp.MustCompile(`^{"timestamp":"\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\.\d{6}",`).MatchString(rec.entries[0].msg) {
+		t.Errorf("unexpected default layout timestamp. [%v]", rec.entries[0].msg)
+	}
+	if !regexp.MustCompile(`(?m)^\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\.\d{6} \[INFO] `).MatchString(stdout.String()) {
+		t.Errorf("unexpected console timestamp. [%v]", stdout.String())
+	}
+	if !regexp.MustCompile(`^{"timestamp":"[^"]+T\d\d:\d\d:\d\d\.\d{6}(Z|[+-]\d\d:\d\d)",`).MatchString(rec.entries[2].msg) {
+		t.Errorf("unexpected RFC 3339 timestamp. [%v]", rec.entries[2].msg)
+	}
+
+	// Seconds precision removes the fractional seconds
+	lg2 := logger.Create(logger.Options{
+		Level:         logger.LogLevelInfo,
+		TimePrecision: logger.TimePrecisionSeconds,
+	})
+	defer lg2.Destroy()
+
+	rec2 := &recorderEngine{}
+	_ = lg2.AddEngine(rec2)
+	lg2.Info(JsonMessage{
+		Message: "This is an information message sample",
+	})
+	if len(rec2.entries) != 1 ||
+		!regexp.MustCompile(`^{"timestamp":"\d{4}-\d\d-\d\d \d\d:\d\d:\d\d",`).MatchString(rec2.entries[0].msg) {
+		t.Errorf("unexpected timestamp. [%v]", rec2.entries)
+	}
+}
+
+func TestTrimTrailingZeros(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:             logger.LogLevelInfo,
+		TimePrecision:     logger.TimePrecisionMicros,
+		TrimTrailingZeros: true,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	lg.Info(JsonMessage{
+		Message: "This is an information message sample",
+	})
+
+	if len(rec.entries) != 1 {
+		t.Fatalf("unexpected number of messages. [%v]", len(rec.entries))
+	}
+	expected := `{"timestamp":"` + rec.entries[0].now.Format("2006-01-02 15:04:05.999999") + `",`
+	if !strings.HasPrefix(rec.entries[0].msg, expected) {
+		t.Errorf("unexpected timestamp. [%v]", rec.entries[0].msg)
+	}
+
+	// The separator is also removed if there are no fractional seconds
+	layout := engines.LayoutWithTrimmedZeros(logger.TimeLayoutRFC3339)
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	if s := engines.FormatTimestamp(now, layout); s != "2024-05-06T07:08:09Z" {
+		t.Errorf("unexpected timestamp. [%v]", s)
+	}
+	now = now.Add(120 * time.Millisecond)
+	if s := engines.FormatTimestamp(now, layout); s != "2024-05-06T07:08:09.12Z" {
+		t.Errorf("unexpected timestamp. [%v]", s)
+	}
+}
+
+func TestAttachStackTrace(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:               logger.LogLevelInfo,
+		AttachStackTrace:    true,
+		StackTraceMaxFrames: 2,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	lg.Error("This is an error message sample")
+	lg.Error(JsonMessage{
+		Message: "This is an error message sample",
+	})
+	lg.Warning("This is a warning message sample")
+
+	if len(rec.entries) != 3 {
+		t.Fatalf("unexpected number of messages. [%v]", len(rec.entries))
+	}
+
+	lines := strings.Split(rec.entries[0].msg, "\n\t")
+	if len(lines) != 3 || lines[0] != "This is an error message sample" ||
+		!strings.HasPrefix(lines[1], "github.com/mxmauro/logger_test.TestAttachStackTrace (") {
+		t.Errorf("unexpected stack trace in text message. [%v]", rec.entries[0].msg)
+	}
+
+	var obj struct {
+		Stack []string `json:"stack"`
+	}
+	if err := json.Unmarshal([]byte(rec.entries[1].msg), &obj); err != nil {
+		t.Fatalf("unable to parse message. [%v]", err)
+	}
+	if len(obj.Stack) != 2 || !strings.HasPrefix(obj.Stack[0], "github.com/mxmauro/logger_test.TestAttachStackTrace (") {
+		t.Errorf("unexpected stack trace in JSON message. [%v]", rec.entries[1].msg)
+	}
+
+	if rec.entries[2].msg != "This is a warning message sample" {
+		t.Errorf("stack trace attached to a warning message. [%v]", rec.entries[2].msg)
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:         logger.LogLevelInfo,
+		RedactKeys:    []string{"password", "Token"},
+		RedactPattern: regexp.MustCompile(`\b\d{4}-\d{4}-\d{4}-\d{4}\b`),
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	lg.Info(map[string]interface{}{
+		"user":     "john",
+		"PASSWORD": "secret",
+		"session": map[string]interface{}{
+			"token": []string{"a", "b"},
+			"card":  "card 1234-5678-9012-3456 used",
+		},
+	})
+	lg.Info("paid with 1234-5678-9012-3456")
+
+	if len(rec.entries) != 2 {
+		t.Fatalf("unexpected number of messages. [%v]", len(rec.entries))
+	}
+	expected := `"PASSWORD":"***","session":{"card":"card *** used","token":"***"},"user":"john"}`
+	if !strings.HasSuffix(rec.entries[0].msg, expected) {
+		t.Errorf("JSON message was not redacted. [%v]", rec.entries[0].msg)
+	}
+	if rec.entries[1].msg != "paid with ***" {
+		t.Errorf("text message was not redacted. [%v]", rec.entries[1].msg)
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:         logger.LogLevelInfo,
+		SchemaVersion: "2.1",
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	lg.Info(JsonMessage{
+		Message: "This is an information message sample",
+	})
+	lg.Info("This is an information message sample")
+
+	if len(rec.entries) != 2 {
+		t.Fatalf("unexpected number of messages. [%v]", len(rec.entries))
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(rec.entries[0].msg), &obj); err != nil {
+		t.Fatalf("unable to parse message. [%v]", err)
+	}
+	if obj["schema_version"] != "2.1" {
+		t.Errorf("schema version not found. [%v]", rec.entries[0].msg)
+	}
+	if rec.entries[1].msg != "This is an information message sample" {
+		t.Errorf("text message was modified. [%v]", rec.entries[1].msg)
+	}
+}
+
+func TestFields(t *testing.T) {
+	wrapStrings := false
+
+	for _, wrap := range []*bool{nil, &wrapStrings} {
+		lg := logger.Create(logger.Options{
+			Level: logger.LogLevelInfo,
+			Fields: map[string]interface{}{
+				"service": "api",
+				"env":     "prod",
+				"invalid": func() {},
+			},
+			WrapStrings: wrap,
+		})
+
+		rec := &recorderEngine{}
+		_ = lg.AddEngine(rec)
+
+		lg.Info(JsonMessage{
+			Message: "This is an information message sample",
+		})
+		lg.Info("This is an information message sample")
+		lg.Destroy()
+
+		if len(rec.entries) != 2 {
+			t.Fatalf("unexpected number of messages. [%v]", len(rec.entries))
+		}
+
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(rec.entries[0].msg), &obj); err != nil {
+			t.Fatalf("unable to parse message. [%v]", err)
+		}
+		if obj["service"] != "api" || obj["env"] != "prod" || obj["message"] != "This is an information message sample" {
+			t.Errorf("static fields not found. [%v]", rec.entries[0].msg)
+		}
+		if _, ok := obj["invalid"]; ok {
+			t.Errorf("invalid field was added. [%v]", rec.entries[0].msg)
+		}
+
+		if wrap == nil {
+			obj = nil
+			if err := json.Unmarshal([]byte(rec.entries[1].msg), &obj); err != nil || !rec.entries[1].raw {
+				t.Fatalf("text message was not wrapped. [%v]", rec.entries[1].msg)
+			}
+			if obj["service"] != "api" || obj["message"] != "This is an information message sample" ||
+				obj["level"] != "info" {
+				t.Errorf("unexpected wrapped message. [%v]", rec.entries[1].msg)
+			}
+		} else if rec.entries[1].msg != "This is an information message sample" {
+			t.Errorf("text message was modified. [%v]", rec.entries[1].msg)
+		}
+	}
+}
+
+func TestScalarValues(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	status := testStatus(2)
+	code := testCode(404)
+	lg.Info(42)
+	lg.Info(3.5)
+	lg.Info(true)
+	lg.Info(testCode(500))
+	lg.Info(status)
+	lg.Info(&code)
+	lg.Info(&status)
+
+	expected := []string{"42", "3.5", "true", "500", "running", "404", "running"}
+	if len(rec.entries) != len(expected) {
+		t.Fatalf("unexpected number of messages. [%v]", len(rec.entries))
+	}
+	for idx, entry := range rec.entries {
+		if entry.raw || entry.msg != expected[idx] {
+			t.Errorf("unexpected scalar output. [%v != %v]", entry.msg, expected[idx])
+		}
+	}
+}
+
+func TestSampling(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+		Sampling: &logger.Sampling{
+			Tick:       time.Hour,
+			First:      3,
+			Thereafter: 5,
+		},
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	// 3 first messages plus the 8th, 13th and 18th
+	for i := 0; i < 20; i++ {
+		lg.Error("This is an error message sample")
+	}
+	// Levels are counted separately
+	lg.Info("This is an information message sample")
+
+	if len(rec.entries) != 7 {
+		t.Errorf("unexpected number of messages. [%v]", len(rec.entries))
+	}
+	if stats := lg.Stats(); stats.SampledOut != 14 {
+		t.Errorf("unexpected number of sampled out messages. [%v]", stats.SampledOut)
+	}
+}
+
+func TestSamplingByMessage(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+		Sampling: &logger.Sampling{
+			Tick:      200 * time.Millisecond,
+			First:     1,
+			ByMessage: true,
+		},
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	for i := 0; i < 10; i++ {
+		lg.Info("message A")
+		lg.Info("message B")
+	}
+	if len(rec.entries) != 2 {
+		t.Errorf("unexpected number of messages. [%v]", len(rec.entries))
+	}
+
+	// Counters are reset on each tick
+	time.Sleep(250 * time.Millisecond)
+	lg.Info("message A")
+	if len(rec.entries) != 3 {
+		t.Errorf("counter was not reset after the tick. [%v]", len(rec.entries))
+	}
+}
+
+func TestReentrancy(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+	_ = lg.AddEngine(&reentrantEngine{
+		lg: lg,
+	})
+
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+
+		lg.Info("This is an information message sample")
+	}()
+
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("nested log call deadlocked")
+	}
+
+	if len(rec.entries) != 1 || rec.entries[0].msg != "This is an information message sample" {
+		t.Errorf("unexpected messages. [%v]", rec.entries)
+	}
+}
+
+func TestAsyncOverflow(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:           logger.LogLevelInfo,
+		Async:           true,
+		AsyncBufferSize: 2,
+	})
+	defer lg.Destroy()
+
+	blocking := &blockingEngine{
+		enteredCh: make(chan struct{}, 1),
+		releaseCh: make(chan struct{}),
+	}
+	_ = lg.AddEngine(blocking)
+
+	// The worker takes the first message and gets stuck
+	lg.Info("message 1")
+	select {
+	case <-blocking.enteredCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("message was not delivered")
+	}
+
+	// Two messages fill the buffer and the rest are dropped
+	for i := 2; i <= 5; i++ {
+		lg.Info("message " + strconv.Itoa(i))
+	}
+
+	stats := lg.Stats()
+	if stats.AsyncBufferSize != 2 || stats.AsyncBuffered != 2 || stats.AsyncHighWaterMark != 2 {
+		t.Errorf("unexpected buffer stats. [%+v]", stats)
+	}
+	if stats.AsyncDropped != 2 {
+		t.Errorf("unexpected number of dropped messages. [%v]", stats.AsyncDropped)
+	}
+
+	close(blocking.releaseCh)
+	lg.Flush()
+
+	if stats = lg.Stats(); stats.AsyncBuffered != 0 {
+		t.Errorf("buffer was not drained. [%v]", stats.AsyncBuffered)
+	}
+	blocking.mtx.Lock()
+	defer blocking.mtx.Unlock()
+	if len(blocking.entries) != 3 {
+		t.Errorf("unexpected number of messages. [%v]", len(blocking.entries))
+	}
+}
+
+func TestAsyncOverflowDropOldest(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:               logger.LogLevelInfo,
+		Async:               true,
+		AsyncBufferSize:     2,
+		AsyncOverflowPolicy: logger.OverflowDropOldest,
+	})
+	defer lg.Destroy()
+
+	blocking := &blockingEngine{
+		enteredCh: make(chan struct{}, 1),
+		releaseCh: make(chan struct{}),
+	}
+	_ = lg.AddEngine(blocking)
+
+	// The worker takes the first message and gets stuck
+	lg.Info("message 1")
+	select {
+	case <-blocking.enteredCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("message was not delivered")
+	}
+
+	// The newest messages replace the oldest queued ones
+	for i := 2; i <= 5; i++ {
+		lg.Info("message " + strconv.Itoa(i))
+	}
+	if dropped := lg.Stats().AsyncDropped; dropped != 2 {
+		t.Errorf("unexpected number of dropped messages. [%v]", dropped)
+	}
+
+	close(blocking.releaseCh)
+	lg.Flush()
+
+	blocking.mtx.Lock()
+	defer blocking.mtx.Unlock()
+	msgs := make([]string, 0, len(blocking.entries))
+	for _, entry := range blocking.entries {
+		msgs = append(msgs, entry.msg)
+	}
+	if strings.Join(msgs, ",") != "message 1,message 4,message 5" {
+		t.Errorf("unexpected messages. [%v]", msgs)
+	}
+}
+
+func TestAsyncOverflowBlock(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:               logger.LogLevelInfo,
+		Async:               true,
+		AsyncBufferSize:     2,
+		AsyncOverflowPolicy: logger.OverflowBlock,
+	})
+	defer lg.Destroy()
+
+	blocking := &blockingEngine{
+		enteredCh: make(chan struct{}, 1),
+		releaseCh: make(chan struct{}),
+	}
+	_ = lg.AddEngine(blocking)
+
+	// The worker takes the first message and gets stuck
+	lg.Info("message 1")
+	select {
+	case <-blocking.enteredCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("message was not delivered")
+	}
+
+	// Once the buffer is full, the caller waits
+	doneCh := make(chan struct{})
+	go func() {
+		for i := 2; i <= 5; i++ {
+			lg.Info("message " + strconv.Itoa(i))
+		}
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+		t.Fatalf("caller was not blocked")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Modifying the engines while a caller waits must not deadlock
+	addedCh := make(chan struct{})
+	go func() {
+		_ = lg.AddEngine(&recorderEngine{})
+		close(addedCh)
+	}()
+
+	close(blocking.releaseCh)
+	for _, ch := range []chan struct{}{doneCh, addedCh} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("caller was not released")
+		}
+	}
+	lg.Flush()
+
+	if dropped := lg.Stats().AsyncDropped; dropped != 0 {
+		t.Errorf("unexpected number of dropped messages. [%v]", dropped)
+	}
+	blocking.mtx.Lock()
+	defer blocking.mtx.Unlock()
+	if len(blocking.entries) != 5 {
+		t.Errorf("unexpected number of messages. [%v]", len(blocking.entries))
+	}
+}
+
+func TestAsyncMaxRecordAge(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:        logger.LogLevelInfo,
+		Async:        true,
+		MaxRecordAge: 100 * time.Millisecond,
+	})
+	defer lg.Destroy()
+
+	blocking := &blockingEngine{
+		enteredCh: make(chan struct{}, 1),
+		releaseCh: make(chan struct{}),
+	}
+	_ = lg.AddEngine(blocking)
+
+	// Stall the worker with the first message
+	lg.Info("message 1")
+	select {
+	case <-blocking.enteredCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("message was not delivered")
+	}
+
+	lg.Info("message 2")
+	lg.Info("message 3")
+	time.Sleep(200 * time.Millisecond)
+
+	close(blocking.releaseCh)
+	lg.Info("message 4")
+	lg.Flush()
+
+	blocking.mtx.Lock()
+	defer blocking.mtx.Unlock()
+	if len(blocking.entries) != 2 || blocking.entries[1].msg != "message 4" {
+		t.Errorf("unexpected messages. [%v]", blocking.entries)
+	}
+	if stats := lg.Stats(); stats.AsyncDroppedStale != 2 {
+		t.Errorf("unexpected number of stale messages. [%v]", stats.AsyncDroppedStale)
+	}
+}
+
+func TestSetTimeMode(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	zone := time.FixedZone("UTC-3", -3*60*60)
+
+	lg.Info("message 1")
+	lg.SetTimeMode(true, zone)
+	lg.Info("message 2")
+	lg.SetTimeMode(true, nil)
+	lg.Info("message 3")
+	lg.SetTimeMode(false, zone)
+	lg.Info("message 4")
+
+	if len(rec.entries) != 4 {
+		t.Fatalf("unexpected number of messages. [%v]", len(rec.entries))
+	}
+	expected := []*time.Location{time.UTC, zone, time.Local, time.UTC}
+	for idx, entry := range rec.entries {
+		if entry.now.Location() != expected[idx] {
+			t.Errorf("unexpected timestamp location. [%v != %v]", entry.now.Location(), expected[idx])
+		}
+	}
+}
+
+func TestRemoveEngine(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	rec1 := &recorderEngine{}
+	rec2 := &recorderEngine{}
+	_ = lg.AddEngine(rec1)
+	_ = lg.AddEngine(rec2)
+
+	if list := lg.Engines(); len(list) != 2 || list[0] != rec1 || list[1] != rec2 {
+		t.Fatalf("unexpected engines. [%v]", list)
+	}
+
+	lg.Info("message 1")
+	if !lg.RemoveEngine(rec1) {
+		t.Fatalf("engine was not removed")
+	}
+	if lg.RemoveEngine(rec1) {
+		t.Errorf("engine was removed twice")
+	}
+	lg.Info("message 2")
+
+	if list := lg.Engines(); len(list) != 1 || list[0] != rec2 {
+		t.Errorf("unexpected engines. [%v]", list)
+	}
+	if len(rec1.entries) != 1 || len(rec2.entries) != 2 {
+		t.Errorf("unexpected number of messages. [%v / %v]", len(rec1.entries), len(rec2.entries))
+	}
+	if rec1.destroyCount != 1 {
+		t.Errorf("removed engine was not destroyed")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	dir := t.TempDir()
+
+	lg.AddConsoleEngine(console.Options{
+		Stdout: &bytes.Buffer{},
+		Stderr: &bytes.Buffer{},
+	})
+	err := lg.AddFileEngine(file.Options{
+		Prefix:    "Test",
+		Directory: dir,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	if err = lg.Validate(context.Background()); err != nil {
+		t.Fatalf("unexpected validation error. [%v]", err)
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, "*")); len(names) != 0 {
+		t.Errorf("unexpected files found. [%v]", names)
+	}
+
+	// Use a regular file as the target directory
+	badDir := filepath.Join(t.TempDir(), "logs")
+	err = os.WriteFile(badDir, []byte{}, 0644)
+	if err != nil {
+		t.Fatalf("unable to create file. [%v]", err)
+	}
+	err = lg.AddFileEngine(file.Options{
+		Prefix:    "Test",
+		Directory: badDir,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	// Get the address of a closed port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to get a free port. [%v]", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	err = lg.AddSysLogEngine(syslog.Options{
+		Host:        "127.0.0.1",
+		Port:        uint16(port),
+		UseTcp:      true,
+		DialTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+
+	err = lg.Validate(context.Background())
+	if err == nil {
+		t.Fatalf("misconfigured engines were not detected")
+	}
+	if !strings.Contains(err.Error(), "file engine:") || !strings.Contains(err.Error(), "syslog engine:") {
+		t.Errorf("unexpected validation error. [%v]", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	var lg io.Closer
+	var hookCalls int
+
+	// Use a regular file as the target directory so writes fail
+	badDir := filepath.Join(t.TempDir(), "logs")
+	err := os.WriteFile(badDir, []byte{}, 0644)
+	if err != nil {
+		t.Fatalf("unable to create file. [%v]", err)
+	}
+
+	l := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	lg = l
+
+	err = l.AddFileEngine(file.Options{
+		Prefix:    "Test",
+		Directory: badDir,
+	})
+	if err != nil {
+		t.Fatalf("unable to initialize. [%v]", err)
+	}
+	_ = l.AddHook(func(_ logger.LogLevel, _ string, _ bool, _ time.Time) {
+		hookCalls += 1
+	})
+
+	l.Error("This message cannot be written")
+
+	err = lg.Close()
+	if err == nil || !strings.Contains(err.Error(), "file engine") {
+		t.Errorf("write error not reported. [%v]", err)
+	}
+
+	// Closing again and destroying are no-ops
+	if err = lg.Close(); err != nil {
+		t.Errorf("unexpected error. [%v]", err)
+	}
+	l.Destroy()
+
+	// Messages are discarded and engines cannot be added
+	l.Error("This message is discarded")
+	if hookCalls != 1 {
+		t.Errorf("message processed after close")
+	}
+
+	rec := &recorderEngine{}
+	if err = l.AddEngine(rec); err != logger.ErrDestroyed {
+		t.Errorf("engine added after close. [%v]", err)
+	}
+}
+
+func TestDestroyWithTimeout(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+	stuck := &stuckDestroyEngine{
+		releaseCh: make(chan struct{}),
+	}
+	defer close(stuck.releaseCh)
+	_ = lg.AddEngine(stuck)
+
+	lg.Info("This is an information message sample")
+
+	startTime := time.Now()
+	lg.DestroyWithTimeout(200 * time.Millisecond)
+	elapsed := time.Since(startTime)
+	if elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("unexpected shutdown time. [%v]", elapsed)
+	}
+
+	// Engines are destroyed concurrently so the stuck one does not delay the rest
+	rec.mtx.Lock()
+	destroyCount := rec.destroyCount
+	rec.mtx.Unlock()
+	if destroyCount != 1 {
+		t.Errorf("engine was not destroyed")
+	}
+
+	// Messages are discarded after the shutdown even if it did not finish
+	lg.Info("This message is discarded")
+	if len(rec.entries) != 1 {
+		t.Errorf("unexpected messages. [%v]", rec.entries)
+	}
+}
+
+func TestDeduplication(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+		Deduplication: &logger.Deduplication{
+			Window: 200 * time.Millisecond,
+			Levels: []logger.LogLevel{logger.LogLevelError},
+		},
+	})
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	getMessages := func() []string {
+		rec.mtx.Lock()
+		defer rec.mtx.Unlock()
+
+		messages := make([]string, 0, len(rec.entries))
+		for _, entry := range rec.entries {
+			messages = append(messages, entry.level+":"+entry.msg)
+		}
+		return messages
+	}
+
+	// Repetitions are collapsed when the message changes
+	for i := 0; i < 5; i++ {
+		lg.Error("connection refused")
+	}
+	lg.Error("connection reset")
+
+	// Other levels are not deduplicated
+	lg.Warning("retrying")
+	lg.Warning("retrying")
+
+	// The summary is emitted when the window closes
+	lg.Error("connection reset")
+	time.Sleep(400 * time.Millisecond)
+
+	// Pending summaries are emitted on destroy
+	lg.Error(map[string]interface{}{
+		"code": 1,
+	})
+	lg.Error(map[string]interface{}{
+		"code": 1,
+	})
+	lg.Destroy()
+
+	messages := getMessages()
+	expected := []string{
+		"error:connection refused",
+		"error:connection refused (repeated 4 times in ",
+		"error:connection reset",
+		"warning:retrying",
+		"warning:retrying",
+		"error:connection reset (repeated 1 times in ",
+		`error:{"timestamp":`,
+		`error:{"timestamp":`,
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("unexpected messages. [%v]", messages)
+	}
+	for idx, msg := range messages {
+		if !strings.HasPrefix(msg, expected[idx]) {
+			t.Errorf("unexpected message. [%v]", msg)
+		}
+	}
+	if !strings.Contains(messages[7], `"repeated":1,"repeated_in":"`) || !strings.Contains(messages[7], `"code":1`) {
+		t.Errorf("unexpected summary. [%v]", messages[7])
+	}
+}
+
+func TestRawJSON(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	lg.Info(json.RawMessage(`{"a":1}`))
+	lg.Info([]byte("{\n  \"b\": [1, 2]\n}"))
+	lg.Info([]byte(`{"broken":`))
+	lg.Info(json.RawMessage(`[1,2]`))
+
+	expected := []struct {
+		raw    bool
+		suffix string
+	}{
+		{true, `"level":"info","a":1}`},
+		{true, `"level":"info","b":[1,2]}`},
+		{false, `{"broken":`},
+		{false, `[1,2]`},
+	}
+	if len(rec.entries) != len(expected) {
+		t.Fatalf("unexpected messages. [%v]", rec.entries)
+	}
+	for idx, entry := range rec.entries {
+		if entry.raw != expected[idx].raw || !strings.HasSuffix(entry.msg, expected[idx].suffix) {
+			t.Errorf("unexpected message. [%v]", entry.msg)
+		}
+	}
+}
+
+func TestMapsAndSlices(t *testing.T) {
+	type item struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	items := []item{{1, "a"}, {2, "b"}}
+	lg.Info(map[string]interface{}{
+		"count": 2,
+		"ok":    true,
+	})
+	lg.Info(items)
+	lg.Info(&items)
+	lg.Info([2]int{3, 4})
+
+	expected := []string{
+		`"level":"info","count":2,"ok":true}`,
+		`"level":"info","data":[{"id":1,"name":"a"},{"id":2,"name":"b"}]}`,
+		`"level":"info","data":[{"id":1,"name":"a"},{"id":2,"name":"b"}]}`,
+		`"level":"info","data":[3,4]}`,
+	}
+	if len(rec.entries) != len(expected) {
+		t.Fatalf("unexpected messages. [%v]", rec.entries)
+	}
+	for idx, entry := range rec.entries {
+		if !entry.raw || !strings.HasSuffix(entry.msg, expected[idx]) {
+			t.Errorf("unexpected message. [%v]", entry.msg)
+		}
+	}
+}
+
+func TestErrorValues(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	baseErr := errors.New("connection refused")
+	wrappedErr := fmt.Errorf("unable to connect: %w", baseErr)
+	lg.Error(baseErr)
+	lg.Error(fmt.Errorf("unable to load settings: %w", wrappedErr))
+	lg.Error(&os.PathError{Op: "open", Path: "/tmp/settings.json", Err: os.ErrNotExist})
+
+	expected := []string{
+		`"level":"error","error":"connection refused"}`,
+		`"level":"error","error":"unable to load settings: unable to connect: connection refused",` +
+			`"causes":["unable to connect: connection refused","connection refused"]}`,
+		`"level":"error","error":"open /tmp/settings.json: file does not exist","causes":["file does not exist"]}`,
+	}
+	if len(rec.entries) != len(expected) {
+		t.Fatalf("unexpected messages. [%v]", rec.entries)
+	}
+	for idx, entry := range rec.entries {
+		if !entry.raw || !strings.HasSuffix(entry.msg, expected[idx]) {
+			t.Errorf("unexpected message. [%v]", entry.msg)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	lg.SetFilter(func(level logger.LogLevel, msg string, isJSON bool) bool {
+		if isJSON {
+			return !strings.Contains(msg, `"path":"/health"`)
+		}
+		return level != logger.LogLevelInfo || !strings.HasPrefix(msg, "health check")
+	})
+
+	lg.Info("health check passed")
+	lg.Error("health check failed")
+	lg.Info(map[string]interface{}{
+		"path": "/health",
+	})
+	lg.Info(map[string]interface{}{
+		"path": "/users",
+	})
+
+	// Remove the filter
+	lg.SetFilter(nil)
+	lg.Info("health check passed")
+
+	if len(rec.entries) != 3 || rec.entries[0].msg != "health check failed" ||
+		!strings.Contains(rec.entries[1].msg, `"path":"/users"`) || rec.entries[2].msg != "health check passed" {
+		t.Errorf("unexpected messages. [%v]", rec.entries)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	var calls []string
+
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelWarning,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	h1 := lg.AddHook(func(level logger.LogLevel, msg string, isJSON bool, _ time.Time) {
+		calls = append(calls, "1:"+level.String()+":"+msg+":"+strconv.FormatBool(isJSON))
+	})
+	_ = lg.AddHook(func(_ logger.LogLevel, _ string, _ bool, _ time.Time) {
+		panic("hook failure")
+	})
+	_ = lg.AddHook(func(level logger.LogLevel, msg string, _ bool, _ time.Time) {
+		calls = append(calls, "3:"+level.String()+":"+msg)
+	})
+
+	lg.Error("first")
+	lg.Info("not emitted")
+	lg.Warning(map[string]interface{}{
+		"a": 1,
+	})
+
+	expected := []string{
+		"1:error:first:false",
+		"3:error:first",
+		`1:warning:{"a":1}:true`,
+		`3:warning:{"a":1}`,
+	}
+	if strings.Join(calls, "|") != strings.Join(expected, "|") {
+		t.Errorf("unexpected hook calls. [%v]", calls)
+	}
+	if len(rec.entries) != 2 {
+		t.Errorf("messages were not sent to the engines. [%v]", len(rec.entries))
+	}
+
+	// Removed hooks are not called anymore
+	if !lg.RemoveHook(h1) || lg.RemoveHook(h1) {
+		t.Fatalf("unexpected result when removing the hook")
+	}
+	calls = nil
+	lg.Error("second")
+	if len(calls) != 1 || calls[0] != "3:error:second" {
+		t.Errorf("unexpected hook calls. [%v]", calls)
+	}
+}
+
+func TestSuccessLevel(t *testing.T) {
+	successLevel := logger.LogLevelWarning
+
+	lg := logger.Create(logger.Options{
+		Level:        logger.LogLevelWarning,
+		SuccessLevel: &successLevel,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	lg.Success("emitted")
+	lg.Info("not emitted")
+
+	// Lowering the level suppresses success messages but not errors
+	lg.SetLogLevel(logger.LogLevelError, 0)
+	lg.Successf("not %v", "emitted")
+	lg.Error("emitted")
+
+	if len(rec.entries) != 2 || rec.entries[0].level != "success" || rec.entries[1].level != "error" {
+		t.Errorf("unexpected messages. [%v]", rec.entries)
+	}
+}
+
+func TestSuccessLevelSeenByHooks(t *testing.T) {
+	successLevel := logger.LogLevelWarning
+
+	lg := logger.Create(logger.Options{
+		Level:        logger.LogLevelInfo,
+		SuccessLevel: &successLevel,
+	})
+	defer lg.Destroy()
+
+	var hookLevels, filterLevels []logger.LogLevel
+	_ = lg.AddHook(func(level logger.LogLevel, _ string, _ bool, _ time.Time) {
+		hookLevels = append(hookLevels, level)
+	})
+	lg.SetFilter(func(level logger.LogLevel, _ string, _ bool) bool {
+		filterLevels = append(filterLevels, level)
+		return true
+	})
+
+	lg.Success("emitted")
+	if len(hookLevels) != 1 || hookLevels[0] != logger.LogLevelWarning {
+		t.Errorf("unexpected hook levels. [%v]", hookLevels)
+	}
+	if len(filterLevels) != 1 || filterLevels[0] != logger.LogLevelWarning {
+		t.Errorf("unexpected filter levels. [%v]", filterLevels)
+	}
+}
+
+func TestSuccessLevelQuiet(t *testing.T) {
+	successLevel := logger.LogLevelQuiet
+
+	lg := logger.Create(logger.Options{
+		Level:        logger.LogLevelDebug,
+		SuccessLevel: &successLevel,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	lg.Success("not emitted")
+	lg.Successf("not %v", "emitted")
+	lg.Successw("not emitted")
+	lg.Error("emitted")
+
+	if len(rec.entries) != 1 || rec.entries[0].level != "error" {
+		t.Errorf("unexpected messages. [%v]", rec.entries)
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	lg1 := logger.Discard()
+	defer lg1.Destroy()
+	lg2 := logger.Discard()
+	defer lg2.Destroy()
+
+	if lg1 == lg2 {
+		t.Fatalf("same instance returned twice")
+	}
+
+	// Messages pass the level gates although they are discarded
+	arg := &countingStringer{}
+	lg1.Debugf(1, "emitted %v", arg)
+	lg1.Infof("emitted %v", arg)
+	if arg.calls != 2 {
+		t.Errorf("messages were not processed")
+	}
+
+	// Changing the level of one instance does not affect the other
+	lg1.SetLogLevel(logger.LogLevelError, 0)
+	lg2.Infof("emitted %v", arg)
+	if arg.calls != 3 {
+		t.Errorf("messages were not processed")
+	}
+}
+
+func TestFormatMethods(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level:      logger.LogLevelWarning,
+		DebugLevel: 1,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	arg := &countingStringer{}
+	lg.Errorf("processed %d items", 5)
+	lg.Warningf("%v items left", 3)
+	lg.Infof("not emitted %v", arg)
+	lg.Debugf(1, "not emitted %v", arg)
+	lg.Successf("not emitted %v", arg)
+
+	if arg.calls != 0 {
+		t.Errorf("message was formatted although it was not emitted")
+	}
+	if len(rec.entries) != 2 || rec.entries[0].msg != "processed 5 items" || rec.entries[1].msg != "3 items left" {
+		t.Errorf("unexpected messages. [%v]", rec.entries)
+	}
+}
+
+func TestDumpGoroutines(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelDebug,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	lg.DumpGoroutines()
+
+	if len(rec.entries) != 1 || rec.entries[0].level != "debug" {
+		t.Fatalf("unexpected messages. [%v]", rec.entries)
+	}
+	if !strings.Contains(rec.entries[0].msg, "TestDumpGoroutines") {
+		t.Errorf("dump does not contain the current goroutine")
+	}
+}
+
+func TestDumpGoroutinesToWriter(t *testing.T) {
+	buf := bytes.Buffer{}
+
+	lg := logger.Create(logger.Options{
+		Level:                logger.LogLevelError,
+		GoroutineDumpMaxSize: 256,
+		GoroutineDumpWriter:  &buf,
+	})
+	defer lg.Destroy()
+
+	lg.DumpGoroutines()
+
+	if !strings.HasPrefix(buf.String(), "goroutine dump:") || !strings.HasSuffix(buf.String(), "... truncated ...\n") {
+		t.Errorf("unexpected dump. [%v]", buf.String())
+	}
+	if buf.Len() > 512 {
+		t.Errorf("dump was not truncated. [%v]", buf.Len())
+	}
+}
+
 //------------------------------------------------------------------------------
 // Private methods
 
+type countingStringer struct {
+	calls int
+}
+
+func (s *countingStringer) String() string {
+	s.calls += 1
+	return "counted"
+}
+
+type testCode int
+
+type testStatus int
+
+func (s testStatus) String() string {
+	switch s {
+	case 1:
+		return "stopped"
+	case 2:
+		return "running"
+	}
+	return "unknown"
+}
+
 type JsonMessage struct {
 	Message string `json:"message"`
 }
@@ -55,3 +1536,322 @@ func printTestMessages(l *logger.Logger) {
 		Message: "This is a debug message sample at level 2 which should NOT be printed",
 	})
 }
+
+// reentrantEngine logs again while processing a message.
+type reentrantEngine struct {
+	recorderEngine
+	lg *logger.Logger
+}
+
+func (e *reentrantEngine) Info(_ time.Time, msg string, _ bool) {
+	// Simulate a pending writer, which makes a recursive read lock block forever
+	go e.lg.SetLogLevel(logger.LogLevelInfo, 0)
+	time.Sleep(100 * time.Millisecond)
+
+	e.lg.Error("nested: " + msg)
+}
+
+// blockingEngine blocks while processing messages until released.
+type blockingEngine struct {
+	recorderEngine
+	enteredCh chan struct{}
+	releaseCh chan struct{}
+}
+
+func (e *blockingEngine) Info(now time.Time, msg string, raw bool) {
+	select {
+	case e.enteredCh <- struct{}{}:
+	default:
+	}
+	<-e.releaseCh
+
+	e.recorderEngine.Info(now, msg, raw)
+}
+
+// stuckDestroyEngine blocks on destroy until released.
+type stuckDestroyEngine struct {
+	recorderEngine
+	releaseCh chan struct{}
+}
+
+func (e *stuckDestroyEngine) Destroy() {
+	<-e.releaseCh
+}
+
+type recorderEntry struct {
+	level string
+	msg   string
+	raw   bool
+	now   time.Time
+}
+
+type recorderEngine struct {
+	mtx          sync.Mutex
+	entries      []recorderEntry
+	flushCount   int
+	destroyCount int
+}
+
+func (e *recorderEngine) Destroy() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.destroyCount += 1
+}
+
+func (e *recorderEngine) Flush() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.flushCount += 1
+}
+
+func (e *recorderEngine) Success(now time.Time, msg string, raw bool, _ bool) {
+	e.add("success", now, msg, raw)
+}
+
+func (e *recorderEngine) Error(now time.Time, msg string, raw bool) {
+	e.add("error", now, msg, raw)
+}
+
+func (e *recorderEngine) Warning(now time.Time, msg string, raw bool) {
+	e.add("warning", now, msg, raw)
+}
+
+func (e *recorderEngine) Info(now time.Time, msg string, raw bool) {
+	e.add("info", now, msg, raw)
+}
+
+func (e *recorderEngine) Debug(now time.Time, msg string, raw bool) {
+	e.add("debug", now, msg, raw)
+}
+
+func (e *recorderEngine) add(level string, now time.Time, msg string, raw bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.entries = append(e.entries, recorderEntry{
+		level: level,
+		msg:   msg,
+		raw:   raw,
+		now:   now,
+	})
+}
+
+func TestNoEngineWarning(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unable to create pipe. [%v]", err)
+	}
+	oldStderr := os.Stderr
+	os.Stderr = w
+	defer func() {
+		os.Stderr = oldStderr
+	}()
+
+	for _, disable := range []bool{false, true} {
+		lg := logger.Create(logger.Options{
+			Level:                  logger.LogLevelInfo,
+			DisableNoEngineWarning: disable,
+		})
+		if lg.HasEngines() {
+			t.Errorf("unexpected engines")
+		}
+		lg.Info("This is an information message sample")
+		lg.Error("This is an error message sample")
+		lg.Destroy()
+	}
+
+	os.Stderr = oldStderr
+	_ = w.Close()
+	output, _ := io.ReadAll(r)
+	if n := strings.Count(string(output), "no engine is added"); n != 1 {
+		t.Errorf("unexpected amount of warnings. [%v / %q]", n, string(output))
+	}
+
+	lg := logger.Create(logger.Options{})
+	defer lg.Destroy()
+
+	_ = lg.AddEngine(&recorderEngine{})
+	if !lg.HasEngines() {
+		t.Errorf("engine not found")
+	}
+}
+
+type loggableUser struct {
+	ID       int    `json:"id"`
+	Password string `json:"password"`
+}
+
+func (u loggableUser) LogValue() interface{} {
+	return "user " + strconv.Itoa(u.ID)
+}
+
+type loggableSession struct {
+	ID    string
+	Token string
+}
+
+func (s *loggableSession) LogValue() interface{} {
+	return struct {
+		Session string `json:"session"`
+	}{
+		Session: s.ID,
+	}
+}
+
+func TestLoggable(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	// Value and pointer receivers must be detected on both values and pointers
+	lg.Info(loggableUser{ID: 1, Password: "secret"})
+	lg.Info(&loggableUser{ID: 2, Password: "secret"})
+	lg.Info(loggableSession{ID: "s3", Token: "secret"})
+	lg.Info(&loggableSession{ID: "s4", Token: "secret"})
+	lg.Info((*loggableSession)(nil)) // Ignored like other nil pointers
+
+	if len(rec.entries) != 4 {
+		t.Fatalf("unexpected messages. [%v]", rec.entries)
+	}
+	for idx, expected := range []string{"user 1", "user 2", `"session":"s3"`, `"session":"s4"`} {
+		entry := rec.entries[idx]
+		if idx < 2 {
+			if entry.raw || entry.msg != expected {
+				t.Errorf("unexpected message. [%+v]", entry)
+			}
+		} else if !entry.raw || !strings.Contains(entry.msg, expected) {
+			t.Errorf("unexpected message. [%+v]", entry)
+		}
+		if strings.Contains(entry.msg, "secret") {
+			t.Errorf("hidden field logged. [%+v]", entry)
+		}
+	}
+}
+
+func TestKeyValueLogging(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	lg.Infow("user logged in", "user", "john", "attempts", 2, "err", errors.New("expired token"))
+	lg.Warningw("odd arguments", "key", "value", "orphan")
+	lg.Errorw("non string key", 10, true)
+	lg.Debugw(1, "filtered", "key", "value")
+
+	if len(rec.entries) != 3 {
+		t.Fatalf("unexpected messages. [%v]", rec.entries)
+	}
+	expected := []map[string]interface{}{
+		{"message": "user logged in", "user": "john", "attempts": float64(2), "err": "expired token"},
+		{"message": "odd arguments", "key": "value", "!BADKEY": "orphan"},
+		{"message": "non string key", "10": true},
+	}
+	for idx, entry := range rec.entries {
+		if !entry.raw {
+			t.Fatalf("message not sent as raw JSON. [%+v]", entry)
+		}
+		fields := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(entry.msg), &fields); err != nil {
+			t.Fatalf("unable to decode message. [%v]", err)
+		}
+		delete(fields, "level")
+		delete(fields, "timestamp")
+		if !reflect.DeepEqual(fields, expected[idx]) {
+			t.Errorf("unexpected fields. [%v]", fields)
+		}
+	}
+}
+
+func TestEntry(t *testing.T) {
+	lg := logger.Create(logger.Options{
+		Level: logger.LogLevelInfo,
+	})
+	defer lg.Destroy()
+
+	rec := &recorderEngine{}
+	_ = lg.AddEngine(rec)
+
+	lg.Entry().Str("user", "john").Int("count", 3).Bool("admin", false).Float("ratio", 0.5).
+		Err(errors.New("access denied")).Any("tags", []string{"a", "b"}).Error("request failed")
+	lg.Entry().Err(nil).Str("key", "first").Str("key", "last").Info("repeated key")
+	lg.Entry().Str("key", "value").Debug(1, "filtered")
+
+	if len(rec.entries) != 2 {
+		t.Fatalf("unexpected messages. [%v]", rec.entries)
+	}
+	expected := []map[string]interface{}{
+		{
+			"message": "request failed", "user": "john", "count": float64(3), "admin": false, "ratio": 0.5,
+			"error": "access denied", "tags": []interface{}{"a", "b"},
+		},
+		{"message": "repeated key", "key": "last"},
+	}
+	for idx, entry := range rec.entries {
+		fields := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(entry.msg), &fields); err != nil {
+			t.Fatalf("unable to decode message. [%v]", err)
+		}
+		delete(fields, "level")
+		delete(fields, "timestamp")
+		if !entry.raw || !reflect.DeepEqual(fields, expected[idx]) {
+			t.Errorf("unexpected fields. [%v]", fields)
+		}
+	}
+	if rec.entries[0].level != "error" || rec.entries[1].level != "info" {
+		t.Errorf("unexpected levels. [%v]", rec.entries)
+	}
+}
+
+func TestSanitizeControlChars(t *testing.T) {
+	for _, action := range []logger.ControlCharsAction{logger.ControlCharsEscape, logger.ControlCharsStrip} {
+		lg := logger.Create(logger.Options{
+			Level:                logger.LogLevelInfo,
+			SanitizeControlChars: true,
+			ControlCharsAction:   action,
+		})
+
+		rec := &recorderEngine{}
+		_ = lg.AddEngine(rec)
+
+		lg.Info("user john\r\n2024-05-01 10:00:00.000 [ERROR]: fake line")
+		lg.Info("\x1b[31mred\x1b[0m\tand \u009b C1 control")
+		lg.Info(map[string]string{
+			"message": "line 1\nline 2",
+		})
+		lg.Destroy()
+
+		expected := []string{
+			`user john\r\n2024-05-01 10:00:00.000 [ERROR]: fake line`,
+			`\x1b[31mred\x1b[0m` + "\t" + `and \u009b C1 control`,
+		}
+		if action == logger.ControlCharsStrip {
+			expected = []string{
+				"user john2024-05-01 10:00:00.000 [ERROR]: fake line",
+				"[31mred[0m\tand  C1 control",
+			}
+		}
+		if len(rec.entries) != 3 {
+			t.Fatalf("unexpected messages. [%v]", rec.entries)
+		}
+		for idx, msg := range expected {
+			if rec.entries[idx].msg != msg {
+				t.Errorf("unexpected message. [%q]", rec.entries[idx].msg)
+			}
+		}
+
+		// JSON messages are already escaped by the encoding
+		if !strings.Contains(rec.entries[2].msg, `"message":"line 1\nline 2"`) {
+			t.Errorf("unexpected JSON message. [%v]", rec.entries[2].msg)
+		}
+	}
+}
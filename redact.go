@@ -0,0 +1,144 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	redactedValue = "***"
+)
+
+//------------------------------------------------------------------------------
+
+type redactor struct {
+	keys    map[string]struct{}
+	pattern *regexp.Regexp
+}
+
+//------------------------------------------------------------------------------
+
+func newRedactor(keys []string, pattern *regexp.Regexp) *redactor {
+	if len(keys) == 0 && pattern == nil {
+		return nil
+	}
+
+	r := &redactor{
+		keys:    make(map[string]struct{}, len(keys)),
+		pattern: pattern,
+	}
+	for _, k := range keys {
+		r.keys[strings.ToLower(k)] = struct{}{}
+	}
+	return r
+}
+
+// redactText masks the parts of a text message that match the pattern.
+func (r *redactor) redactText(msg string) string {
+	if r.pattern == nil {
+		return msg
+	}
+	return r.pattern.ReplaceAllString(msg, redactedValue)
+}
+
+// redactJSON replaces the values of the matching keys, at any depth, and masks the parts of string values
+// that match the pattern. The order of the fields is preserved.
+func (r *redactor) redactJSON(msg string) string {
+	dec := json.NewDecoder(strings.NewReader(msg))
+	dec.UseNumber()
+
+	buf := bytes.Buffer{}
+	if r.writeValue(dec, &buf) != nil {
+		return msg // Should not happen because the message was generated by the JSON encoder
+	}
+	return buf.String()
+}
+
+func (r *redactor) writeValue(dec *json.Decoder, buf *bytes.Buffer) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch v := tok.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			_ = buf.WriteByte('{')
+			for idx := 0; dec.More(); idx++ {
+				tok, err = dec.Token()
+				if err != nil {
+					return err
+				}
+				key, ok := tok.(string)
+				if !ok {
+					return errors.New("invalid object key")
+				}
+
+				if idx > 0 {
+					_ = buf.WriteByte(',')
+				}
+				writeJSONString(buf, key)
+				_ = buf.WriteByte(':')
+
+				if _, found := r.keys[strings.ToLower(key)]; found {
+					var discard json.RawMessage
+					err = dec.Decode(&discard)
+					writeJSONString(buf, redactedValue)
+				} else {
+					err = r.writeValue(dec, buf)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			_ = buf.WriteByte('}')
+
+		case '[':
+			_ = buf.WriteByte('[')
+			for idx := 0; dec.More(); idx++ {
+				if idx > 0 {
+					_ = buf.WriteByte(',')
+				}
+				err = r.writeValue(dec, buf)
+				if err != nil {
+					return err
+				}
+			}
+			_ = buf.WriteByte(']')
+		}
+
+		// Consume the closing delimiter
+		_, err = dec.Token()
+		return err
+
+	case string:
+		writeJSONString(buf, r.redactText(v))
+
+	case json.Number:
+		_, _ = buf.WriteString(v.String())
+
+	case bool:
+		if v {
+			_, _ = buf.WriteString("true")
+		} else {
+			_, _ = buf.WriteString("false")
+		}
+
+	case nil:
+		_, _ = buf.WriteString("null")
+	}
+
+	// Done
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	_, _ = buf.Write(b)
+}
@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	samplerBucketsCount = 4096
+)
+
+//------------------------------------------------------------------------------
+
+// Sampling specifies how to limit repeated messages. Within each tick, the first messages of a given level
+// are emitted and then only one of every Thereafter messages.
+type Sampling struct {
+	// Duration of the sampling interval. Zero disables sampling.
+	Tick time.Duration `json:"tick,omitempty"`
+
+	// Amount of messages to emit on each tick before sampling starts.
+	First uint64 `json:"first,omitempty"`
+
+	// After the first messages, emit only one of every Thereafter messages. Zero drops them all.
+	Thereafter uint64 `json:"thereafter,omitempty"`
+
+	// Count messages with different text separately instead of only by level.
+	ByMessage bool `json:"byMessage,omitempty"`
+}
+
+type sampler struct {
+	tick       int64
+	first      uint64
+	thereafter uint64
+	byMessage  bool
+	counters   [5][]samplerCounter
+	dropped    atomic.Uint64
+}
+
+type samplerCounter struct {
+	resetAt atomic.Int64
+	count   atomic.Uint64
+}
+
+//------------------------------------------------------------------------------
+
+func newSampler(opts *Sampling) *sampler {
+	if opts == nil || opts.Tick <= 0 {
+		return nil
+	}
+
+	s := &sampler{
+		tick:       int64(opts.Tick),
+		first:      opts.First,
+		thereafter: opts.Thereafter,
+		byMessage:  opts.ByMessage,
+	}
+	bucketsCount := 1
+	if opts.ByMessage {
+		bucketsCount = samplerBucketsCount
+	}
+	for idx := range s.counters {
+		s.counters[idx] = make([]samplerCounter, bucketsCount)
+	}
+	return s
+}
+
+// check returns true if the message must be emitted.
+func (s *sampler) check(_type logType, msg string) bool {
+	bucket := 0
+	if s.byMessage {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(msg))
+		bucket = int(h.Sum32() % samplerBucketsCount)
+	}
+
+	n := s.counters[_type][bucket].inc(time.Now().UnixNano(), s.tick)
+	if n <= s.first || (s.thereafter > 0 && (n-s.first)%s.thereafter == 0) {
+		return true
+	}
+
+	s.dropped.Add(1)
+	return false
+}
+
+// inc increments the counter and returns the new value. The counter is reset when the tick elapses.
+func (c *samplerCounter) inc(now int64, tick int64) uint64 {
+	resetAt := c.resetAt.Load()
+	if resetAt > now {
+		return c.count.Add(1)
+	}
+
+	// Only the goroutine that starts the new tick resets the counter, the others just count the message
+	if !c.resetAt.CompareAndSwap(resetAt, now+tick) {
+		return c.count.Add(1)
+	}
+	c.count.Store(1)
+	return 1
+}
@@ -0,0 +1,185 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+)
+
+//------------------------------------------------------------------------------
+
+const (
+	// badKey is the field where a trailing value without a key is stored.
+	badKey = "!BADKEY"
+)
+
+//------------------------------------------------------------------------------
+
+// Successw emits a success message as a JSON object with the message in the message field and the fields
+// given as alternating keys and values, like lg.Successw("backup done", "files", 120).
+func (lg *Logger) Successw(msg string, keysAndValues ...interface{}) {
+	if !lg.mayEmit(lg.successLevel, 0) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(buildKeyValueMessage(msg, keysAndValues), "SUCCESS")
+		return
+	}
+	defer lg.leaveLog(gid)
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	if !lg.successEnabled() {
+		return
+	}
+
+	lg.log(buildKeyValueMessage(msg, keysAndValues), "success", logTypeSuccess)
+}
+
+// Errorw emits an error message as a JSON object with the message and the given keys and values.
+func (lg *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	if !lg.mayEmit(LogLevelError, 0) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(buildKeyValueMessage(msg, keysAndValues), "ERROR")
+		return
+	}
+	defer lg.leaveLog(gid)
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	if lg.logLevel < LogLevelError {
+		return
+	}
+
+	lg.log(buildKeyValueMessage(msg, keysAndValues), "error", logTypeError)
+}
+
+// Warningw emits a warning message as a JSON object with the message and the given keys and values.
+func (lg *Logger) Warningw(msg string, keysAndValues ...interface{}) {
+	if !lg.mayEmit(LogLevelWarning, 0) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(buildKeyValueMessage(msg, keysAndValues), "WARNING")
+		return
+	}
+	defer lg.leaveLog(gid)
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	if lg.logLevel < LogLevelWarning {
+		return
+	}
+
+	lg.log(buildKeyValueMessage(msg, keysAndValues), "warning", logTypeWarning)
+}
+
+// Infow emits an information message as a JSON object with the message and the given keys and values.
+func (lg *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	if !lg.mayEmit(LogLevelInfo, 0) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(buildKeyValueMessage(msg, keysAndValues), "INFO")
+		return
+	}
+	defer lg.leaveLog(gid)
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	if lg.logLevel < LogLevelInfo {
+		return
+	}
+
+	lg.log(buildKeyValueMessage(msg, keysAndValues), "info", logTypeInfo)
+}
+
+// Debugw emits a debug message as a JSON object with the message and the given keys and values.
+func (lg *Logger) Debugw(level uint, msg string, keysAndValues ...interface{}) {
+	if !lg.mayEmit(LogLevelDebug, level) {
+		return
+	}
+
+	// Avoid deadlocks and infinite recursion if called while another message is being processed
+	gid, ok := lg.enterLog()
+	if !ok {
+		logNested(buildKeyValueMessage(msg, keysAndValues), "DEBUG")
+		return
+	}
+	defer lg.leaveLog(gid)
+
+	// Lock access
+	lg.mtx.RLock()
+	defer lg.mtx.RUnlock()
+
+	if lg.logLevel < LogLevelDebug || lg.debugLogLevel < level {
+		return
+	}
+	if lg.debugSampleRate > 0 && lg.debugSampleRate < 1 && rand.Float64() >= lg.debugSampleRate {
+		return
+	}
+
+	lg.log(buildKeyValueMessage(msg, keysAndValues), "debug", logTypeDebug)
+}
+
+// buildKeyValueMessage encodes the message and the alternating keys and values as a JSON object. Keys that
+// are not strings are converted to text and a trailing value without a key is stored in the !BADKEY field.
+func buildKeyValueMessage(msg string, keysAndValues []interface{}) json.RawMessage {
+	fields := make(map[string]interface{}, 1+(len(keysAndValues)+1)/2)
+	fields["message"] = msg
+
+	for idx := 0; idx < len(keysAndValues); idx += 2 {
+		if idx+1 == len(keysAndValues) {
+			fields[badKey] = keyValueField(keysAndValues[idx])
+			break
+		}
+
+		key, ok := keysAndValues[idx].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[idx])
+		}
+		fields[key] = keyValueField(keysAndValues[idx+1])
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		// Some value cannot be encoded, so send all of them as text
+		for key, value := range fields {
+			if _, ok := value.(string); !ok {
+				fields[key] = fmt.Sprint(value)
+			}
+		}
+		b, _ = json.Marshal(fields)
+	}
+	return b
+}
+
+// keyValueField returns the value to encode, using the message of errors.
+func keyValueField(value interface{}) interface{} {
+	if err, ok := value.(error); ok && err != nil {
+		return err.Error()
+	}
+	return value
+}